@@ -16,12 +16,36 @@ limitations under the License.
 
 package v1
 
+import (
+	"strconv"
+)
+
+// Keys of the StorageClassDeviceSet config map which Rook understands
+const (
+	osdsPerDeviceKey   = "osdsPerDevice"
+	encryptedDeviceKey = "encryptedDevice"
+	metadataDeviceKey  = "metadataDevice"
+)
+
 // ToMap converts a StorageDeviceSetConfig object to a map[string]string that
-// can be set in a Rook StorageClassDeviceSet object
-// This functions just returns `nil` right now as the StorageDeviceSetConfig
-// struct itself is empty. It will be updated to perform actual conversion and
-// return a proper map when the StorageDeviceSetConfig struct is updated.
-// TODO: Do actual conversion to map when StorageDeviceSetConfig has defined members
+// can be set in a Rook StorageClassDeviceSet object. Only the options that are
+// set are part of the map. Rook ignores the Ceph options in this map, so the
+// BlueStore cache sizes and the OSD memory target are left out of it. It
+// returns nil if no option is set.
 func (c *StorageDeviceSetConfig) ToMap() map[string]string {
-	return nil
+	config := map[string]string{}
+	if c.OSDsPerDevice > 0 {
+		config[osdsPerDeviceKey] = strconv.Itoa(c.OSDsPerDevice)
+	}
+	if c.EncryptedDevice != nil {
+		config[encryptedDeviceKey] = strconv.FormatBool(*c.EncryptedDevice)
+	}
+	if c.MetadataDevice != "" {
+		config[metadataDeviceKey] = c.MetadataDevice
+	}
+
+	if len(config) == 0 {
+		return nil
+	}
+	return config
 }
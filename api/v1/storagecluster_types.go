@@ -21,6 +21,7 @@ import (
 	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
 	rook "github.com/rook/rook/pkg/apis/rook.io/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -57,16 +58,94 @@ type StorageClusterSpec struct {
 	// distributed evenly across all nodes, regardless of distribution in zones
 	// or racks.
 	FlexibleScaling bool `json:"flexibleScaling,omitempty"`
+	// FailureDomain is the CRUSH level across which Ceph spreads the replicas
+	// of the data: host, zone, or any level of the topology.rook.io node
+	// labels which Rook adds to the CRUSH map, such as rack, row, room or
+	// datacenter, given as the level or as the label key. It is determined
+	// from the topology of the storage nodes when it is not set, and can't be
+	// changed once the StorageCluster has a failure domain.
+	// +optional
+	FailureDomain string `json:"failureDomain,omitempty"`
+	// CrushHierarchy declares the levels of the topology.rook.io node labels
+	// of the CRUSH map, from the widest to the narrowest, such as datacenter,
+	// room, row and rack. Every storage node must have a label for each level,
+	// and each value of a level must belong to a single value of the level
+	// above. When the failureDomain is not set, it defaults to the widest
+	// level with enough values for the replicas of the data.
+	// +optional
+	CrushHierarchy []string `json:"crushHierarchy,omitempty"`
 	// NodeTopologies specifies the nodes available for the storage cluster,
 	// preferred failure domain and location for the arbiter resources. This is
-	// optional for non-arbiter clusters. For arbiter clusters, the
-	// arbiterLocation is required; failure domain and the node labels are
-	// optional. When the failure domain and the node labels are missing, the
-	// ocs-operator makes a best effort to determine them automatically.
+	// optional. For arbiter clusters, the ocs-operator elects the
+	// arbiterLocation when it is missing. When the failure domain and the node
+	// labels are missing, the ocs-operator makes a best effort to determine
+	// them automatically.
 	NodeTopologies *NodeTopologyMap `json:"nodeTopologies,omitempty"`
 	// ArbiterSpec specifies the storage cluster options related to arbiter.
-	// If Arbiter is enabled, ArbiterLocation in the NodeTopologies must be specified.
+	// If Arbiter is enabled and no ArbiterLocation is specified in the
+	// NodeTopologies, the ocs-operator elects the zone of the arbiter.
 	Arbiter ArbiterSpec `json:"arbiter,omitempty"`
+	// CephConfig holds Ceph configuration options which are merged over the
+	// defaults set by the ocs-operator in the rook-config-override ConfigMap.
+	// It is not used when the CephConfig reconcile strategy is ignore.
+	// +optional
+	CephConfig *CephConfigSpec `json:"cephConfig,omitempty"`
+	// Tenants isolate the volumes of teams sharing the cluster, each tenant
+	// getting a CephFS subvolume group or an RBD RADOS namespace, a Ceph user
+	// limited to it and its own StorageClass. Rook creates the subvolume
+	// groups and RADOS namespaces.
+	// +optional
+	Tenants []TenantSpec `json:"tenants,omitempty"`
+}
+
+// TenantType is the kind of isolation of a tenant
+type TenantType string
+
+const (
+	// TenantTypeCephFS isolates a tenant in a CephFS subvolume group
+	TenantTypeCephFS TenantType = "cephfs"
+	// TenantTypeRBD isolates a tenant in an RBD RADOS namespace
+	TenantTypeRBD TenantType = "rbd"
+)
+
+// TenantSpec defines a tenant of the StorageCluster
+type TenantSpec struct {
+	// Name is the name of the subvolume group or of the RADOS namespace, and
+	// is appended to the name of the StorageClass of the tenant
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=40
+	Name string `json:"name"`
+	// +kubebuilder:validation:Enum=cephfs;rbd
+	Type TenantType `json:"type"`
+	// Filesystem is the name of the additional CephFilesystem holding the
+	// subvolume group of a cephfs tenant. It defaults to the default
+	// CephFilesystem.
+	// +optional
+	Filesystem string `json:"filesystem,omitempty"`
+	// BlockPool is the name of the additional CephBlockPool holding the
+	// RADOS namespace of an rbd tenant. It defaults to the default
+	// CephBlockPool.
+	// +optional
+	BlockPool string `json:"blockPool,omitempty"`
+	// Quota limits the storage the tenant can request through its
+	// StorageClass
+	// +optional
+	Quota *TenantQuotaSpec `json:"quota,omitempty"`
+}
+
+// TenantQuotaSpec defines the ResourceQuotas limiting the use of the
+// StorageClass of a tenant
+type TenantQuotaSpec struct {
+	// Namespaces get a ResourceQuota for the StorageClass of the tenant. The
+	// limits apply to each of the namespaces.
+	Namespaces []string `json:"namespaces"`
+	// Storage is the total storage the PVCs of a namespace can request
+	// +optional
+	Storage *resource.Quantity `json:"storage,omitempty"`
+	// PersistentVolumeClaims is the number of PVCs of a namespace
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	PersistentVolumeClaims *int64 `json:"persistentVolumeClaims,omitempty"`
 }
 
 // KeyManagementServiceSpec provides a way to enable KMS
@@ -90,6 +169,28 @@ type ManageCephConfig struct {
 	ReconcileStrategy string `json:"reconcileStrategy,omitempty"`
 }
 
+// CephConfigSpec holds Ceph configuration options, by section of the Ceph
+// configuration file. The option names can be written with spaces, dashes or
+// underscores, as Ceph does.
+type CephConfigSpec struct {
+	// Global options apply to all the Ceph daemons
+	// +optional
+	Global map[string]string `json:"global,omitempty"`
+	// Mon options apply to the Ceph monitors
+	// +optional
+	Mon map[string]string `json:"mon,omitempty"`
+	// OSD options apply to the Ceph OSDs
+	// +optional
+	OSD map[string]string `json:"osd,omitempty"`
+	// MDS options apply to the Ceph metadata servers
+	// +optional
+	MDS map[string]string `json:"mds,omitempty"`
+	// RGW options apply to the Ceph object gateways. They are written in the
+	// client.rgw section, so that they don't apply to the other Ceph clients.
+	// +optional
+	RGW map[string]string `json:"rgw,omitempty"`
+}
+
 // ManageCephDashboard defines how to reconcile Ceph dashboard
 type ManageCephDashboard struct {
 	Enable bool `json:"enable,omitempty"`
@@ -102,6 +203,71 @@ type ManageCephBlockPools struct {
 	ReconcileStrategy    string `json:"reconcileStrategy,omitempty"`
 	DisableStorageClass  bool   `json:"disableStorageClass,omitempty"`
 	DisableSnapshotClass bool   `json:"disableSnapshotClass,omitempty"`
+	// AdditionalPools are created next to the default CephBlockPool, each
+	// with its own StorageClass and VolumeSnapshotClass. Removing a pool from
+	// the list keeps its CephBlockPool, StorageClass and VolumeSnapshotClass
+	// so that its volumes keep their data. The CephBlockPools are deleted
+	// with the StorageCluster, the StorageClass and the VolumeSnapshotClass
+	// have to be deleted manually.
+	// +optional
+	AdditionalPools []AdditionalBlockPoolSpec `json:"additionalPools,omitempty"`
+}
+
+// AdditionalBlockPoolSpec defines a CephBlockPool created in addition to the
+// default one
+type AdditionalBlockPoolSpec struct {
+	// Name is appended to the names of the CephBlockPool, StorageClass and
+	// VolumeSnapshotClass generated for the pool
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=40
+	Name string `json:"name"`
+	// Replica is the number of copies of the data in the pool. It defaults to
+	// the replica of the default CephBlockPool. It can't be combined with
+	// ErasureCoded.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replica int `json:"replica,omitempty"`
+	// ErasureCoded stores the data of the images in an erasure coded pool.
+	// The image metadata is then stored in a replicated pool named after
+	// the erasure coded one with a "-metadata" suffix.
+	// +optional
+	ErasureCoded *ErasureCodedPoolSpec `json:"erasureCoded,omitempty"`
+	// DeviceClass restricts the pool to the OSDs of a device class, e.g.
+	// ssd or hdd
+	// +optional
+	DeviceClass string `json:"deviceClass,omitempty"`
+	// CompressionMode is the BlueStore compression mode of the pool
+	// +kubebuilder:validation:Enum=none;passive;aggressive;force;""
+	// +optional
+	CompressionMode string `json:"compressionMode,omitempty"`
+	// Quotas limit the amount of data stored in the pool
+	// +optional
+	Quotas *PoolQuotaSpec `json:"quotas,omitempty"`
+	// +optional
+	DisableStorageClass bool `json:"disableStorageClass,omitempty"`
+	// +optional
+	DisableSnapshotClass bool `json:"disableSnapshotClass,omitempty"`
+}
+
+// ErasureCodedPoolSpec defines the erasure coding profile of a pool
+type ErasureCodedPoolSpec struct {
+	// DataChunks is the number of chunks the objects are split into
+	// +kubebuilder:validation:Minimum=2
+	DataChunks uint `json:"dataChunks"`
+	// CodingChunks is the number of coding chunks computed for each object,
+	// which is also the number of failure domains the pool can lose
+	// +kubebuilder:validation:Minimum=1
+	CodingChunks uint `json:"codingChunks"`
+}
+
+// PoolQuotaSpec defines the quotas of a pool
+type PoolQuotaSpec struct {
+	// MaxSize is the maximum amount of data stored in the pool
+	// +optional
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+	// MaxObjects is the maximum number of objects stored in the pool
+	// +optional
+	MaxObjects *uint64 `json:"maxObjects,omitempty"`
 }
 
 // ManageCephFilesystems defines how to reconcile CephFilesystems
@@ -109,6 +275,69 @@ type ManageCephFilesystems struct {
 	ReconcileStrategy    string `json:"reconcileStrategy,omitempty"`
 	DisableStorageClass  bool   `json:"disableStorageClass,omitempty"`
 	DisableSnapshotClass bool   `json:"disableSnapshotClass,omitempty"`
+	// ActiveMetadataServers is the number of active MDS of the default
+	// CephFilesystem, each of them having a standby. It defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10
+	// +optional
+	ActiveMetadataServers int `json:"activeMetadataServers,omitempty"`
+	// AdditionalDataPools are added to the default CephFilesystem, each with
+	// its own StorageClass. New data pools can only be appended to the list.
+	// +optional
+	AdditionalDataPools []FilesystemDataPoolSpec `json:"additionalDataPools,omitempty"`
+	// AdditionalFilesystems are created next to the default CephFilesystem,
+	// each with its own StorageClass and VolumeSnapshotClass
+	// +optional
+	AdditionalFilesystems []AdditionalFilesystemSpec `json:"additionalFilesystems,omitempty"`
+}
+
+// AdditionalFilesystemSpec defines a CephFilesystem created in addition to
+// the default one
+type AdditionalFilesystemSpec struct {
+	// Name is appended to the names of the CephFilesystem, StorageClass and
+	// VolumeSnapshotClass generated for the filesystem
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=40
+	Name string `json:"name"`
+	// ActiveMetadataServers is the number of active MDS of the filesystem,
+	// each of them having a standby. It defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=10
+	// +optional
+	ActiveMetadataServers int `json:"activeMetadataServers,omitempty"`
+	// AdditionalDataPools are added to the default data pool of the
+	// filesystem, each with its own StorageClass. New data pools can only be
+	// appended to the list.
+	// +optional
+	AdditionalDataPools []FilesystemDataPoolSpec `json:"additionalDataPools,omitempty"`
+	// +optional
+	DisableStorageClass bool `json:"disableStorageClass,omitempty"`
+	// +optional
+	DisableSnapshotClass bool `json:"disableSnapshotClass,omitempty"`
+}
+
+// FilesystemDataPoolSpec defines a data pool of a CephFilesystem
+type FilesystemDataPoolSpec struct {
+	// Name is appended to the name of the StorageClass of the filesystem to
+	// name the StorageClass of the data pool
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=40
+	Name string `json:"name"`
+	// Replica is the number of copies of the data in the pool. It defaults to
+	// the replica of the default data pool.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replica int `json:"replica,omitempty"`
+	// DeviceClass restricts the pool to the OSDs of a device class, e.g.
+	// ssd or hdd
+	// +optional
+	DeviceClass string `json:"deviceClass,omitempty"`
+	// CompressionMode is the BlueStore compression mode of the pool
+	// +kubebuilder:validation:Enum=none;passive;aggressive;force;""
+	// +optional
+	CompressionMode string `json:"compressionMode,omitempty"`
+	// +optional
+	DisableStorageClass bool `json:"disableStorageClass,omitempty"`
 }
 
 // ManageCephObjectStores defines how to reconcile CephObjectStores
@@ -128,6 +357,17 @@ type ManageCephObjectStoreUsers struct {
 type ExternalStorageClusterSpec struct {
 	// +optional
 	Enable bool `json:"enable,omitempty"`
+
+	// ClusterDetailsSecret is the name of the Secret with the details of the
+	// external cluster, rook-ceph-external-cluster-details by default. The
+	// StorageClusters using another Secret are additional external clusters,
+	// which only provide the Ceph CSI StorageClasses and SnapshotClasses of
+	// their cluster. Each one gets an external CephCluster in a namespace of
+	// its own, <namespace>-<name>, which is its clusterID, so the Rook
+	// operator must watch all namespaces. It can't be changed once the
+	// StorageCluster is created.
+	// +optional
+	ClusterDetailsSecret string `json:"clusterDetailsSecret,omitempty"`
 }
 
 // StorageDeviceSet defines a set of storage devices.
@@ -194,7 +434,6 @@ type StorageDeviceSet struct {
 }
 
 // StorageDeviceSetConfig defines Ceph OSD specific config options for the StorageDeviceSet
-// TODO: Fill in the members when the actual configurable options are defined in rook-ceph
 type StorageDeviceSetConfig struct {
 	// TuneSlowDeviceClass tunes the OSD when running on a slow Device Class
 	// +optional
@@ -203,6 +442,50 @@ type StorageDeviceSetConfig struct {
 	// TuneFastDeviceClass tunes the OSD when running on a fast Device Class
 	// +optional
 	TuneFastDeviceClass bool `json:"tuneFastDeviceClass,omitempty"`
+
+	// OSDsPerDevice is the number of OSDs to create on each device of the
+	// StorageDeviceSet. If not set, one OSD is created per device.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	OSDsPerDevice int `json:"osdsPerDevice,omitempty"`
+
+	// EncryptedDevice overrides spec.encryption.enable for the OSDs of the
+	// StorageDeviceSet. It can't be changed once the StorageDeviceSet is
+	// created.
+	// +optional
+	EncryptedDevice *bool `json:"encryptedDevice,omitempty"`
+
+	// MetadataDevice is the name of the device, e.g. nvme0n1, on which the
+	// metadata of the OSDs of the StorageDeviceSet are placed. It can't be
+	// used along with a metadataPVCTemplate, nor changed once the
+	// StorageDeviceSet is created.
+	// +optional
+	MetadataDevice string `json:"metadataDevice,omitempty"`
+
+	// BlueStoreCacheSize is the size of the BlueStore cache of each OSD. If
+	// not set, the OSDs size their cache automatically from their memory
+	// target. Setting a cache size turns this autotuning off. The cache
+	// sizes are set in the Ceph configuration of the OSDs once they are
+	// created, and apply when the OSDs are restarted.
+	// +optional
+	BlueStoreCacheSize *resource.Quantity `json:"bluestoreCacheSize,omitempty"`
+
+	// BlueStoreCacheSizeHDD is the size of the BlueStore cache of each OSD
+	// running on a rotational device
+	// +optional
+	BlueStoreCacheSizeHDD *resource.Quantity `json:"bluestoreCacheSizeHDD,omitempty"`
+
+	// BlueStoreCacheSizeSSD is the size of the BlueStore cache of each OSD
+	// running on a non rotational device
+	// +optional
+	BlueStoreCacheSizeSSD *resource.Quantity `json:"bluestoreCacheSizeSSD,omitempty"`
+
+	// OSDMemoryTarget is the amount of memory each OSD tries to stay under.
+	// The OSDs derive it from their memory limit, which is set from the
+	// target and osd_memory_target_cgroup_limit_ratio, so it can't be set
+	// along with a memory in the StorageDeviceSet resources.
+	// +optional
+	OSDMemoryTarget *resource.Quantity `json:"osdMemoryTarget,omitempty"`
 }
 
 // MultiCloudGatewaySpec defines specific multi-cloud gateway configuration options
@@ -230,7 +513,11 @@ type MonitoringSpec struct {
 // It is optional and defaults to false.
 type EncryptionSpec struct {
 	// +optional
-	Enable               bool                     `json:"enable,omitempty"`
+	Enable bool `json:"enable,omitempty"`
+	// StorageClass enables an additional RBD StorageClass whose volumes are
+	// each encrypted with their own key stored in the KMS, which must be enabled.
+	// +optional
+	StorageClass         bool                     `json:"storageClass,omitempty"`
 	KeyManagementService KeyManagementServiceSpec `json:"kms,omitempty"`
 }
 
@@ -245,6 +532,23 @@ type StorageClusterStatus struct {
 	// +optional
 	Conditions []conditionsv1.Condition `json:"conditions,omitempty"`
 
+	// Components is the list of components managed by the StorageCluster
+	// along with the negative conditions each of them reports. Conditions
+	// only holds one condition per type, aggregated across all components.
+	// +optional
+	Components []ComponentStatus `json:"components,omitempty"`
+
+	// ResourceManagers holds the outcome of the last run of each of the
+	// resource managers that ensure the resources owned by the StorageCluster.
+	// +optional
+	ResourceManagers []ResourceManagerStatus `json:"resourceManagers,omitempty"`
+
+	// Plan lists the changes the operator would make to the resources owned
+	// by the StorageCluster. It is only set while the StorageCluster is in
+	// dry-run mode, in which case none of those changes are applied.
+	// +optional
+	Plan *StorageClusterPlan `json:"plan,omitempty"`
+
 	// RelatedObjects is a list of objects created and maintained by this
 	// operator. Object references will be added to this list after they have
 	// been created AND found in the cluster.
@@ -274,10 +578,554 @@ type StorageClusterStatus struct {
 	// ExternalSecretHash holds the checksum value of external secret data.
 	ExternalSecretHash string `json:"externalSecretHash,omitempty"`
 
+	// ExternalClusterDetailsSecret records the Secret the external cluster
+	// details were applied from. The clusterDetailsSecret of the spec can't
+	// be changed afterwards.
+	// +optional
+	ExternalClusterDetailsSecret string `json:"externalClusterDetailsSecret,omitempty"`
+
+	// FilesystemDataPools records the additional data pools of each
+	// CephFilesystem in the order Rook numbers them. The additional data
+	// pools can only be appended, as the StorageClasses refer to the pools
+	// by their index.
+	// +optional
+	FilesystemDataPools []FilesystemDataPoolsStatus `json:"filesystemDataPools,omitempty"`
+
+	// KMS holds the state of the connection to the key management service,
+	// when the KMS is enabled
+	// +optional
+	KMS *KMSStatus `json:"kms,omitempty"`
+
+	// ExternalCluster holds the reachability of the endpoints of the
+	// external cluster, in external mode
+	// +optional
+	ExternalCluster *ExternalClusterStatus `json:"externalCluster,omitempty"`
+
+	// Uninstall holds the uninstall report, when requested, and the
+	// progress of the uninstall once the StorageCluster is deleted
+	// +optional
+	Uninstall *UninstallStatus `json:"uninstall,omitempty"`
+
+	// RetainedData is the adoption of the data a StorageCluster deleted with
+	// the retain cleanup policy left behind. It is only set when the
+	// adoption is requested with the
+	// uninstall.ocs.openshift.io/adopt-retained-data annotation.
+	// +optional
+	RetainedData *RetainedDataStatus `json:"retainedData,omitempty"`
+
+	// Topology reports how the storage nodes and the OSDs are spread across
+	// the failure domain, how the topology drifted since the failure domain
+	// was determined, and the migration of the failure domain
+	// +optional
+	Topology *TopologyStatus `json:"topology,omitempty"`
+
+	// ArbiterElection records the zone of the arbiter, either set in the spec
+	// or elected by the ocs-operator, and why it was chosen
+	// +optional
+	ArbiterElection *ArbiterElectionStatus `json:"arbiterElection,omitempty"`
+
 	// Images holds the image reconcile status for all images reconciled by the operator
 	Images ImagesStatus `json:"images,omitempty"`
 }
 
+// FilesystemDataPoolsStatus records the additional data pools of a
+// CephFilesystem
+type FilesystemDataPoolsStatus struct {
+	// Name is the name of the CephFilesystem
+	Name string `json:"name"`
+
+	// DataPools are the names of the additional data pools, the first one
+	// being the data pool at index 1 of the CephFilesystem
+	DataPools []string `json:"dataPools"`
+}
+
+// KMSStatus holds the state of the connection to the key management service
+type KMSStatus struct {
+	// Provider is the KMS_PROVIDER of the KMS ConfigMap
+	// +optional
+	Provider string `json:"provider,omitempty"`
+
+	// AuthMethod is the method the operator authenticates to the KMS with,
+	// e.g. token, kubernetes or approle for Vault
+	// +optional
+	AuthMethod string `json:"authMethod,omitempty"`
+
+	// TokenExpiryTime is the time at which the KMS token expires. It is not
+	// set for tokens which never expire.
+	// +optional
+	TokenExpiryTime *metav1.Time `json:"tokenExpiryTime,omitempty"`
+
+	// NextTokenRenewalTime is the time at which the operator will renew or
+	// rotate the KMS token. It is not set if the token can't be renewed.
+	// +optional
+	NextTokenRenewalTime *metav1.Time `json:"nextTokenRenewalTime,omitempty"`
+
+	// LastTokenRenewalTime is the last time the operator renewed or rotated
+	// the KMS token
+	// +optional
+	LastTokenRenewalTime *metav1.Time `json:"lastTokenRenewalTime,omitempty"`
+
+	// LastHealthCheckTime is the last time the operator checked that it
+	// could connect to the KMS
+	// +optional
+	LastHealthCheckTime *metav1.Time `json:"lastHealthCheckTime,omitempty"`
+
+	// ConfigHash holds the checksum of the KMS configuration of the last
+	// health check
+	// +optional
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// LastSuccessfulHealthCheckTime is the last time the operator connected
+	// successfully to the KMS
+	// +optional
+	LastSuccessfulHealthCheckTime *metav1.Time `json:"lastSuccessfulHealthCheckTime,omitempty"`
+
+	// LastHealthCheckLatency is the time the KMS took to answer the last
+	// health check
+	// +optional
+	LastHealthCheckLatency *metav1.Duration `json:"lastHealthCheckLatency,omitempty"`
+}
+
+// ExternalClusterStatus holds the result of the probes of the endpoints of
+// the external cluster
+type ExternalClusterStatus struct {
+	// Endpoints holds the reachability of each endpoint of the external
+	// cluster at the last probe
+	// +optional
+	Endpoints []ExternalEndpointStatus `json:"endpoints,omitempty"`
+
+	// LastProbeTime is the last time the operator probed the endpoints of
+	// the external cluster
+	// +optional
+	LastProbeTime *metav1.Time `json:"lastProbeTime,omitempty"`
+
+	// NextProbeTime is the time at which the operator will probe the
+	// endpoints of the external cluster again. It backs off while some
+	// endpoints are unreachable.
+	// +optional
+	NextProbeTime *metav1.Time `json:"nextProbeTime,omitempty"`
+
+	// ConsecutiveFailures is the number of probes in a row in which some
+	// endpoints were unreachable
+	// +optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+}
+
+// ExternalEndpointStatus holds the reachability of an endpoint of the
+// external cluster
+type ExternalEndpointStatus struct {
+	// Type is the service of the external cluster behind the endpoint, one
+	// of mon, rgw or mgr-prometheus
+	Type string `json:"type"`
+
+	// Name is the name of the mon behind the endpoint, if any
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Address is the host and port of the endpoint
+	Address string `json:"address"`
+
+	// Reachable is whether the operator could connect to the endpoint at
+	// the last probe
+	Reachable bool `json:"reachable"`
+
+	// Message is the error of the last probe, if any
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// LastProbeLatency is the time the endpoint took to accept the
+	// connection at the last probe
+	// +optional
+	LastProbeLatency *metav1.Duration `json:"lastProbeLatency,omitempty"`
+
+	// LastReachableTime is the last time the operator could connect to the
+	// endpoint
+	// +optional
+	LastReachableTime *metav1.Time `json:"lastReachableTime,omitempty"`
+}
+
+// ComponentStatus holds the negative conditions reported by a single
+// component managed by the StorageCluster
+type ComponentStatus struct {
+	// Name of the component, e.g. CephCluster or NooBaa
+	Name string `json:"name"`
+
+	// Conditions is the list of negative conditions (!Available, Degraded,
+	// Progressing, !Upgradeable) reported by the component. It is empty when
+	// the component is healthy.
+	// +optional
+	Conditions []conditionsv1.Condition `json:"conditions,omitempty"`
+}
+
+// ResourceManagerResult is the outcome of a resource manager run
+type ResourceManagerResult string
+
+const (
+	// ResourceManagerSucceeded is used when the resource manager ensured all of its resources
+	ResourceManagerSucceeded ResourceManagerResult = "Succeeded"
+	// ResourceManagerFailed is used when the resource manager returned an error
+	ResourceManagerFailed ResourceManagerResult = "Failed"
+	// ResourceManagerSkipped is used when the resource manager didn't run
+	// because one of its dependencies didn't succeed
+	ResourceManagerSkipped ResourceManagerResult = "Skipped"
+	// ResourceManagerPaused is used when the resource manager didn't run
+	// because its reconcile is paused
+	ResourceManagerPaused ResourceManagerResult = "Paused"
+)
+
+// ResourceManagerStatus holds the outcome of the last run of a resource manager
+type ResourceManagerStatus struct {
+	// Name of the resource manager, e.g. CephCluster or StorageClasses
+	Name string `json:"name"`
+
+	// Result of the last run: Succeeded, Failed, Skipped or Paused
+	Result ResourceManagerResult `json:"result"`
+
+	// Message holds the error of a failed run, or the reason why the run was
+	// skipped
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Duration is the time the last run took
+	// +optional
+	Duration metav1.Duration `json:"duration,omitempty"`
+}
+
+// StorageClusterPlan lists the changes the operator would make to reconcile
+// the StorageCluster
+type StorageClusterPlan struct {
+	// ObservedGeneration is the generation of the StorageCluster the plan was
+	// computed for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Changes is the list of objects that would be created, updated or
+	// deleted
+	// +optional
+	Changes []PlannedChange `json:"changes,omitempty"`
+
+	// ResourceManagers holds the outcome of the dry-run of each of the
+	// resource managers. The plan is incomplete if any of them didn't succeed.
+	// +optional
+	ResourceManagers []ResourceManagerStatus `json:"resourceManagers,omitempty"`
+}
+
+// PlannedAction is the action the operator would take on an object
+type PlannedAction string
+
+const (
+	// PlannedActionCreate is used when the object would be created
+	PlannedActionCreate PlannedAction = "Create"
+	// PlannedActionUpdate is used when the object would be updated in place
+	PlannedActionUpdate PlannedAction = "Update"
+	// PlannedActionDelete is used when the object would be deleted
+	PlannedActionDelete PlannedAction = "Delete"
+	// PlannedActionRecreate is used when the object would be deleted and
+	// created again, e.g. to change an immutable field
+	PlannedActionRecreate PlannedAction = "Recreate"
+)
+
+// PlannedChange describes the change the operator would make to a single object
+type PlannedChange struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+
+	// Action is one of Create, Update, Delete or Recreate
+	Action PlannedAction `json:"action"`
+
+	// Patch is the list of JSON patch operations that turn the current
+	// object into the desired one, for the Update and Recreate actions
+	// +optional
+	Patch []JSONPatchOperation `json:"patch,omitempty"`
+}
+
+// JSONPatchOperation is a single RFC 6902 JSON patch operation
+type JSONPatchOperation struct {
+	// Op is one of add, remove or replace
+	Op string `json:"op"`
+	// Path is the JSON pointer to the changed field
+	Path string `json:"path"`
+	// Value is the JSON encoded new value of the field
+	// +optional
+	Value string `json:"value,omitempty"`
+}
+
+// UninstallStatus holds the uninstall report and the progress of the
+// uninstall of the StorageCluster
+type UninstallStatus struct {
+	// Report lists the resources which would block the uninstall or be
+	// destroyed by it. It is only set while the uninstall dry-run is
+	// requested, with the uninstall.ocs.openshift.io/dry-run annotation.
+	// +optional
+	Report *UninstallReport `json:"report,omitempty"`
+
+	// Steps is the progress of each step of the uninstall, in the order in
+	// which they run. It is set once the StorageCluster is deleted.
+	// +optional
+	Steps []UninstallStep `json:"steps,omitempty"`
+}
+
+// UninstallReport lists, by namespace, the resources which would block the
+// uninstall of the StorageCluster or be destroyed by it
+type UninstallReport struct {
+	// GeneratedTime is the time at which the report was generated
+	GeneratedTime metav1.Time `json:"generatedTime"`
+
+	// Mode is the uninstall mode the report was generated for, graceful or
+	// forced
+	Mode string `json:"mode"`
+
+	// CleanupPolicy is the cleanup policy the report was generated for,
+	// delete or retain
+	CleanupPolicy string `json:"cleanupPolicy"`
+
+	// Blocked is true if some resources would block the uninstall until
+	// they are deleted
+	Blocked bool `json:"blocked"`
+
+	// Namespaces lists the affected resources by namespace. Cluster-scoped
+	// resources are listed under an empty namespace.
+	// +optional
+	Namespaces []UninstallNamespaceReport `json:"namespaces,omitempty"`
+
+	// Unavailable lists the kinds of resources the operator isn't allowed
+	// to list, the report doesn't include them
+	// +optional
+	Unavailable []string `json:"unavailable,omitempty"`
+}
+
+// UninstallNamespaceReport lists the affected resources of a namespace
+type UninstallNamespaceReport struct {
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	Resources []UninstallAffectedResource `json:"resources"`
+}
+
+// UninstallImpact is the effect of the uninstall on a resource
+type UninstallImpact string
+
+const (
+	// UninstallImpactBlocking is used for the resources which must be
+	// deleted before the uninstall can complete
+	UninstallImpactBlocking UninstallImpact = "Blocking"
+	// UninstallImpactDestroyed is used for the resources which the
+	// uninstall deletes along with their data
+	UninstallImpactDestroyed UninstallImpact = "Destroyed"
+	// UninstallImpactModified is used for the resources which the uninstall
+	// changes but keeps
+	UninstallImpactModified UninstallImpact = "Modified"
+)
+
+// UninstallAffectedResource is a resource affected by the uninstall
+type UninstallAffectedResource struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+
+	// Impact is one of Blocking, Destroyed or Modified
+	Impact UninstallImpact `json:"impact"`
+
+	// Message details how the resource is affected
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// UninstallStepState is the state of a step of the uninstall
+type UninstallStepState string
+
+const (
+	// UninstallStepPending is used for the steps which haven't started
+	UninstallStepPending UninstallStepState = "Pending"
+	// UninstallStepInProgress is used for the step the uninstall is waiting on
+	UninstallStepInProgress UninstallStepState = "InProgress"
+	// UninstallStepCompleted is used for the steps which are done
+	UninstallStepCompleted UninstallStepState = "Completed"
+)
+
+// UninstallStep is the progress of a step of the uninstall
+type UninstallStep struct {
+	Name string `json:"name"`
+
+	// State is one of Pending, InProgress or Completed
+	State UninstallStepState `json:"state"`
+
+	// Message is what the step is waiting for while it is in progress, or
+	// its outcome once it completed
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// LastTransitionTime is the last time the state of the step changed
+	// +optional
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// ArbiterElectionReason is why a zone was chosen for the arbiter
+type ArbiterElectionReason string
+
+const (
+	// ArbiterZoneSpecified is used when the zone is set in the spec
+	ArbiterZoneSpecified ArbiterElectionReason = "Specified"
+	// ArbiterZoneMasterNodesOnly is used when the zone only holds master
+	// nodes
+	ArbiterZoneMasterNodesOnly ArbiterElectionReason = "MasterNodesOnly"
+	// ArbiterZoneFewestStorageNodes is used when the zone has the fewest
+	// storage nodes
+	ArbiterZoneFewestStorageNodes ArbiterElectionReason = "FewestStorageNodes"
+)
+
+// ArbiterElectionStatus records the zone of the arbiter
+type ArbiterElectionStatus struct {
+	Zone string `json:"zone"`
+
+	// Reason is one of Specified, MasterNodesOnly or FewestStorageNodes
+	Reason ArbiterElectionReason `json:"reason"`
+
+	// Message justifies the choice of the zone
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// MonsPlaced is set once the mons are placed, the zone of the arbiter
+	// can't be changed after that
+	// +optional
+	MonsPlaced bool `json:"monsPlaced,omitempty"`
+
+	// ElectionTime is when the zone was chosen
+	// +optional
+	ElectionTime *metav1.Time `json:"electionTime,omitempty"`
+}
+
+// TopologyDriftType is a change of the topology of the storage nodes since
+// the failure domain was determined
+type TopologyDriftType string
+
+const (
+	// TopologyDriftZonesAvailable is used when enough zones are available for
+	// the zone failure domain, which the rack failure domain can migrate to
+	TopologyDriftZonesAvailable TopologyDriftType = "ZonesAvailable"
+	// TopologyDriftFailureDomainEmpty is used when all the storage nodes of a
+	// failure domain are gone
+	TopologyDriftFailureDomainEmpty TopologyDriftType = "FailureDomainEmpty"
+	// TopologyDriftOSDImbalance is used when the OSDs are unevenly spread
+	// across the failure domain
+	TopologyDriftOSDImbalance TopologyDriftType = "OSDImbalance"
+)
+
+// TopologyStatus reports the topology of the storage nodes
+type TopologyStatus struct {
+	// Drifts lists the changes of the topology since the failure domain was
+	// determined
+	// +optional
+	Drifts []TopologyDrift `json:"drifts,omitempty"`
+
+	// FailureDomains counts the storage nodes and the OSDs in each value of
+	// the failure domain
+	// +optional
+	FailureDomains []FailureDomainUsage `json:"failureDomains,omitempty"`
+
+	// Migration is the migration of the failure domain, requested with the
+	// topology.ocs.openshift.io/migrate-failure-domain annotation
+	// +optional
+	Migration *FailureDomainMigration `json:"migration,omitempty"`
+}
+
+// TopologyDrift is a change of the topology of the storage nodes
+type TopologyDrift struct {
+	// Type is one of ZonesAvailable, FailureDomainEmpty or OSDImbalance
+	Type TopologyDriftType `json:"type"`
+
+	Message string `json:"message"`
+}
+
+// FailureDomainUsage counts the storage nodes and the OSDs in a value of the
+// failure domain
+type FailureDomainUsage struct {
+	Value string `json:"value"`
+	Nodes int32  `json:"nodes"`
+	OSDs  int32  `json:"osds"`
+}
+
+// FailureDomainMigrationPhase is the progress of a failure domain migration
+type FailureDomainMigrationPhase string
+
+const (
+	// FailureDomainMigrationBlocked is used while the topology doesn't
+	// allow the requested migration
+	FailureDomainMigrationBlocked FailureDomainMigrationPhase = "Blocked"
+	// FailureDomainMigrationInProgress is used once the failure domain is
+	// changed, while Ceph moves the data to the new failure domain
+	FailureDomainMigrationInProgress FailureDomainMigrationPhase = "InProgress"
+	// FailureDomainMigrationCompleted is used once Ceph is healthy again
+	// with the new failure domain
+	FailureDomainMigrationCompleted FailureDomainMigrationPhase = "Completed"
+)
+
+// FailureDomainMigration is the migration of the failure domain
+type FailureDomainMigration struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Phase is one of Blocked, InProgress or Completed
+	Phase FailureDomainMigrationPhase `json:"phase"`
+
+	// Message explains what blocks the migration, or what it waits for
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// StartTime is when the failure domain was changed
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+}
+
+// RetainedDataPhase is the progress of the adoption of the retained data
+type RetainedDataPhase string
+
+const (
+	// RetainedDataInvalid is used when the retained data can't be adopted,
+	// the CephCluster is not created until it is fixed
+	RetainedDataInvalid RetainedDataPhase = "Invalid"
+	// RetainedDataValidated is used once the retained data is validated and
+	// the CephCluster is being created around it
+	RetainedDataValidated RetainedDataPhase = "Validated"
+	// RetainedDataAdopted is used once the CephCluster runs with the
+	// retained data
+	RetainedDataAdopted RetainedDataPhase = "Adopted"
+)
+
+// RetainedDataStatus is the adoption of the OSD, mon and NooBaa DB PVCs, and
+// of the Ceph cluster secrets, retained by a deleted StorageCluster
+type RetainedDataStatus struct {
+	// Phase is one of Invalid, Validated or Adopted
+	Phase RetainedDataPhase `json:"phase"`
+
+	// FSID is the fsid of the Ceph cluster the data belongs to
+	// +optional
+	FSID string `json:"fsid,omitempty"`
+
+	// PersistentVolumeClaims are the retained PVCs which are adopted
+	// +optional
+	PersistentVolumeClaims []RetainedPersistentVolumeClaim `json:"persistentVolumeClaims,omitempty"`
+
+	// Secrets are the retained NooBaa Secrets which are reused along with the
+	// NooBaa DB PVC
+	// +optional
+	Secrets []string `json:"secrets,omitempty"`
+
+	// Message explains why the retained data can't be adopted
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// RetainedPersistentVolumeClaim is a retained PVC
+type RetainedPersistentVolumeClaim struct {
+	Name string `json:"name"`
+
+	// Type is one of osd, mon or noobaa-db
+	Type string `json:"type"`
+}
+
 // ImagesStatus maps every component image name it's reconciliation status information
 type ImagesStatus struct {
 	Ceph       *ComponentImageStatus `json:"ceph,omitempty"`
@@ -324,6 +1172,26 @@ const (
 	// ConditionExternalClusterConnecting type indicates that rook is still trying for
 	// an external connection
 	ConditionExternalClusterConnecting conditionsv1.ConditionType = "ExternalClusterConnecting"
+
+	// ConditionReconcilePaused type indicates that the reconcile of some or
+	// all of the StorageCluster components is paused
+	ConditionReconcilePaused conditionsv1.ConditionType = "ReconcilePaused"
+
+	// ConditionKMSConnected type indicates whether the operator could
+	// authenticate to the key management service at its last health check
+	ConditionKMSConnected conditionsv1.ConditionType = "KMSConnected"
+
+	// ConditionExternalClusterDetailsValid type indicates whether the
+	// details of the external cluster could be parsed and validated
+	ConditionExternalClusterDetailsValid conditionsv1.ConditionType = "ExternalClusterDetailsValid"
+
+	// ConditionTopologyDegraded type indicates whether the storage nodes or
+	// the OSDs no longer match the failure domain
+	ConditionTopologyDegraded conditionsv1.ConditionType = "TopologyDegraded"
+
+	// ConditionFailureDomainMigrating type indicates whether Ceph is moving
+	// the data to the failure domain requested by a migration
+	ConditionFailureDomainMigrating conditionsv1.ConditionType = "FailureDomainMigrating"
 )
 
 // List of constants to show different different reconciliation messages and statuses.
@@ -334,6 +1202,21 @@ const (
 	ReconcileCompletedMessage       = "Reconcile completed successfully"
 	ExternalClusterConnected        = "ExternalClusterConnected"
 	ExternalClusterConnectedMessage = "Connected successfully to an external cluster"
+	ExternalClusterDegraded         = "ExternalClusterDegraded"
+	ExternalClusterMonsUnreachable  = "ExternalClusterMonsUnreachable"
+	ReconcilePaused                 = "ReconcilePaused"
+	ReconcileResumed                = "ReconcileResumed"
+	KMSConnected                    = "KMSConnected"
+	KMSConnectionFailed             = "KMSConnectionFailed"
+	KMSProviderUnknown              = "KMSProviderUnknown"
+	ExternalClusterDetailsValid     = "ExternalClusterDetailsValid"
+	ExternalClusterDetailsInvalid   = "ExternalClusterDetailsInvalid"
+	TopologyHealthy                 = "TopologyHealthy"
+	TopologyDrifted                 = "TopologyDrifted"
+	FailureDomainMigrationAvailable = "FailureDomainMigrationAvailable"
+	FailureDomainMigrating          = "FailureDomainMigrating"
+	FailureDomainMigrated           = "FailureDomainMigrated"
+	FailureDomainNotMigrated        = "FailureDomainNotMigrated"
 )
 
 // +kubebuilder:object:root=true
@@ -364,7 +1247,8 @@ type StorageClusterList struct {
 
 // ArbiterSpec defines if arbiter should be enabled for the Ceph Cluster.
 // It is optional and defaults to false.
-// If set to true, ArbiterLocation must be set in the NodeTopologies.
+// If set to true and no ArbiterLocation is set in the NodeTopologies, the
+// ocs-operator elects the zone of the arbiter.
 type ArbiterSpec struct {
 	Enable bool `json:"enable,omitempty"`
 	// DisableMasterNodeToleration can be used to turn off the arbiter mon toleration for the master node taint.
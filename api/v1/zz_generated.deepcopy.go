@@ -29,6 +29,70 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdditionalBlockPoolSpec) DeepCopyInto(out *AdditionalBlockPoolSpec) {
+	*out = *in
+	if in.ErasureCoded != nil {
+		in, out := &in.ErasureCoded, &out.ErasureCoded
+		*out = new(ErasureCodedPoolSpec)
+		**out = **in
+	}
+	if in.Quotas != nil {
+		in, out := &in.Quotas, &out.Quotas
+		*out = new(PoolQuotaSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdditionalBlockPoolSpec.
+func (in *AdditionalBlockPoolSpec) DeepCopy() *AdditionalBlockPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AdditionalBlockPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AdditionalFilesystemSpec) DeepCopyInto(out *AdditionalFilesystemSpec) {
+	*out = *in
+	if in.AdditionalDataPools != nil {
+		in, out := &in.AdditionalDataPools, &out.AdditionalDataPools
+		*out = make([]FilesystemDataPoolSpec, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AdditionalFilesystemSpec.
+func (in *AdditionalFilesystemSpec) DeepCopy() *AdditionalFilesystemSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AdditionalFilesystemSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ArbiterElectionStatus) DeepCopyInto(out *ArbiterElectionStatus) {
+	*out = *in
+	if in.ElectionTime != nil {
+		in, out := &in.ElectionTime, &out.ElectionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ArbiterElectionStatus.
+func (in *ArbiterElectionStatus) DeepCopy() *ArbiterElectionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ArbiterElectionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ArbiterSpec) DeepCopyInto(out *ArbiterSpec) {
 	*out = *in
@@ -49,6 +113,56 @@ func (in *ArbiterSpec) DeepCopy() *ArbiterSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CephConfigSpec) DeepCopyInto(out *CephConfigSpec) {
+	*out = *in
+	if in.Global != nil {
+		in, out := &in.Global, &out.Global
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Mon != nil {
+		in, out := &in.Mon, &out.Mon
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.OSD != nil {
+		in, out := &in.OSD, &out.OSD
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.MDS != nil {
+		in, out := &in.MDS, &out.MDS
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.RGW != nil {
+		in, out := &in.RGW, &out.RGW
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CephConfigSpec.
+func (in *CephConfigSpec) DeepCopy() *CephConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CephConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ComponentImageStatus) DeepCopyInto(out *ComponentImageStatus) {
 	*out = *in
@@ -64,6 +178,28 @@ func (in *ComponentImageStatus) DeepCopy() *ComponentImageStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ComponentStatus) DeepCopyInto(out *ComponentStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]conditionsv1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ComponentStatus.
+func (in *ComponentStatus) DeepCopy() *ComponentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ComponentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EncryptionSpec) DeepCopyInto(out *EncryptionSpec) {
 	*out = *in
@@ -80,6 +216,75 @@ func (in *EncryptionSpec) DeepCopy() *EncryptionSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ErasureCodedPoolSpec) DeepCopyInto(out *ErasureCodedPoolSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ErasureCodedPoolSpec.
+func (in *ErasureCodedPoolSpec) DeepCopy() *ErasureCodedPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ErasureCodedPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalClusterStatus) DeepCopyInto(out *ExternalClusterStatus) {
+	*out = *in
+	if in.Endpoints != nil {
+		in, out := &in.Endpoints, &out.Endpoints
+		*out = make([]ExternalEndpointStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.LastProbeTime != nil {
+		in, out := &in.LastProbeTime, &out.LastProbeTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextProbeTime != nil {
+		in, out := &in.NextProbeTime, &out.NextProbeTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalClusterStatus.
+func (in *ExternalClusterStatus) DeepCopy() *ExternalClusterStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalClusterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalEndpointStatus) DeepCopyInto(out *ExternalEndpointStatus) {
+	*out = *in
+	if in.LastProbeLatency != nil {
+		in, out := &in.LastProbeLatency, &out.LastProbeLatency
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.LastReachableTime != nil {
+		in, out := &in.LastReachableTime, &out.LastReachableTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalEndpointStatus.
+func (in *ExternalEndpointStatus) DeepCopy() *ExternalEndpointStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalEndpointStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExternalStorageClusterSpec) DeepCopyInto(out *ExternalStorageClusterSpec) {
 	*out = *in
@@ -95,6 +300,75 @@ func (in *ExternalStorageClusterSpec) DeepCopy() *ExternalStorageClusterSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FailureDomainMigration) DeepCopyInto(out *FailureDomainMigration) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailureDomainMigration.
+func (in *FailureDomainMigration) DeepCopy() *FailureDomainMigration {
+	if in == nil {
+		return nil
+	}
+	out := new(FailureDomainMigration)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FailureDomainUsage) DeepCopyInto(out *FailureDomainUsage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FailureDomainUsage.
+func (in *FailureDomainUsage) DeepCopy() *FailureDomainUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(FailureDomainUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FilesystemDataPoolSpec) DeepCopyInto(out *FilesystemDataPoolSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FilesystemDataPoolSpec.
+func (in *FilesystemDataPoolSpec) DeepCopy() *FilesystemDataPoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FilesystemDataPoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FilesystemDataPoolsStatus) DeepCopyInto(out *FilesystemDataPoolsStatus) {
+	*out = *in
+	if in.DataPools != nil {
+		in, out := &in.DataPools, &out.DataPools
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FilesystemDataPoolsStatus.
+func (in *FilesystemDataPoolsStatus) DeepCopy() *FilesystemDataPoolsStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FilesystemDataPoolsStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImagesStatus) DeepCopyInto(out *ImagesStatus) {
 	*out = *in
@@ -125,6 +399,61 @@ func (in *ImagesStatus) DeepCopy() *ImagesStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *JSONPatchOperation) DeepCopyInto(out *JSONPatchOperation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new JSONPatchOperation.
+func (in *JSONPatchOperation) DeepCopy() *JSONPatchOperation {
+	if in == nil {
+		return nil
+	}
+	out := new(JSONPatchOperation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KMSStatus) DeepCopyInto(out *KMSStatus) {
+	*out = *in
+	if in.TokenExpiryTime != nil {
+		in, out := &in.TokenExpiryTime, &out.TokenExpiryTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextTokenRenewalTime != nil {
+		in, out := &in.NextTokenRenewalTime, &out.NextTokenRenewalTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastTokenRenewalTime != nil {
+		in, out := &in.LastTokenRenewalTime, &out.LastTokenRenewalTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastHealthCheckTime != nil {
+		in, out := &in.LastHealthCheckTime, &out.LastHealthCheckTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessfulHealthCheckTime != nil {
+		in, out := &in.LastSuccessfulHealthCheckTime, &out.LastSuccessfulHealthCheckTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastHealthCheckLatency != nil {
+		in, out := &in.LastHealthCheckLatency, &out.LastHealthCheckLatency
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KMSStatus.
+func (in *KMSStatus) DeepCopy() *KMSStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KMSStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KeyManagementServiceSpec) DeepCopyInto(out *KeyManagementServiceSpec) {
 	*out = *in
@@ -143,6 +472,13 @@ func (in *KeyManagementServiceSpec) DeepCopy() *KeyManagementServiceSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManageCephBlockPools) DeepCopyInto(out *ManageCephBlockPools) {
 	*out = *in
+	if in.AdditionalPools != nil {
+		in, out := &in.AdditionalPools, &out.AdditionalPools
+		*out = make([]AdditionalBlockPoolSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManageCephBlockPools.
@@ -188,6 +524,18 @@ func (in *ManageCephDashboard) DeepCopy() *ManageCephDashboard {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ManageCephFilesystems) DeepCopyInto(out *ManageCephFilesystems) {
 	*out = *in
+	if in.AdditionalDataPools != nil {
+		in, out := &in.AdditionalDataPools, &out.AdditionalDataPools
+		*out = make([]FilesystemDataPoolSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.AdditionalFilesystems != nil {
+		in, out := &in.AdditionalFilesystems, &out.AdditionalFilesystems
+		*out = make([]AdditionalFilesystemSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ManageCephFilesystems.
@@ -235,8 +583,8 @@ func (in *ManagedResourcesSpec) DeepCopyInto(out *ManagedResourcesSpec) {
 	*out = *in
 	out.CephConfig = in.CephConfig
 	out.CephDashboard = in.CephDashboard
-	out.CephBlockPools = in.CephBlockPools
-	out.CephFilesystems = in.CephFilesystems
+	in.CephBlockPools.DeepCopyInto(&out.CephBlockPools)
+	in.CephFilesystems.DeepCopyInto(&out.CephFilesystems)
 	out.CephObjectStores = in.CephObjectStores
 	out.CephObjectStoreUsers = in.CephObjectStoreUsers
 }
@@ -424,6 +772,107 @@ func (in *OCSInitializationStatus) DeepCopy() *OCSInitializationStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlannedChange) DeepCopyInto(out *PlannedChange) {
+	*out = *in
+	if in.Patch != nil {
+		in, out := &in.Patch, &out.Patch
+		*out = make([]JSONPatchOperation, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlannedChange.
+func (in *PlannedChange) DeepCopy() *PlannedChange {
+	if in == nil {
+		return nil
+	}
+	out := new(PlannedChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolQuotaSpec) DeepCopyInto(out *PoolQuotaSpec) {
+	*out = *in
+	if in.MaxSize != nil {
+		in, out := &in.MaxSize, &out.MaxSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MaxObjects != nil {
+		in, out := &in.MaxObjects, &out.MaxObjects
+		*out = new(uint64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolQuotaSpec.
+func (in *PoolQuotaSpec) DeepCopy() *PoolQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceManagerStatus) DeepCopyInto(out *ResourceManagerStatus) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceManagerStatus.
+func (in *ResourceManagerStatus) DeepCopy() *ResourceManagerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceManagerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetainedDataStatus) DeepCopyInto(out *RetainedDataStatus) {
+	*out = *in
+	if in.PersistentVolumeClaims != nil {
+		in, out := &in.PersistentVolumeClaims, &out.PersistentVolumeClaims
+		*out = make([]RetainedPersistentVolumeClaim, len(*in))
+		copy(*out, *in)
+	}
+	if in.Secrets != nil {
+		in, out := &in.Secrets, &out.Secrets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetainedDataStatus.
+func (in *RetainedDataStatus) DeepCopy() *RetainedDataStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RetainedDataStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RetainedPersistentVolumeClaim) DeepCopyInto(out *RetainedPersistentVolumeClaim) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RetainedPersistentVolumeClaim.
+func (in *RetainedPersistentVolumeClaim) DeepCopy() *RetainedPersistentVolumeClaim {
+	if in == nil {
+		return nil
+	}
+	out := new(RetainedPersistentVolumeClaim)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StorageCluster) DeepCopyInto(out *StorageCluster) {
 	*out = *in
@@ -483,6 +932,33 @@ func (in *StorageClusterList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageClusterPlan) DeepCopyInto(out *StorageClusterPlan) {
+	*out = *in
+	if in.Changes != nil {
+		in, out := &in.Changes, &out.Changes
+		*out = make([]PlannedChange, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ResourceManagers != nil {
+		in, out := &in.ResourceManagers, &out.ResourceManagers
+		*out = make([]ResourceManagerStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageClusterPlan.
+func (in *StorageClusterPlan) DeepCopy() *StorageClusterPlan {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageClusterPlan)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StorageClusterSpec) DeepCopyInto(out *StorageClusterSpec) {
 	*out = *in
@@ -534,13 +1010,30 @@ func (in *StorageClusterSpec) DeepCopyInto(out *StorageClusterSpec) {
 		*out = new(rook_iov1.NetworkSpec)
 		(*in).DeepCopyInto(*out)
 	}
-	out.ManagedResources = in.ManagedResources
+	in.ManagedResources.DeepCopyInto(&out.ManagedResources)
+	if in.CrushHierarchy != nil {
+		in, out := &in.CrushHierarchy, &out.CrushHierarchy
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.NodeTopologies != nil {
 		in, out := &in.NodeTopologies, &out.NodeTopologies
 		*out = new(NodeTopologyMap)
 		(*in).DeepCopyInto(*out)
 	}
 	in.Arbiter.DeepCopyInto(&out.Arbiter)
+	if in.CephConfig != nil {
+		in, out := &in.CephConfig, &out.CephConfig
+		*out = new(CephConfigSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tenants != nil {
+		in, out := &in.Tenants, &out.Tenants
+		*out = make([]TenantSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageClusterSpec.
@@ -563,6 +1056,23 @@ func (in *StorageClusterStatus) DeepCopyInto(out *StorageClusterStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Components != nil {
+		in, out := &in.Components, &out.Components
+		*out = make([]ComponentStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ResourceManagers != nil {
+		in, out := &in.ResourceManagers, &out.ResourceManagers
+		*out = make([]ResourceManagerStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Plan != nil {
+		in, out := &in.Plan, &out.Plan
+		*out = new(StorageClusterPlan)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.RelatedObjects != nil {
 		in, out := &in.RelatedObjects, &out.RelatedObjects
 		*out = make([]corev1.ObjectReference, len(*in))
@@ -578,6 +1088,43 @@ func (in *StorageClusterStatus) DeepCopyInto(out *StorageClusterStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.FilesystemDataPools != nil {
+		in, out := &in.FilesystemDataPools, &out.FilesystemDataPools
+		*out = make([]FilesystemDataPoolsStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.KMS != nil {
+		in, out := &in.KMS, &out.KMS
+		*out = new(KMSStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExternalCluster != nil {
+		in, out := &in.ExternalCluster, &out.ExternalCluster
+		*out = new(ExternalClusterStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Uninstall != nil {
+		in, out := &in.Uninstall, &out.Uninstall
+		*out = new(UninstallStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RetainedData != nil {
+		in, out := &in.RetainedData, &out.RetainedData
+		*out = new(RetainedDataStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Topology != nil {
+		in, out := &in.Topology, &out.Topology
+		*out = new(TopologyStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ArbiterElection != nil {
+		in, out := &in.ArbiterElection, &out.ArbiterElection
+		*out = new(ArbiterElectionStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	in.Images.DeepCopyInto(&out.Images)
 }
 
@@ -597,7 +1144,7 @@ func (in *StorageDeviceSet) DeepCopyInto(out *StorageDeviceSet) {
 	in.Resources.DeepCopyInto(&out.Resources)
 	in.PreparePlacement.DeepCopyInto(&out.PreparePlacement)
 	in.Placement.DeepCopyInto(&out.Placement)
-	out.Config = in.Config
+	in.Config.DeepCopyInto(&out.Config)
 	in.DataPVCTemplate.DeepCopyInto(&out.DataPVCTemplate)
 	if in.MetadataPVCTemplate != nil {
 		in, out := &in.MetadataPVCTemplate, &out.MetadataPVCTemplate
@@ -624,6 +1171,31 @@ func (in *StorageDeviceSet) DeepCopy() *StorageDeviceSet {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *StorageDeviceSetConfig) DeepCopyInto(out *StorageDeviceSetConfig) {
 	*out = *in
+	if in.EncryptedDevice != nil {
+		in, out := &in.EncryptedDevice, &out.EncryptedDevice
+		*out = new(bool)
+		**out = **in
+	}
+	if in.BlueStoreCacheSize != nil {
+		in, out := &in.BlueStoreCacheSize, &out.BlueStoreCacheSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.BlueStoreCacheSizeHDD != nil {
+		in, out := &in.BlueStoreCacheSizeHDD, &out.BlueStoreCacheSizeHDD
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.BlueStoreCacheSizeSSD != nil {
+		in, out := &in.BlueStoreCacheSizeSSD, &out.BlueStoreCacheSizeSSD
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.OSDMemoryTarget != nil {
+		in, out := &in.OSDMemoryTarget, &out.OSDMemoryTarget
+		x := (*in).DeepCopy()
+		*out = &x
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageDeviceSetConfig.
@@ -654,3 +1226,207 @@ func (in TopologyLabelValues) DeepCopy() TopologyLabelValues {
 	in.DeepCopyInto(out)
 	return *out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenantQuotaSpec) DeepCopyInto(out *TenantQuotaSpec) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.PersistentVolumeClaims != nil {
+		in, out := &in.PersistentVolumeClaims, &out.PersistentVolumeClaims
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TenantQuotaSpec.
+func (in *TenantQuotaSpec) DeepCopy() *TenantQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TenantQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TenantSpec) DeepCopyInto(out *TenantSpec) {
+	*out = *in
+	if in.Quota != nil {
+		in, out := &in.Quota, &out.Quota
+		*out = new(TenantQuotaSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TenantSpec.
+func (in *TenantSpec) DeepCopy() *TenantSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TenantSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TopologyDrift) DeepCopyInto(out *TopologyDrift) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TopologyDrift.
+func (in *TopologyDrift) DeepCopy() *TopologyDrift {
+	if in == nil {
+		return nil
+	}
+	out := new(TopologyDrift)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TopologyStatus) DeepCopyInto(out *TopologyStatus) {
+	*out = *in
+	if in.Drifts != nil {
+		in, out := &in.Drifts, &out.Drifts
+		*out = make([]TopologyDrift, len(*in))
+		copy(*out, *in)
+	}
+	if in.FailureDomains != nil {
+		in, out := &in.FailureDomains, &out.FailureDomains
+		*out = make([]FailureDomainUsage, len(*in))
+		copy(*out, *in)
+	}
+	if in.Migration != nil {
+		in, out := &in.Migration, &out.Migration
+		*out = new(FailureDomainMigration)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TopologyStatus.
+func (in *TopologyStatus) DeepCopy() *TopologyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TopologyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UninstallAffectedResource) DeepCopyInto(out *UninstallAffectedResource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UninstallAffectedResource.
+func (in *UninstallAffectedResource) DeepCopy() *UninstallAffectedResource {
+	if in == nil {
+		return nil
+	}
+	out := new(UninstallAffectedResource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UninstallNamespaceReport) DeepCopyInto(out *UninstallNamespaceReport) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]UninstallAffectedResource, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UninstallNamespaceReport.
+func (in *UninstallNamespaceReport) DeepCopy() *UninstallNamespaceReport {
+	if in == nil {
+		return nil
+	}
+	out := new(UninstallNamespaceReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UninstallReport) DeepCopyInto(out *UninstallReport) {
+	*out = *in
+	in.GeneratedTime.DeepCopyInto(&out.GeneratedTime)
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]UninstallNamespaceReport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Unavailable != nil {
+		in, out := &in.Unavailable, &out.Unavailable
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UninstallReport.
+func (in *UninstallReport) DeepCopy() *UninstallReport {
+	if in == nil {
+		return nil
+	}
+	out := new(UninstallReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UninstallStatus) DeepCopyInto(out *UninstallStatus) {
+	*out = *in
+	if in.Report != nil {
+		in, out := &in.Report, &out.Report
+		*out = new(UninstallReport)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]UninstallStep, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UninstallStatus.
+func (in *UninstallStatus) DeepCopy() *UninstallStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(UninstallStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UninstallStep) DeepCopyInto(out *UninstallStep) {
+	*out = *in
+	if in.LastTransitionTime != nil {
+		in, out := &in.LastTransitionTime, &out.LastTransitionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UninstallStep.
+func (in *UninstallStep) DeepCopy() *UninstallStep {
+	if in == nil {
+		return nil
+	}
+	out := new(UninstallStep)
+	in.DeepCopyInto(out)
+	return out
+}
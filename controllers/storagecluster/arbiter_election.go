@@ -0,0 +1,201 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// masterNodeRoleLabels are the labels of the master nodes
+var masterNodeRoleLabels = []string{"node-role.kubernetes.io/master", "node-role.kubernetes.io/control-plane"}
+
+// getArbiterLocation returns the zone of the arbiter, set in the spec or
+// elected by the ocs-operator
+func getArbiterLocation(sc *ocsv1.StorageCluster) string {
+	if sc.Spec.NodeTopologies != nil && sc.Spec.NodeTopologies.ArbiterLocation != "" {
+		return sc.Spec.NodeTopologies.ArbiterLocation
+	}
+	if sc.Status.ArbiterElection != nil {
+		return sc.Status.ArbiterElection.Zone
+	}
+	return ""
+}
+
+// reconcileArbiterZone records the zone of the arbiter in the status of an
+// arbiter StorageCluster, and elects it when the spec doesn't set it. Once
+// the mons are placed the zone is kept, as Ceph can't move the arbiter to
+// another zone of a stretch cluster.
+func (r *StorageClusterReconciler) reconcileArbiterZone(sc *ocsv1.StorageCluster) error {
+	if !arbiterEnabled(sc) {
+		sc.Status.ArbiterElection = nil
+		return nil
+	}
+
+	previous := sc.Status.ArbiterElection
+	if previous == nil || !previous.MonsPlaced {
+		election, err := r.getArbiterElection(sc, previous)
+		if err != nil {
+			return err
+		}
+		if previous == nil || previous.Zone != election.Zone {
+			r.Log.Info("Arbiter zone chosen.", "Zone", election.Zone, "Reason", election.Reason, "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+			r.recorder.Report(sc, corev1.EventTypeNormal, statusutil.EventReasonArbiterZoneElected, election.Message)
+		}
+		sc.Status.ArbiterElection = election
+	}
+
+	if !sc.Status.ArbiterElection.MonsPlaced {
+		monsPlaced, err := r.areMonsPlaced(sc)
+		if err != nil {
+			return err
+		}
+		sc.Status.ArbiterElection.MonsPlaced = monsPlaced
+	}
+	if sc.Status.NodeTopologies != nil {
+		sc.Status.NodeTopologies.ArbiterLocation = sc.Status.ArbiterElection.Zone
+	}
+	return nil
+}
+
+// getArbiterElection returns the zone of the arbiter set in the spec, or the
+// one elected before, or elects one
+func (r *StorageClusterReconciler) getArbiterElection(sc *ocsv1.StorageCluster, previous *ocsv1.ArbiterElectionStatus) (*ocsv1.ArbiterElectionStatus, error) {
+	now := metav1.Now()
+	if sc.Spec.NodeTopologies != nil && sc.Spec.NodeTopologies.ArbiterLocation != "" {
+		zone := sc.Spec.NodeTopologies.ArbiterLocation
+		if previous != nil && previous.Reason == ocsv1.ArbiterZoneSpecified && previous.Zone == zone {
+			return previous, nil
+		}
+		return &ocsv1.ArbiterElectionStatus{
+			Zone:         zone,
+			Reason:       ocsv1.ArbiterZoneSpecified,
+			Message:      fmt.Sprintf("Zone %s is set as the arbiterLocation in the spec", zone),
+			ElectionTime: &now,
+		}, nil
+	}
+	if previous != nil && previous.Reason != ocsv1.ArbiterZoneSpecified {
+		return previous, nil
+	}
+
+	nodes := &corev1.NodeList{}
+	if err := r.Client.List(context.TODO(), nodes); err != nil {
+		return nil, fmt.Errorf("failed to list the nodes: %v", err)
+	}
+	storageNodes, err := r.getStorageClusterEligibleNodes(sc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the storage nodes: %v", err)
+	}
+	zoneKey := corev1.LabelZoneFailureDomainStable
+	if sc.Status.NodeTopologies != nil {
+		if key, _ := sc.Status.NodeTopologies.GetKeyValues("zone"); key != "zone" {
+			zoneKey = key
+		}
+	}
+	election, err := electArbiterZone(nodes, storageNodes, zoneKey)
+	if err != nil {
+		return nil, err
+	}
+	election.ElectionTime = &now
+	return election, nil
+}
+
+// electArbiterZone elects the zone of the arbiter: a zone which only holds
+// master nodes, or else the zone with the fewest storage nodes. The data is
+// stretched across the other zones, so at least two of them must have
+// storage nodes. The ties are broken by the name of the zones.
+func electArbiterZone(nodes, storageNodes *corev1.NodeList, zoneKey string) (*ocsv1.ArbiterElectionStatus, error) {
+	storageNodeNames := map[string]bool{}
+	for _, node := range storageNodes.Items {
+		storageNodeNames[node.Name] = true
+	}
+	storageNodesPerZone := map[string]int{}
+	masterOnlyZones := map[string]bool{}
+	for _, node := range nodes.Items {
+		zone, found := node.Labels[zoneKey]
+		if !found {
+			continue
+		}
+		if _, seen := masterOnlyZones[zone]; !seen {
+			masterOnlyZones[zone] = true
+		}
+		if storageNodeNames[node.Name] {
+			storageNodesPerZone[zone]++
+			masterOnlyZones[zone] = false
+		} else if !isMasterNode(node) {
+			masterOnlyZones[zone] = false
+		}
+	}
+
+	zones := make([]string, 0, len(masterOnlyZones))
+	for zone := range masterOnlyZones {
+		zones = append(zones, zone)
+	}
+	sort.Slice(zones, func(i, j int) bool {
+		if masterOnlyZones[zones[i]] != masterOnlyZones[zones[j]] {
+			return masterOnlyZones[zones[i]]
+		}
+		if storageNodesPerZone[zones[i]] != storageNodesPerZone[zones[j]] {
+			return storageNodesPerZone[zones[i]] < storageNodesPerZone[zones[j]]
+		}
+		return zones[i] < zones[j]
+	})
+
+	for _, zone := range zones {
+		var dataZones []string
+		for _, other := range zones {
+			if other != zone && storageNodesPerZone[other] > 0 {
+				dataZones = append(dataZones, fmt.Sprintf("%s (%d)", other, storageNodesPerZone[other]))
+			}
+		}
+		if len(dataZones) < 2 {
+			continue
+		}
+		sort.Strings(dataZones)
+		if masterOnlyZones[zone] {
+			return &ocsv1.ArbiterElectionStatus{
+				Zone:   zone,
+				Reason: ocsv1.ArbiterZoneMasterNodesOnly,
+				Message: fmt.Sprintf("Zone %s only holds master nodes, the data is stretched across the zones with storage nodes %s",
+					zone, strings.Join(dataZones, ", ")),
+			}, nil
+		}
+		return &ocsv1.ArbiterElectionStatus{
+			Zone:   zone,
+			Reason: ocsv1.ArbiterZoneFewestStorageNodes,
+			Message: fmt.Sprintf("Zone %s has the fewest storage nodes (%d), the data is stretched across the zones with storage nodes %s",
+				zone, storageNodesPerZone[zone], strings.Join(dataZones, ", ")),
+		}, nil
+	}
+	return nil, fmt.Errorf("failed to elect the arbiter zone: the nodes are in %d zones of the %s label, at least 3 are needed with 2 of them holding storage nodes",
+		len(zones), zoneKey)
+}
+
+func isMasterNode(node corev1.Node) bool {
+	for _, label := range masterNodeRoleLabels {
+		if _, found := node.Labels[label]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// areMonsPlaced returns true once Rook has placed the mons of the CephCluster
+func (r *StorageClusterReconciler) areMonsPlaced(sc *ocsv1.StorageCluster) (bool, error) {
+	monEndpoints := &corev1.ConfigMap{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: rookMonEndpointsConfigMap, Namespace: sc.Namespace}, monEndpoints)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get the mon endpoints: %v", err)
+	}
+	return monEndpoints.Data["data"] != "", nil
+}
@@ -0,0 +1,148 @@
+package storagecluster
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestElectArbiterZone(t *testing.T) {
+	cases := []struct {
+		label          string
+		nodes          []*corev1.Node
+		expectedZone   string
+		expectedReason api.ArbiterElectionReason
+	}{
+		{
+			label: "a zone with only master nodes",
+			nodes: []*corev1.Node{
+				newTestNode("master-a", map[string]string{corev1.LabelZoneFailureDomainStable: "a", "node-role.kubernetes.io/master": ""}),
+				newTestNode("master-b", map[string]string{corev1.LabelZoneFailureDomainStable: "b", "node-role.kubernetes.io/master": ""}),
+				newTestNode("master-c", map[string]string{corev1.LabelZoneFailureDomainStable: "c", "node-role.kubernetes.io/master": ""}),
+				newTestNode("worker-a", map[string]string{corev1.LabelZoneFailureDomainStable: "a", defaults.NodeAffinityKey: ""}),
+				newTestNode("worker-b", map[string]string{corev1.LabelZoneFailureDomainStable: "b", defaults.NodeAffinityKey: ""}),
+			},
+			expectedZone:   "c",
+			expectedReason: api.ArbiterZoneMasterNodesOnly,
+		},
+		{
+			label: "the zone with the fewest storage nodes",
+			nodes: []*corev1.Node{
+				newTestNode("worker-a1", map[string]string{corev1.LabelZoneFailureDomainStable: "a", defaults.NodeAffinityKey: ""}),
+				newTestNode("worker-a2", map[string]string{corev1.LabelZoneFailureDomainStable: "a", defaults.NodeAffinityKey: ""}),
+				newTestNode("worker-b1", map[string]string{corev1.LabelZoneFailureDomainStable: "b", defaults.NodeAffinityKey: ""}),
+				newTestNode("worker-b2", map[string]string{corev1.LabelZoneFailureDomainStable: "b", defaults.NodeAffinityKey: ""}),
+				newTestNode("worker-c1", map[string]string{corev1.LabelZoneFailureDomainStable: "c", defaults.NodeAffinityKey: ""}),
+				newTestNode("master-c", map[string]string{corev1.LabelZoneFailureDomainStable: "c", "node-role.kubernetes.io/master": ""}),
+			},
+			expectedZone:   "c",
+			expectedReason: api.ArbiterZoneFewestStorageNodes,
+		},
+		{
+			label: "the first zone with the fewest storage nodes",
+			nodes: []*corev1.Node{
+				newTestNode("worker-a", map[string]string{corev1.LabelZoneFailureDomainStable: "a", defaults.NodeAffinityKey: ""}),
+				newTestNode("worker-b", map[string]string{corev1.LabelZoneFailureDomainStable: "b", defaults.NodeAffinityKey: ""}),
+				newTestNode("worker-c", map[string]string{corev1.LabelZoneFailureDomainStable: "c", defaults.NodeAffinityKey: ""}),
+			},
+			expectedZone:   "a",
+			expectedReason: api.ArbiterZoneFewestStorageNodes,
+		},
+		{
+			label: "two zones with storage nodes are left",
+			nodes: []*corev1.Node{
+				newTestNode("worker-a", map[string]string{corev1.LabelZoneFailureDomainStable: "a", defaults.NodeAffinityKey: ""}),
+				newTestNode("worker-b", map[string]string{corev1.LabelZoneFailureDomainStable: "b", defaults.NodeAffinityKey: ""}),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		nodes := &corev1.NodeList{}
+		storageNodes := &corev1.NodeList{}
+		for _, node := range c.nodes {
+			nodes.Items = append(nodes.Items, *node)
+			if !isMasterNode(*node) {
+				storageNodes.Items = append(storageNodes.Items, *node)
+			}
+		}
+		election, err := electArbiterZone(nodes, storageNodes, corev1.LabelZoneFailureDomainStable)
+		if c.expectedZone == "" {
+			assert.Errorf(t, err, "[%s]", c.label)
+			continue
+		}
+		if assert.NoErrorf(t, err, "[%s]", c.label) {
+			assert.Equalf(t, c.expectedZone, election.Zone, "[%s]", c.label)
+			assert.Equalf(t, c.expectedReason, election.Reason, "[%s]", c.label)
+			assert.NotEmptyf(t, election.Message, "[%s]", c.label)
+		}
+	}
+}
+
+func TestReconcileArbiterZone(t *testing.T) {
+	objs := []runtime.Object{
+		newTestNode("master-c", map[string]string{corev1.LabelZoneFailureDomainStable: "c", "node-role.kubernetes.io/master": ""}),
+		newTestNode("worker-a", map[string]string{corev1.LabelZoneFailureDomainStable: "a", defaults.NodeAffinityKey: ""}),
+		newTestNode("worker-b", map[string]string{corev1.LabelZoneFailureDomainStable: "b", defaults.NodeAffinityKey: ""}),
+	}
+	reconciler := createFakeStorageClusterReconciler(t, objs...)
+	sc := &api.StorageCluster{ObjectMeta: metav1.ObjectMeta{Name: "ocsinit", Namespace: "openshift-storage"}}
+	sc.Spec.Arbiter.Enable = true
+	assert.NoError(t, validateArbiterSpec(sc, reconciler.Log))
+
+	// the zone with only the master node is elected
+	assert.NoError(t, reconciler.reconcileArbiterZone(sc))
+	election := sc.Status.ArbiterElection
+	if assert.NotNil(t, election) {
+		assert.Equal(t, "c", election.Zone)
+		assert.Equal(t, api.ArbiterZoneMasterNodesOnly, election.Reason)
+		assert.False(t, election.MonsPlaced)
+	}
+	assert.Equal(t, "c", getArbiterLocation(sc))
+	stretch := generateStretchClusterSpec(&api.StorageCluster{
+		Spec: sc.Spec,
+		Status: api.StorageClusterStatus{
+			ArbiterElection: election,
+			FailureDomain:   "zone",
+			NodeTopologies: &api.NodeTopologyMap{Labels: map[string]api.TopologyLabelValues{
+				corev1.LabelZoneFailureDomainStable: {"a", "b"},
+			}},
+		},
+	})
+	if assert.Len(t, stretch.Zones, 3) {
+		assert.Equal(t, api.TopologyLabelValues{"a", "b", "c"}, api.TopologyLabelValues{stretch.Zones[0].Name, stretch.Zones[1].Name, stretch.Zones[2].Name})
+		assert.True(t, stretch.Zones[2].Arbiter)
+	}
+
+	// the zone set in the spec is used until the mons are placed
+	sc.Spec.NodeTopologies = &api.NodeTopologyMap{ArbiterLocation: "b"}
+	assert.NoError(t, reconciler.reconcileArbiterZone(sc))
+	assert.Equal(t, "b", sc.Status.ArbiterElection.Zone)
+	assert.Equal(t, api.ArbiterZoneSpecified, sc.Status.ArbiterElection.Reason)
+	sc.Spec.NodeTopologies = nil
+	assert.NoError(t, reconciler.reconcileArbiterZone(sc))
+	assert.Equal(t, "c", sc.Status.ArbiterElection.Zone)
+
+	// then the zone is kept
+	monEndpoints := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: rookMonEndpointsConfigMap, Namespace: sc.Namespace},
+		Data:       map[string]string{"data": "a=10.0.0.1:6789,b=10.0.0.2:6789,c=10.0.0.3:6789"},
+	}
+	assert.NoError(t, reconciler.Client.Create(context.TODO(), monEndpoints))
+	assert.NoError(t, reconciler.reconcileArbiterZone(sc))
+	assert.True(t, sc.Status.ArbiterElection.MonsPlaced)
+	assert.NoError(t, reconciler.Client.Create(context.TODO(), newTestNode("master-d", map[string]string{corev1.LabelZoneFailureDomainStable: "d", "node-role.kubernetes.io/master": ""})))
+	assert.NoError(t, reconciler.reconcileArbiterZone(sc))
+	assert.Equal(t, "c", sc.Status.ArbiterElection.Zone)
+
+	sc.Spec.NodeTopologies = &api.NodeTopologyMap{ArbiterLocation: "c"}
+	assert.NoError(t, validateArbiterSpec(sc, reconciler.Log))
+	sc.Spec.NodeTopologies.ArbiterLocation = "d"
+	assert.EqualError(t, validateArbiterSpec(sc, reconciler.Log), "arbiterLocation can't be changed from c to d once the mons are placed")
+}
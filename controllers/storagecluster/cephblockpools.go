@@ -3,12 +3,14 @@ package storagecluster
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
@@ -31,6 +33,9 @@ func (r *StorageClusterReconciler) newCephBlockPoolInstances(initData *ocsv1.Sto
 			},
 		},
 	}
+	for _, pool := range initData.Spec.ManagedResources.CephBlockPools.AdditionalPools {
+		ret = append(ret, newAdditionalCephBlockPoolInstances(initData, pool)...)
+	}
 	for _, obj := range ret {
 		err := controllerutil.SetControllerReference(initData, obj, r.Scheme)
 		if err != nil {
@@ -41,8 +46,138 @@ func (r *StorageClusterReconciler) newCephBlockPoolInstances(initData *ocsv1.Sto
 	return ret, nil
 }
 
+// newAdditionalCephBlockPoolInstances returns the CephBlockPools of an
+// additional pool. An erasure coded pool comes with a replicated pool holding
+// the image metadata, which RBD can't store in an erasure coded pool.
+func newAdditionalCephBlockPoolInstances(initData *ocsv1.StorageCluster, pool ocsv1.AdditionalBlockPoolSpec) []*cephv1.CephBlockPool {
+	quotas := cephv1.QuotaSpec{}
+	if pool.Quotas != nil {
+		if pool.Quotas.MaxSize != nil {
+			maxSize := pool.Quotas.MaxSize.String()
+			quotas.MaxSize = &maxSize
+		}
+		if pool.Quotas.MaxObjects != nil {
+			maxObjects := *pool.Quotas.MaxObjects
+			quotas.MaxObjects = &maxObjects
+		}
+	}
+
+	replicated := generateCephAdditionalReplicatedSpec(initData, pool.Replica)
+	dataPool := &cephv1.CephBlockPool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateNameForAdditionalCephBlockPool(initData, pool.Name),
+			Namespace: initData.Namespace,
+		},
+		Spec: cephv1.PoolSpec{
+			FailureDomain:   getFailureDomain(initData),
+			DeviceClass:     pool.DeviceClass,
+			CompressionMode: pool.CompressionMode,
+			Quotas:          quotas,
+		},
+	}
+	if pool.ErasureCoded == nil {
+		dataPool.Spec.Replicated = replicated
+		dataPool.Spec.EnableRBDStats = true
+		return []*cephv1.CephBlockPool{dataPool}
+	}
+
+	dataPool.Spec.ErasureCoded = cephv1.ErasureCodedSpec{
+		DataChunks:   pool.ErasureCoded.DataChunks,
+		CodingChunks: pool.ErasureCoded.CodingChunks,
+	}
+	metadataPool := &cephv1.CephBlockPool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateNameForAdditionalCephBlockPoolMetadata(initData, pool.Name),
+			Namespace: initData.Namespace,
+		},
+		Spec: cephv1.PoolSpec{
+			FailureDomain:  getFailureDomain(initData),
+			DeviceClass:    pool.DeviceClass,
+			Replicated:     replicated,
+			EnableRBDStats: true,
+		},
+	}
+	return []*cephv1.CephBlockPool{metadataPool, dataPool}
+}
+
+// validateAdditionalBlockPools checks that the additional pools can be created
+// next to each other and to the default CephBlockPool
+func validateAdditionalBlockPools(sc *ocsv1.StorageCluster) error {
+	pools := sc.Spec.ManagedResources.CephBlockPools.AdditionalPools
+	names := map[string]bool{}
+	for _, pool := range pools {
+		if errs := validation.IsDNS1123Label(pool.Name); len(errs) > 0 {
+			return fmt.Errorf("failed to validate additional CephBlockPool %q: %s", pool.Name, strings.Join(errs, ", "))
+		}
+		// the StorageClass of the pool would be the thick provisioned or
+		// the encrypted one
+		if pool.Name == "thick" || pool.Name == "encrypted" {
+			return fmt.Errorf("failed to validate additional CephBlockPool %q: the name is reserved", pool.Name)
+		}
+		if strings.HasPrefix(pool.Name, tenantStorageClassPrefix) {
+			return fmt.Errorf("failed to validate additional CephBlockPool %q: the %s prefix is reserved for the StorageClasses of the tenants",
+				pool.Name, tenantStorageClassPrefix)
+		}
+		if names[pool.Name] {
+			return fmt.Errorf("failed to validate additional CephBlockPool %q: the name is used by another pool", pool.Name)
+		}
+		names[pool.Name] = true
+
+		if err := validatePoolOptions(sc, pool.Replica, pool.CompressionMode); err != nil {
+			return fmt.Errorf("failed to validate additional CephBlockPool %q: %v", pool.Name, err)
+		}
+		if pool.ErasureCoded != nil {
+			if pool.Replica != 0 {
+				return fmt.Errorf("failed to validate additional CephBlockPool %q: replica and erasureCoded are mutually exclusive", pool.Name)
+			}
+			if pool.ErasureCoded.DataChunks < 2 || pool.ErasureCoded.CodingChunks < 1 {
+				return fmt.Errorf("failed to validate additional CephBlockPool %q: erasureCoded needs at least 2 dataChunks and 1 codingChunks", pool.Name)
+			}
+			if arbiterEnabled(sc) {
+				return fmt.Errorf("failed to validate additional CephBlockPool %q: pools of an arbiter cluster can't be erasure coded", pool.Name)
+			}
+			// every chunk goes to its own failure domain. The failure domains
+			// are only known once the nodes are labeled, the pool stays
+			// unclean until there are enough of them otherwise.
+			chunks := pool.ErasureCoded.DataChunks + pool.ErasureCoded.CodingChunks
+			if found := len(sc.Status.FailureDomainValues); found > 0 && int(chunks) > found {
+				return fmt.Errorf("failed to validate additional CephBlockPool %q: erasureCoded needs %d failure domains, found %d", pool.Name, chunks, found)
+			}
+		}
+		if pool.Quotas != nil && pool.Quotas.MaxSize != nil && pool.Quotas.MaxSize.Sign() < 0 {
+			return fmt.Errorf("failed to validate additional CephBlockPool %q: quotas.maxSize must not be negative", pool.Name)
+		}
+	}
+
+	for _, pool := range pools {
+		if pool.ErasureCoded != nil && names[pool.Name+"-metadata"] {
+			return fmt.Errorf("failed to validate additional CephBlockPool %q: the name is used by the metadata pool of %q", pool.Name+"-metadata", pool.Name)
+		}
+	}
+	return nil
+}
+
+// validatePoolOptions checks the replica and the compression mode of a
+// user-defined pool, a zero replica standing for the default one
+func validatePoolOptions(sc *ocsv1.StorageCluster, replica int, compressionMode string) error {
+	switch compressionMode {
+	case "", "none", "passive", "aggressive", "force":
+	default:
+		return fmt.Errorf("invalid compressionMode %q", compressionMode)
+	}
+	if replica < 0 || replica == 1 {
+		return fmt.Errorf("replica must be at least 2, got %d", replica)
+	}
+	// the replicas of a stretched cluster are spread over its two data zones
+	if arbiterEnabled(sc) && replica != 0 {
+		return fmt.Errorf("pools of an arbiter cluster must use the default replica")
+	}
+	return nil
+}
+
 // ensureCreated ensures that cephBlockPool resources exist in the desired
-// state.
+// state. The CephBlockPools of a pool removed from the additional pools are
+// kept on purpose, deleting them would delete the data of their volumes.
 func (obj *ocsCephBlockPools) ensureCreated(r *StorageClusterReconciler, instance *ocsv1.StorageCluster) error {
 	reconcileStrategy := ReconcileStrategy(instance.Spec.ManagedResources.CephBlockPools.ReconcileStrategy)
 	if reconcileStrategy == ReconcileStrategyIgnore {
@@ -60,7 +195,7 @@ func (obj *ocsCephBlockPools) ensureCreated(r *StorageClusterReconciler, instanc
 		switch {
 		case err == nil:
 			if reconcileStrategy == ReconcileStrategyInit {
-				return nil
+				continue
 			}
 			if existing.DeletionTimestamp != nil {
 				r.Log.Info("Unable to restore CephBlockPool because it is marked for deletion.", "CephBlockPool", klog.KRef(existing.Namespace, existing.Name))
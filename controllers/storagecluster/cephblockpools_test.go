@@ -6,6 +6,7 @@ import (
 
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -56,3 +57,160 @@ func assertCephBlockPools(t *testing.T, reconciler StorageClusterReconciler, cr
 	assert.Equal(t, expectedCbp[0].ObjectMeta.Name, actualCbp.ObjectMeta.Name)
 	assert.Equal(t, expectedCbp[0].Spec, actualCbp.Spec)
 }
+
+func TestAdditionalCephBlockPools(t *testing.T) {
+	maxObjects := uint64(1000)
+	maxSize := resource.MustParse("100Gi")
+	sc := createDefaultStorageCluster()
+	sc.Spec.ManagedResources.CephBlockPools.AdditionalPools = []api.AdditionalBlockPoolSpec{
+		{
+			Name:            "gold",
+			DeviceClass:     "ssd",
+			CompressionMode: "aggressive",
+			Quotas:          &api.PoolQuotaSpec{MaxSize: &maxSize, MaxObjects: &maxObjects},
+		},
+		{
+			Name:                 "bronze",
+			DeviceClass:          "hdd",
+			ErasureCoded:         &api.ErasureCodedPoolSpec{DataChunks: 2, CodingChunks: 1},
+			DisableSnapshotClass: true,
+		},
+	}
+	reconciler := createFakeStorageClusterReconciler(t)
+
+	cbps, err := reconciler.newCephBlockPoolInstances(sc)
+	assert.NoError(t, err)
+	assert.Len(t, cbps, 4)
+
+	gold := cbps[1]
+	assert.Equal(t, "ocsinit-cephblockpool-gold", gold.Name)
+	assert.Len(t, gold.OwnerReferences, 1)
+	assert.Equal(t, "ssd", gold.Spec.DeviceClass)
+	assert.Equal(t, "aggressive", gold.Spec.CompressionMode)
+	assert.Equal(t, uint(3), gold.Spec.Replicated.Size)
+	assert.Zero(t, gold.Spec.Replicated.TargetSizeRatio)
+	assert.Equal(t, "100Gi", *gold.Spec.Quotas.MaxSize)
+	assert.Equal(t, maxObjects, *gold.Spec.Quotas.MaxObjects)
+
+	bronzeMetadata, bronze := cbps[2], cbps[3]
+	assert.Equal(t, "ocsinit-cephblockpool-bronze-metadata", bronzeMetadata.Name)
+	assert.Equal(t, uint(3), bronzeMetadata.Spec.Replicated.Size)
+	assert.Equal(t, "hdd", bronzeMetadata.Spec.DeviceClass)
+	assert.Equal(t, "ocsinit-cephblockpool-bronze", bronze.Name)
+	assert.Equal(t, uint(0), bronze.Spec.Replicated.Size)
+	assert.Equal(t, uint(2), bronze.Spec.ErasureCoded.DataChunks)
+	assert.Equal(t, uint(1), bronze.Spec.ErasureCoded.CodingChunks)
+
+	sccs, err := reconciler.newStorageClassConfigurations(sc)
+	assert.NoError(t, err)
+	parameters := map[string]map[string]string{}
+	for _, scc := range sccs {
+		parameters[scc.storageClass.Name] = scc.storageClass.Parameters
+	}
+	assert.Equal(t, "ocsinit-cephblockpool-gold", parameters["ocsinit-ceph-rbd-gold"]["pool"])
+	assert.NotContains(t, parameters["ocsinit-ceph-rbd-gold"], "dataPool")
+	assert.Equal(t, "ocsinit-cephblockpool-bronze-metadata", parameters["ocsinit-ceph-rbd-bronze"]["pool"])
+	assert.Equal(t, "ocsinit-cephblockpool-bronze", parameters["ocsinit-ceph-rbd-bronze"]["dataPool"])
+
+	disabled := map[string]bool{}
+	for _, vscc := range newSnapshotClassConfigurations(sc) {
+		disabled[vscc.snapshotClass.Name] = vscc.disable
+	}
+	assert.Contains(t, disabled, "ocsinit-rbdplugin-gold-snapclass")
+	assert.False(t, disabled["ocsinit-rbdplugin-gold-snapclass"])
+	assert.True(t, disabled["ocsinit-rbdplugin-bronze-snapclass"])
+}
+
+func TestValidateAdditionalBlockPools(t *testing.T) {
+	negativeSize := resource.MustParse("-1Gi")
+	cases := []struct {
+		label   string
+		pools   []api.AdditionalBlockPoolSpec
+		arbiter bool
+		domains []string
+		isValid bool
+	}{
+		{
+			label:   "Case 1: replicated and erasure coded pools",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "gold", Replica: 3}, {Name: "bronze", ErasureCoded: &api.ErasureCodedPoolSpec{DataChunks: 4, CodingChunks: 2}}},
+			isValid: true,
+		},
+		{
+			label:   "Case 2: duplicated names",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "gold"}, {Name: "gold"}},
+			isValid: false,
+		},
+		{
+			label:   "Case 3: replica and erasure coding",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "gold", Replica: 2, ErasureCoded: &api.ErasureCodedPoolSpec{DataChunks: 2, CodingChunks: 1}}},
+			isValid: false,
+		},
+		{
+			label:   "Case 4: too few data chunks",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "bronze", ErasureCoded: &api.ErasureCodedPoolSpec{DataChunks: 1, CodingChunks: 1}}},
+			isValid: false,
+		},
+		{
+			label:   "Case 5: invalid compression mode",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "gold", CompressionMode: "zstd"}},
+			isValid: false,
+		},
+		{
+			label:   "Case 6: name of a metadata pool",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "bronze", ErasureCoded: &api.ErasureCodedPoolSpec{DataChunks: 2, CodingChunks: 1}}, {Name: "bronze-metadata"}},
+			isValid: false,
+		},
+		{
+			label:   "Case 7: reserved name",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "thick"}},
+			isValid: false,
+		},
+		{
+			label:   "Case 8: negative quota",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "gold", Quotas: &api.PoolQuotaSpec{MaxSize: &negativeSize}}},
+			isValid: false,
+		},
+		{
+			label:   "Case 9: custom replica on an arbiter cluster",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "gold", Replica: 2}},
+			arbiter: true,
+			isValid: false,
+		},
+		{
+			label:   "Case 10: default replica on an arbiter cluster",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "gold", DeviceClass: "ssd"}},
+			arbiter: true,
+			isValid: true,
+		},
+		{
+			label:   "Case 11: erasure coding wider than the failure domains",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "bronze", ErasureCoded: &api.ErasureCodedPoolSpec{DataChunks: 4, CodingChunks: 2}}},
+			domains: []string{"rack0", "rack1", "rack2"},
+			isValid: false,
+		},
+		{
+			label:   "Case 12: erasure coding fitting the failure domains",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "bronze", ErasureCoded: &api.ErasureCodedPoolSpec{DataChunks: 2, CodingChunks: 1}}},
+			domains: []string{"rack0", "rack1", "rack2"},
+			isValid: true,
+		},
+		{
+			label:   "Case 13: prefix of the tenant StorageClasses",
+			pools:   []api.AdditionalBlockPoolSpec{{Name: "tenant-gold"}},
+			isValid: false,
+		},
+	}
+
+	for _, c := range cases {
+		sc := createDefaultStorageCluster()
+		sc.Spec.ManagedResources.CephBlockPools.AdditionalPools = c.pools
+		sc.Spec.Arbiter.Enable = c.arbiter
+		sc.Status.FailureDomainValues = c.domains
+		err := validateAdditionalBlockPools(sc)
+		if c.isValid {
+			assert.NoErrorf(t, err, "[%s]", c.label)
+		} else {
+			assert.Errorf(t, err, "[%s]", c.label)
+		}
+	}
+}
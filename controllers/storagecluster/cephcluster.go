@@ -3,6 +3,7 @@ package storagecluster
 import (
 	"context"
 	"fmt"
+	"math"
 	"os"
 	"reflect"
 	"strconv"
@@ -113,8 +114,9 @@ func (obj *ocsCephCluster) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.
 			return err
 		}
 		if kmsConfigMap != nil {
-			if err = reachKMSProvider(kmsConfigMap); err != nil {
-				r.Log.Error(err, "Address provided in KMS ConfigMap is not reachable.", "KMSConfigMap", klog.KRef(kmsConfigMap.Namespace, kmsConfigMap.Name))
+			// the KMS isn't called in dry-run mode
+			if err = validateKMSProvider(r.Client, kmsConfigMap, !r.dryRun); err != nil {
+				r.Log.Error(err, "Failed to validate the KMS provider of the KMS ConfigMap.", "KMSConfigMap", klog.KRef(kmsConfigMap.Namespace, kmsConfigMap.Name))
 				return err
 			}
 		}
@@ -154,7 +156,7 @@ func (obj *ocsCephCluster) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.
 			// Assuming progress when ceph cluster CR is created.
 			reason := "CephClusterStatus"
 			message := "CephCluster resource is not reporting status"
-			statusutil.MapCephClusterNoConditions(&r.conditions, reason, message)
+			statusutil.MapCephClusterNoConditions(r.conditions.For(statusutil.ComponentCephCluster), reason, message)
 			return nil
 		}
 		r.Log.Error(err, "Unable to fetch CephCluster.", "CephCluster", klog.KRef(cephCluster.Namespace, cephCluster.Name))
@@ -182,13 +184,13 @@ func (obj *ocsCephCluster) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.
 		// What does this mean to OCS status? Assuming progress.
 		reason := "CephClusterStatus"
 		message := "CephCluster resource is not reporting status"
-		statusutil.MapCephClusterNoConditions(&r.conditions, reason, message)
+		statusutil.MapCephClusterNoConditions(r.conditions.For(statusutil.ComponentCephCluster), reason, message)
 	} else {
 		// Interpret CephCluster status and set any negative conditions
 		if sc.Spec.ExternalStorage.Enable {
-			statusutil.MapExternalCephClusterNegativeConditions(&r.conditions, found)
+			statusutil.MapExternalCephClusterNegativeConditions(r.conditions.For(statusutil.ComponentCephCluster), found)
 		} else {
-			statusutil.MapCephClusterNegativeConditions(&r.conditions, found)
+			statusutil.MapCephClusterNegativeConditions(r.conditions.For(statusutil.ComponentCephCluster), found)
 		}
 	}
 
@@ -365,8 +367,7 @@ func newCephCluster(sc *ocsv1.StorageCluster, cephImage string, nodeCount int, s
 	}
 	// if kmsConfig is not 'nil', add the KMS details to CephCluster spec
 	if kmsConfigMap != nil {
-		cephCluster.Spec.Security.KeyManagementService.ConnectionDetails = kmsConfigMap.Data
-		cephCluster.Spec.Security.KeyManagementService.TokenSecretName = KMSTokenSecretName
+		cephCluster.Spec.Security.KeyManagementService = getCephKMSSpec(kmsConfigMap)
 	}
 	return cephCluster
 }
@@ -530,6 +531,9 @@ func newStorageClassDeviceSets(sc *ocsv1.StorageCluster, serverVersion *version.
 		if resources.Requests == nil && resources.Limits == nil {
 			resources = defaults.DaemonResources["osd"]
 		}
+		if ds.Config.OSDMemoryTarget != nil {
+			resources = newOSDMemoryTargetResources(sc, resources, *ds.Config.OSDMemoryTarget)
+		}
 
 		portable := ds.Portable
 
@@ -554,7 +558,7 @@ func newStorageClassDeviceSets(sc *ocsv1.StorageCluster, serverVersion *version.
 			}
 
 			if topologyMap != nil {
-				topologyKey, topologyKeyValues = topologyMap.GetKeyValues(topologyKey)
+				topologyKey, topologyKeyValues = getFailureDomainKeyValues(topologyMap, topologyKey)
 			}
 		}
 
@@ -658,6 +662,8 @@ func newStorageClassDeviceSets(sc *ocsv1.StorageCluster, serverVersion *version.
 			}
 			ds.DataPVCTemplate.Annotations = annotations
 
+			encrypted := isDeviceSetEncrypted(sc, ds)
+
 			set := rook.StorageClassDeviceSet{
 				Name:                 fmt.Sprintf("%s-%d", ds.Name, i),
 				Count:                count,
@@ -669,7 +675,7 @@ func newStorageClassDeviceSets(sc *ocsv1.StorageCluster, serverVersion *version.
 				Portable:             portable,
 				TuneSlowDeviceClass:  ds.Config.TuneSlowDeviceClass,
 				TuneFastDeviceClass:  ds.Config.TuneFastDeviceClass,
-				Encrypted:            sc.Spec.Encryption.Enable,
+				Encrypted:            encrypted,
 			}
 
 			if ds.MetadataPVCTemplate != nil {
@@ -688,6 +694,23 @@ func newStorageClassDeviceSets(sc *ocsv1.StorageCluster, serverVersion *version.
 	return storageClassDeviceSets
 }
 
+// newOSDMemoryTargetResources returns the OSD resources with the memory limit
+// and request from which the OSDs derive the given osd_memory_target. Rook
+// ignores osd_memory_target in the config of a StorageClassDeviceSet.
+func newOSDMemoryTargetResources(sc *ocsv1.StorageCluster, resources corev1.ResourceRequirements, target resource.Quantity) corev1.ResourceRequirements {
+	ret := resources.DeepCopy()
+	memory := resource.NewQuantity(int64(math.Ceil(float64(target.Value())/getOSDMemoryLimitRatio(sc))), resource.BinarySI)
+	if ret.Limits == nil {
+		ret.Limits = corev1.ResourceList{}
+	}
+	if ret.Requests == nil {
+		ret.Requests = corev1.ResourceList{}
+	}
+	ret.Limits[corev1.ResourceMemory] = *memory
+	ret.Requests[corev1.ResourceMemory] = *memory
+	return *ret
+}
+
 func newCephDaemonResources(sc *ocsv1.StorageCluster) map[string]corev1.ResourceRequirements {
 
 	custom := sc.Spec.Resources
@@ -765,7 +788,7 @@ func generateStretchClusterSpec(sc *ocsv1.StorageCluster) *cephv1.StretchCluster
 	stretchClusterSpec.FailureDomainLabel, zones = sc.Status.NodeTopologies.GetKeyValues(getFailureDomain(sc))
 
 	for _, zone := range zones {
-		if zone == sc.Spec.NodeTopologies.ArbiterLocation {
+		if zone == getArbiterLocation(sc) {
 			continue
 		}
 		stretchClusterSpec.Zones = append(stretchClusterSpec.Zones, cephv1.StretchClusterZoneSpec{
@@ -775,7 +798,7 @@ func generateStretchClusterSpec(sc *ocsv1.StorageCluster) *cephv1.StretchCluster
 	}
 
 	arbiterZoneSpec := cephv1.StretchClusterZoneSpec{
-		Name:    sc.Spec.NodeTopologies.ArbiterLocation,
+		Name:    getArbiterLocation(sc),
 		Arbiter: true,
 	}
 	if sc.Spec.Arbiter.ArbiterMonPVCTemplate != nil {
@@ -3,6 +3,7 @@ package storagecluster
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/openshift/ocs-operator/controllers/defaults"
@@ -120,11 +121,12 @@ func TestEnsureCephCluster(t *testing.T) {
 			ocsutil.MapCephClusterNegativeConditions(&expectedConditions, expected)
 		}
 
-		assert.Len(t, reconciler.conditions, len(expectedConditions))
+		actualConditions := reconciler.conditions.Conditions()
+		assert.Len(t, actualConditions, len(expectedConditions))
 		for i, condition := range expectedConditions {
-			if i < len(reconciler.conditions) {
-				assert.Equal(t, condition.Type, reconciler.conditions[i].Type)
-				assert.Equal(t, condition.Status, reconciler.conditions[i].Status)
+			if i < len(actualConditions) {
+				assert.Equal(t, condition.Type, actualConditions[i].Type)
+				assert.Equal(t, condition.Status, actualConditions[i].Status)
 			}
 		}
 	}
@@ -451,12 +453,61 @@ func createDummyKMSConfigMap(kmsProvider, kmsAddr string) *corev1.ConfigMap {
 	cm.Name = KMSConfigMapName
 	cm.Data = make(map[string]string)
 	cm.Data["KMS_PROVIDER"] = kmsProvider
-	cm.Data[kmsProviderAddressKeyMap[kmsProvider]] = kmsAddr
+	cm.Data[vaultAddrKey] = kmsAddr
 	cm.Data["VAULT_BACKEND_PATH"] = "ocs"
 	cm.Data["VAULT_NAMESPACE"] = "my-ocs-namespace"
 	return cm
 }
 
+func createDummyKMSTokenSecret(token string) *corev1.Secret {
+	secret := &corev1.Secret{}
+	secret.Name = KMSTokenSecretName
+	secret.Data = map[string][]byte{"token": []byte(token)}
+	return secret
+}
+
+func TestStorageClassDeviceSetConfig(t *testing.T) {
+	encryptedDevice := false
+	osdMemoryTarget := resource.MustParse("4Gi")
+	bluestoreCacheSize := resource.MustParse("1Gi")
+
+	sc := &api.StorageCluster{}
+	sc.Spec.Encryption.Enable = true
+	sc.Spec.StorageDeviceSets = []api.StorageDeviceSet{*mockDeviceSets[0].DeepCopy(), *mockDeviceSets[0].DeepCopy()}
+	sc.Spec.StorageDeviceSets[1].Name = "mock-sds-tuned"
+	sc.Spec.StorageDeviceSets[1].Config = api.StorageDeviceSetConfig{
+		OSDsPerDevice:      2,
+		EncryptedDevice:    &encryptedDevice,
+		OSDMemoryTarget:    &osdMemoryTarget,
+		BlueStoreCacheSize: &bluestoreCacheSize,
+	}
+	serverVersion := &version.Info{
+		Major: "1",
+		Minor: "19",
+	}
+
+	actual := newStorageClassDeviceSets(sc, serverVersion)
+	for _, scds := range actual {
+		if strings.HasPrefix(scds.Name, "mock-sds-tuned-") {
+			assert.False(t, scds.Encrypted)
+			assert.Equal(t, map[string]string{
+				"osdsPerDevice":   "2",
+				"encryptedDevice": "false",
+			}, scds.Config)
+			// the OSDs take osd_memory_target_cgroup_limit_ratio of their
+			// memory limit as their memory target
+			assert.Equal(t, resource.MustParse("8Gi"), scds.Resources.Limits[corev1.ResourceMemory])
+			assert.Equal(t, resource.MustParse("8Gi"), scds.Resources.Requests[corev1.ResourceMemory])
+			assert.Equal(t, resource.MustParse("2"), scds.Resources.Limits[corev1.ResourceCPU])
+		} else {
+			// the other device sets are left untouched
+			assert.True(t, scds.Encrypted)
+			assert.Nil(t, scds.Config)
+			assert.Equal(t, defaults.DaemonResources["osd"], scds.Resources)
+		}
+	}
+}
+
 func TestKMSConfigChanges(t *testing.T) {
 	validKMSArgs := []struct {
 		testLabel       string
@@ -470,6 +521,7 @@ func TestKMSConfigChanges(t *testing.T) {
 		{testLabel: "case 3", kmsProvider: "newKMSProvider", kmsAddress: "http://127.0.0.1:1553"},
 		// invalid test cases, make sure label has a prefix 'invalid'
 		{testLabel: "case 4", kmsProvider: "vault", kmsAddress: "http://unearchable.url.location:3366", failureExpected: true},
+		{testLabel: "case 5", kmsProvider: "vault", kmsAddress: "", failureExpected: true},
 	}
 	for _, kmsArgs := range validKMSArgs {
 		assertCephClusterKMSConfiguration(t, kmsArgs)
@@ -483,21 +535,26 @@ func assertCephClusterKMSConfiguration(t *testing.T, kmsArgs struct {
 	failureExpected bool
 }) {
 	ctxTodo := context.TODO()
+	// don't start fake servers for invalid tests
+	if !kmsArgs.failureExpected && kmsArgs.kmsProvider == VaultKMSProvider {
+		vault := newFakeVaultServer(fakeVaultToken)
+		defer vault.Close()
+		kmsArgs.kmsAddress = vault.URL
+	}
 	kmsCM := createDummyKMSConfigMap(kmsArgs.kmsProvider, kmsArgs.kmsAddress)
 	reconciler := createFakeInitializationStorageClusterReconciler(t, &nbv1.NooBaa{})
 	if err := reconciler.Client.Create(ctxTodo, kmsCM); err != nil {
 		t.Errorf("Unable to create KMS configmap: %v", err)
 		t.FailNow()
 	}
+	if err := reconciler.Client.Create(ctxTodo, createDummyKMSTokenSecret(fakeVaultToken)); err != nil {
+		t.Errorf("Unable to create KMS token secret: %v", err)
+		t.FailNow()
+	}
 	// create a cephcluster CR and enable the KMS
 	cr := createDefaultStorageCluster()
 	cr.Spec.Encryption.KeyManagementService.Enable = true
 
-	// don't start dummy servers for invalid tests
-	if !kmsArgs.failureExpected {
-		startServerAt(kmsArgs.kmsAddress)
-	}
-
 	var obj ocsCephCluster
 
 	// have to initialize the image status,
@@ -0,0 +1,334 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	cephConfigSectionGlobal = "global"
+	cephConfigSectionMon    = "mon"
+	cephConfigSectionOSD    = "osd"
+	cephConfigSectionMDS    = "mds"
+	// the object gateways run as client.rgw.<name> daemons. The section
+	// doesn't apply to the other Ceph clients, such as the CSI drivers.
+	cephConfigSectionRGW = "client.rgw"
+)
+
+// cephConfigSections is the order in which the sections are rendered
+var cephConfigSections = []string{
+	cephConfigSectionGlobal,
+	cephConfigSectionMon,
+	cephConfigSectionOSD,
+	cephConfigSectionMDS,
+	cephConfigSectionRGW,
+}
+
+type cephConfigOption struct {
+	key   string
+	value string
+}
+
+// defaultCephConfig holds the Ceph configuration options that the
+// ocs-operator sets in the rook-config-override ConfigMap, by section. They
+// are rendered in this order, so that the ConfigMap of the existing clusters
+// is left untouched.
+var defaultCephConfig = map[string][]cephConfigOption{
+	cephConfigSectionGlobal: {
+		{"bdev_flock_retry", "20"},
+		{"mon_osd_full_ratio", ".85"},
+		{"mon_osd_backfillfull_ratio", ".8"},
+		{"mon_osd_nearfull_ratio", ".75"},
+		{"mon_max_pg_per_osd", "600"},
+	},
+	cephConfigSectionOSD: {
+		{"osd_memory_target_cgroup_limit_ratio", "0.5"},
+	},
+}
+
+// normalizeCephConfigKey returns the canonical form of a Ceph option name,
+// Ceph treats spaces, dashes and underscores the same way
+func normalizeCephConfigKey(key string) string {
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(strings.TrimSpace(key))
+}
+
+// getCephConfigSpecSections returns the options of the CephConfigSpec by
+// section of the Ceph configuration file
+func getCephConfigSpecSections(spec *ocsv1.CephConfigSpec) map[string]map[string]string {
+	if spec == nil {
+		return nil
+	}
+	return map[string]map[string]string{
+		cephConfigSectionGlobal: spec.Global,
+		cephConfigSectionMon:    spec.Mon,
+		cephConfigSectionOSD:    spec.OSD,
+		cephConfigSectionMDS:    spec.MDS,
+		cephConfigSectionRGW:    spec.RGW,
+	}
+}
+
+// getCephConfig returns the options of the StorageCluster CephConfig merged
+// over the default ones, by section
+func getCephConfig(sc *ocsv1.StorageCluster) map[string]map[string]string {
+	config := map[string]map[string]string{}
+	for section, options := range defaultCephConfig {
+		config[section] = map[string]string{}
+		for _, option := range options {
+			config[section][option.key] = option.value
+		}
+	}
+	for section, options := range getCephConfigSpecSections(sc.Spec.CephConfig) {
+		for key, value := range options {
+			if config[section] == nil {
+				config[section] = map[string]string{}
+			}
+			config[section][normalizeCephConfigKey(key)] = strings.TrimSpace(value)
+		}
+	}
+	return config
+}
+
+// getDeviceSetOSDConfig returns the Ceph options of the OSDs of a
+// StorageDeviceSet. Rook ignores them in the config of a
+// StorageClassDeviceSet, so they are set in the sections of the OSDs.
+func getDeviceSetOSDConfig(config ocsv1.StorageDeviceSetConfig) map[string]string {
+	options := map[string]string{}
+	if config.BlueStoreCacheSize != nil {
+		options["bluestore_cache_size"] = strconv.FormatInt(config.BlueStoreCacheSize.Value(), 10)
+	}
+	if config.BlueStoreCacheSizeHDD != nil {
+		options["bluestore_cache_size_hdd"] = strconv.FormatInt(config.BlueStoreCacheSizeHDD.Value(), 10)
+	}
+	if config.BlueStoreCacheSizeSSD != nil {
+		options["bluestore_cache_size_ssd"] = strconv.FormatInt(config.BlueStoreCacheSizeSSD.Value(), 10)
+	}
+	if len(options) > 0 {
+		// the cache sizes are ignored while BlueStore sizes the cache from
+		// osd_memory_target
+		options["bluestore_cache_autotune"] = "false"
+	}
+	return options
+}
+
+// getStorageDeviceSetName returns the name of the StorageDeviceSet of a Rook
+// StorageClassDeviceSet, which is suffixed with its replica
+func getStorageDeviceSetName(deviceSetName string) string {
+	i := strings.LastIndex(deviceSetName, "-")
+	if i < 0 {
+		return ""
+	}
+	if _, err := strconv.Atoi(deviceSetName[i+1:]); err != nil {
+		return ""
+	}
+	return deviceSetName[:i]
+}
+
+// addDeviceSetOSDConfig adds a section for each OSD of the StorageDeviceSets
+// which set Ceph options, given the IDs of the OSDs by Rook
+// StorageClassDeviceSet
+func addDeviceSetOSDConfig(config map[string]map[string]string, sc *ocsv1.StorageCluster, osds map[string][]int) {
+	for _, ds := range sc.Spec.StorageDeviceSets {
+		options := getDeviceSetOSDConfig(ds.Config)
+		if len(options) == 0 {
+			continue
+		}
+		for deviceSetName, ids := range osds {
+			if getStorageDeviceSetName(deviceSetName) != ds.Name {
+				continue
+			}
+			for _, id := range ids {
+				section := fmt.Sprintf("%s.%d", cephConfigSectionOSD, id)
+				config[section] = map[string]string{}
+				for key, value := range options {
+					config[section][key] = value
+				}
+			}
+		}
+	}
+}
+
+// getDeviceSetOSDs returns the IDs of the OSDs created by Rook, by
+// StorageClassDeviceSet. The OSDs are only listed if a StorageDeviceSet sets
+// options in their sections.
+func (r *StorageClusterReconciler) getDeviceSetOSDs(sc *ocsv1.StorageCluster) (map[string][]int, error) {
+	needed := false
+	for _, ds := range sc.Spec.StorageDeviceSets {
+		needed = needed || len(getDeviceSetOSDConfig(ds.Config)) > 0
+	}
+	if !needed {
+		return nil, nil
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	err := r.Client.List(context.TODO(), deployments, client.InNamespace(sc.Namespace),
+		client.MatchingLabels{"app": "rook-ceph-osd"}, client.HasLabels{"ceph.rook.io/DeviceSet"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the OSD deployments: %v", err)
+	}
+	osds := map[string][]int{}
+	for _, deployment := range deployments.Items {
+		id, err := strconv.Atoi(deployment.Labels["ceph-osd-id"])
+		if err != nil {
+			continue
+		}
+		deviceSetName := deployment.Labels["ceph.rook.io/DeviceSet"]
+		osds[deviceSetName] = append(osds[deviceSetName], id)
+	}
+	return osds, nil
+}
+
+// getOSDMemoryLimitRatio returns the share of their memory limit which the
+// OSDs take as their osd_memory_target
+func getOSDMemoryLimitRatio(sc *ocsv1.StorageCluster) float64 {
+	value, _ := lookupCephConfig(getCephConfig(sc), cephConfigSectionOSD, "osd_memory_target_cgroup_limit_ratio")
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil || ratio <= 0 || ratio > 1 {
+		// validateCephConfig rejects these values
+		return 1
+	}
+	return ratio
+}
+
+// renderCephConfig renders the options in the INI format of the Ceph
+// configuration file. The default options of each section come first, in
+// their order, followed by the other ones sorted by name. The sections of the
+// OSDs follow the other ones, sorted by OSD ID.
+func renderCephConfig(config map[string]map[string]string) string {
+	var osdIDs []int
+	for section := range config {
+		if id, err := strconv.Atoi(strings.TrimPrefix(section, cephConfigSectionOSD+".")); err == nil {
+			osdIDs = append(osdIDs, id)
+		}
+	}
+	sort.Ints(osdIDs)
+	sections := append([]string{}, cephConfigSections...)
+	for _, id := range osdIDs {
+		sections = append(sections, fmt.Sprintf("%s.%d", cephConfigSectionOSD, id))
+	}
+
+	var b strings.Builder
+	b.WriteString("\n")
+	for _, section := range sections {
+		if len(config[section]) == 0 {
+			continue
+		}
+		var keys, otherKeys []string
+		for _, option := range defaultCephConfig[section] {
+			if _, found := config[section][option.key]; found {
+				keys = append(keys, option.key)
+			}
+		}
+		for key := range config[section] {
+			if !isDefaultCephConfigOption(section, key) {
+				otherKeys = append(otherKeys, key)
+			}
+		}
+		sort.Strings(otherKeys)
+		keys = append(keys, otherKeys...)
+
+		fmt.Fprintf(&b, "[%s]\n", section)
+		for _, key := range keys {
+			fmt.Fprintf(&b, "%s = %s\n", key, config[section][key])
+		}
+	}
+	return b.String()
+}
+
+func isDefaultCephConfigOption(section, key string) bool {
+	for _, option := range defaultCephConfig[section] {
+		if option.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// getCephConfigData returns the content of the rook-config-override ConfigMap,
+// given the IDs of the OSDs by Rook StorageClassDeviceSet
+func getCephConfigData(sc *ocsv1.StorageCluster, osds map[string][]int) string {
+	config := getCephConfig(sc)
+	addDeviceSetOSDConfig(config, sc, osds)
+	return renderCephConfig(config)
+}
+
+// lookupCephConfig returns the value of an option as seen by the daemons which
+// read the given section
+func lookupCephConfig(config map[string]map[string]string, section, key string) (string, bool) {
+	if value, found := config[section][key]; found {
+		return value, true
+	}
+	value, found := config[cephConfigSectionGlobal][key]
+	return value, found
+}
+
+// validateCephConfig checks that the CephConfig of the StorageCluster can be
+// rendered, and that the values of the known options are consistent once
+// merged over the defaults
+func validateCephConfig(sc *ocsv1.StorageCluster) error {
+	for section, options := range getCephConfigSpecSections(sc.Spec.CephConfig) {
+		// Ceph reads spaces, dashes and underscores the same way, only one
+		// of the spellings of an option would be applied
+		names := map[string]string{}
+		for key, value := range options {
+			name := normalizeCephConfigKey(key)
+			if name == "" {
+				return fmt.Errorf("failed to validate CephConfig: empty option name in section %q", section)
+			}
+			if other, found := names[name]; found {
+				keys := []string{other, key}
+				sort.Strings(keys)
+				return fmt.Errorf("failed to validate CephConfig: options %q and %q in section %q are the same option", keys[0], keys[1], section)
+			}
+			names[name] = key
+			if strings.ContainsAny(key, "=[]#;\n") {
+				return fmt.Errorf("failed to validate CephConfig: invalid option name %q in section %q", key, section)
+			}
+			if strings.ContainsAny(value, "\n") {
+				return fmt.Errorf("failed to validate CephConfig: invalid value for option %q in section %q", key, section)
+			}
+		}
+	}
+
+	config := getCephConfig(sc)
+
+	// The OSDs must be reported as nearfull before they stop backfilling,
+	// and stop backfilling before they are full.
+	ratioKeys := []string{"mon_osd_nearfull_ratio", "mon_osd_backfillfull_ratio", "mon_osd_full_ratio"}
+	var ratios []float64
+	for _, key := range ratioKeys {
+		value, found := lookupCephConfig(config, cephConfigSectionMon, key)
+		if !found {
+			continue
+		}
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio <= 0 || ratio > 1 {
+			return fmt.Errorf("failed to validate CephConfig: %s must be a number between 0 and 1, got %q", key, value)
+		}
+		ratios = append(ratios, ratio)
+	}
+	if len(ratios) == len(ratioKeys) && !(ratios[0] < ratios[1] && ratios[1] < ratios[2]) {
+		return fmt.Errorf("failed to validate CephConfig: %s (%v) must be lower than %s (%v), which must be lower than %s (%v)",
+			ratioKeys[0], ratios[0], ratioKeys[1], ratios[1], ratioKeys[2], ratios[2])
+	}
+
+	if value, found := lookupCephConfig(config, cephConfigSectionMon, "mon_max_pg_per_osd"); found {
+		if maxPGs, err := strconv.Atoi(value); err != nil || maxPGs <= 0 {
+			return fmt.Errorf("failed to validate CephConfig: mon_max_pg_per_osd must be a positive integer, got %q", value)
+		}
+	}
+
+	if value, found := lookupCephConfig(config, cephConfigSectionOSD, "osd_memory_target_cgroup_limit_ratio"); found {
+		if ratio, err := strconv.ParseFloat(value, 64); err != nil || ratio <= 0 || ratio > 1 {
+			return fmt.Errorf("failed to validate CephConfig: osd_memory_target_cgroup_limit_ratio must be a number between 0 and 1, got %q", value)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package storagecluster
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestGetCephConfigData(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	// the defaults are rendered as the operator always did
+	assert.Equal(t, `
+[global]
+bdev_flock_retry = 20
+mon_osd_full_ratio = .85
+mon_osd_backfillfull_ratio = .8
+mon_osd_nearfull_ratio = .75
+mon_max_pg_per_osd = 600
+[osd]
+osd_memory_target_cgroup_limit_ratio = 0.5
+`, getCephConfigData(sc, nil))
+
+	sc.Spec.CephConfig = &api.CephConfigSpec{
+		Global: map[string]string{"mon max pg per osd": "1000", "ms_bind_ipv6": "true", "debug_ms": "0/0"},
+		OSD:    map[string]string{"osd-memory-target-cgroup-limit-ratio": "0.8"},
+		MDS:    map[string]string{"mds_cache_memory_limit": "4294967296"},
+		RGW:    map[string]string{"rgw_enable_usage_log": "true"},
+	}
+	assert.Equal(t, `
+[global]
+bdev_flock_retry = 20
+mon_osd_full_ratio = .85
+mon_osd_backfillfull_ratio = .8
+mon_osd_nearfull_ratio = .75
+mon_max_pg_per_osd = 1000
+debug_ms = 0/0
+ms_bind_ipv6 = true
+[osd]
+osd_memory_target_cgroup_limit_ratio = 0.8
+[mds]
+mds_cache_memory_limit = 4294967296
+[client.rgw]
+rgw_enable_usage_log = true
+`, getCephConfigData(sc, nil))
+}
+
+func TestValidateCephConfig(t *testing.T) {
+	cases := []struct {
+		label      string
+		cephConfig *api.CephConfigSpec
+		isValid    bool
+	}{
+		{
+			label:      "Case 1: defaults",
+			cephConfig: nil,
+			isValid:    true,
+		},
+		{
+			label: "Case 2: ratios raised in order",
+			cephConfig: &api.CephConfigSpec{
+				Global: map[string]string{
+					"mon_osd_nearfull_ratio":     "0.85",
+					"mon_osd_backfillfull_ratio": "0.9",
+					"mon_osd_full_ratio":         "0.95",
+				},
+			},
+			isValid: true,
+		},
+		{
+			label: "Case 3: nearfull ratio above the default backfillfull ratio",
+			cephConfig: &api.CephConfigSpec{
+				Global: map[string]string{"mon osd nearfull ratio": "0.82"},
+			},
+			isValid: false,
+		},
+		{
+			label: "Case 4: mon section overrides the global one",
+			cephConfig: &api.CephConfigSpec{
+				Global: map[string]string{"mon_osd_full_ratio": "0.7"},
+				Mon:    map[string]string{"mon_osd_full_ratio": "0.9"},
+			},
+			isValid: true,
+		},
+		{
+			label: "Case 5: ratio out of range",
+			cephConfig: &api.CephConfigSpec{
+				Mon: map[string]string{"mon_osd_full_ratio": "1.5"},
+			},
+			isValid: false,
+		},
+		{
+			label: "Case 6: invalid mon_max_pg_per_osd",
+			cephConfig: &api.CephConfigSpec{
+				Global: map[string]string{"mon_max_pg_per_osd": "-1"},
+			},
+			isValid: false,
+		},
+		{
+			label: "Case 7: option name injecting a section",
+			cephConfig: &api.CephConfigSpec{
+				OSD: map[string]string{"[global]\nfoo": "bar"},
+			},
+			isValid: false,
+		},
+		{
+			label: "Case 8: multi-line value",
+			cephConfig: &api.CephConfigSpec{
+				RGW: map[string]string{"rgw_enable_usage_log": "true\n[global]"},
+			},
+			isValid: false,
+		},
+		{
+			label: "Case 9: two spellings of the same option",
+			cephConfig: &api.CephConfigSpec{
+				Global: map[string]string{"mon-max-pg-per-osd": "300", "mon_max_pg_per_osd": "400"},
+			},
+			isValid: false,
+		},
+		{
+			label: "Case 10: same option in two sections",
+			cephConfig: &api.CephConfigSpec{
+				Global: map[string]string{"mon-max-pg-per-osd": "300"},
+				Mon:    map[string]string{"mon_max_pg_per_osd": "400"},
+			},
+			isValid: true,
+		},
+	}
+
+	for _, c := range cases {
+		sc := createDefaultStorageCluster()
+		sc.Spec.CephConfig = c.cephConfig
+		err := validateCephConfig(sc)
+		if c.isValid {
+			assert.NoErrorf(t, err, "[%s]", c.label)
+		} else {
+			assert.Errorf(t, err, "[%s]", c.label)
+		}
+	}
+}
+
+func TestEnsureCephConfig(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	reconciler := createFakeStorageClusterReconciler(t)
+	obj := &ocsCephConfig{}
+
+	assert.NoError(t, obj.ensureCreated(&reconciler, sc))
+	cm := &corev1.ConfigMap{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: rookConfigMapName, Namespace: sc.Namespace}, cm))
+	assert.NotContains(t, cm.Data["config"], "[mon]")
+
+	// changing the CephConfig updates the ConfigMap
+	sc.Spec.CephConfig = &api.CephConfigSpec{
+		Mon: map[string]string{"mon_data_avail_warn": "20"},
+	}
+	assert.NoError(t, obj.ensureCreated(&reconciler, sc))
+	cm = &corev1.ConfigMap{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: rookConfigMapName, Namespace: sc.Namespace}, cm))
+	assert.Contains(t, cm.Data["config"], "[mon]\nmon_data_avail_warn = 20\n")
+}
+
+func TestDeviceSetOSDCephConfig(t *testing.T) {
+	cacheSize := resource.MustParse("1Gi")
+	sc := createDefaultStorageCluster()
+	sc.Spec.StorageDeviceSets = []api.StorageDeviceSet{
+		{Name: "hdd", Config: api.StorageDeviceSetConfig{BlueStoreCacheSizeHDD: &cacheSize}},
+		{Name: "ssd"},
+	}
+	newOSDDeployment := func(deviceSet, id string) runtime.Object {
+		return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+			Name:      "rook-ceph-osd-" + id,
+			Namespace: sc.Namespace,
+			Labels:    map[string]string{"app": "rook-ceph-osd", "ceph.rook.io/DeviceSet": deviceSet, "ceph-osd-id": id},
+		}}
+	}
+	reconciler := createFakeStorageClusterReconciler(t,
+		newOSDDeployment("hdd-0", "10"),
+		newOSDDeployment("hdd-1", "2"),
+		newOSDDeployment("ssd-0", "1"),
+	)
+
+	obj := &ocsCephConfig{}
+	assert.NoError(t, obj.ensureCreated(&reconciler, sc))
+	cm := &corev1.ConfigMap{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: rookConfigMapName, Namespace: sc.Namespace}, cm))
+	assert.Equal(t, `
+[global]
+bdev_flock_retry = 20
+mon_osd_full_ratio = .85
+mon_osd_backfillfull_ratio = .8
+mon_osd_nearfull_ratio = .75
+mon_max_pg_per_osd = 600
+[osd]
+osd_memory_target_cgroup_limit_ratio = 0.5
+[osd.2]
+bluestore_cache_autotune = false
+bluestore_cache_size_hdd = 1073741824
+[osd.10]
+bluestore_cache_autotune = false
+bluestore_cache_size_hdd = 1073741824
+`, cm.Data["config"])
+}
@@ -3,6 +3,7 @@ package storagecluster
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	"github.com/openshift/ocs-operator/controllers/defaults"
@@ -10,7 +11,9 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
@@ -19,33 +22,12 @@ type ocsCephFilesystems struct{}
 // newCephFilesystemInstances returns the cephFilesystem instances that should be created
 // on first run.
 func (r *StorageClusterReconciler) newCephFilesystemInstances(initData *ocsv1.StorageCluster) ([]*cephv1.CephFilesystem, error) {
+	managementSpec := initData.Spec.ManagedResources.CephFilesystems
 	ret := []*cephv1.CephFilesystem{
-		{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      generateNameForCephFilesystem(initData),
-				Namespace: initData.Namespace,
-			},
-			Spec: cephv1.FilesystemSpec{
-				MetadataPool: cephv1.PoolSpec{
-					Replicated:    generateCephReplicatedSpec(initData, "metadata"),
-					FailureDomain: initData.Status.FailureDomain,
-				},
-				DataPools: []cephv1.PoolSpec{
-					{
-						Replicated:    generateCephReplicatedSpec(initData, "data"),
-						FailureDomain: initData.Status.FailureDomain,
-					},
-				},
-				MetadataServer: cephv1.MetadataServerSpec{
-					ActiveCount:   1,
-					ActiveStandby: true,
-					Placement:     getPlacement(initData, "mds"),
-					Resources:     defaults.GetDaemonResources("mds", initData.Spec.Resources),
-					// set PriorityClassName for the MDS pods
-					PriorityClassName: openshiftUserCritical,
-				},
-			},
-		},
+		newCephFilesystem(initData, generateNameForCephFilesystem(initData), managementSpec.ActiveMetadataServers, managementSpec.AdditionalDataPools),
+	}
+	for _, fs := range managementSpec.AdditionalFilesystems {
+		ret = append(ret, newCephFilesystem(initData, generateNameForAdditionalCephFilesystem(initData, fs.Name), fs.ActiveMetadataServers, fs.AdditionalDataPools))
 	}
 	for _, obj := range ret {
 		err := controllerutil.SetControllerReference(initData, obj, r.Scheme)
@@ -57,6 +39,145 @@ func (r *StorageClusterReconciler) newCephFilesystemInstances(initData *ocsv1.St
 	return ret, nil
 }
 
+// newCephFilesystem returns a CephFilesystem with a default data pool followed
+// by the additional ones, which Rook names after their index
+func newCephFilesystem(initData *ocsv1.StorageCluster, name string, activeMetadataServers int, additionalDataPools []ocsv1.FilesystemDataPoolSpec) *cephv1.CephFilesystem {
+	if activeMetadataServers == 0 {
+		activeMetadataServers = 1
+	}
+	dataPools := []cephv1.PoolSpec{
+		{
+			Replicated:    generateCephReplicatedSpec(initData, "data"),
+			FailureDomain: initData.Status.FailureDomain,
+		},
+	}
+	for _, pool := range additionalDataPools {
+		dataPools = append(dataPools, cephv1.PoolSpec{
+			Replicated:      generateCephAdditionalReplicatedSpec(initData, pool.Replica),
+			FailureDomain:   initData.Status.FailureDomain,
+			DeviceClass:     pool.DeviceClass,
+			CompressionMode: pool.CompressionMode,
+		})
+	}
+
+	return &cephv1.CephFilesystem{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: initData.Namespace,
+		},
+		Spec: cephv1.FilesystemSpec{
+			MetadataPool: cephv1.PoolSpec{
+				Replicated:    generateCephReplicatedSpec(initData, "metadata"),
+				FailureDomain: initData.Status.FailureDomain,
+			},
+			DataPools: dataPools,
+			MetadataServer: cephv1.MetadataServerSpec{
+				ActiveCount:   int32(activeMetadataServers),
+				ActiveStandby: true,
+				Placement:     getPlacement(initData, "mds"),
+				Resources:     defaults.GetDaemonResources("mds", initData.Spec.Resources),
+				// set PriorityClassName for the MDS pods
+				PriorityClassName: openshiftUserCritical,
+			},
+		},
+	}
+}
+
+// validateCephFilesystems checks that the additional filesystems and data
+// pools can be created next to each other, that the names of their
+// StorageClasses don't collide, and that the data pools created before are
+// kept in place
+func validateCephFilesystems(sc *ocsv1.StorageCluster) error {
+	managementSpec := sc.Spec.ManagedResources.CephFilesystems
+	if managementSpec.ActiveMetadataServers < 0 || managementSpec.ActiveMetadataServers > 10 {
+		return fmt.Errorf("failed to validate CephFilesystems: activeMetadataServers must be between 0 and 10, got %d", managementSpec.ActiveMetadataServers)
+	}
+
+	// the StorageClasses are named after the filesystems and their data pools
+	storageClassNames := map[string]bool{}
+	validateDataPools := func(fsName, cephFilesystemName string, pools []ocsv1.FilesystemDataPoolSpec) error {
+		// Rook names the data pools after their index, and the StorageClasses
+		// refer to them by that name
+		created := getFilesystemDataPools(sc, cephFilesystemName)
+		for i, name := range created {
+			if i >= len(pools) || pools[i].Name != name {
+				return fmt.Errorf("failed to validate data pools of CephFilesystem %q: the data pools %v are created and can't be removed or reordered, new data pools can only be appended",
+					fsName, created)
+			}
+		}
+		for _, pool := range pools {
+			if errs := validation.IsDNS1123Label(pool.Name); len(errs) > 0 {
+				return fmt.Errorf("failed to validate data pool %q of CephFilesystem %q: %s", pool.Name, fsName, strings.Join(errs, ", "))
+			}
+			if err := validatePoolOptions(sc, pool.Replica, pool.CompressionMode); err != nil {
+				return fmt.Errorf("failed to validate data pool %q of CephFilesystem %q: %v", pool.Name, fsName, err)
+			}
+			storageClassName := strings.TrimPrefix(fmt.Sprintf("%s-%s", fsName, pool.Name), "-")
+			if strings.HasPrefix(storageClassName, tenantStorageClassPrefix) {
+				return fmt.Errorf("failed to validate data pool %q of CephFilesystem %q: the %s prefix of the name of its StorageClass is reserved for the tenants",
+					pool.Name, fsName, tenantStorageClassPrefix)
+			}
+			if storageClassNames[storageClassName] {
+				return fmt.Errorf("failed to validate data pool %q of CephFilesystem %q: the name of its StorageClass is used by another filesystem or data pool", pool.Name, fsName)
+			}
+			storageClassNames[storageClassName] = true
+		}
+		return nil
+	}
+
+	storageClassNames[""] = true
+	if err := validateDataPools("", generateNameForCephFilesystem(sc), managementSpec.AdditionalDataPools); err != nil {
+		return err
+	}
+	for _, fs := range managementSpec.AdditionalFilesystems {
+		if errs := validation.IsDNS1123Label(fs.Name); len(errs) > 0 {
+			return fmt.Errorf("failed to validate additional CephFilesystem %q: %s", fs.Name, strings.Join(errs, ", "))
+		}
+		if fs.ActiveMetadataServers < 0 || fs.ActiveMetadataServers > 10 {
+			return fmt.Errorf("failed to validate additional CephFilesystem %q: activeMetadataServers must be between 0 and 10, got %d", fs.Name, fs.ActiveMetadataServers)
+		}
+		if strings.HasPrefix(fs.Name, tenantStorageClassPrefix) {
+			return fmt.Errorf("failed to validate additional CephFilesystem %q: the %s prefix is reserved for the StorageClasses of the tenants",
+				fs.Name, tenantStorageClassPrefix)
+		}
+		if storageClassNames[fs.Name] {
+			return fmt.Errorf("failed to validate additional CephFilesystem %q: the name of its StorageClass is used by another filesystem or data pool", fs.Name)
+		}
+		storageClassNames[fs.Name] = true
+		if err := validateDataPools(fs.Name, generateNameForAdditionalCephFilesystem(sc, fs.Name), fs.AdditionalDataPools); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getFilesystemDataPools returns the additional data pools created for a
+// CephFilesystem
+func getFilesystemDataPools(sc *ocsv1.StorageCluster, cephFilesystemName string) []string {
+	for _, fs := range sc.Status.FilesystemDataPools {
+		if fs.Name == cephFilesystemName {
+			return fs.DataPools
+		}
+	}
+	return nil
+}
+
+// setFilesystemDataPools records the additional data pools of a
+// CephFilesystem in the status
+func setFilesystemDataPools(sc *ocsv1.StorageCluster, cephFilesystem *cephv1.CephFilesystem, pools []ocsv1.FilesystemDataPoolSpec) {
+	status := ocsv1.FilesystemDataPoolsStatus{Name: cephFilesystem.Name, DataPools: []string{}}
+	for _, pool := range pools {
+		status.DataPools = append(status.DataPools, pool.Name)
+	}
+	for i := range sc.Status.FilesystemDataPools {
+		if sc.Status.FilesystemDataPools[i].Name == cephFilesystem.Name {
+			sc.Status.FilesystemDataPools[i] = status
+			return
+		}
+	}
+	sc.Status.FilesystemDataPools = append(sc.Status.FilesystemDataPools, status)
+}
+
 // ensureCreated ensures that cephFilesystem resources exist in the desired
 // state.
 func (obj *ocsCephFilesystems) ensureCreated(r *StorageClusterReconciler, instance *ocsv1.StorageCluster) error {
@@ -69,13 +190,20 @@ func (obj *ocsCephFilesystems) ensureCreated(r *StorageClusterReconciler, instan
 	if err != nil {
 		return err
 	}
-	for _, cephFilesystem := range cephFilesystems {
+	// the instances are returned in the order of the spec, the default
+	// filesystem first
+	managementSpec := instance.Spec.ManagedResources.CephFilesystems
+	dataPools := [][]ocsv1.FilesystemDataPoolSpec{managementSpec.AdditionalDataPools}
+	for _, fs := range managementSpec.AdditionalFilesystems {
+		dataPools = append(dataPools, fs.AdditionalDataPools)
+	}
+	for i, cephFilesystem := range cephFilesystems {
 		existing := cephv1.CephFilesystem{}
 		err = r.Client.Get(context.TODO(), types.NamespacedName{Name: cephFilesystem.Name, Namespace: cephFilesystem.Namespace}, &existing)
 		switch {
 		case err == nil:
 			if reconcileStrategy == ReconcileStrategyInit {
-				return nil
+				continue
 			}
 			if existing.DeletionTimestamp != nil {
 				r.Log.Info("Unable to restore CephFileSystem because it is marked for deletion.", "CephFileSystem", klog.KRef(existing.Namespace, existing.Name))
@@ -90,6 +218,7 @@ func (obj *ocsCephFilesystems) ensureCreated(r *StorageClusterReconciler, instan
 				r.Log.Error(err, "Unable to update CephFileSystem.", "CephFileSystem", klog.KRef(cephFilesystem.Namespace, cephFilesystem.Name))
 				return err
 			}
+			setFilesystemDataPools(instance, cephFilesystem, dataPools[i])
 		case errors.IsNotFound(err):
 			r.Log.Info("Creating CephFileSystem.", "CephFileSystem", klog.KRef(cephFilesystem.Namespace, cephFilesystem.Name))
 			err = r.Client.Create(context.TODO(), cephFilesystem)
@@ -97,50 +226,51 @@ func (obj *ocsCephFilesystems) ensureCreated(r *StorageClusterReconciler, instan
 				r.Log.Error(err, "Unable to create CephFileSystem.", "CephFileSystem", klog.KRef(cephFilesystem.Namespace, cephFilesystem.Name))
 				return err
 			}
+			setFilesystemDataPools(instance, cephFilesystem, dataPools[i])
 		}
 	}
 
 	return nil
 }
 
-// ensureDeleted deletes the CephFilesystems owned by the StorageCluster
+// ensureDeleted deletes the CephFilesystems owned by the StorageCluster. The
+// deletion of all the filesystems is requested before waiting for them.
 func (obj *ocsCephFilesystems) ensureDeleted(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
-	foundCephFilesystem := &cephv1.CephFilesystem{}
-	cephFilesystems, err := r.newCephFilesystemInstances(sc)
+	// the filesystems removed from the spec are still owned by the
+	// StorageCluster, so they are listed rather than generated from the spec
+	cephFilesystems := &cephv1.CephFilesystemList{}
+	err := r.Client.List(context.TODO(), cephFilesystems, client.InNamespace(sc.Namespace))
 	if err != nil {
-		return err
+		r.Log.Error(err, "Uninstall: Unable to list CephFileSystems.", "Namespace", sc.Namespace)
+		return fmt.Errorf("uninstall: Unable to list CephFileSystems: %v", err)
 	}
 
-	for _, cephFilesystem := range cephFilesystems {
-		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: cephFilesystem.Name, Namespace: sc.Namespace}, foundCephFilesystem)
-		if err != nil {
-			if errors.IsNotFound(err) {
-				r.Log.Info("Uninstall: CephFileSystem not found.", "CephFileSystem", klog.KRef(cephFilesystem.Namespace, cephFilesystem.Name))
-				continue
-			}
-			r.Log.Error(err, "Uninstall: Unable to retrieve CephFileSystem.", "CephFileSystem", klog.KRef(cephFilesystem.Namespace, cephFilesystem.Name))
-			return fmt.Errorf("uninstall: Unable to retrieve CephFileSystem %v: %v", cephFilesystem.Name, err)
+	var pending []string
+	for i := range cephFilesystems.Items {
+		foundCephFilesystem := &cephFilesystems.Items[i]
+		if !metav1.IsControlledBy(foundCephFilesystem, sc) {
+			continue
 		}
 
-		if cephFilesystem.GetDeletionTimestamp().IsZero() {
+		if foundCephFilesystem.GetDeletionTimestamp().IsZero() {
 			r.Log.Info("Uninstall: Deleting cephFilesystem.", "CephFileSystem", klog.KRef(foundCephFilesystem.Namespace, foundCephFilesystem.Name))
 			err = r.Client.Delete(context.TODO(), foundCephFilesystem)
-			if err != nil {
+			if err != nil && !errors.IsNotFound(err) {
 				r.Log.Error(err, "Uninstall: Failed to delete CephFileSystem.", "CephFileSystem", klog.KRef(foundCephFilesystem.Namespace, foundCephFilesystem.Name))
 				return fmt.Errorf("uninstall: Failed to delete CephFileSystem %v: %v", foundCephFilesystem.Name, err)
 			}
 		}
 
-		err = r.Client.Get(context.TODO(), types.NamespacedName{Name: cephFilesystem.Name, Namespace: sc.Namespace}, foundCephFilesystem)
-		if err != nil {
-			if errors.IsNotFound(err) {
-				r.Log.Info("Uninstall: CephFilesystem is deleted.", "CephFileSystem", klog.KRef(cephFilesystem.Namespace, cephFilesystem.Name))
-				continue
-			}
+		err = r.Client.Get(context.TODO(), types.NamespacedName{Name: foundCephFilesystem.Name, Namespace: sc.Namespace}, &cephv1.CephFilesystem{})
+		if errors.IsNotFound(err) {
+			r.Log.Info("Uninstall: CephFilesystem is deleted.", "CephFileSystem", klog.KRef(foundCephFilesystem.Namespace, foundCephFilesystem.Name))
+			continue
 		}
-		r.Log.Error(err, "Uninstall: Waiting for CephFileSystem to be deleted.", "CephFileSystem", klog.KRef(cephFilesystem.Namespace, cephFilesystem.Name))
-		return fmt.Errorf("uninstall: Waiting for CephFileSystem %v to be deleted", cephFilesystem.Name)
-
+		r.Log.Info("Uninstall: Waiting for CephFileSystem to be deleted.", "CephFileSystem", klog.KRef(foundCephFilesystem.Namespace, foundCephFilesystem.Name))
+		pending = append(pending, foundCephFilesystem.Name)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("uninstall: Waiting for CephFileSystems %v to be deleted", strings.Join(pending, ", "))
 	}
 	return nil
 }
@@ -6,6 +6,7 @@ import (
 
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -56,3 +57,168 @@ func assertCephFileSystem(t *testing.T, reconciler StorageClusterReconciler, cr
 	assert.Equal(t, expectedAf[0].ObjectMeta.Name, actualFs.ObjectMeta.Name)
 	assert.Equal(t, expectedAf[0].Spec, actualFs.Spec)
 }
+
+func TestAdditionalCephFilesystems(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	sc.Spec.ManagedResources.CephFilesystems.ActiveMetadataServers = 2
+	sc.Spec.ManagedResources.CephFilesystems.AdditionalDataPools = []api.FilesystemDataPoolSpec{
+		{Name: "archive", DeviceClass: "hdd", CompressionMode: "passive"},
+	}
+	sc.Spec.ManagedResources.CephFilesystems.AdditionalFilesystems = []api.AdditionalFilesystemSpec{
+		{
+			Name:                 "analytics",
+			AdditionalDataPools:  []api.FilesystemDataPoolSpec{{Name: "bulk", Replica: 2, DeviceClass: "hdd"}},
+			DisableSnapshotClass: true,
+		},
+	}
+	reconciler := createFakeStorageClusterReconciler(t)
+
+	cephFilesystems, err := reconciler.newCephFilesystemInstances(sc)
+	assert.NoError(t, err)
+	assert.Len(t, cephFilesystems, 2)
+	assert.Equal(t, int32(2), cephFilesystems[0].Spec.MetadataServer.ActiveCount)
+	assert.Len(t, cephFilesystems[0].Spec.DataPools, 2)
+	assert.Equal(t, "hdd", cephFilesystems[0].Spec.DataPools[1].DeviceClass)
+	assert.Equal(t, "passive", cephFilesystems[0].Spec.DataPools[1].CompressionMode)
+	assert.Equal(t, "ocsinit-cephfilesystem-analytics", cephFilesystems[1].Name)
+	assert.Len(t, cephFilesystems[1].OwnerReferences, 1)
+	assert.Equal(t, int32(1), cephFilesystems[1].Spec.MetadataServer.ActiveCount)
+	assert.Equal(t, uint(2), cephFilesystems[1].Spec.DataPools[1].Replicated.Size)
+	assert.Zero(t, cephFilesystems[1].Spec.DataPools[1].Replicated.TargetSizeRatio)
+
+	sccs, err := reconciler.newStorageClassConfigurations(sc)
+	assert.NoError(t, err)
+	parameters := map[string]map[string]string{}
+	for _, scc := range sccs {
+		parameters[scc.storageClass.Name] = scc.storageClass.Parameters
+	}
+	assert.NotContains(t, parameters["ocsinit-cephfs"], "pool")
+	assert.Equal(t, "ocsinit-cephfilesystem", parameters["ocsinit-cephfs-archive"]["fsName"])
+	assert.Equal(t, "ocsinit-cephfilesystem-data1", parameters["ocsinit-cephfs-archive"]["pool"])
+	assert.Equal(t, "ocsinit-cephfilesystem-analytics", parameters["ocsinit-cephfs-analytics"]["fsName"])
+	assert.NotContains(t, parameters["ocsinit-cephfs-analytics"], "pool")
+	assert.Equal(t, "ocsinit-cephfilesystem-analytics-data1", parameters["ocsinit-cephfs-analytics-bulk"]["pool"])
+
+	disabled := map[string]bool{}
+	for _, vscc := range newSnapshotClassConfigurations(sc) {
+		disabled[vscc.snapshotClass.Name] = vscc.disable
+	}
+	assert.Contains(t, disabled, "ocsinit-cephfsplugin-analytics-snapclass")
+	assert.True(t, disabled["ocsinit-cephfsplugin-analytics-snapclass"])
+
+	// all the filesystems are removed on uninstall
+	obj := &ocsCephFilesystems{}
+	assert.NoError(t, obj.ensureCreated(&reconciler, sc))
+	for _, cephFilesystem := range cephFilesystems {
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), client.ObjectKeyFromObject(cephFilesystem), &cephv1.CephFilesystem{}))
+	}
+	assert.Equal(t, []string{"archive"}, getFilesystemDataPools(sc, "ocsinit-cephfilesystem"))
+	assert.Equal(t, []string{"bulk"}, getFilesystemDataPools(sc, "ocsinit-cephfilesystem-analytics"))
+	// the filesystems removed from the spec are deleted too, but not the ones
+	// the StorageCluster doesn't own
+	sc.Spec.ManagedResources.CephFilesystems.AdditionalFilesystems = nil
+	unowned := &cephv1.CephFilesystem{ObjectMeta: metav1.ObjectMeta{Name: "unowned", Namespace: sc.Namespace}}
+	assert.NoError(t, reconciler.Client.Create(context.TODO(), unowned))
+	assert.NoError(t, obj.ensureDeleted(&reconciler, sc))
+	for _, cephFilesystem := range cephFilesystems {
+		err = reconciler.Client.Get(context.TODO(), client.ObjectKeyFromObject(cephFilesystem), &cephv1.CephFilesystem{})
+		assert.True(t, errors.IsNotFound(err))
+	}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), client.ObjectKeyFromObject(unowned), &cephv1.CephFilesystem{}))
+}
+
+func TestValidateCephFilesystems(t *testing.T) {
+	cases := []struct {
+		label     string
+		fsSpec    api.ManageCephFilesystems
+		dataPools []api.FilesystemDataPoolsStatus
+		isValid   bool
+	}{
+		{
+			label: "Case 1: additional filesystems and data pools",
+			fsSpec: api.ManageCephFilesystems{
+				ActiveMetadataServers: 2,
+				AdditionalDataPools:   []api.FilesystemDataPoolSpec{{Name: "archive", DeviceClass: "hdd"}},
+				AdditionalFilesystems: []api.AdditionalFilesystemSpec{{Name: "analytics", AdditionalDataPools: []api.FilesystemDataPoolSpec{{Name: "archive"}}}},
+			},
+			isValid: true,
+		},
+		{
+			label:   "Case 2: too many active MDS",
+			fsSpec:  api.ManageCephFilesystems{ActiveMetadataServers: 11},
+			isValid: false,
+		},
+		{
+			label: "Case 3: filesystem named after a data pool of the default filesystem",
+			fsSpec: api.ManageCephFilesystems{
+				AdditionalDataPools:   []api.FilesystemDataPoolSpec{{Name: "analytics"}},
+				AdditionalFilesystems: []api.AdditionalFilesystemSpec{{Name: "analytics"}},
+			},
+			isValid: false,
+		},
+		{
+			label: "Case 4: StorageClass names colliding across filesystems",
+			fsSpec: api.ManageCephFilesystems{
+				AdditionalDataPools:   []api.FilesystemDataPoolSpec{{Name: "analytics-bulk"}},
+				AdditionalFilesystems: []api.AdditionalFilesystemSpec{{Name: "analytics", AdditionalDataPools: []api.FilesystemDataPoolSpec{{Name: "bulk"}}}},
+			},
+			isValid: false,
+		},
+		{
+			label:   "Case 5: invalid replica",
+			fsSpec:  api.ManageCephFilesystems{AdditionalDataPools: []api.FilesystemDataPoolSpec{{Name: "archive", Replica: 1}}},
+			isValid: false,
+		},
+		{
+			label:   "Case 6: invalid filesystem name",
+			fsSpec:  api.ManageCephFilesystems{AdditionalFilesystems: []api.AdditionalFilesystemSpec{{Name: "Analytics"}}},
+			isValid: false,
+		},
+		{
+			label: "Case 7: data pool appended",
+			fsSpec: api.ManageCephFilesystems{
+				AdditionalDataPools: []api.FilesystemDataPoolSpec{{Name: "archive"}, {Name: "bulk"}},
+			},
+			dataPools: []api.FilesystemDataPoolsStatus{{Name: "ocsinit-cephfilesystem", DataPools: []string{"archive"}}},
+			isValid:   true,
+		},
+		{
+			label: "Case 8: data pools reordered",
+			fsSpec: api.ManageCephFilesystems{
+				AdditionalDataPools: []api.FilesystemDataPoolSpec{{Name: "bulk"}, {Name: "archive"}},
+			},
+			dataPools: []api.FilesystemDataPoolsStatus{{Name: "ocsinit-cephfilesystem", DataPools: []string{"archive", "bulk"}}},
+			isValid:   false,
+		},
+		{
+			label: "Case 9: data pool of an additional filesystem removed",
+			fsSpec: api.ManageCephFilesystems{
+				AdditionalFilesystems: []api.AdditionalFilesystemSpec{{Name: "analytics", AdditionalDataPools: []api.FilesystemDataPoolSpec{{Name: "bulk"}}}},
+			},
+			dataPools: []api.FilesystemDataPoolsStatus{{Name: "ocsinit-cephfilesystem-analytics", DataPools: []string{"archive", "bulk"}}},
+			isValid:   false,
+		},
+		{
+			label:   "Case 10: filesystem with the prefix of the tenant StorageClasses",
+			fsSpec:  api.ManageCephFilesystems{AdditionalFilesystems: []api.AdditionalFilesystemSpec{{Name: "tenant-analytics"}}},
+			isValid: false,
+		},
+		{
+			label:   "Case 11: data pool with the prefix of the tenant StorageClasses",
+			fsSpec:  api.ManageCephFilesystems{AdditionalDataPools: []api.FilesystemDataPoolSpec{{Name: "tenant-archive"}}},
+			isValid: false,
+		},
+	}
+
+	for _, c := range cases {
+		sc := createDefaultStorageCluster()
+		sc.Spec.ManagedResources.CephFilesystems = c.fsSpec
+		sc.Status.FilesystemDataPools = c.dataPools
+		err := validateCephFilesystems(sc)
+		if c.isValid {
+			assert.NoErrorf(t, err, "[%s]", c.label)
+		} else {
+			assert.Errorf(t, err, "[%s]", c.label)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package storagecluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	objectreferencesv1 "github.com/openshift/custom-resource-status/objectreferences/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	resourceManagerDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "ocs_resource_manager_duration_seconds",
+			Help:    "Time taken by a StorageCluster resource manager to ensure its resources",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"namespace", "storagecluster", "manager"},
+	)
+	resourceManagerRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ocs_resource_manager_runs_total",
+			Help: "Number of StorageCluster resource manager runs, by result",
+		},
+		[]string{"namespace", "storagecluster", "manager", "result"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(resourceManagerDuration, resourceManagerRuns)
+}
+
+// managerNode is a resourceManager along with the names of the resource
+// managers that must have succeeded before it can run. A serial manager
+// changes the state the managers share, the phase, the conditions or the
+// events of the StorageCluster, and only runs while no other serial manager
+// does.
+type managerNode struct {
+	name      string
+	manager   resourceManager
+	dependsOn []string
+	serial    bool
+}
+
+// validateManagerNodes checks that every dependency refers to a known
+// resource manager and that the dependencies don't form a cycle
+func validateManagerNodes(nodes []managerNode) error {
+	pending := map[string][]string{}
+	for _, node := range nodes {
+		if _, found := pending[node.name]; found {
+			return fmt.Errorf("resource manager %q is declared more than once", node.name)
+		}
+		pending[node.name] = node.dependsOn
+	}
+	for _, node := range nodes {
+		for _, dep := range node.dependsOn {
+			if _, found := pending[dep]; !found {
+				return fmt.Errorf("resource manager %q depends on unknown resource manager %q", node.name, dep)
+			}
+		}
+	}
+
+	// Repeatedly remove the managers whose dependencies have all been
+	// removed, whatever is left over is part of a cycle.
+	for len(pending) > 0 {
+		removed := false
+		for name, deps := range pending {
+			ready := true
+			for _, dep := range deps {
+				if _, found := pending[dep]; found {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				delete(pending, name)
+				removed = true
+			}
+		}
+		if !removed {
+			var names []string
+			for name := range pending {
+				names = append(names, name)
+			}
+			return fmt.Errorf("dependency cycle between resource managers %v", names)
+		}
+	}
+	return nil
+}
+
+// ensureResourceManagers runs ensureCreated of every resource manager as soon
+// as all of its dependencies have succeeded, so that independent managers run
+// concurrently. A manager whose dependencies failed is skipped, while the
+// managers that don't depend on it keep going. A paused manager doesn't run,
+// but its dependents do, as its resources are left as they are. Each manager
+// works on its own copy of the reconciler and of the StorageCluster, and the
+// status changes it makes are merged back into instance once it returns.
+func (r *StorageClusterReconciler) ensureResourceManagers(instance *ocsv1.StorageCluster, nodes []managerNode) ([]ocsv1.ResourceManagerStatus, error) {
+	if err := validateManagerNodes(nodes); err != nil {
+		return nil, err
+	}
+
+	paused, _ := getPausedComponents(instance)
+
+	// lock protects instance, the state of r and the maps below, serialLock
+	// is held by the serial manager which is running
+	var lock, serialLock sync.Mutex
+	var wg sync.WaitGroup
+	done := map[string]chan struct{}{}
+	results := map[string]*ocsv1.ResourceManagerStatus{}
+	errs := map[string]error{}
+	for _, node := range nodes {
+		done[node.name] = make(chan struct{})
+	}
+
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node managerNode) {
+			defer wg.Done()
+			defer close(done[node.name])
+
+			var failedDeps []string
+			for _, dep := range node.dependsOn {
+				<-done[dep]
+				lock.Lock()
+				if results[dep].Result != ocsv1.ResourceManagerSucceeded && results[dep].Result != ocsv1.ResourceManagerPaused {
+					failedDeps = append(failedDeps, dep)
+				}
+				lock.Unlock()
+			}
+
+			var err error
+			result := &ocsv1.ResourceManagerStatus{Name: node.name}
+			if paused[node.name] {
+				result.Result = ocsv1.ResourceManagerPaused
+				result.Message = fmt.Sprintf("reconcile is paused by the %s annotation", PauseReconcileAnnotation)
+				r.Log.Info("Resource manager is paused.", "ResourceManager", node.name, "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+			} else if len(failedDeps) > 0 {
+				result.Result = ocsv1.ResourceManagerSkipped
+				result.Message = fmt.Sprintf("dependencies %v did not succeed", failedDeps)
+				r.Log.Info("Skipping resource manager.", "ResourceManager", node.name, "FailedDependencies", failedDeps)
+			} else {
+				if node.serial {
+					serialLock.Lock()
+				}
+				lock.Lock()
+				managerReconciler := *r
+				before := instance.DeepCopy()
+				lock.Unlock()
+				sc := before.DeepCopy()
+
+				start := time.Now()
+				err = node.manager.ensureCreated(&managerReconciler, sc)
+				result.Duration = metav1.Duration{Duration: time.Since(start)}
+
+				lock.Lock()
+				if !reflect.DeepEqual(before.ObjectMeta, sc.ObjectMeta) || !reflect.DeepEqual(before.Spec, sc.Spec) {
+					err = utilerrors.NewAggregate([]error{err, fmt.Errorf("the spec and the metadata of the StorageCluster can't be changed by a resource manager")})
+				}
+				if mergeErr := mergeStatusChanges(instance, before, sc); mergeErr != nil {
+					err = utilerrors.NewAggregate([]error{err, mergeErr})
+				}
+				// the state of a serial manager is kept for the managers
+				// which run after it and for the rest of the reconcile
+				if node.serial {
+					r.phase = managerReconciler.phase
+					r.monitoringIP = managerReconciler.monitoringIP
+					r.monitoringPort = managerReconciler.monitoringPort
+					r.conditions = managerReconciler.conditions
+				}
+				lock.Unlock()
+				if node.serial {
+					serialLock.Unlock()
+				}
+
+				if err != nil {
+					result.Result = ocsv1.ResourceManagerFailed
+					result.Message = err.Error()
+				} else {
+					result.Result = ocsv1.ResourceManagerSucceeded
+				}
+				resourceManagerDuration.WithLabelValues(instance.Namespace, instance.Name, node.name).Observe(result.Duration.Seconds())
+			}
+			resourceManagerRuns.WithLabelValues(instance.Namespace, instance.Name, node.name, string(result.Result)).Inc()
+
+			lock.Lock()
+			results[node.name] = result
+			if err != nil {
+				errs[node.name] = err
+			}
+			lock.Unlock()
+		}(node)
+	}
+	wg.Wait()
+
+	var statuses []ocsv1.ResourceManagerStatus
+	var failures []error
+	for _, node := range nodes {
+		statuses = append(statuses, *results[node.name])
+		if err, found := errs[node.name]; found {
+			r.Log.Error(err, "Resource manager failed.", "ResourceManager", node.name, "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+			failures = append(failures, fmt.Errorf("%s: %v", node.name, err))
+		}
+	}
+	return statuses, utilerrors.NewAggregate(failures)
+}
+
+// mergeStatusChanges applies the changes a resource manager made to the status
+// of its own copy of the StorageCluster (after, taken from before) onto the
+// status of instance
+func mergeStatusChanges(instance, before, after *ocsv1.StorageCluster) error {
+	// The status lists don't declare a patch strategy and are replaced as a
+	// whole, the conditions are merged by type below.
+	beforeStatus, afterStatus := before.Status.DeepCopy(), after.Status.DeepCopy()
+	beforeStatus.Conditions, afterStatus.Conditions = nil, nil
+	beforeJSON, err := json.Marshal(beforeStatus)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(afterStatus)
+	if err != nil {
+		return err
+	}
+	patch, err := strategicpatch.CreateTwoWayMergePatch(beforeJSON, afterJSON, ocsv1.StorageClusterStatus{})
+	if err != nil {
+		return err
+	}
+
+	status := instance.Status.DeepCopy()
+	if string(patch) != "{}" {
+		instanceJSON, err := json.Marshal(instance.Status)
+		if err != nil {
+			return err
+		}
+		merged, err := strategicpatch.StrategicMergePatch(instanceJSON, patch, ocsv1.StorageClusterStatus{})
+		if err != nil {
+			return err
+		}
+		status = &ocsv1.StorageClusterStatus{}
+		if err := json.Unmarshal(merged, status); err != nil {
+			return err
+		}
+
+		// add back the objects related by the managers which ran
+		// concurrently
+		for _, objectRef := range instance.Status.RelatedObjects {
+			if err := objectreferencesv1.SetObjectReference(&status.RelatedObjects, objectRef); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Only the conditions the manager set or removed are changed, so that the
+	// conditions of the other types set concurrently are kept.
+	for _, condition := range after.Status.Conditions {
+		previous := conditionsv1.FindStatusCondition(before.Status.Conditions, condition.Type)
+		if previous == nil || !reflect.DeepEqual(*previous, condition) {
+			status.Conditions = replaceStatusCondition(status.Conditions, condition)
+		}
+	}
+	for _, condition := range before.Status.Conditions {
+		if conditionsv1.FindStatusCondition(after.Status.Conditions, condition.Type) == nil {
+			conditionsv1.RemoveStatusCondition(&status.Conditions, condition.Type)
+		}
+	}
+	instance.Status = *status
+	return nil
+}
+
+// replaceStatusCondition sets the condition of its type as it is, keeping the
+// transition and heartbeat times the resource manager gave it
+func replaceStatusCondition(conditions []conditionsv1.Condition, condition conditionsv1.Condition) []conditionsv1.Condition {
+	for i := range conditions {
+		if conditions[i].Type == condition.Type {
+			conditions[i] = condition
+			return conditions
+		}
+	}
+	return append(conditions, condition)
+}
+
+// getResourceManagerNodes returns the resource managers which reconcile the
+// given StorageCluster, along with their dependencies
+func getResourceManagerNodes(instance *ocsv1.StorageCluster) []managerNode {
+	if !instance.Spec.ExternalStorage.Enable {
+		// list of default ensure functions, along with the ones that
+		// must succeed before each of them can run
+		return []managerNode{
+			{name: "CephConfig", manager: &ocsCephConfig{}},
+			{name: "KMS", manager: &ocsKMS{}, serial: true},
+			{name: "RetainedData", manager: &ocsRetainedData{}, serial: true},
+			{name: "CephCluster", manager: &ocsCephCluster{}, dependsOn: []string{"CephConfig", "KMS", "RetainedData"}, serial: true},
+			{name: "CephBlockPools", manager: &ocsCephBlockPools{}},
+			{name: "CephFilesystems", manager: &ocsCephFilesystems{}},
+			{name: "CephObjectStores", manager: &ocsCephObjectStores{}},
+			{name: "CephObjectStoreUsers", manager: &ocsCephObjectStoreUsers{}, dependsOn: []string{"CephObjectStores"}},
+			{name: "CephRGWRoutes", manager: &ocsCephRGWRoutes{}, dependsOn: []string{"CephObjectStores"}},
+			{name: "StorageClasses", manager: &ocsStorageClass{}, dependsOn: []string{"CephBlockPools", "CephFilesystems"}},
+			{name: "SnapshotClasses", manager: &ocsSnapshotClass{}, dependsOn: []string{"CephBlockPools", "CephFilesystems"}},
+			{name: "Tenants", manager: &ocsTenants{}, dependsOn: []string{"CephCluster", "CephBlockPools", "CephFilesystems"}},
+			{name: "NooBaa", manager: &ocsNoobaaSystem{}, dependsOn: []string{"CephCluster", "StorageClasses"}, serial: true},
+			{name: "JobTemplates", manager: &ocsJobTemplates{}},
+			{name: "QuickStarts", manager: &ocsQuickStarts{}},
+		}
+	}
+
+	// an additional external cluster only has its Ceph CSI resources
+	if isAdditionalExternalStorageCluster(instance) {
+		return []managerNode{
+			{name: "ExternalResources", manager: &ocsExternalResources{}, serial: true},
+			{name: "ExternalProber", manager: &ocsExternalProber{}, dependsOn: []string{"ExternalResources"}, serial: true},
+			{name: "SnapshotClasses", manager: &ocsSnapshotClass{}, dependsOn: []string{"ExternalResources"}},
+		}
+	}
+
+	// for external cluster, we have a different set of ensure functions
+	return []managerNode{
+		{name: "ExternalResources", manager: &ocsExternalResources{}, serial: true},
+		{name: "ExternalProber", manager: &ocsExternalProber{}, dependsOn: []string{"ExternalResources"}, serial: true},
+		{name: "CephCluster", manager: &ocsCephCluster{}, dependsOn: []string{"ExternalResources"}, serial: true},
+		{name: "SnapshotClasses", manager: &ocsSnapshotClass{}, dependsOn: []string{"ExternalResources"}},
+		{name: "NooBaa", manager: &ocsNoobaaSystem{}, dependsOn: []string{"CephCluster"}, serial: true},
+		{name: "QuickStarts", manager: &ocsQuickStarts{}},
+	}
+}
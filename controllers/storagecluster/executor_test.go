@@ -0,0 +1,246 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	configv1 "github.com/openshift/api/config/v1"
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeResourceManager records the order in which it was run and sets a
+// related object in the status of the StorageCluster it is given, along with
+// its condition if it has one
+type fakeResourceManager struct {
+	name      string
+	err       error
+	started   chan struct{}
+	wait      chan struct{}
+	lock      *sync.Mutex
+	order     *[]string
+	condition *conditionsv1.Condition
+	setSpec   bool
+}
+
+func (f *fakeResourceManager) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	if f.started != nil {
+		close(f.started)
+	}
+	if f.wait != nil {
+		<-f.wait
+	}
+	f.lock.Lock()
+	*f.order = append(*f.order, f.name)
+	f.lock.Unlock()
+	sc.Status.RelatedObjects = append(sc.Status.RelatedObjects, corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Namespace:  sc.Namespace,
+		Name:       f.name,
+	})
+	if f.condition != nil {
+		conditionsv1.SetStatusCondition(&sc.Status.Conditions, *f.condition)
+	}
+	if f.setSpec {
+		sc.Spec.LabelSelector = nil
+	}
+	return f.err
+}
+
+func (f *fakeResourceManager) ensureDeleted(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	return nil
+}
+
+func TestEnsureResourceManagers(t *testing.T) {
+	var lock sync.Mutex
+	var order []string
+	newFake := func(name string, err error) *fakeResourceManager {
+		return &fakeResourceManager{name: name, err: err, lock: &lock, order: &order}
+	}
+
+	// "slow" only returns once "independent" has started, which proves that
+	// managers without dependencies between them run concurrently
+	independent := newFake("independent", nil)
+	independent.started = make(chan struct{})
+	slow := newFake("slow", nil)
+	slow.wait = independent.started
+
+	nodes := []managerNode{
+		{name: "slow", manager: slow},
+		{name: "independent", manager: independent},
+		{name: "after-slow", manager: newFake("after-slow", nil), dependsOn: []string{"slow"}},
+		{name: "failing", manager: newFake("failing", fmt.Errorf("boom"))},
+		{name: "after-failing", manager: newFake("after-failing", nil), dependsOn: []string{"failing", "slow"}},
+	}
+
+	reconciler := createFakeStorageClusterReconciler(t)
+	sc := createDefaultStorageCluster()
+	statuses, err := reconciler.ensureResourceManagers(sc, nodes)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failing: boom")
+
+	expected := map[string]ocsv1.ResourceManagerResult{
+		"slow":          ocsv1.ResourceManagerSucceeded,
+		"independent":   ocsv1.ResourceManagerSucceeded,
+		"after-slow":    ocsv1.ResourceManagerSucceeded,
+		"failing":       ocsv1.ResourceManagerFailed,
+		"after-failing": ocsv1.ResourceManagerSkipped,
+	}
+	assert.Len(t, statuses, len(nodes))
+	for i, status := range statuses {
+		assert.Equal(t, nodes[i].name, status.Name)
+		assert.Equalf(t, expected[status.Name], status.Result, "unexpected result for %q", status.Name)
+	}
+
+	assert.NotContains(t, order, "after-failing")
+	slowIndex, afterSlowIndex := -1, -1
+	for i, name := range order {
+		if name == "slow" {
+			slowIndex = i
+		} else if name == "after-slow" {
+			afterSlowIndex = i
+		}
+	}
+	assert.True(t, slowIndex < afterSlowIndex, "dependency ran after its dependent: %v", order)
+
+	// the status changes made by every manager that ran are kept
+	assert.Len(t, sc.Status.RelatedObjects, 4)
+}
+
+func TestEnsureResourceManagersPaused(t *testing.T) {
+	var lock sync.Mutex
+	var order []string
+	nodes := []managerNode{
+		{name: "paused", manager: &fakeResourceManager{name: "paused", lock: &lock, order: &order}},
+		{name: "after-paused", manager: &fakeResourceManager{name: "after-paused", lock: &lock, order: &order}, dependsOn: []string{"paused"}},
+	}
+
+	reconciler := createFakeStorageClusterReconciler(t)
+	sc := createDefaultStorageCluster()
+	sc.Annotations = map[string]string{PauseReconcileAnnotation: "paused"}
+	statuses, err := reconciler.ensureResourceManagers(sc, nodes)
+	assert.NoError(t, err)
+
+	// a paused manager doesn't hold back the managers which depend on it
+	assert.Equal(t, ocsv1.ResourceManagerPaused, statuses[0].Result)
+	assert.Equal(t, ocsv1.ResourceManagerSucceeded, statuses[1].Result)
+	assert.Equal(t, []string{"after-paused"}, order)
+}
+
+func TestEnsureResourceManagersConditions(t *testing.T) {
+	var lock sync.Mutex
+	var order []string
+	newFake := func(name string, conditionType conditionsv1.ConditionType) *fakeResourceManager {
+		return &fakeResourceManager{name: name, lock: &lock, order: &order, condition: &conditionsv1.Condition{
+			Type:   conditionType,
+			Status: corev1.ConditionTrue,
+			Reason: name,
+		}}
+	}
+
+	// both managers start from the same StorageCluster, each condition
+	// they set is kept
+	first := newFake("first", ocsv1.ConditionKMSConnected)
+	first.started = make(chan struct{})
+	second := newFake("second", ocsv1.ConditionExternalClusterConnecting)
+	second.wait = first.started
+	nodes := []managerNode{
+		{name: "first", manager: first},
+		{name: "second", manager: second},
+		{name: "spec", manager: &fakeResourceManager{name: "spec", lock: &lock, order: &order, setSpec: true}},
+	}
+
+	reconciler := createFakeStorageClusterReconciler(t)
+	sc := createDefaultStorageCluster()
+	sc.Spec.LabelSelector = &metav1.LabelSelector{}
+	sc.Status.Conditions = []conditionsv1.Condition{{Type: conditionsv1.ConditionAvailable, Status: corev1.ConditionTrue}}
+	statuses, err := reconciler.ensureResourceManagers(sc, nodes)
+
+	assert.True(t, conditionsv1.IsStatusConditionTrue(sc.Status.Conditions, conditionsv1.ConditionAvailable))
+	assert.True(t, conditionsv1.IsStatusConditionTrue(sc.Status.Conditions, ocsv1.ConditionKMSConnected))
+	assert.True(t, conditionsv1.IsStatusConditionTrue(sc.Status.Conditions, ocsv1.ConditionExternalClusterConnecting))
+
+	// the changes of the spec are not kept, and fail the manager
+	assert.Error(t, err)
+	assert.Equal(t, ocsv1.ResourceManagerFailed, statuses[2].Result)
+	assert.NotNil(t, sc.Spec.LabelSelector)
+}
+
+// TestEnsureResourceManagersRace runs the resource managers of the
+// StorageClusters, run it with -race to check that the managers running
+// concurrently don't share any state
+func TestEnsureResourceManagersRace(t *testing.T) {
+	for _, external := range []bool{false, true} {
+		sc := createDefaultStorageCluster()
+		sc.Spec.ExternalStorage.Enable = external
+		// the managers detect the platform concurrently
+		reconciler := createFakeInitializationStorageClusterReconcilerWithPlatform(t, &Platform{}, sc)
+		assert.NoError(t, configv1.AddToScheme(reconciler.Scheme))
+		assert.NoError(t, reconciler.Client.Create(context.TODO(), &configv1.Infrastructure{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster"},
+			Status:     configv1.InfrastructureStatus{Platform: configv1.NonePlatformType},
+		}))
+		reconciler.initializeImagesStatus(sc)
+		for i := 0; i < 2; i++ {
+			statuses, _ := reconciler.ensureResourceManagers(sc, getResourceManagerNodes(sc))
+			assert.Len(t, statuses, len(getResourceManagerNodes(sc)))
+		}
+	}
+}
+
+func TestValidateManagerNodes(t *testing.T) {
+	cases := []struct {
+		label   string
+		nodes   []managerNode
+		isValid bool
+	}{
+		{
+			label: "Case 1: valid dependencies",
+			nodes: []managerNode{
+				{name: "a"},
+				{name: "b", dependsOn: []string{"a"}},
+				{name: "c", dependsOn: []string{"a", "b"}},
+			},
+			isValid: true,
+		},
+		{
+			label: "Case 2: unknown dependency",
+			nodes: []managerNode{
+				{name: "a", dependsOn: []string{"b"}},
+			},
+			isValid: false,
+		},
+		{
+			label: "Case 3: dependency cycle",
+			nodes: []managerNode{
+				{name: "a", dependsOn: []string{"c"}},
+				{name: "b", dependsOn: []string{"a"}},
+				{name: "c", dependsOn: []string{"b"}},
+			},
+			isValid: false,
+		},
+		{
+			label: "Case 4: duplicate manager",
+			nodes: []managerNode{
+				{name: "a"},
+				{name: "a"},
+			},
+			isValid: false,
+		},
+	}
+
+	for _, c := range cases {
+		err := validateManagerNodes(c.nodes)
+		if c.isValid {
+			assert.NoErrorf(t, err, "[%s]", c.label)
+		} else {
+			assert.Errorf(t, err, "[%s]", c.label)
+		}
+	}
+}
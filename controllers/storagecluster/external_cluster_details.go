@@ -0,0 +1,501 @@
+package storagecluster
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ExternalClusterDetailsV1 is the version of the current format of the
+// external cluster details
+const ExternalClusterDetailsV1 = "v1"
+
+// names of the resources in the legacy external cluster details, which are
+// also the names of the ConfigMaps and Secrets created from the details
+const (
+	externalMonEndpointsConfigMap   = "rook-ceph-mon-endpoints"
+	externalMonSecret               = "rook-ceph-mon"
+	externalOperatorCredsSecret     = "rook-ceph-operator-creds"
+	externalRBDNodeSecret           = "rook-csi-rbd-node"
+	externalRBDProvisionerSecret    = "rook-csi-rbd-provisioner"
+	externalCephFSNodeSecret        = "rook-csi-cephfs-node"
+	externalCephFSProvisionerSecret = "rook-csi-cephfs-provisioner"
+	externalDashboardLinkSecret     = "rook-ceph-dashboard-link"
+	externalMonitoringEndpoint      = "monitoring-endpoint"
+)
+
+var fsidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ExternalClusterDetails describes the Ceph cluster which a StorageCluster
+// in external mode connects to. It is exported from the Ceph cluster to the
+// externalClusterDetailsKey of the externalClusterDetailsSecret, either as
+// is or in the legacy format, a list of ExternalResources.
+type ExternalClusterDetails struct {
+	// Version of the format, ExternalClusterDetailsV1
+	Version string `json:"version"`
+	// Mons of the Ceph cluster
+	Mons ExternalMons `json:"mons"`
+	// Users are the Ceph users of the operator and the CSI drivers
+	Users ExternalUsers `json:"users,omitempty"`
+	// BlockPool is the RBD pool of the block StorageClasses, which are not
+	// created when it is not set
+	BlockPool *ExternalBlockPool `json:"blockPool,omitempty"`
+	// Filesystem is the CephFS of the filesystem StorageClass, which is not
+	// created when it is not set
+	Filesystem *ExternalFilesystem `json:"filesystem,omitempty"`
+	// RGW is the object store of the OBC StorageClass, which is not created
+	// when it is not set
+	RGW *ExternalRGW `json:"rgw,omitempty"`
+	// Monitoring is how to reach the Prometheus exporter and the dashboard
+	// of the Ceph manager
+	Monitoring *ExternalMonitoring `json:"monitoring,omitempty"`
+}
+
+// ExternalMons describes the mons of the external Ceph cluster
+type ExternalMons struct {
+	FSID        string `json:"fsid,omitempty"`
+	ClusterName string `json:"clusterName,omitempty"`
+	// Endpoints are the names and the addresses of the mons
+	Endpoints []ExternalMonEndpoint `json:"endpoints"`
+	MaxMonID  int                   `json:"maxMonId,omitempty"`
+	// AdminSecret and MonSecret are only passed on to Rook, which doesn't
+	// need them in external mode
+	AdminSecret string `json:"adminSecret,omitempty"`
+	MonSecret   string `json:"monSecret,omitempty"`
+}
+
+// ExternalMonEndpoint is a mon of the external Ceph cluster
+type ExternalMonEndpoint struct {
+	Name string `json:"name"`
+	// Address is the <host>:<port> of the mon
+	Address string `json:"address"`
+}
+
+// ExternalUsers are the Ceph users created for the StorageCluster on the
+// external Ceph cluster
+type ExternalUsers struct {
+	Operator          *ExternalCephUser `json:"operator,omitempty"`
+	RBDNode           *ExternalCephUser `json:"rbdNode,omitempty"`
+	RBDProvisioner    *ExternalCephUser `json:"rbdProvisioner,omitempty"`
+	CephFSNode        *ExternalCephUser `json:"cephfsNode,omitempty"`
+	CephFSProvisioner *ExternalCephUser `json:"cephfsProvisioner,omitempty"`
+}
+
+// ExternalCephUser is the name and the base64 encoded key of a Ceph user
+type ExternalCephUser struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+}
+
+// ExternalBlockPool is an RBD pool of the external Ceph cluster
+type ExternalBlockPool struct {
+	Name string `json:"name"`
+	// DataPool is the erasure coded pool of the RBD images, if any
+	DataPool string `json:"dataPool,omitempty"`
+}
+
+// ExternalFilesystem is a CephFS of the external Ceph cluster
+type ExternalFilesystem struct {
+	Name     string `json:"name"`
+	DataPool string `json:"dataPool"`
+}
+
+// ExternalRGW is the object store of the external Ceph cluster
+type ExternalRGW struct {
+	// Scheme of the RGW endpoint, http, the default, or https
+	Scheme string `json:"scheme,omitempty"`
+	// Endpoint is the <host>:<port> of the RGW
+	Endpoint   string `json:"endpoint"`
+	PoolPrefix string `json:"poolPrefix,omitempty"`
+	// TLS is how to verify the certificate of an RGW serving HTTPS. The CA
+	// certificates of the system are used without it.
+	TLS *ExternalTLS `json:"tls,omitempty"`
+}
+
+// ExternalTLS is how to verify the certificate of a TLS endpoint
+type ExternalTLS struct {
+	// CACert is the PEM encoded bundle of the CA certificates which the
+	// certificate of the endpoint is checked against
+	CACert string `json:"caCert"`
+	// ServerName is the host name in the certificate, when it isn't the one
+	// of the endpoint
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// ExternalMonitoring describes the monitoring endpoints of the external Ceph
+// cluster
+type ExternalMonitoring struct {
+	// Endpoints are the IPs of the Ceph managers
+	Endpoints []string `json:"endpoints,omitempty"`
+	// Port of the Prometheus exporter of the managers, Rook uses its
+	// default one when it is not set
+	Port         int    `json:"port,omitempty"`
+	DashboardURL string `json:"dashboardURL,omitempty"`
+}
+
+// parseExternalClusterDetails decodes the external cluster details in either
+// format and validates them. It also returns the unknown resources and keys of
+// the legacy format, which are ignored.
+func parseExternalClusterDetails(blob []byte) (*ExternalClusterDetails, []string, error) {
+	blob = bytes.TrimSpace(blob)
+	details := &ExternalClusterDetails{}
+	var ignored []string
+	if bytes.HasPrefix(blob, []byte("[")) {
+		var resources []ExternalResource
+		if err := json.Unmarshal(blob, &resources); err != nil {
+			return nil, nil, fmt.Errorf("invalid external cluster details: %v", err)
+		}
+		var errs field.ErrorList
+		if details, ignored, errs = convertExternalResources(resources); len(errs) > 0 {
+			return nil, nil, fmt.Errorf("invalid external cluster details: %v", errs.ToAggregate())
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(blob))
+		// a misspelled field would otherwise be silently ignored
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(details); err != nil {
+			return nil, nil, fmt.Errorf("invalid external cluster details: %v", err)
+		}
+	}
+	if errs := validateExternalClusterDetails(details); len(errs) > 0 {
+		return nil, nil, fmt.Errorf("invalid external cluster details: %v", errs.ToAggregate())
+	}
+	return details, ignored, nil
+}
+
+// convertExternalResources converts the legacy external cluster details to
+// the current format. The exporting script of older and newer Ceph versions
+// may add resources and keys this version doesn't know about, so they are
+// ignored and returned.
+func convertExternalResources(resources []ExternalResource) (*ExternalClusterDetails, []string, field.ErrorList) {
+	details := &ExternalClusterDetails{Version: ExternalClusterDetailsV1}
+	var ignored []string
+	var errs field.ErrorList
+	seen := map[string]bool{}
+	for _, res := range resources {
+		path := field.NewPath(res.Kind + "/" + res.Name)
+		if seen[path.String()] {
+			errs = append(errs, field.Duplicate(path, res.Name))
+			continue
+		}
+		seen[path.String()] = true
+		data := res.Data
+		var keys []string
+		switch res.Kind + "/" + res.Name {
+		case "ConfigMap/" + externalMonEndpointsConfigMap:
+			keys = []string{"data", "maxMonId", "mapping"}
+			for _, mon := range strings.Split(data["data"], ",") {
+				nameAndAddress := strings.SplitN(mon, "=", 2)
+				if len(nameAndAddress) != 2 {
+					errs = append(errs, field.Invalid(path.Child("data").Key("data"), data["data"], "expected <name>=<host>:<port>[,...]"))
+					break
+				}
+				details.Mons.Endpoints = append(details.Mons.Endpoints,
+					ExternalMonEndpoint{Name: nameAndAddress[0], Address: nameAndAddress[1]})
+			}
+			if maxMonID, ok := data["maxMonId"]; ok {
+				id, err := strconv.Atoi(maxMonID)
+				if err != nil {
+					errs = append(errs, field.Invalid(path.Child("data").Key("maxMonId"), maxMonID, "must be an integer"))
+				}
+				details.Mons.MaxMonID = id
+			}
+		case "Secret/" + externalMonSecret:
+			keys = []string{"fsid", "cluster-name", "admin-secret", "mon-secret"}
+			details.Mons.FSID = data["fsid"]
+			details.Mons.ClusterName = data["cluster-name"]
+			details.Mons.AdminSecret = data["admin-secret"]
+			details.Mons.MonSecret = data["mon-secret"]
+		case "Secret/" + externalOperatorCredsSecret:
+			keys = []string{"userID", "userKey"}
+			details.Users.Operator = &ExternalCephUser{ID: data["userID"], Key: data["userKey"]}
+		case "Secret/" + externalRBDNodeSecret:
+			keys = []string{"userID", "userKey"}
+			details.Users.RBDNode = &ExternalCephUser{ID: data["userID"], Key: data["userKey"]}
+		case "Secret/" + externalRBDProvisionerSecret:
+			keys = []string{"userID", "userKey"}
+			details.Users.RBDProvisioner = &ExternalCephUser{ID: data["userID"], Key: data["userKey"]}
+		case "Secret/" + externalCephFSNodeSecret:
+			keys = []string{"adminID", "adminKey"}
+			details.Users.CephFSNode = &ExternalCephUser{ID: data["adminID"], Key: data["adminKey"]}
+		case "Secret/" + externalCephFSProvisionerSecret:
+			keys = []string{"adminID", "adminKey"}
+			details.Users.CephFSProvisioner = &ExternalCephUser{ID: data["adminID"], Key: data["adminKey"]}
+		case "Secret/" + externalDashboardLinkSecret:
+			keys = []string{"userID", "userKey"}
+			if details.Monitoring == nil {
+				details.Monitoring = &ExternalMonitoring{}
+			}
+			details.Monitoring.DashboardURL = data["userKey"]
+		case "StorageClass/" + cephRbdStorageClassName:
+			keys = []string{"pool", "dataPool"}
+			details.BlockPool = &ExternalBlockPool{Name: data["pool"], DataPool: data["dataPool"]}
+		case "StorageClass/" + cephFsStorageClassName:
+			keys = []string{"fsName", "pool"}
+			details.Filesystem = &ExternalFilesystem{Name: data["fsName"], DataPool: data["pool"]}
+		case "StorageClass/" + cephRgwStorageClassName:
+			keys = []string{externalCephRgwEndpointKey, "poolPrefix"}
+			details.RGW = &ExternalRGW{Endpoint: data[externalCephRgwEndpointKey], PoolPrefix: data["poolPrefix"]}
+			// the endpoint may be an URL
+			if schemeAndHost := strings.SplitN(details.RGW.Endpoint, "://", 2); len(schemeAndHost) == 2 {
+				details.RGW.Scheme, details.RGW.Endpoint = schemeAndHost[0], schemeAndHost[1]
+			}
+		case "CephCluster/" + externalMonitoringEndpoint:
+			keys = []string{"MonitoringEndpoint", "MonitoringPort"}
+			if details.Monitoring == nil {
+				details.Monitoring = &ExternalMonitoring{}
+			}
+			details.Monitoring.Endpoints = parseMonitoringIPs(data["MonitoringEndpoint"])
+			if port, ok := data["MonitoringPort"]; ok && port != "" {
+				portNum, err := strconv.ParseUint(port, 10, 16)
+				if err != nil {
+					errs = append(errs, field.Invalid(path.Child("data").Key("MonitoringPort"), port, "must be a port number"))
+				}
+				details.Monitoring.Port = int(portNum)
+			}
+		default:
+			ignored = append(ignored, path.String())
+			continue
+		}
+		ignored = append(ignored, getUnknownExternalResourceKeys(path.Child("data"), data, keys)...)
+	}
+	return details, ignored, errs
+}
+
+// getUnknownExternalResourceKeys returns the paths of the keys of data which
+// are not in keys, sorted
+func getUnknownExternalResourceKeys(path *field.Path, data map[string]string, keys []string) []string {
+	known := map[string]bool{}
+	for _, key := range keys {
+		known[key] = true
+	}
+	var unknown []string
+	for key := range data {
+		if !known[key] {
+			unknown = append(unknown, path.Key(key).String())
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// validateExternalClusterDetails checks the external cluster details and
+// returns an error for each invalid field
+func validateExternalClusterDetails(details *ExternalClusterDetails) field.ErrorList {
+	var errs field.ErrorList
+	if details.Version != ExternalClusterDetailsV1 {
+		errs = append(errs, field.NotSupported(field.NewPath("version"), details.Version, []string{ExternalClusterDetailsV1}))
+	}
+
+	monsPath := field.NewPath("mons")
+	if details.Mons.FSID != "" && !fsidRegexp.MatchString(details.Mons.FSID) {
+		errs = append(errs, field.Invalid(monsPath.Child("fsid"), details.Mons.FSID, "must be a UUID"))
+	}
+	if len(details.Mons.Endpoints) == 0 {
+		errs = append(errs, field.Required(monsPath.Child("endpoints"), "at least one mon is needed"))
+	}
+	monNames := map[string]bool{}
+	for i, mon := range details.Mons.Endpoints {
+		path := monsPath.Child("endpoints").Index(i)
+		if mon.Name == "" || strings.ContainsAny(mon.Name, "=,") {
+			errs = append(errs, field.Invalid(path.Child("name"), mon.Name, "must be a non empty name without '=' and ','"))
+		} else if monNames[mon.Name] {
+			errs = append(errs, field.Duplicate(path.Child("name"), mon.Name))
+		}
+		monNames[mon.Name] = true
+		errs = append(errs, validateHostPort(path.Child("address"), mon.Address)...)
+	}
+	if details.Mons.MaxMonID < 0 {
+		errs = append(errs, field.Invalid(monsPath.Child("maxMonId"), details.Mons.MaxMonID, "must not be negative"))
+	}
+
+	usersPath := field.NewPath("users")
+	for name, user := range map[string]*ExternalCephUser{
+		"operator":          details.Users.Operator,
+		"rbdNode":           details.Users.RBDNode,
+		"rbdProvisioner":    details.Users.RBDProvisioner,
+		"cephfsNode":        details.Users.CephFSNode,
+		"cephfsProvisioner": details.Users.CephFSProvisioner,
+	} {
+		if user == nil {
+			continue
+		}
+		path := usersPath.Child(name)
+		if user.ID == "" {
+			errs = append(errs, field.Required(path.Child("id"), ""))
+		}
+		if user.Key == "" {
+			errs = append(errs, field.Required(path.Child("key"), ""))
+		} else if _, err := base64.StdEncoding.DecodeString(user.Key); err != nil {
+			// the key itself is not part of the error, not to leak it
+			errs = append(errs, field.Invalid(path.Child("key"), "", "must be base64 encoded"))
+		}
+	}
+
+	if pool := details.BlockPool; pool != nil && pool.Name == "" {
+		errs = append(errs, field.Required(field.NewPath("blockPool", "name"), ""))
+	}
+
+	if fs := details.Filesystem; fs != nil {
+		if fs.Name == "" {
+			errs = append(errs, field.Required(field.NewPath("filesystem", "name"), ""))
+		}
+		if fs.DataPool == "" {
+			errs = append(errs, field.Required(field.NewPath("filesystem", "dataPool"), ""))
+		}
+	}
+
+	if rgw := details.RGW; rgw != nil {
+		rgwPath := field.NewPath("rgw")
+		errs = append(errs, validateHostPort(rgwPath.Child("endpoint"), rgw.Endpoint)...)
+		switch rgw.Scheme {
+		case "", "http":
+			if rgw.TLS != nil {
+				errs = append(errs, field.Forbidden(rgwPath.Child("tls"), "only allowed with the https scheme"))
+			}
+		case "https":
+			if rgw.TLS == nil {
+				break
+			}
+			if rgw.TLS.CACert == "" {
+				errs = append(errs, field.Required(rgwPath.Child("tls", "caCert"), "needed when tls is set"))
+			} else if !x509.NewCertPool().AppendCertsFromPEM([]byte(rgw.TLS.CACert)) {
+				errs = append(errs, field.Invalid(rgwPath.Child("tls", "caCert"), "", "must contain PEM encoded certificates"))
+			}
+		default:
+			errs = append(errs, field.NotSupported(rgwPath.Child("scheme"), rgw.Scheme, []string{"http", "https"}))
+		}
+	}
+
+	if monitoring := details.Monitoring; monitoring != nil {
+		monitoringPath := field.NewPath("monitoring")
+		if len(monitoring.Endpoints) == 0 && monitoring.DashboardURL == "" {
+			errs = append(errs, field.Required(monitoringPath.Child("endpoints"), "at least one manager is needed"))
+		}
+		for i, ip := range monitoring.Endpoints {
+			if net.ParseIP(ip) == nil {
+				errs = append(errs, field.Invalid(monitoringPath.Child("endpoints").Index(i), ip, "must be an IP address"))
+			}
+		}
+		if monitoring.Port < 0 || monitoring.Port > 65535 {
+			errs = append(errs, field.Invalid(monitoringPath.Child("port"), monitoring.Port, "must be a port number"))
+		}
+		if monitoring.DashboardURL != "" {
+			if u, err := url.Parse(monitoring.DashboardURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, field.Invalid(monitoringPath.Child("dashboardURL"), monitoring.DashboardURL, "must be an http or https URL"))
+			}
+		}
+	}
+	return errs
+}
+
+// isTLS returns whether the RGW serves HTTPS
+func (rgw *ExternalRGW) isTLS() bool {
+	return rgw.Scheme == "https"
+}
+
+// tlsConfig returns the configuration to connect to the RGW over TLS
+func (rgw *ExternalRGW) tlsConfig() *tls.Config {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if rgw.TLS != nil {
+		config.RootCAs = x509.NewCertPool()
+		config.RootCAs.AppendCertsFromPEM([]byte(rgw.TLS.CACert))
+		config.ServerName = rgw.TLS.ServerName
+	}
+	return config
+}
+
+func validateHostPort(path *field.Path, hostPort string) field.ErrorList {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil || host == "" {
+		return field.ErrorList{field.Invalid(path, hostPort, "must be <host>:<port>")}
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return field.ErrorList{field.Invalid(path, hostPort, "must have a valid port number")}
+	}
+	return nil
+}
+
+// configMapsAndSecrets returns the ConfigMaps and Secrets which Rook and the
+// CSI drivers read the external cluster details from
+func (details *ExternalClusterDetails) configMapsAndSecrets() []ExternalResource {
+	var monEndpoints []string
+	for _, mon := range details.Mons.Endpoints {
+		monEndpoints = append(monEndpoints, mon.Name+"="+mon.Address)
+	}
+	resources := []ExternalResource{
+		{
+			Kind: "ConfigMap",
+			Name: externalMonEndpointsConfigMap,
+			Data: map[string]string{
+				"data":     strings.Join(monEndpoints, ","),
+				"maxMonId": strconv.Itoa(details.Mons.MaxMonID),
+				"mapping":  "{}",
+			},
+		},
+	}
+	if details.Mons.FSID != "" {
+		monSecret := ExternalResource{
+			Kind: "Secret",
+			Name: externalMonSecret,
+			Data: map[string]string{
+				"fsid": details.Mons.FSID,
+				// the placeholders written by the export script
+				"admin-secret": "admin-secret",
+				"mon-secret":   "mon-secret",
+			},
+		}
+		if details.Mons.ClusterName != "" {
+			monSecret.Data["cluster-name"] = details.Mons.ClusterName
+		}
+		if details.Mons.AdminSecret != "" {
+			monSecret.Data["admin-secret"] = details.Mons.AdminSecret
+		}
+		if details.Mons.MonSecret != "" {
+			monSecret.Data["mon-secret"] = details.Mons.MonSecret
+		}
+		resources = append(resources, monSecret)
+	}
+
+	for _, user := range []struct {
+		secretName string
+		user       *ExternalCephUser
+		idKey      string
+		keyKey     string
+	}{
+		{externalOperatorCredsSecret, details.Users.Operator, "userID", "userKey"},
+		{externalRBDNodeSecret, details.Users.RBDNode, "userID", "userKey"},
+		{externalRBDProvisionerSecret, details.Users.RBDProvisioner, "userID", "userKey"},
+		{externalCephFSNodeSecret, details.Users.CephFSNode, "adminID", "adminKey"},
+		{externalCephFSProvisionerSecret, details.Users.CephFSProvisioner, "adminID", "adminKey"},
+	} {
+		if user.user == nil {
+			continue
+		}
+		resources = append(resources, ExternalResource{
+			Kind: "Secret",
+			Name: user.secretName,
+			Data: map[string]string{user.idKey: user.user.ID, user.keyKey: user.user.Key},
+		})
+	}
+
+	if details.Monitoring != nil && details.Monitoring.DashboardURL != "" {
+		resources = append(resources, ExternalResource{
+			Kind: "Secret",
+			Name: externalDashboardLinkSecret,
+			Data: map[string]string{"userID": "ceph-dashboard-link", "userKey": details.Monitoring.DashboardURL},
+		})
+	}
+	return resources
+}
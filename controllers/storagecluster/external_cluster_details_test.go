@@ -0,0 +1,278 @@
+package storagecluster
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	api "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+)
+
+var testExternalClusterDetailsV1 = `{
+	"version": "v1",
+	"mons": {
+		"fsid": "0f3e6d2c-1a9b-4c1e-9d7a-5b2e8f1c3a4d",
+		"endpoints": [{"name": "a", "address": "10.20.30.40:6789"}]
+	},
+	"users": {
+		"rbdNode": {"id": "csi-rbd-node", "key": "someUserKeyRBD=="},
+		"cephfsNode": {"id": "csi-cephfs-node", "key": "someUserKeyFS1=="}
+	},
+	"blockPool": {"name": "rbd"},
+	"filesystem": {"name": "myfs", "dataPool": "myfs-data0"},
+	"rgw": {"endpoint": "10.20.30.41:8080", "poolPrefix": "default"},
+	"monitoring": {"endpoints": ["10.20.30.42"], "port": 9283, "dashboardURL": "https://10.20.30.42:8443/"}
+}`
+
+func TestParseExternalClusterDetails(t *testing.T) {
+	cases := []struct {
+		label   string
+		details string
+		// the invalid field of the external cluster details, if any
+		errorField string
+		// the unknown resources and keys of the legacy format
+		ignored []string
+	}{
+		{
+			label:   "Case 1: current format",
+			details: testExternalClusterDetailsV1,
+		},
+		{
+			label:      "Case 2: unsupported version",
+			details:    `{"version": "v2", "mons": {"endpoints": [{"name": "a", "address": "10.20.30.40:6789"}]}}`,
+			errorField: "version",
+		},
+		{
+			label:      "Case 3: misspelled field",
+			details:    `{"version": "v1", "mons": {"endpoints": [{"name": "a", "address": "10.20.30.40:6789"}]}, "blockPools": [{"name": "rbd"}]}`,
+			errorField: "blockPools",
+		},
+		{
+			label:      "Case 4: no mons",
+			details:    `{"version": "v1", "mons": {}}`,
+			errorField: "mons.endpoints",
+		},
+		{
+			label:      "Case 5: mon without port",
+			details:    `{"version": "v1", "mons": {"endpoints": [{"name": "a", "address": "10.20.30.40"}]}}`,
+			errorField: "mons.endpoints[0].address",
+		},
+		{
+			label:      "Case 6: invalid fsid",
+			details:    `{"version": "v1", "mons": {"fsid": "abc", "endpoints": [{"name": "a", "address": "10.20.30.40:6789"}]}}`,
+			errorField: "mons.fsid",
+		},
+		{
+			label: "Case 7: truncated user key",
+			details: `{"version": "v1", "mons": {"endpoints": [{"name": "a", "address": "10.20.30.40:6789"}]},
+				"users": {"rbdProvisioner": {"id": "csi-rbd-provisioner", "key": "AQBsomeKey="}}}`,
+			errorField: "users.rbdProvisioner.key",
+		},
+		{
+			label: "Case 8: filesystem without data pool",
+			details: `{"version": "v1", "mons": {"endpoints": [{"name": "a", "address": "10.20.30.40:6789"}]},
+				"filesystem": {"name": "myfs"}}`,
+			errorField: "filesystem.dataPool",
+		},
+		{
+			label: "Case 9: invalid RGW CA certificate",
+			details: `{"version": "v1", "mons": {"endpoints": [{"name": "a", "address": "10.20.30.40:6789"}]},
+				"rgw": {"scheme": "https", "endpoint": "10.20.30.41:443", "tls": {"caCert": "not a certificate"}}}`,
+			errorField: "rgw.tls.caCert",
+		},
+		{
+			label: "Case 10: RGW TLS without CA certificate",
+			details: `{"version": "v1", "mons": {"endpoints": [{"name": "a", "address": "10.20.30.40:6789"}]},
+				"rgw": {"scheme": "https", "endpoint": "10.20.30.41:443", "tls": {"serverName": "rgw.example.com"}}}`,
+			errorField: "rgw.tls.caCert",
+		},
+		{
+			label: "Case 11: https RGW verified with the CA certificates of the system",
+			details: `{"version": "v1", "mons": {"endpoints": [{"name": "a", "address": "10.20.30.40:6789"}]},
+				"rgw": {"scheme": "https", "endpoint": "10.20.30.41:443"}}`,
+		},
+		{
+			label: "Case 12: monitoring endpoint which is not an IP",
+			details: `{"version": "v1", "mons": {"endpoints": [{"name": "a", "address": "10.20.30.40:6789"}]},
+				"monitoring": {"endpoints": ["mgr.example.com"]}}`,
+			errorField: "monitoring.endpoints[0]",
+		},
+		{
+			label: "Case 13: legacy format",
+			details: `[{"kind": "ConfigMap", "name": "rook-ceph-mon-endpoints", "data": {"data": "a=10.20.30.40:6789", "maxMonId": "0", "mapping": "{}"}},
+				{"kind": "StorageClass", "name": "ceph-rbd", "data": {"pool": "rbd"}}]`,
+		},
+		{
+			label: "Case 14: legacy format with an unknown resource",
+			details: `[{"kind": "ConfigMap", "name": "rook-ceph-mon-endpoints", "data": {"data": "a=10.20.30.40:6789", "maxMonId": "0", "mapping": "{}"}},
+				{"kind": "StorageClass", "name": "ceph-rbd-ec", "data": {"pool": "rbd"}}]`,
+			ignored: []string{"StorageClass/ceph-rbd-ec"},
+		},
+		{
+			label: "Case 15: legacy format with an unknown key",
+			details: `[{"kind": "ConfigMap", "name": "rook-ceph-mon-endpoints", "data": {"data": "a=10.20.30.40:6789", "maxMonId": "0", "mapping": "{}"}},
+				{"kind": "StorageClass", "name": "ceph-rbd", "data": {"pool": "rbd", "pol": "rbd"}}]`,
+			ignored: []string{"StorageClass/ceph-rbd.data[pol]"},
+		},
+		{
+			label: "Case 16: legacy format with an invalid monitoring port",
+			details: `[{"kind": "ConfigMap", "name": "rook-ceph-mon-endpoints", "data": {"data": "a=10.20.30.40:6789", "maxMonId": "0", "mapping": "{}"}},
+				{"kind": "CephCluster", "name": "monitoring-endpoint", "data": {"MonitoringEndpoint": "10.20.30.42", "MonitoringPort": "abcde"}}]`,
+			errorField: "CephCluster/monitoring-endpoint.data[MonitoringPort]",
+		},
+		{
+			label: "Case 17: legacy format with an https RGW endpoint",
+			details: `[{"kind": "ConfigMap", "name": "rook-ceph-mon-endpoints", "data": {"data": "a=10.20.30.40:6789", "maxMonId": "0", "mapping": "{}"}},
+				{"kind": "StorageClass", "name": "ceph-rgw", "data": {"endpoint": "https://10.20.30.41:443", "poolPrefix": "default"}}]`,
+		},
+	}
+
+	for _, c := range cases {
+		details, ignored, err := parseExternalClusterDetails([]byte(c.details))
+		if c.errorField != "" {
+			if assert.Errorf(t, err, "[%s]", c.label) {
+				assert.Containsf(t, err.Error(), c.errorField, "[%s]", c.label)
+			}
+			continue
+		}
+		if assert.NoErrorf(t, err, "[%s]", c.label) {
+			assert.Equalf(t, ExternalClusterDetailsV1, details.Version, "[%s]", c.label)
+			assert.Equalf(t, c.ignored, ignored, "[%s]", c.label)
+		}
+	}
+}
+
+func TestConvertExternalResources(t *testing.T) {
+	resources := append(globalTestExternalResources,
+		ExternalResource{
+			Kind: "Secret",
+			Name: externalMonSecret,
+			Data: map[string]string{
+				"fsid":         "0f3e6d2c-1a9b-4c1e-9d7a-5b2e8f1c3a4d",
+				"admin-secret": "admin-secret",
+				"mon-secret":   "mon-secret",
+			},
+		},
+		ExternalResource{
+			Kind: "Secret",
+			Name: externalCephFSNodeSecret,
+			Data: map[string]string{"adminID": "csi-cephfs-node", "adminKey": "someUserKeyFS1=="},
+		},
+		ExternalResource{
+			Kind: "CephCluster",
+			Name: externalMonitoringEndpoint,
+			Data: map[string]string{"MonitoringEndpoint": "10.20.30.42,10.20.30.43", "MonitoringPort": "9283"},
+		},
+	)
+	details, ignored, errs := convertExternalResources(resources)
+	assert.Empty(t, errs)
+	assert.Empty(t, ignored)
+	assert.Empty(t, validateExternalClusterDetails(details))
+	assert.Equal(t, []ExternalMonEndpoint{{Name: "a", Address: "10.20.30.40:1234"}}, details.Mons.Endpoints)
+	assert.Equal(t, &ExternalCephUser{ID: "csi-cephfs-node", Key: "someUserKeyFS1=="}, details.Users.CephFSNode)
+	assert.Equal(t, &ExternalBlockPool{Name: "device_health_metrics"}, details.BlockPool)
+	assert.Equal(t, &ExternalFilesystem{Name: "myfs", DataPool: "myfs-data0"}, details.Filesystem)
+	assert.Equal(t, &ExternalMonitoring{Endpoints: []string{"10.20.30.42", "10.20.30.43"}, Port: 9283}, details.Monitoring)
+
+	// the ConfigMaps and Secrets are the same as in the legacy format
+	converted := details.configMapsAndSecrets()
+	for _, res := range resources {
+		if res.Kind != "ConfigMap" && res.Kind != "Secret" {
+			continue
+		}
+		actual, err := findNamedResourceFromArray(converted, res.Name)
+		if assert.NoErrorf(t, err, "%s %s", res.Kind, res.Name) {
+			assert.Equal(t, res, actual)
+		}
+	}
+	assert.Len(t, converted, 4)
+
+	// and they are kept through the current format
+	blob, err := json.Marshal(details)
+	assert.NoError(t, err)
+	parsed, _, err := parseExternalClusterDetails(blob)
+	assert.NoError(t, err)
+	assert.Equal(t, details, parsed)
+}
+
+func TestExternalClusterDetailsValidCondition(t *testing.T) {
+	request := types.NamespacedName{Name: "ocsinit"}
+	extResources := append(globalTestExternalResources, ExternalResource{
+		Kind: "CephCluster",
+		Name: externalMonitoringEndpoint,
+		Data: map[string]string{"MonitoringEndpoint": "10.20.30.42", "MonitoringPort": "abcde"},
+	})
+	reconciler := createExternalClusterReconcilerFromCustomResources(t, extResources)
+	sc := &api.StorageCluster{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), request, sc))
+
+	// the invalid field is reported in the condition
+	assert.Error(t, (&ocsExternalResources{}).ensureCreated(&reconciler, sc))
+	condition := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionExternalClusterDetailsValid)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, api.ExternalClusterDetailsInvalid, condition.Reason)
+		assert.Contains(t, condition.Message, "CephCluster/monitoring-endpoint.data[MonitoringPort]")
+	}
+	assert.Empty(t, sc.Status.ExternalSecretHash)
+
+	// the details are applied once fixed
+	secret := &corev1.Secret{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalClusterDetailsSecret}, secret))
+	secret.Data[externalClusterDetailsKey] = []byte(`{
+		"version": "v1",
+		"mons": {"endpoints": [{"name": "a", "address": "10.20.30.40:1234"}]},
+		"users": {"rbdNode": {"id": "csi-rbd-node", "key": "someUserKeyRBD=="}},
+		"blockPool": {"name": "device_health_metrics"}
+	}`)
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), secret))
+	assert.NoError(t, (&ocsExternalResources{}).ensureCreated(&reconciler, sc))
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionExternalClusterDetailsValid)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+		assert.Equal(t, api.ExternalClusterDetailsValid, condition.Reason)
+	}
+	assert.NotEmpty(t, sc.Status.ExternalSecretHash)
+	configMap := &corev1.ConfigMap{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalMonEndpointsConfigMap}, configMap))
+	assert.Equal(t, "a=10.20.30.40:1234", configMap.Data["data"])
+}
+
+func TestExternalClusterDetailsIgnoredResources(t *testing.T) {
+	request := types.NamespacedName{Name: "ocsinit"}
+	extResources := removeNamedResourceFromArray(globalTestExternalResources, cephRgwStorageClassName)
+	extResources = append(extResources, ExternalResource{
+		Kind: "Secret",
+		Name: "unknown-secret",
+		Data: map[string]string{"key": "value"},
+	})
+	reconciler := createExternalClusterReconcilerFromCustomResources(t, extResources)
+	recorder := record.NewFakeRecorder(100)
+	reconciler.recorder = statusutil.NewEventReporter(recorder)
+	sc := &api.StorageCluster{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), request, sc))
+
+	// unknown resources don't fail the reconcile, they are reported instead
+	assert.NoError(t, (&ocsExternalResources{}).ensureCreated(&reconciler, sc))
+	condition := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionExternalClusterDetailsValid)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	}
+	assert.NotEmpty(t, sc.Status.ExternalSecretHash)
+	err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "unknown-secret"}, &corev1.Secret{})
+	assert.True(t, errors.IsNotFound(err))
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	assert.Contains(t, events, "Warning ExternalResourceIgnored Ignoring unknown resources and keys of the external cluster details in Secret "+
+		externalClusterDetailsSecret+": Secret/unknown-secret")
+}
@@ -0,0 +1,300 @@
+package storagecluster
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// externalProbeInterval is how often the operator probes the endpoints
+	// of the external cluster while they are all reachable
+	externalProbeInterval = 2 * time.Minute
+	// externalProbeMinBackoff and externalProbeMaxBackoff bound the delay
+	// between two probes while some endpoints are unreachable, which doubles
+	// after each failed probe
+	externalProbeMinBackoff = 10 * time.Second
+	externalProbeMaxBackoff = 5 * time.Minute
+	// externalProbeTimeout is how long an endpoint has to accept a connection
+	externalProbeTimeout = 5 * time.Second
+
+	externalEndpointMon           = "mon"
+	externalEndpointRGW           = "rgw"
+	externalEndpointMgrPrometheus = "mgr-prometheus"
+)
+
+// externalEndpoint is an endpoint of the external cluster the operator probes
+type externalEndpoint struct {
+	endpointType string
+	name         string
+	address      string
+	// tlsConfig is set for the endpoints which are probed with a TLS
+	// handshake
+	tlsConfig *tls.Config
+}
+
+func (e externalEndpoint) String() string {
+	if e.name != "" {
+		return fmt.Sprintf("%s %s (%s)", e.endpointType, e.name, e.address)
+	}
+	return fmt.Sprintf("%s %s", e.endpointType, e.address)
+}
+
+type ocsExternalProber struct{}
+
+// ensureCreated probes the mons, the RGW and the MGR Prometheus endpoints of
+// the external cluster, and records their reachability in the status. The
+// StorageCluster is requeued to probe them again, with a backoff while some
+// endpoints are unreachable.
+func (obj *ocsExternalProber) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	// the external cluster isn't probed in dry-run mode
+	if r.dryRun {
+		return nil
+	}
+	details, err := r.retrieveExternalSecretData(sc)
+	if err != nil {
+		return err
+	}
+	r.probeExternalCluster(sc, getExternalEndpoints(sc, details), time.Now())
+	return nil
+}
+
+// ensureDeleted removes the probe results of the external cluster
+func (obj *ocsExternalProber) ensureDeleted(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	sc.Status.ExternalCluster = nil
+	return nil
+}
+
+// getExternalEndpoints returns the endpoints of the external cluster which
+// the StorageCluster uses
+func getExternalEndpoints(sc *ocsv1.StorageCluster, details *ExternalClusterDetails) []externalEndpoint {
+	var endpoints []externalEndpoint
+	for _, mon := range details.Mons.Endpoints {
+		endpoints = append(endpoints, externalEndpoint{endpointType: externalEndpointMon, name: mon.Name, address: mon.Address})
+	}
+	// the object store and the monitoring of an additional external cluster
+	// are not used
+	if isAdditionalExternalStorageCluster(sc) {
+		return endpoints
+	}
+	if rgw := details.RGW; rgw != nil {
+		endpoint := externalEndpoint{endpointType: externalEndpointRGW, address: rgw.Endpoint}
+		if rgw.isTLS() {
+			endpoint.tlsConfig = rgw.tlsConfig()
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if monitoring := details.Monitoring; monitoring != nil && monitoring.Port != 0 {
+		for _, ip := range monitoring.Endpoints {
+			endpoints = append(endpoints, externalEndpoint{
+				endpointType: externalEndpointMgrPrometheus,
+				address:      net.JoinHostPort(ip, strconv.Itoa(monitoring.Port)),
+			})
+		}
+	}
+	return endpoints
+}
+
+// probeExternalCluster probes the endpoints of the external cluster, unless
+// the next probe isn't due yet and the endpoints haven't changed since the
+// last one, and records the results in the status of the StorageCluster
+func (r *StorageClusterReconciler) probeExternalCluster(sc *ocsv1.StorageCluster, endpoints []externalEndpoint, now time.Time) {
+	previous := sc.Status.ExternalCluster
+	if previous == nil {
+		previous = &ocsv1.ExternalClusterStatus{}
+	}
+	if previous.NextProbeTime != nil && now.Before(previous.NextProbeTime.Time) && sameExternalEndpoints(previous.Endpoints, endpoints) {
+		return
+	}
+
+	results := probeExternalEndpoints(endpoints, externalProbeTimeout)
+	probeTime := metav1.NewTime(now)
+	status := &ocsv1.ExternalClusterStatus{LastProbeTime: &probeTime}
+	var unreachable []string
+	monsReachable := 0
+	for i, endpoint := range endpoints {
+		endpointStatus := ocsv1.ExternalEndpointStatus{
+			Type:    endpoint.endpointType,
+			Name:    endpoint.name,
+			Address: endpoint.address,
+		}
+		var last *ocsv1.ExternalEndpointStatus
+		for j := range previous.Endpoints {
+			if previous.Endpoints[j].Type == endpoint.endpointType && previous.Endpoints[j].Address == endpoint.address {
+				last = &previous.Endpoints[j]
+				break
+			}
+		}
+		if results[i].err == nil {
+			endpointStatus.Reachable = true
+			endpointStatus.LastReachableTime = &probeTime
+			endpointStatus.LastProbeLatency = &metav1.Duration{Duration: results[i].latency}
+			if endpoint.endpointType == externalEndpointMon {
+				monsReachable++
+			}
+			if last != nil && !last.Reachable {
+				r.Log.Info("Endpoint of the external cluster is reachable again.", "Endpoint", endpoint.String(), "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+				r.recorder.Report(sc, corev1.EventTypeNormal, statusutil.EventReasonExternalEndpointReachable,
+					fmt.Sprintf("Reconnected to the %s of the external cluster", endpoint))
+			}
+		} else {
+			endpointStatus.Message = results[i].err.Error()
+			if last != nil {
+				endpointStatus.LastReachableTime = last.LastReachableTime
+			}
+			unreachable = append(unreachable, fmt.Sprintf("%s: %v", endpoint, results[i].err))
+			if last == nil || last.Reachable {
+				r.Log.Error(results[i].err, "Endpoint of the external cluster is unreachable.", "Endpoint", endpoint.String(), "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+				r.recorder.Report(sc, corev1.EventTypeWarning, statusutil.EventReasonExternalEndpointUnreachable,
+					fmt.Sprintf("Failed to connect to the %s of the external cluster: %v", endpoint, results[i].err))
+			}
+		}
+		status.Endpoints = append(status.Endpoints, endpointStatus)
+	}
+
+	var nextProbeTime metav1.Time
+	if len(unreachable) > 0 {
+		status.ConsecutiveFailures = previous.ConsecutiveFailures + 1
+		nextProbeTime = metav1.NewTime(now.Add(getExternalProbeBackoff(status.ConsecutiveFailures)))
+	} else {
+		nextProbeTime = metav1.NewTime(now.Add(externalProbeInterval))
+	}
+	status.NextProbeTime = &nextProbeTime
+	sc.Status.ExternalCluster = status
+}
+
+// setExternalClusterConnectionConditions reports the last probe of the
+// external cluster in the ExternalClusterConnected and
+// ExternalClusterConnecting conditions. It runs once the resource managers
+// are done, so that it is their only writer besides the mapping of the
+// CephCluster state. A failed probe takes precedence over the state reported
+// by Rook, which is kept otherwise.
+func setExternalClusterConnectionConditions(sc *ocsv1.StorageCluster, rookReported bool) {
+	status := sc.Status.ExternalCluster
+	if status == nil || status.LastProbeTime == nil {
+		return
+	}
+	var unreachable []string
+	monsReachable := 0
+	for _, endpointStatus := range status.Endpoints {
+		endpoint := externalEndpoint{endpointType: endpointStatus.Type, name: endpointStatus.Name, address: endpointStatus.Address}
+		if !endpointStatus.Reachable {
+			unreachable = append(unreachable, fmt.Sprintf("%s: %s", endpoint, endpointStatus.Message))
+		} else if endpoint.endpointType == externalEndpointMon {
+			monsReachable++
+		}
+	}
+
+	connected := conditionsv1.Condition{
+		Type:    ocsv1.ConditionExternalClusterConnected,
+		Status:  corev1.ConditionTrue,
+		Reason:  ocsv1.ExternalClusterConnected,
+		Message: ocsv1.ExternalClusterConnectedMessage,
+	}
+	switch {
+	case monsReachable == 0 && len(unreachable) > 0:
+		connected.Status = corev1.ConditionFalse
+		connected.Reason = ocsv1.ExternalClusterMonsUnreachable
+		connected.Message = fmt.Sprintf("None of the mons of the external cluster is reachable after %d failed attempts, next attempt at %s: %s",
+			status.ConsecutiveFailures, status.NextProbeTime.UTC().Format(time.RFC3339), strings.Join(unreachable, "; "))
+	case len(unreachable) > 0:
+		connected.Reason = ocsv1.ExternalClusterDegraded
+		connected.Message = fmt.Sprintf("Some endpoints of the external cluster are unreachable: %s", strings.Join(unreachable, "; "))
+	case rookReported:
+		return
+	}
+	connecting := conditionsv1.Condition{
+		Type:    ocsv1.ConditionExternalClusterConnecting,
+		Status:  corev1.ConditionFalse,
+		Reason:  connected.Reason,
+		Message: connected.Message,
+	}
+	if connected.Status == corev1.ConditionFalse {
+		connecting.Status = corev1.ConditionTrue
+	}
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, connected)
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, connecting)
+}
+
+type externalProbeResult struct {
+	err     error
+	latency time.Duration
+}
+
+// probeExternalEndpoint connects to an endpoint of the external cluster, with
+// a TLS handshake for the ones which need it. The tests replace it so as not
+// to depend on the network.
+var probeExternalEndpoint = func(endpoint externalEndpoint, timeout time.Duration) error {
+	if endpoint.tlsConfig != nil {
+		return checkTLSEndpointReachable(endpoint.address, endpoint.tlsConfig, timeout)
+	}
+	return checkEndpointReachable(endpoint.address, timeout)
+}
+
+// probeExternalEndpoints probes the endpoints concurrently
+func probeExternalEndpoints(endpoints []externalEndpoint, timeout time.Duration) []externalProbeResult {
+	results := make([]externalProbeResult, len(endpoints))
+	var wg sync.WaitGroup
+	for i := range endpoints {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			start := time.Now()
+			results[i].err = probeExternalEndpoint(endpoints[i], timeout)
+			results[i].latency = time.Since(start)
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// sameExternalEndpoints returns whether the endpoints were all probed last time
+func sameExternalEndpoints(probed []ocsv1.ExternalEndpointStatus, endpoints []externalEndpoint) bool {
+	if len(probed) != len(endpoints) {
+		return false
+	}
+	for i := range endpoints {
+		if probed[i].Type != endpoints[i].endpointType || probed[i].Address != endpoints[i].address {
+			return false
+		}
+	}
+	return true
+}
+
+// getExternalProbeBackoff returns the delay before the next probe after the
+// given number of failed probes in a row
+func getExternalProbeBackoff(failures int32) time.Duration {
+	backoff := externalProbeMinBackoff
+	for i := int32(1); i < failures && backoff < externalProbeMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > externalProbeMaxBackoff {
+		return externalProbeMaxBackoff
+	}
+	return backoff
+}
+
+// getExternalProbeRequeueAfter returns when the StorageCluster must be
+// reconciled again to probe the endpoints of the external cluster, 0 if it
+// doesn't need to
+func getExternalProbeRequeueAfter(sc *ocsv1.StorageCluster, now time.Time) time.Duration {
+	if sc.Status.ExternalCluster == nil || sc.Status.ExternalCluster.NextProbeTime == nil {
+		return 0
+	}
+	requeueAfter := sc.Status.ExternalCluster.NextProbeTime.Sub(now)
+	if requeueAfter < externalProbeMinBackoff {
+		return externalProbeMinBackoff
+	}
+	return requeueAfter
+}
@@ -0,0 +1,157 @@
+package storagecluster
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func init() {
+	// nothing listens on the endpoints of the test external clusters, the
+	// probes fail at once instead of waiting for the connections to time out
+	probeExternalEndpoint = func(endpoint externalEndpoint, timeout time.Duration) error {
+		return fmt.Errorf("dial tcp %s: connect: connection refused", endpoint.address)
+	}
+}
+
+// setReachableExternalEndpoints makes the probes only reach the given
+// addresses until the test ends
+func setReachableExternalEndpoints(t *testing.T, addresses ...string) {
+	probe := probeExternalEndpoint
+	t.Cleanup(func() { probeExternalEndpoint = probe })
+	reachable := map[string]bool{}
+	for _, address := range addresses {
+		reachable[address] = true
+	}
+	probeExternalEndpoint = func(endpoint externalEndpoint, timeout time.Duration) error {
+		if reachable[endpoint.address] {
+			return nil
+		}
+		return fmt.Errorf("dial tcp %s: connect: connection refused", endpoint.address)
+	}
+}
+
+func assertExternalClusterConnected(t *testing.T, sc *api.StorageCluster, status corev1.ConditionStatus, reason string) {
+	setExternalClusterConnectionConditions(sc, false)
+	connected := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionExternalClusterConnected)
+	if assert.NotNil(t, connected) {
+		assert.Equal(t, status, connected.Status)
+		assert.Equal(t, reason, connected.Reason)
+	}
+	connecting := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionExternalClusterConnecting)
+	if assert.NotNil(t, connecting) {
+		assert.NotEqual(t, status, connecting.Status)
+		assert.Equal(t, reason, connecting.Reason)
+	}
+}
+
+func TestProbeExternalCluster(t *testing.T) {
+	reconciler := createFakeStorageClusterReconciler(t)
+	sc := &api.StorageCluster{}
+	endpoints := []externalEndpoint{
+		{endpointType: externalEndpointMon, name: "a", address: "10.20.30.40:6789"},
+		{endpointType: externalEndpointMon, name: "b", address: "10.20.30.41:6789"},
+		{endpointType: externalEndpointRGW, address: "10.20.30.42:80"},
+	}
+	now := time.Now().Truncate(time.Second)
+
+	// the cluster is reachable through the other mon
+	setReachableExternalEndpoints(t, "10.20.30.40:6789", "10.20.30.42:80")
+	reconciler.probeExternalCluster(sc, endpoints, now)
+	status := sc.Status.ExternalCluster
+	if assert.NotNil(t, status) && assert.Len(t, status.Endpoints, 3) {
+		assert.True(t, status.Endpoints[0].Reachable)
+		assert.False(t, status.Endpoints[1].Reachable)
+		assert.NotEmpty(t, status.Endpoints[1].Message)
+		assert.Nil(t, status.Endpoints[1].LastReachableTime)
+		assert.True(t, status.Endpoints[2].Reachable)
+		assert.Equal(t, int32(1), status.ConsecutiveFailures)
+		assert.Equal(t, now.Add(externalProbeMinBackoff), status.NextProbeTime.Time)
+	}
+	assertExternalClusterConnected(t, sc, corev1.ConditionTrue, api.ExternalClusterDegraded)
+	assert.Equal(t, externalProbeMinBackoff, getExternalProbeRequeueAfter(sc, now))
+
+	// nothing is probed before the backoff expires
+	setReachableExternalEndpoints(t, "10.20.30.42:80")
+	reconciler.probeExternalCluster(sc, endpoints, now.Add(5*time.Second))
+	assert.Equal(t, now, sc.Status.ExternalCluster.LastProbeTime.Time)
+
+	// then none of the mons is reachable, and the backoff doubles
+	reconciler.probeExternalCluster(sc, endpoints, now.Add(externalProbeMinBackoff))
+	status = sc.Status.ExternalCluster
+	assert.False(t, status.Endpoints[0].Reachable)
+	assert.Equal(t, now, status.Endpoints[0].LastReachableTime.Time)
+	assert.Equal(t, int32(2), status.ConsecutiveFailures)
+	assert.Equal(t, now.Add(externalProbeMinBackoff+2*externalProbeMinBackoff), status.NextProbeTime.Time)
+	assertExternalClusterConnected(t, sc, corev1.ConditionFalse, api.ExternalClusterMonsUnreachable)
+
+	// new endpoints are probed right away
+	setReachableExternalEndpoints(t, "10.20.30.43:6789")
+	endpoints = []externalEndpoint{{endpointType: externalEndpointMon, name: "c", address: "10.20.30.43:6789"}}
+	probeTime := now.Add(externalProbeMinBackoff + time.Second)
+	reconciler.probeExternalCluster(sc, endpoints, probeTime)
+	status = sc.Status.ExternalCluster
+	if assert.Len(t, status.Endpoints, 1) {
+		assert.True(t, status.Endpoints[0].Reachable)
+		assert.NotNil(t, status.Endpoints[0].LastProbeLatency)
+	}
+	assert.Zero(t, status.ConsecutiveFailures)
+	assert.Equal(t, probeTime.Add(externalProbeInterval), status.NextProbeTime.Time)
+	assertExternalClusterConnected(t, sc, corev1.ConditionTrue, api.ExternalClusterConnected)
+
+	// the conditions reported by Rook are kept while the endpoints are reachable
+	rookCondition := conditionsv1.Condition{Type: api.ConditionExternalClusterConnected, Status: corev1.ConditionTrue, Reason: "ClusterConnected"}
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, rookCondition)
+	setExternalClusterConnectionConditions(sc, true)
+	assert.Equal(t, "ClusterConnected", conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionExternalClusterConnected).Reason)
+}
+
+func TestGetExternalEndpoints(t *testing.T) {
+	details := &ExternalClusterDetails{
+		Mons: ExternalMons{Endpoints: []ExternalMonEndpoint{{Name: "a", Address: "10.20.30.40:6789"}}},
+		RGW:  &ExternalRGW{Scheme: "https", Endpoint: "10.20.30.41:443", TLS: &ExternalTLS{ServerName: "rgw.example.com"}},
+		Monitoring: &ExternalMonitoring{
+			Endpoints: []string{"10.20.30.42", "10.20.30.43"},
+			Port:      9283,
+		},
+	}
+	sc := &api.StorageCluster{}
+	sc.Spec.ExternalStorage.Enable = true
+	endpoints := getExternalEndpoints(sc, details)
+	if assert.Len(t, endpoints, 4) {
+		assert.Equal(t, "mon a (10.20.30.40:6789)", endpoints[0].String())
+		assert.Equal(t, externalEndpointRGW, endpoints[1].endpointType)
+		assert.Equal(t, "rgw.example.com", endpoints[1].tlsConfig.ServerName)
+		assert.Equal(t, "mgr-prometheus 10.20.30.43:9283", endpoints[3].String())
+	}
+
+	// only the mons of an additional external cluster are used
+	sc.Spec.ExternalStorage.ClusterDetailsSecret = "backup-cluster-details"
+	assert.Len(t, getExternalEndpoints(sc, details), 1)
+}
+
+func TestGetExternalProbeBackoff(t *testing.T) {
+	for failures, expected := range map[int32]time.Duration{
+		1:   externalProbeMinBackoff,
+		2:   2 * externalProbeMinBackoff,
+		3:   4 * externalProbeMinBackoff,
+		6:   externalProbeMaxBackoff,
+		100: externalProbeMaxBackoff,
+	} {
+		assert.Equalf(t, expected, getExternalProbeBackoff(failures), "%d failures", failures)
+	}
+
+	now := time.Now()
+	sc := &api.StorageCluster{}
+	assert.Zero(t, getExternalProbeRequeueAfter(sc, now))
+	nextProbeTime := metav1.NewTime(now.Add(-time.Minute))
+	sc.Status.ExternalCluster = &api.ExternalClusterStatus{NextProbeTime: &nextProbeTime}
+	assert.Equal(t, externalProbeMinBackoff, getExternalProbeRequeueAfter(sc, now))
+	assert.Equal(t, 3*time.Minute, earliestRequeueAfter(0, 5*time.Minute, 3*time.Minute))
+}
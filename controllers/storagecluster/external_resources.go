@@ -3,22 +3,31 @@ package storagecluster
 import (
 	"context"
 	"crypto/sha512"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 const (
@@ -28,11 +37,24 @@ const (
 	cephRbdStorageClassName      = "ceph-rbd"
 	cephRgwStorageClassName      = "ceph-rgw"
 	externalCephRgwEndpointKey   = "endpoint"
+	// externalRgwCACertKey is the key of the CA certificates in the CA bundle
+	// Secret of the external CephObjectStore
+	externalRgwCACertKey = "cabundle"
+	// externalResourceLabel marks the ConfigMaps, Secrets, StorageClasses and
+	// CephObjectStores created from the external cluster details with the
+	// name of their StorageCluster, so that the ones removed from the details
+	// can be pruned
+	externalResourceLabel = "ocs.openshift.io/external-cluster-resource"
+	// externalResourcesVersion is hashed along the external cluster details,
+	// so that the resources created by an older operator are applied again
+	// once after an upgrade. Version 2 labels them with externalResourceLabel.
+	externalResourcesVersion = "2"
 )
 
 const (
 	rookCephOperatorConfigName = "rook-ceph-operator-config"
 	rookEnableCephFSCSIKey     = "ROOK_CSI_ENABLE_CEPHFS"
+	rookOperatorDeploymentName = "rook-ceph-operator"
 )
 
 // ExternalResource contains a list of External Cluster Resources
@@ -76,6 +98,30 @@ func checkEndpointReachable(endpoint string, timeout time.Duration) error {
 	return nil
 }
 
+// checkTLSEndpointReachable checks that the endpoint completes a TLS
+// handshake, with a certificate which is valid for the configuration
+func checkTLSEndpointReachable(endpoint string, config *tls.Config, timeout time.Duration) error {
+	con, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", endpoint, config)
+	if err != nil {
+		return err
+	}
+	defer con.Close()
+	return nil
+}
+
+// checkExternalEndpointReachable checks that an endpoint of the external
+// cluster is reachable, over TLS when tlsConfig is set. Nothing is checked in
+// dry-run mode.
+func (r *StorageClusterReconciler) checkExternalEndpointReachable(endpoint string, tlsConfig *tls.Config) error {
+	if r.dryRun {
+		return nil
+	}
+	if tlsConfig != nil {
+		return checkTLSEndpointReachable(endpoint, tlsConfig, 5*time.Second)
+	}
+	return checkEndpointReachable(endpoint, 5*time.Second)
+}
+
 func sha512sum(tobeHashed []byte) (string, error) {
 	h := sha512.New()
 	if _, err := h.Write(tobeHashed); err != nil {
@@ -88,26 +134,52 @@ func parseMonitoringIPs(monIP string) []string {
 	return strings.Fields(strings.ReplaceAll(monIP, ",", " "))
 }
 
-func (r *StorageClusterReconciler) externalSecretDataChecksum(instance *ocsv1.StorageCluster) (string, error) {
-	found, err := r.retrieveSecret(externalClusterDetailsSecret, instance)
-	if err != nil {
-		return "", err
+// getExternalClusterDetailsSecret returns the name of the Secret with the
+// details of the external cluster of the StorageCluster
+func getExternalClusterDetailsSecret(instance *ocsv1.StorageCluster) string {
+	if instance.Spec.ExternalStorage.ClusterDetailsSecret != "" {
+		return instance.Spec.ExternalStorage.ClusterDetailsSecret
 	}
-	return sha512sum(found.Data[externalClusterDetailsKey])
+	return externalClusterDetailsSecret
 }
 
-func (r *StorageClusterReconciler) sameExternalSecretData(instance *ocsv1.StorageCluster) bool {
-	extSecretChecksum, err := r.externalSecretDataChecksum(instance)
-	if err != nil {
-		return false
+// isAdditionalExternalStorageCluster returns whether the StorageCluster is an
+// external one besides the external cluster managed by Rook in its namespace.
+// Rook manages a single CephCluster per namespace, so each additional cluster
+// has an external CephCluster in a namespace of its own, through which Rook
+// adds it to the Ceph CSI configuration.
+func isAdditionalExternalStorageCluster(instance *ocsv1.StorageCluster) bool {
+	return instance.Spec.ExternalStorage.Enable && getExternalClusterDetailsSecret(instance) != externalClusterDetailsSecret
+}
+
+// validateExternalStorageSpec checks the name of the Secret with the details
+// of the external cluster
+func validateExternalStorageSpec(sc *ocsv1.StorageCluster) error {
+	// the webhook compares it with the previous spec, this catches the
+	// changes made while it was not running
+	if applied := sc.Status.ExternalClusterDetailsSecret; applied != "" && applied != getExternalClusterDetailsSecret(sc) {
+		return fmt.Errorf("failed to validate externalStorage: clusterDetailsSecret can't be changed from %q to %q once the external cluster details are applied",
+			applied, getExternalClusterDetailsSecret(sc))
 	}
-	// if the 'ExternalSecretHash' and fetched hash are same, then return true
-	if instance.Status.ExternalSecretHash == extSecretChecksum {
-		return true
+	secretName := sc.Spec.ExternalStorage.ClusterDetailsSecret
+	if secretName == "" {
+		return nil
 	}
-	// at this point the checksums are different, so update it
-	instance.Status.ExternalSecretHash = extSecretChecksum
-	return false
+	if !sc.Spec.ExternalStorage.Enable {
+		return fmt.Errorf("failed to validate externalStorage: clusterDetailsSecret is only used in external mode")
+	}
+	if errs := validation.IsDNS1123Subdomain(secretName); len(errs) > 0 {
+		return fmt.Errorf("failed to validate externalStorage: invalid clusterDetailsSecret %q: %s", secretName, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+func (r *StorageClusterReconciler) externalSecretDataChecksum(instance *ocsv1.StorageCluster) (string, error) {
+	found, err := r.retrieveSecret(getExternalClusterDetailsSecret(instance), instance)
+	if err != nil {
+		return "", err
+	}
+	return sha512sum(append([]byte(externalResourcesVersion+"\n"), found.Data[externalClusterDetailsKey]...))
 }
 
 // retrieveSecret function retrieves the secret object with the specified name
@@ -122,29 +194,34 @@ func (r *StorageClusterReconciler) retrieveSecret(secretName string, instance *o
 	return found, err
 }
 
-// retrieveExternalSecretData function retrieves the external secret and returns the data it contains
+// retrieveExternalSecretData function retrieves the external secret and returns the
+// validated external cluster details it contains
 func (r *StorageClusterReconciler) retrieveExternalSecretData(
-	instance *ocsv1.StorageCluster) ([]ExternalResource, error) {
-	found, err := r.retrieveSecret(externalClusterDetailsSecret, instance)
+	instance *ocsv1.StorageCluster) (*ExternalClusterDetails, error) {
+	found, err := r.retrieveSecret(getExternalClusterDetailsSecret(instance), instance)
 	if err != nil {
 		r.Log.Error(err, "Could not find the RookCeph external secret resource.")
 		return nil, err
 	}
-	var data []ExternalResource
-	err = json.Unmarshal(found.Data[externalClusterDetailsKey], &data)
+	details, ignored, err := parseExternalClusterDetails(found.Data[externalClusterDetailsKey])
 	if err != nil {
-		r.Log.Error(err, "Could not parse json blob.")
+		r.Log.Error(err, "Could not parse the external cluster details.", "Secret", klog.KRef(found.Namespace, found.Name))
 		return nil, err
 	}
-	return data, nil
+	if len(ignored) > 0 {
+		r.Log.Info("Ignoring unknown resources and keys of the external cluster details.", "Secret", klog.KRef(found.Namespace, found.Name), "Ignored", ignored)
+		r.recorder.ReportIfNotPresent(instance, corev1.EventTypeWarning, statusutil.EventReasonExternalResourceIgnored,
+			fmt.Sprintf("Ignoring unknown resources and keys of the external cluster details in Secret %s: %s", found.Name, strings.Join(ignored, ", ")))
+	}
+	return details, nil
 }
 
-func newExternalGatewaySpec(rgwEndpoint string, reqLogger logr.Logger) (*cephv1.GatewaySpec, error) {
+func newExternalGatewaySpec(rgw *ExternalRGW, reqLogger logr.Logger) (*cephv1.GatewaySpec, error) {
 	var gateWay cephv1.GatewaySpec
-	hostIP, portStr, err := net.SplitHostPort(rgwEndpoint)
+	hostIP, portStr, err := net.SplitHostPort(rgw.Endpoint)
 	if err != nil {
 		reqLogger.Error(err,
-			fmt.Sprintf("invalid rgw endpoint provided: %s", rgwEndpoint))
+			fmt.Sprintf("invalid rgw endpoint provided: %s", rgw.Endpoint))
 		return nil, err
 	}
 	if hostIP == "" {
@@ -159,7 +236,11 @@ func newExternalGatewaySpec(rgwEndpoint string, reqLogger logr.Logger) (*cephv1.
 			fmt.Sprintf("invalid rgw 'port' provided: %s", portStr))
 		return nil, err
 	}
-	gateWay.Port = int32(portInt64)
+	if rgw.isTLS() {
+		gateWay.SecurePort = int32(portInt64)
+	} else {
+		gateWay.Port = int32(portInt64)
+	}
 	// set PriorityClassName for the rgw pods
 	gateWay.PriorityClassName = openshiftUserCritical
 	gateWay.Instances = 1
@@ -169,13 +250,13 @@ func newExternalGatewaySpec(rgwEndpoint string, reqLogger logr.Logger) (*cephv1.
 // newExternalCephObjectStoreInstances returns a set of CephObjectStores
 // needed for external cluster mode
 func (r *StorageClusterReconciler) newExternalCephObjectStoreInstances(
-	initData *ocsv1.StorageCluster, rgwEndpoint string) ([]*cephv1.CephObjectStore, error) {
+	initData *ocsv1.StorageCluster, rgw *ExternalRGW) ([]*cephv1.CephObjectStore, error) {
 	// check whether the provided rgw endpoint is empty
-	if rgwEndpoint = strings.TrimSpace(rgwEndpoint); rgwEndpoint == "" {
+	if strings.TrimSpace(rgw.Endpoint) == "" {
 		r.Log.Info("Empty RGW Endpoint specified, external CephObjectStore won't be created.")
 		return nil, nil
 	}
-	gatewaySpec, err := newExternalGatewaySpec(rgwEndpoint, r.Log)
+	gatewaySpec, err := newExternalGatewaySpec(rgw, r.Log)
 	if err != nil {
 		return nil, err
 	}
@@ -205,90 +286,204 @@ func (r *StorageClusterReconciler) newExternalCephObjectStoreInstances(
 // ensureCreated ensures that requested resources for the external cluster
 // being created
 func (obj *ocsExternalResources) ensureCreated(r *StorageClusterReconciler, instance *ocsv1.StorageCluster) error {
-	if r.sameExternalSecretData(instance) {
+	extSecretChecksum, err := r.externalSecretDataChecksum(instance)
+	if err != nil {
+		r.Log.Error(err, "Could not read the external cluster details.", "Secret", klog.KRef(instance.Namespace, getExternalClusterDetailsSecret(instance)))
+		return err
+	}
+	// nothing changed in the external cluster details since they were last
+	// applied
+	if instance.Status.ExternalSecretHash == extSecretChecksum {
+		instance.Status.ExternalClusterDetailsSecret = getExternalClusterDetailsSecret(instance)
 		return nil
 	}
-	err := r.createExternalStorageClusterResources(instance)
+	details, err := r.retrieveExternalSecretData(instance)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			setExternalClusterDetailsValidCondition(instance, corev1.ConditionFalse, ocsv1.ExternalClusterDetailsInvalid, err.Error())
+		}
+		return err
+	}
+	setExternalClusterDetailsValidCondition(instance, corev1.ConditionTrue, ocsv1.ExternalClusterDetailsValid,
+		fmt.Sprintf("The external cluster details are valid, with format %s", details.Version))
+	err = r.createExternalStorageClusterResources(instance, details)
 	if err != nil {
 		r.Log.Error(err, "Could not create ExternalStorageClusterResource.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
 		return err
 	}
+	// only record the checksum once the details are fully applied, so that
+	// a failure is retried
+	instance.Status.ExternalSecretHash = extSecretChecksum
+	instance.Status.ExternalClusterDetailsSecret = getExternalClusterDetailsSecret(instance)
 	return nil
 }
 
-// ensureDeleted is dummy func for the ocsExternalResources
+func setExternalClusterDetailsValidCondition(instance *ocsv1.StorageCluster, status corev1.ConditionStatus, reason, message string) {
+	conditionsv1.SetStatusCondition(&instance.Status.Conditions, conditionsv1.Condition{
+		Type:    ocsv1.ConditionExternalClusterDetailsValid,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// ensureDeleted deletes the namespace of an additional external cluster.
+// Rook removes the cluster from the Ceph CSI configuration when its
+// CephCluster is deleted along the namespace.
 func (obj *ocsExternalResources) ensureDeleted(r *StorageClusterReconciler, instance *ocsv1.StorageCluster) error {
+	if !isAdditionalExternalStorageCluster(instance) {
+		return nil
+	}
+	namespace := &corev1.Namespace{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCSIClusterID(instance)}, namespace)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get the namespace of the external cluster %s: %v", generateNameForCSIClusterID(instance), err)
+	}
+	if namespace.Labels[externalResourceLabel] != instance.Name {
+		r.Log.Info("Namespace of the external cluster was not created by the StorageCluster, not deleting it.", "Namespace", klog.KRef("", namespace.Name))
+		return nil
+	}
+	if namespace.GetDeletionTimestamp().IsZero() {
+		r.Log.Info("Deleting the namespace of the external cluster.", "Namespace", klog.KRef("", namespace.Name))
+		if err := r.Client.Delete(context.TODO(), namespace); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete the namespace of the external cluster %s: %v", namespace.Name, err)
+		}
+	}
+	return fmt.Errorf("waiting for the namespace of the external cluster %s to be deleted", namespace.Name)
+}
+
+// ensureExternalClusterNamespace creates the namespace of an additional
+// external cluster
+func (r *StorageClusterReconciler) ensureExternalClusterNamespace(instance *ocsv1.StorageCluster) error {
+	name := generateNameForCSIClusterID(instance)
+	namespace := &corev1.Namespace{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: name}, namespace)
+	if err == nil {
+		if namespace.Labels[externalResourceLabel] != instance.Name {
+			return fmt.Errorf("namespace %s of the external cluster already exists and was not created by StorageCluster %s", name, instance.Name)
+		}
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+	namespace = &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{externalResourceLabel: instance.Name},
+		},
+	}
+	r.Log.Info("Creating the namespace of the external cluster.", "Namespace", klog.KRef("", name))
+	if err := r.Client.Create(context.TODO(), namespace); err != nil {
+		return err
+	}
+	r.recorder.Report(instance, corev1.EventTypeNormal, statusutil.EventReasonExternalResourceCreated,
+		fmt.Sprintf("Created Namespace %s for the external cluster", name))
 	return nil
 }
 
+// rookWatchesAllNamespaces returns whether the Rook operator reconciles the
+// CephClusters outside of its namespace. It only watches its namespace unless
+// ROOK_CURRENT_NAMESPACE_ONLY is set to "false" in the config of its
+// subscription, which the additional external clusters require.
+func (r *StorageClusterReconciler) rookWatchesAllNamespaces(namespace string) (bool, error) {
+	deployment := &appsv1.Deployment{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: rookOperatorDeploymentName, Namespace: namespace}, deployment)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the Rook operator Deployment: %v", err)
+	}
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name == "ROOK_CURRENT_NAMESPACE_ONLY" {
+				return env.Value == "false", nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// ensureAdditionalExternalCephCluster creates the external CephCluster of an
+// additional external cluster in its namespace. The StorageCluster can't own
+// it from another namespace, it is deleted along the namespace.
+func (r *StorageClusterReconciler) ensureAdditionalExternalCephCluster(instance *ocsv1.StorageCluster) error {
+	cephCluster := newExternalCephCluster(instance, r.images.Ceph, "", "")
+	cephCluster.Namespace = generateNameForCSIClusterID(instance)
+	cephCluster.Labels[externalResourceLabel] = instance.Name
+
+	found := &cephv1.CephCluster{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: cephCluster.Name, Namespace: cephCluster.Namespace}, found)
+	if errors.IsNotFound(err) {
+		r.Log.Info("Creating external CephCluster.", "CephCluster", klog.KRef(cephCluster.Namespace, cephCluster.Name))
+		return r.Client.Create(context.TODO(), cephCluster)
+	} else if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(found.Spec, cephCluster.Spec) {
+		return nil
+	}
+	found.Spec = cephCluster.Spec
+	r.Log.Info("Updating external CephCluster.", "CephCluster", klog.KRef(found.Namespace, found.Name))
+	return r.Client.Update(context.TODO(), found)
+}
+
 // createExternalStorageClusterResources creates external cluster resources
-func (r *StorageClusterReconciler) createExternalStorageClusterResources(instance *ocsv1.StorageCluster) error {
+func (r *StorageClusterReconciler) createExternalStorageClusterResources(instance *ocsv1.StorageCluster, details *ExternalClusterDetails) error {
 	ownerRef := metav1.OwnerReference{
 		UID:        instance.UID,
 		APIVersion: instance.APIVersion,
 		Kind:       instance.Kind,
 		Name:       instance.Name,
 	}
-	// this flag sets the 'ROOK_CSI_ENABLE_CEPHFS' flag
-	enableRookCSICephFS := false
-	// this stores only the StorageClasses specified in the Secret
-	availableSCCs := []StorageClassConfiguration{}
-	data, err := r.retrieveExternalSecretData(instance)
-	if err != nil {
-		r.Log.Error(err, "Failed to retrieve external secret resources.")
-		return err
+	// the ConfigMaps and Secrets in the external cluster details, by kind
+	// and name, the other ones created from them are pruned
+	syncedResources := map[string]bool{}
+	additional := isAdditionalExternalStorageCluster(instance)
+	if additional {
+		watchesAll, err := r.rookWatchesAllNamespaces(instance.Namespace)
+		if err != nil {
+			return err
+		}
+		if !watchesAll {
+			err = fmt.Errorf("the Rook operator only watches the namespace %s, set ROOK_CURRENT_NAMESPACE_ONLY to \"false\" in the config of its subscription to use an additional external cluster",
+				instance.Namespace)
+			r.recorder.ReportIfNotPresent(instance, corev1.EventTypeWarning, statusutil.EventReasonValidationFailed, err.Error())
+			return err
+		}
+		if err := r.ensureExternalClusterNamespace(instance); err != nil {
+			r.Log.Error(err, "Could not create the namespace of the external cluster.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+			return err
+		}
 	}
-	var extCephObjectStores []*cephv1.CephObjectStore
-	for _, d := range data {
+	for _, d := range details.configMapsAndSecrets() {
 		objectMeta := metav1.ObjectMeta{
 			Name:            d.Name,
 			Namespace:       instance.Namespace,
 			OwnerReferences: []metav1.OwnerReference{ownerRef},
+			Labels:          map[string]string{externalResourceLabel: instance.Name},
 		}
-		objectKey := types.NamespacedName{Name: d.Name, Namespace: instance.Namespace}
-		switch d.Kind {
-		case "CephCluster":
-			monitoringIP := d.Data["MonitoringEndpoint"]
-			if monitoringIP == "" {
-				err := fmt.Errorf(
-					"Monitoring Endpoint not present in the external cluster secret %s",
-					externalClusterDetailsSecret)
-				r.Log.Error(err, "Failed to get Monitoring IP.")
-				return err
+		if additional {
+			if isCSIUserSecret(d.Name) {
+				objectMeta.Name = generateNameForCSISecret(instance, d.Name)
+			} else {
+				// the other ones are read by Rook, next to the CephCluster
+				objectMeta.Namespace = generateNameForCSIClusterID(instance)
+				objectMeta.OwnerReferences = nil
 			}
-			// replace any comma in the monitoring ip string with space
-			// and then collect individual (non-empty) items' array
-			monIPArr := parseMonitoringIPs(monitoringIP)
-			monitoringPort := d.Data["MonitoringPort"]
-			if monitoringPort != "" {
-				var err error
-				for _, eachMonIP := range monIPArr {
-					err = checkEndpointReachable(net.JoinHostPort(eachMonIP, monitoringPort), 5*time.Second)
-					// if any one of the mon's IP:PORT combination is reachable,
-					// consider the whole set as valid
-					if err == nil {
-						break
-					}
-				}
-				if err != nil {
-					r.Log.Error(err, "Monitoring validation failed")
-					return err
-				}
-				r.monitoringPort = monitoringPort
-			}
-			r.Log.Info("Monitoring Information found. Monitoring will be enabled on the external cluster.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
-			r.monitoringIP = monitoringIP
+		}
+		switch d.Kind {
 		case "ConfigMap":
 			cm := &corev1.ConfigMap{
 				ObjectMeta: objectMeta,
 				Data:       d.Data,
 			}
-			found := &corev1.ConfigMap{ObjectMeta: objectMeta}
-			err := r.createExternalStorageClusterConfigMap(cm, found, objectKey)
+			err := r.ensureExternalStorageClusterConfigMap(instance, cm)
 			if err != nil {
 				r.Log.Error(err, "Could not create ExternalStorageClusterConfigMap.", "ConfigMap", klog.KRef(cm.Namespace, cm.Name))
 				return err
 			}
+			syncedResources[externalResourceKey("ConfigMap", cm)] = true
 		case "Secret":
 			sec := &corev1.Secret{
 				ObjectMeta: objectMeta,
@@ -297,111 +492,370 @@ func (r *StorageClusterReconciler) createExternalStorageClusterResources(instanc
 			for k, v := range d.Data {
 				sec.Data[k] = []byte(v)
 			}
-			found := &corev1.Secret{ObjectMeta: objectMeta}
-			err := r.createExternalStorageClusterSecret(sec, found, objectKey)
+			err := r.ensureExternalStorageClusterSecret(instance, sec)
 			if err != nil {
 				r.Log.Error(err, "Could not create ExternalStorageClusterSecret.", "Secret", klog.KRef(sec.Namespace, sec.Name))
 				return err
 			}
-		case "StorageClass":
-			// sccArr will contain all the SC Configs
-			var sccArr []StorageClassConfiguration
-			if d.Name == cephFsStorageClassName {
-				sccArr = append(sccArr,
-					newCephFilesystemStorageClassConfiguration(instance))
-				enableRookCSICephFS = true
-			} else if d.Name == cephRbdStorageClassName {
-				// if RBD storageclass is present, we need to add
-				// a thick provision storageclass as well
-				sccArr = append(sccArr,
-					newCephBlockPoolStorageClassConfiguration(instance, false),
-					newCephBlockPoolStorageClassConfiguration(instance, true),
-				)
-			} else if d.Name == cephRgwStorageClassName {
-				rgwEndpoint := d.Data[externalCephRgwEndpointKey]
-				if err := checkEndpointReachable(rgwEndpoint, 5*time.Second); err != nil {
-					r.Log.Error(err, "RGW endpoint is not reachable.", "RGWEndpoint", rgwEndpoint)
-					return err
-				}
-				extCephObjectStores, err = r.newExternalCephObjectStoreInstances(instance, rgwEndpoint)
-				if err != nil {
-					return err
+			syncedResources[externalResourceKey("Secret", sec)] = true
+		}
+	}
+
+	if additional {
+		if err := r.ensureAdditionalExternalCephCluster(instance); err != nil {
+			r.Log.Error(err, "Could not create the external CephCluster.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+			return err
+		}
+	}
+
+	if additional && (details.Monitoring != nil || details.RGW != nil) {
+		r.Log.Info("The monitoring and the object store of an additional external cluster are not used.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+	}
+	if monitoring := details.Monitoring; monitoring != nil && len(monitoring.Endpoints) > 0 && !additional {
+		if monitoring.Port != 0 {
+			monitoringPort := strconv.Itoa(monitoring.Port)
+			var err error
+			for _, eachMonIP := range monitoring.Endpoints {
+				err = r.checkExternalEndpointReachable(net.JoinHostPort(eachMonIP, monitoringPort), nil)
+				// if any one of the mon's IP:PORT combination is reachable,
+				// consider the whole set as valid
+				if err == nil {
+					break
 				}
-				// rgw-endpoint is no longer needed in the 'd.Data' dictionary,
-				// and can be deleted
-				// created an issue in rook to add `CephObjectStore` type directly in the JSON output
-				// https://github.com/rook/rook/issues/6165
-				delete(d.Data, externalCephRgwEndpointKey)
-
-				sccArr = append(sccArr,
-					newCephOBCStorageClassConfiguration(instance))
 			}
-			// most cases, 'sccArr' will be a singleton array,
-			// only in case of 'ceph-rbd' SC name, we create
-			// both thin and thick provision SCs.
-			for _, scc := range sccArr {
-				// now 'scc' is pointing to
-				// appropriate StorageClass Configuration,
-				// whose SC parameters have to be updated
-				for k, v := range d.Data {
-					scc.storageClass.Parameters[k] = v
-				}
-				availableSCCs = append(availableSCCs, scc)
+			if err != nil {
+				r.Log.Error(err, "Monitoring validation failed")
+				return err
+			}
+			r.monitoringPort = monitoringPort
+		}
+		r.Log.Info("Monitoring Information found. Monitoring will be enabled on the external cluster.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+		r.monitoringIP = strings.Join(monitoring.Endpoints, ",")
+	}
+
+	// this stores only the StorageClasses of the pools, filesystem and
+	// object store in the external cluster details
+	availableSCCs := []StorageClassConfiguration{}
+	if pool := details.BlockPool; pool != nil {
+		params := map[string]string{"pool": pool.Name}
+		if pool.DataPool != "" {
+			params["dataPool"] = pool.DataPool
+		}
+		// along the RBD storageclass, we need to add a thick provision
+		// storageclass as well
+		availableSCCs = append(availableSCCs,
+			withStorageClassParameters(newCephBlockPoolStorageClassConfiguration(instance, false), params),
+			withStorageClassParameters(newCephBlockPoolStorageClassConfiguration(instance, true), params),
+		)
+	}
+	// this flag sets the 'ROOK_CSI_ENABLE_CEPHFS' flag
+	enableRookCSICephFS := false
+	if fs := details.Filesystem; fs != nil {
+		params := map[string]string{"fsName": fs.Name, "pool": fs.DataPool}
+		availableSCCs = append(availableSCCs,
+			withStorageClassParameters(newCephFilesystemStorageClassConfiguration(instance), params))
+		enableRookCSICephFS = true
+	}
+	var extCephObjectStores []*cephv1.CephObjectStore
+	var caBundleSecretName string
+	if rgw := details.RGW; rgw != nil && !additional {
+		if rgw.isTLS() {
+			if err := r.checkExternalEndpointReachable(rgw.Endpoint, rgw.tlsConfig()); err != nil {
+				r.Log.Error(err, "RGW endpoint is not reachable over TLS.", "RGWEndpoint", rgw.Endpoint)
+				return err
+			}
+		} else if err := r.checkExternalEndpointReachable(rgw.Endpoint, nil); err != nil {
+			r.Log.Error(err, "RGW endpoint is not reachable.", "RGWEndpoint", rgw.Endpoint)
+			return err
+		}
+		if rgw.TLS != nil {
+			caBundleSecretName = generateNameForExternalRgwCASecret(instance)
+			caSecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            caBundleSecretName,
+					Namespace:       instance.Namespace,
+					OwnerReferences: []metav1.OwnerReference{ownerRef},
+					Labels:          map[string]string{externalResourceLabel: instance.Name},
+				},
+				Data: map[string][]byte{externalRgwCACertKey: []byte(rgw.TLS.CACert)},
+			}
+			if err := r.ensureExternalStorageClusterSecret(instance, caSecret); err != nil {
+				r.Log.Error(err, "Could not create the CA Secret of the RGW.", "Secret", klog.KRef(caSecret.Namespace, caSecret.Name))
+				return err
 			}
+			syncedResources[externalResourceKey("Secret", caSecret)] = true
 		}
+		var err error
+		extCephObjectStores, err = r.newExternalCephObjectStoreInstances(instance, rgw)
+		if err != nil {
+			return err
+		}
+		// the rgw endpoint is set in the CephObjectStore, not in the
+		// StorageClass
+		params := map[string]string{}
+		if rgw.PoolPrefix != "" {
+			params["poolPrefix"] = rgw.PoolPrefix
+		}
+		availableSCCs = append(availableSCCs,
+			withStorageClassParameters(newCephOBCStorageClassConfiguration(instance), params))
+	}
+
+	for _, scc := range availableSCCs {
+		if scc.storageClass.Labels == nil {
+			scc.storageClass.Labels = map[string]string{}
+		}
+		scc.storageClass.Labels[externalResourceLabel] = instance.Name
+		syncedResources[externalResourceKey("StorageClass", scc.storageClass)] = true
+	}
+	for _, cephObjectStore := range extCephObjectStores {
+		syncedResources[externalResourceKey("CephObjectStore", cephObjectStore)] = true
+	}
+
+	if err := r.pruneExternalStorageClusterResources(instance, syncedResources); err != nil {
+		r.Log.Error(err, "Failed to prune the resources removed from the external cluster details.")
+		return err
 	}
 	// creating only the available storageClasses
-	err = r.createStorageClasses(availableSCCs)
+	err := r.createStorageClasses(availableSCCs)
 	if err != nil {
 		r.Log.Error(err, "Failed to create needed StorageClasses.")
 		return err
 	}
-	if err = r.setRookCSICephFS(enableRookCSICephFS, instance); err != nil {
-		r.Log.Error(err, "Failed to set RookEnableCephFSCSIKey to EnableRookCSICephFS.", "RookEnableCephFSCSIKey", rookEnableCephFSCSIKey, "EnableRookCSICephFS", enableRookCSICephFS)
-		return err
+	// an additional cluster doesn't disable the CephFS CSI driver, which the
+	// other clusters may use
+	if enableRookCSICephFS || !additional {
+		if err = r.setRookCSICephFS(enableRookCSICephFS, instance); err != nil {
+			r.Log.Error(err, "Failed to set RookEnableCephFSCSIKey to EnableRookCSICephFS.", "RookEnableCephFSCSIKey", rookEnableCephFSCSIKey, "EnableRookCSICephFS", enableRookCSICephFS)
+			return err
+		}
 	}
 	if extCephObjectStores != nil {
-		if err = r.createCephObjectStores(extCephObjectStores, instance); err != nil {
+		if err = r.createExternalCephObjectStores(extCephObjectStores, caBundleSecretName, instance); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-// createExternalStorageClusterConfigMap creates configmap for external cluster
-func (r *StorageClusterReconciler) createExternalStorageClusterConfigMap(cm *corev1.ConfigMap, found *corev1.ConfigMap, objectKey types.NamespacedName) error {
-	err := r.Client.Get(context.TODO(), objectKey, found)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			r.Log.Info("Creating External StorageCluster ConfigMap.", "ConfigMap", klog.KRef(objectKey.Namespace, cm.Name))
-			err = r.Client.Create(context.TODO(), cm)
-			if err != nil {
-				r.Log.Error(err, "Creation of External StorageCluster ConfigMap failed.", "ConfigMap", klog.KRef(objectKey.Namespace, cm.Name))
+// createExternalCephObjectStores creates or updates the CephObjectStores of
+// the external RGW. Rook trusts the CA certificates of an RGW serving HTTPS
+// through caBundleRef, which is newer than the Rook API the operator is built
+// with, so the CephObjectStores are written as unstructured objects.
+func (r *StorageClusterReconciler) createExternalCephObjectStores(cephObjectStores []*cephv1.CephObjectStore, caBundleSecretName string, instance *ocsv1.StorageCluster) error {
+	for _, cephObjectStore := range cephObjectStores {
+		cephObjectStore.SetGroupVersionKind(cephv1.SchemeGroupVersion.WithKind("CephObjectStore"))
+		data, err := json.Marshal(cephObjectStore)
+		if err != nil {
+			return err
+		}
+		desired := &unstructured.Unstructured{}
+		if err := desired.UnmarshalJSON(data); err != nil {
+			return err
+		}
+		if caBundleSecretName != "" {
+			if err := unstructured.SetNestedField(desired.Object, caBundleSecretName, "spec", "gateway", "caBundleRef"); err != nil {
 				return err
 			}
-		} else {
-			r.Log.Error(err, "Unable the get the External StorageCluster ConfigMap.", "ConfigMap", klog.KRef(objectKey.Namespace, cm.Name))
+		}
+		desired.SetLabels(map[string]string{externalResourceLabel: instance.Name})
+
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(desired.GroupVersionKind())
+		err = r.Client.Get(context.TODO(), types.NamespacedName{Name: desired.GetName(), Namespace: desired.GetNamespace()}, existing)
+		switch {
+		case errors.IsNotFound(err):
+			r.Log.Info("Creating CephObjectStore.", "CephObjectStore", klog.KRef(desired.GetNamespace(), desired.GetName()))
+			if err := r.Client.Create(context.TODO(), desired); err != nil {
+				r.Log.Error(err, "Failed to create CephObjectStore.", "CephObjectStore", klog.KRef(desired.GetNamespace(), desired.GetName()))
+				return err
+			}
+		case err != nil:
 			return err
+		case ReconcileStrategy(instance.Spec.ManagedResources.CephObjectStores.ReconcileStrategy) == ReconcileStrategyInit:
+			continue
+		case existing.GetDeletionTimestamp() != nil:
+			return fmt.Errorf("failed to restore CephObjectStore object %s because it is marked for deletion", existing.GetName())
+		case !reflect.DeepEqual(existing.Object["spec"], desired.Object["spec"]) || existing.GetLabels()[externalResourceLabel] != instance.Name:
+			r.Log.Info("Restoring original CephObjectStore.", "CephObjectStore", klog.KRef(desired.GetNamespace(), desired.GetName()))
+			existing.Object["spec"] = desired.Object["spec"]
+			labels := existing.GetLabels()
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			labels[externalResourceLabel] = instance.Name
+			existing.SetLabels(labels)
+			if err := r.Client.Update(context.TODO(), existing); err != nil {
+				r.Log.Error(err, "Failed to update CephObjectStore.", "CephObjectStore", klog.KRef(desired.GetNamespace(), desired.GetName()))
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-// createExternalStorageClusterSecret creates secret for external cluster
-func (r *StorageClusterReconciler) createExternalStorageClusterSecret(sec *corev1.Secret, found *corev1.Secret, objectKey types.NamespacedName) error {
-	err := r.Client.Get(context.TODO(), objectKey, found)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			r.Log.Info("Creating External StorageCluster Secret.", "Secret", klog.KRef(sec.Name, objectKey.Namespace))
-			err = r.Client.Create(context.TODO(), sec)
-			if err != nil {
-				r.Log.Error(err, "Creation of External StorageCluster Secret failed.", "Secret", klog.KRef(sec.Name, objectKey.Namespace))
-				return err
-			}
-		} else {
-			r.Log.Error(err, "Unable the get External StorageCluster Secret", "Secret", klog.KRef(sec.Name, objectKey.Namespace))
+func isCSIUserSecret(name string) bool {
+	switch name {
+	case externalRBDNodeSecret, externalRBDProvisionerSecret, externalCephFSNodeSecret, externalCephFSProvisionerSecret:
+		return true
+	}
+	return false
+}
+
+// withStorageClassParameters adds the parameters from the external cluster
+// details to the StorageClass configuration
+func withStorageClassParameters(scc StorageClassConfiguration, params map[string]string) StorageClassConfiguration {
+	for k, v := range params {
+		scc.storageClass.Parameters[k] = v
+	}
+	return scc
+}
+
+// ensureExternalStorageClusterConfigMap creates the ConfigMap of the external
+// cluster, or updates its data to the one in the external cluster details
+func (r *StorageClusterReconciler) ensureExternalStorageClusterConfigMap(instance *ocsv1.StorageCluster, cm *corev1.ConfigMap) error {
+	found := &corev1.ConfigMap{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}, found)
+	if errors.IsNotFound(err) {
+		r.Log.Info("Creating External StorageCluster ConfigMap.", "ConfigMap", klog.KRef(cm.Namespace, cm.Name))
+		if err = r.Client.Create(context.TODO(), cm); err != nil {
+			r.Log.Error(err, "Creation of External StorageCluster ConfigMap failed.", "ConfigMap", klog.KRef(cm.Namespace, cm.Name))
+			return err
+		}
+		r.recorder.Report(instance, corev1.EventTypeNormal, statusutil.EventReasonExternalResourceCreated,
+			fmt.Sprintf("Created ConfigMap %s from the external cluster details", cm.Name))
+		return nil
+	} else if err != nil {
+		r.Log.Error(err, "Unable the get the External StorageCluster ConfigMap.", "ConfigMap", klog.KRef(cm.Namespace, cm.Name))
+		return err
+	}
+
+	if reflect.DeepEqual(found.Data, cm.Data) && found.Labels[externalResourceLabel] == instance.Name {
+		return nil
+	}
+	found.Data = cm.Data
+	if found.Labels == nil {
+		found.Labels = map[string]string{}
+	}
+	found.Labels[externalResourceLabel] = instance.Name
+	r.Log.Info("Updating External StorageCluster ConfigMap.", "ConfigMap", klog.KRef(cm.Namespace, cm.Name))
+	if err = r.Client.Update(context.TODO(), found); err != nil {
+		r.Log.Error(err, "Update of External StorageCluster ConfigMap failed.", "ConfigMap", klog.KRef(cm.Namespace, cm.Name))
+		return err
+	}
+	r.recorder.Report(instance, corev1.EventTypeNormal, statusutil.EventReasonExternalResourceUpdated,
+		fmt.Sprintf("Updated ConfigMap %s from the external cluster details", cm.Name))
+	return nil
+}
+
+// ensureExternalStorageClusterSecret creates the Secret of the external
+// cluster, or updates its data to the one in the external cluster details
+func (r *StorageClusterReconciler) ensureExternalStorageClusterSecret(instance *ocsv1.StorageCluster, sec *corev1.Secret) error {
+	found := &corev1.Secret{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: sec.Name, Namespace: sec.Namespace}, found)
+	if errors.IsNotFound(err) {
+		r.Log.Info("Creating External StorageCluster Secret.", "Secret", klog.KRef(sec.Namespace, sec.Name))
+		if err = r.Client.Create(context.TODO(), sec); err != nil {
+			r.Log.Error(err, "Creation of External StorageCluster Secret failed.", "Secret", klog.KRef(sec.Namespace, sec.Name))
+			return err
+		}
+		r.recorder.Report(instance, corev1.EventTypeNormal, statusutil.EventReasonExternalResourceCreated,
+			fmt.Sprintf("Created Secret %s from the external cluster details", sec.Name))
+		return nil
+	} else if err != nil {
+		r.Log.Error(err, "Unable the get External StorageCluster Secret", "Secret", klog.KRef(sec.Namespace, sec.Name))
+		return err
+	}
+
+	if reflect.DeepEqual(found.Data, sec.Data) && found.Labels[externalResourceLabel] == instance.Name {
+		return nil
+	}
+	found.Data = sec.Data
+	if found.Labels == nil {
+		found.Labels = map[string]string{}
+	}
+	found.Labels[externalResourceLabel] = instance.Name
+	r.Log.Info("Updating External StorageCluster Secret.", "Secret", klog.KRef(sec.Namespace, sec.Name))
+	if err = r.Client.Update(context.TODO(), found); err != nil {
+		r.Log.Error(err, "Update of External StorageCluster Secret failed.", "Secret", klog.KRef(sec.Namespace, sec.Name))
+		return err
+	}
+	// the message doesn't tell which keys changed, not to leak anything
+	// about the credentials
+	r.recorder.Report(instance, corev1.EventTypeNormal, statusutil.EventReasonExternalResourceUpdated,
+		fmt.Sprintf("Updated Secret %s from the external cluster details", sec.Name))
+	return nil
+}
+
+// externalResourceKey returns the key of a resource created from the external
+// cluster details in the ones synced with them
+func externalResourceKey(kind string, obj metav1.Object) string {
+	return fmt.Sprintf("%s/%s/%s", kind, obj.GetNamespace(), obj.GetName())
+}
+
+// pruneExternalStorageClusterResources deletes the ConfigMaps, Secrets,
+// StorageClasses and CephObjectStores created from the external cluster
+// details which are no longer in them. synced holds the keys of the ones which
+// still are.
+func (r *StorageClusterReconciler) pruneExternalStorageClusterResources(instance *ocsv1.StorageCluster, synced map[string]bool) error {
+	type prunedResource struct {
+		kind string
+		obj  client.Object
+	}
+	var pruned []prunedResource
+	addPruned := func(kind string, obj client.Object) {
+		if !synced[externalResourceKey(kind, obj)] {
+			pruned = append(pruned, prunedResource{kind: kind, obj: obj})
+		}
+	}
+	selector := client.MatchingLabels{externalResourceLabel: instance.Name}
+
+	namespaces := []string{instance.Namespace}
+	if isAdditionalExternalStorageCluster(instance) {
+		namespaces = append(namespaces, generateNameForCSIClusterID(instance))
+	}
+	for _, namespace := range namespaces {
+		configMaps := &corev1.ConfigMapList{}
+		if err := r.Client.List(context.TODO(), configMaps, client.InNamespace(namespace), selector); err != nil {
+			return err
+		}
+		for i := range configMaps.Items {
+			addPruned("ConfigMap", &configMaps.Items[i])
+		}
+		secrets := &corev1.SecretList{}
+		if err := r.Client.List(context.TODO(), secrets, client.InNamespace(namespace), selector); err != nil {
+			return err
+		}
+		for i := range secrets.Items {
+			addPruned("Secret", &secrets.Items[i])
+		}
+	}
+	storageClasses := &storagev1.StorageClassList{}
+	if err := r.Client.List(context.TODO(), storageClasses, selector); err != nil {
+		return err
+	}
+	for i := range storageClasses.Items {
+		addPruned("StorageClass", &storageClasses.Items[i])
+	}
+	// the external CephObjectStore has a fixed name, and is read like
+	// createExternalCephObjectStores writes it
+	cephObjectStore := &unstructured.Unstructured{}
+	cephObjectStore.SetGroupVersionKind(cephv1.SchemeGroupVersion.WithKind("CephObjectStore"))
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephObjectStore(instance), Namespace: instance.Namespace}, cephObjectStore)
+	if err == nil && cephObjectStore.GetLabels()[externalResourceLabel] == instance.Name {
+		addPruned("CephObjectStore", cephObjectStore)
+	} else if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	for _, resource := range pruned {
+		kind, obj := resource.kind, resource.obj
+		r.Log.Info("Pruning resource removed from the external cluster details.", kind, klog.KRef(obj.GetNamespace(), obj.GetName()))
+		if err := r.Client.Delete(context.TODO(), obj); err != nil && !errors.IsNotFound(err) {
+			r.Log.Error(err, "Failed to prune resource removed from the external cluster details.", kind, klog.KRef(obj.GetNamespace(), obj.GetName()))
 			return err
 		}
+		r.recorder.Report(instance, corev1.EventTypeNormal, statusutil.EventReasonExternalResourcePruned,
+			fmt.Sprintf("Deleted %s %s, which was removed from the external cluster details", kind, obj.GetName()))
 	}
 	return nil
 }
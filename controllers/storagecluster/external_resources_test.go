@@ -2,10 +2,19 @@ package storagecluster
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cryptorand "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"math/rand"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
 	"strconv"
 	"testing"
@@ -14,12 +23,17 @@ import (
 	nbv1 "github.com/noobaa/noobaa-operator/v2/pkg/apis/noobaa/v1alpha1"
 	api "github.com/openshift/ocs-operator/api/v1"
 	"github.com/openshift/ocs-operator/controllers/defaults"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -76,7 +90,7 @@ func TestEnsureExternalStorageClusterResources(t *testing.T) {
 	reconciler := createExternalClusterReconciler(t)
 	result, err := reconciler.Reconcile(context.TODO(), request)
 	assert.NoError(t, err)
-	assert.Equal(t, reconcile.Result{}, result)
+	assert.Equal(t, reconcile.Result{RequeueAfter: externalProbeMinBackoff}, result)
 	assertExpectedExternalResources(t, reconciler)
 }
 
@@ -326,7 +340,7 @@ func TestOptionalExternalStorageClusterResources(t *testing.T) {
 		reconciler := createExternalClusterReconcilerFromCustomResources(t, extResources)
 		result, err := reconciler.Reconcile(context.TODO(), request)
 		assert.NoError(t, err)
-		assert.Equal(t, reconcile.Result{}, result)
+		assert.Equal(t, reconcile.Result{RequeueAfter: externalProbeMinBackoff}, result)
 		// rest of the resources should be available
 		assertExpectedExternalResources(t, reconciler)
 		// make sure we are missing the provided resource
@@ -409,11 +423,10 @@ func assertCephObjectStore(t *testing.T, reconciler StorageClusterReconciler, re
 		assert.Error(t, err)
 	} else {
 		assert.NoError(t, err)
-		extRs, err := reconciler.retrieveExternalSecretData(sc)
+		details, err := reconciler.retrieveExternalSecretData(sc)
 		assert.NoError(t, err)
-		extR, err := findNamedResourceFromArray(extRs, "ceph-rgw")
-		assert.NoError(t, err)
-		hostFound, portFound, err := net.SplitHostPort(extR.Data["endpoint"])
+		assert.NotNil(t, details.RGW)
+		hostFound, portFound, err := net.SplitHostPort(details.RGW.Endpoint)
 		assert.NoError(t, err)
 		assert.Equal(t, portFound, fmt.Sprintf("%d", cObjS.Spec.Gateway.Port))
 		// length of 'ExternalRgwEndpoints' should be atleast 1
@@ -437,10 +450,11 @@ func assertReconciliationOfExternalResource(t *testing.T, reconciler StorageClus
 		},
 	}
 
-	// first reconcile, which sets everything in place
+	// first reconcile, which sets everything in place. The mons of the test
+	// cluster are unreachable, so they are probed again after a backoff.
 	result, err := reconciler.Reconcile(context.TODO(), request)
 	assert.NoError(t, err)
-	assert.Equal(t, reconcile.Result{}, result)
+	assert.Equal(t, reconcile.Result{RequeueAfter: externalProbeMinBackoff}, result)
 	assertExpectedExternalResources(t, reconciler)
 
 	sc := &api.StorageCluster{}
@@ -448,7 +462,11 @@ func assertReconciliationOfExternalResource(t *testing.T, reconciler StorageClus
 	assert.NoError(t, err)
 	firstExtSecretChecksum := sc.Status.ExternalSecretHash
 
-	extRsrcs, err := reconciler.retrieveExternalSecretData(sc)
+	var extRsrcs []ExternalResource
+	secret := corev1.Secret{}
+	err = reconciler.Client.Get(nil, types.NamespacedName{Name: externalClusterDetailsSecret, Namespace: ""}, &secret)
+	assert.NoError(t, err)
+	err = json.Unmarshal(secret.Data[externalClusterDetailsKey], &extRsrcs)
 	assert.NoError(t, err)
 	rgwRsrc, err := findNamedResourceFromArray(extRsrcs, cephRgwStorageClassName)
 	assert.NoError(t, err)
@@ -460,17 +478,15 @@ func assertReconciliationOfExternalResource(t *testing.T, reconciler StorageClus
 	// create and update external secret with new changes
 	extSecret, err := createExternalCephClusterSecret(extRsrcs)
 	assert.NoError(t, err)
-	secret := corev1.Secret{}
-	reconciler.Client.Get(nil, types.NamespacedName{Name: externalClusterDetailsSecret, Namespace: ""}, &secret)
-	assert.NoError(t, err)
 	extSecret.ObjectMeta = secret.ObjectMeta
 	err = reconciler.Client.Update(nil, extSecret)
 	assert.NoError(t, err)
 
 	// second reconcile on same 'reconciler', we should have expected/changed resources
+	// and the changed endpoints are probed again, still without mons
 	result, err = reconciler.Reconcile(context.TODO(), request)
 	assert.NoError(t, err)
-	assert.Equal(t, reconcile.Result{}, result)
+	assert.InDelta(t, getExternalProbeBackoff(2).Seconds(), result.RequeueAfter.Seconds(), 1)
 	assertExpectedExternalResources(t, reconciler)
 
 	// get the updated storagecluster object after second reconciliation
@@ -484,7 +500,7 @@ func assertReconciliationOfExternalResource(t *testing.T, reconciler StorageClus
 	// third reconcile on same 'reconciler', without any change in the resources
 	result, err = reconciler.Reconcile(context.TODO(), request)
 	assert.NoError(t, err)
-	assert.Equal(t, reconcile.Result{}, result)
+	assert.InDelta(t, getExternalProbeBackoff(2).Seconds(), result.RequeueAfter.Seconds(), 1)
 	assertExpectedExternalResources(t, reconciler)
 
 	// get the updated storagecluster object after third reconciliation
@@ -559,7 +575,338 @@ func TestExternalMonitoringResources(t *testing.T) {
 		if ok := assert.NoError(t, err); !ok {
 			t.Fatalf("Reconcile Error: %v", err)
 		}
-		assert.Equal(t, reconcile.Result{}, result)
+		assert.Equal(t, reconcile.Result{RequeueAfter: externalProbeMinBackoff}, result)
 		assertExpectedExternalResources(t, reconciler)
 	}
 }
+
+func TestExternalResourceSync(t *testing.T) {
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      "ocsinit",
+			Namespace: "",
+		},
+	}
+	extResources := removeNamedResourceFromArray(globalTestExternalResources, cephRgwStorageClassName)
+	extResources = append(extResources, ExternalResource{
+		Kind: "Secret",
+		Name: externalCephFSProvisionerSecret,
+		Data: map[string]string{"adminKey": "someAdminKeyFS==", "adminID": "csi-cephfs-provisioner"},
+	})
+	reconciler := createExternalClusterReconcilerFromCustomResources(t, extResources)
+	recorder := record.NewFakeRecorder(100)
+	reconciler.recorder = statusutil.NewEventReporter(recorder)
+	// a ConfigMap and an object store created from an earlier version of the
+	// external cluster details
+	assert.NoError(t, reconciler.Client.Create(context.TODO(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "stale-configmap", Labels: map[string]string{externalResourceLabel: "ocsinit"}},
+	}))
+	assert.NoError(t, reconciler.Client.Create(context.TODO(), &cephv1.CephObjectStore{
+		ObjectMeta: metav1.ObjectMeta{Name: "ocsinit-cephobjectstore", Labels: map[string]string{externalResourceLabel: "ocsinit"}},
+	}))
+
+	_, err := reconciler.Reconcile(context.TODO(), request)
+	assert.NoError(t, err)
+	assertExpectedExternalResources(t, reconciler)
+	configMap := &corev1.ConfigMap{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "rook-ceph-mon-endpoints"}, configMap)
+	assert.NoError(t, err)
+	assert.Equal(t, "ocsinit", configMap.Labels[externalResourceLabel])
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephobjectstore"}, &cephv1.CephObjectStore{})
+	assert.True(t, errors.IsNotFound(err))
+
+	// the StorageClasses created by an operator which didn't label them are
+	// labeled after the upgrade, even though the details didn't change
+	storageClass := &storagev1.StorageClass{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephfs"}, storageClass))
+	assert.Equal(t, "ocsinit", storageClass.Labels[externalResourceLabel])
+	storageClass.Labels = nil
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), storageClass))
+	sc := &api.StorageCluster{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), request.NamespacedName, sc))
+	secret := &corev1.Secret{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalClusterDetailsSecret}, secret)
+	assert.NoError(t, err)
+	sc.Status.ExternalSecretHash, err = sha512sum(secret.Data[externalClusterDetailsKey])
+	assert.NoError(t, err)
+	assert.NoError(t, reconciler.Client.Status().Update(context.TODO(), sc))
+	_, err = reconciler.Reconcile(context.TODO(), request)
+	assert.NoError(t, err)
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephfs"}, storageClass))
+	assert.Equal(t, "ocsinit", storageClass.Labels[externalResourceLabel])
+
+	// rotate a key, move a mon and remove a user
+	extResources = updateNamedResourceInArray(extResources, ExternalResource{
+		Kind: "Secret",
+		Name: "rook-csi-rbd-node",
+		Data: map[string]string{"userKey": "rotatedUserKey==", "userID": "csi-rbd-node"},
+	})
+	extResources = updateNamedResourceInArray(extResources, ExternalResource{
+		Kind: "ConfigMap",
+		Name: "rook-ceph-mon-endpoints",
+		Data: map[string]string{"maxMonId": "1", "data": "b=10.20.30.41:1234", "mapping": "{}"},
+	})
+	extResources = removeNamedResourceFromArray(extResources, externalCephFSProvisionerSecret)
+	extResources = removeNamedResourceFromArray(extResources, cephFsStorageClassName)
+	extSecret, err := createExternalCephClusterSecret(extResources)
+	assert.NoError(t, err)
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalClusterDetailsSecret}, secret)
+	assert.NoError(t, err)
+	secret.Data = extSecret.Data
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), secret))
+
+	_, err = reconciler.Reconcile(context.TODO(), request)
+	assert.NoError(t, err)
+	assertExpectedExternalResources(t, reconciler)
+
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "rook-csi-rbd-node"}, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, "rotatedUserKey==", string(secret.Data["userKey"]))
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "rook-ceph-mon-endpoints"}, configMap)
+	assert.NoError(t, err)
+	assert.Equal(t, "b=10.20.30.41:1234", configMap.Data["data"])
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "stale-configmap"}, configMap)
+	assert.True(t, errors.IsNotFound(err))
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalCephFSProvisionerSecret}, secret)
+	assert.True(t, errors.IsNotFound(err))
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-cephfs"}, storageClass)
+	assert.True(t, errors.IsNotFound(err))
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-ceph-rbd"}, storageClass))
+	// resources which were not created from the external cluster details are kept
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: rookCephOperatorConfigName}, configMap)
+	assert.NoError(t, err)
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	for _, expected := range []string{
+		"Normal ExternalResourceCreated Created Secret rook-csi-cephfs-provisioner from the external cluster details",
+		"Normal ExternalResourceUpdated Updated Secret rook-csi-rbd-node from the external cluster details",
+		"Normal ExternalResourceUpdated Updated ConfigMap rook-ceph-mon-endpoints from the external cluster details",
+		"Normal ExternalResourcePruned Deleted ConfigMap stale-configmap, which was removed from the external cluster details",
+		"Normal ExternalResourcePruned Deleted Secret rook-csi-cephfs-provisioner, which was removed from the external cluster details",
+		"Normal ExternalResourcePruned Deleted CephObjectStore ocsinit-cephobjectstore, which was removed from the external cluster details",
+		"Normal ExternalResourcePruned Deleted StorageClass ocsinit-cephfs, which was removed from the external cluster details",
+	} {
+		assert.Contains(t, events, expected)
+	}
+}
+
+func TestExternalRGWTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	// a self-signed CA which didn't sign the certificate of the server
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cryptorand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "other-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	otherCert, err := x509.CreateCertificate(cryptorand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	otherCACert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherCert}))
+	endpoint := server.Listener.Addr().String()
+	_, port, err := net.SplitHostPort(endpoint)
+	assert.NoError(t, err)
+
+	cases := []struct {
+		label   string
+		tls     *ExternalTLS
+		isValid bool
+	}{
+		{
+			label:   "Case 1: certificate signed by the CA",
+			tls:     &ExternalTLS{CACert: caCert},
+			isValid: true,
+		},
+		{
+			label:   "Case 2: certificate for the host name",
+			tls:     &ExternalTLS{CACert: caCert, ServerName: "example.com"},
+			isValid: true,
+		},
+		{
+			label:   "Case 3: certificate for another host name",
+			tls:     &ExternalTLS{CACert: caCert, ServerName: "rgw.example.org"},
+			isValid: false,
+		},
+		{
+			label:   "Case 4: certificate signed by another CA",
+			tls:     &ExternalTLS{CACert: otherCACert},
+			isValid: false,
+		},
+		{
+			label:   "Case 5: certificate checked against the CAs of the system",
+			isValid: false,
+		},
+	}
+
+	for _, c := range cases {
+		extResources := removeNamedResourceFromArray(globalTestExternalResources, cephRgwStorageClassName)
+		reconciler := createExternalClusterReconcilerFromCustomResources(t, extResources)
+		details, err := reconciler.retrieveExternalSecretData(&api.StorageCluster{})
+		assert.NoError(t, err)
+		details.RGW = &ExternalRGW{Scheme: "https", Endpoint: endpoint, TLS: c.tls}
+		blob, err := json.Marshal(details)
+		assert.NoError(t, err)
+		secret := &corev1.Secret{}
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalClusterDetailsSecret}, secret))
+		secret.Data[externalClusterDetailsKey] = blob
+		assert.NoError(t, reconciler.Client.Update(context.TODO(), secret))
+
+		sc := &api.StorageCluster{}
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit"}, sc))
+		err = (&ocsExternalResources{}).ensureCreated(&reconciler, sc)
+		if !c.isValid {
+			assert.Errorf(t, err, "[%s]", c.label)
+			continue
+		}
+		assert.NoErrorf(t, err, "[%s]", c.label)
+
+		// rook connects to the RGW over TLS with the CA bundle
+		objectStore := &unstructured.Unstructured{}
+		objectStore.SetGroupVersionKind(cephv1.SchemeGroupVersion.WithKind("CephObjectStore"))
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephObjectStore(sc)}, objectStore)
+		assert.NoErrorf(t, err, "[%s]", c.label)
+		securePort, _, _ := unstructured.NestedInt64(objectStore.Object, "spec", "gateway", "securePort")
+		assert.Equalf(t, port, fmt.Sprint(securePort), "[%s]", c.label)
+		_, found, _ := unstructured.NestedFieldNoCopy(objectStore.Object, "spec", "gateway", "port")
+		assert.Falsef(t, found, "[%s]", c.label)
+		caBundleRef, _, _ := unstructured.NestedString(objectStore.Object, "spec", "gateway", "caBundleRef")
+		assert.Equalf(t, generateNameForExternalRgwCASecret(sc), caBundleRef, "[%s]", c.label)
+		sslCertificateRef, _, _ := unstructured.NestedString(objectStore.Object, "spec", "gateway", "sslCertificateRef")
+		assert.Emptyf(t, sslCertificateRef, "[%s]", c.label)
+		caSecret := &corev1.Secret{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForExternalRgwCASecret(sc)}, caSecret)
+		assert.NoErrorf(t, err, "[%s]", c.label)
+		assert.Equalf(t, c.tls.CACert, string(caSecret.Data[externalRgwCACertKey]), "[%s]", c.label)
+	}
+}
+
+func TestAdditionalExternalStorageCluster(t *testing.T) {
+	reconciler := createExternalClusterReconciler(t)
+	csiConfig := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: csiConfigMapName, Namespace: "storage-test-ns"},
+		Data:       map[string]string{"csi-cluster-config-json": `[{"clusterID":"storage-test-ns","monitors":["10.20.30.40:1234"]}]`},
+	}
+	backupDetails := `{
+		"version": "v1",
+		"mons": {"fsid": "d1d2a2c2-e8a0-4ac4-9f95-2c5c4d3a4b5e", "endpoints": [{"name": "a", "address": "10.0.0.1:6789"}, {"name": "b", "address": "10.0.0.2:6789"}]},
+		"users": {
+			"rbdNode": {"id": "csi-rbd-node", "key": "someUserKeyRBD=="},
+			"rbdProvisioner": {"id": "csi-rbd-provisioner", "key": "someUserKeyRBD=="}
+		},
+		"blockPool": {"name": "backup-pool"},
+		"rgw": {"endpoint": "10.0.0.3:8080"}
+	}`
+	sc := &api.StorageCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "backup",
+			Namespace: "storage-test-ns",
+		},
+		Spec: api.StorageClusterSpec{
+			ExternalStorage: api.ExternalStorageClusterSpec{
+				Enable:               true,
+				ClusterDetailsSecret: "backup-cluster-details",
+			},
+			Monitoring: &api.MonitoringSpec{
+				ReconcileStrategy: string(ReconcileStrategyIgnore),
+			},
+		},
+	}
+	for _, obj := range []client.Object{
+		sc,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-cluster-details", Namespace: sc.Namespace},
+			Data:       map[string][]byte{externalClusterDetailsKey: []byte(backupDetails)},
+		},
+		csiConfig.DeepCopy(),
+	} {
+		assert.NoError(t, reconciler.Client.Create(context.TODO(), obj))
+	}
+	assert.True(t, isAdditionalExternalStorageCluster(sc))
+	assert.NoError(t, validateExternalStorageSpec(sc))
+
+	// Rook must watch the namespace of the external CephCluster
+	rookOperator := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: rookOperatorDeploymentName, Namespace: sc.Namespace}}
+	rookOperator.Spec.Template.Spec.Containers = []corev1.Container{{
+		Name: "rook-ceph-operator",
+		Env:  []corev1.EnvVar{{Name: "ROOK_CURRENT_NAMESPACE_ONLY", Value: "true"}},
+	}}
+	assert.NoError(t, reconciler.Client.Create(context.TODO(), rookOperator))
+	err := (&ocsExternalResources{}).ensureCreated(&reconciler, sc)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ROOK_CURRENT_NAMESPACE_ONLY")
+	assert.True(t, errors.IsNotFound(reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCSIClusterID(sc)}, &corev1.Namespace{})))
+	rookOperator.Spec.Template.Spec.Containers[0].Env[0].Value = "false"
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), rookOperator))
+
+	assert.NoError(t, (&ocsExternalResources{}).ensureCreated(&reconciler, sc))
+	assert.NoError(t, (&ocsSnapshotClass{}).ensureCreated(&reconciler, sc))
+	assert.Equal(t, "backup-cluster-details", sc.Status.ExternalClusterDetailsSecret)
+
+	// the additional cluster has an external CephCluster in a namespace of
+	// its own, which Rook adds to the Ceph CSI configuration
+	clusterID := generateNameForCSIClusterID(sc)
+	assert.Equal(t, "storage-test-ns-backup", clusterID)
+	namespace := &corev1.Namespace{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: clusterID}, namespace))
+	assert.Equal(t, sc.Name, namespace.Labels[externalResourceLabel])
+	cephCluster := &cephv1.CephCluster{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephCluster(sc), Namespace: clusterID}, cephCluster))
+	assert.True(t, cephCluster.Spec.External.Enable)
+	assert.False(t, cephCluster.Spec.Monitoring.Enabled)
+	assert.Empty(t, cephCluster.OwnerReferences)
+	configMap := &corev1.ConfigMap{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalMonEndpointsConfigMap, Namespace: clusterID}, configMap))
+	assert.Empty(t, configMap.OwnerReferences)
+	secret := &corev1.Secret{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalMonSecret, Namespace: clusterID}, secret))
+
+	// the operator leaves the Ceph CSI configuration to Rook
+	actualCSIConfig := &corev1.ConfigMap{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: csiConfigMapName, Namespace: sc.Namespace}, actualCSIConfig))
+	assert.Equal(t, csiConfig.Data, actualCSIConfig.Data)
+
+	// the CSI users are in the namespace of the StorageCluster, which owns
+	// them
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "backup-rook-csi-rbd-node", Namespace: sc.Namespace}, secret))
+	assert.Equal(t, "csi-rbd-node", string(secret.Data["userID"]))
+	storageClass := &storagev1.StorageClass{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "backup-ceph-rbd"}, storageClass))
+	assert.Equal(t, clusterID, storageClass.Parameters["clusterID"])
+	assert.Equal(t, "backup-pool", storageClass.Parameters["pool"])
+	assert.Equal(t, "backup-rook-csi-rbd-node", storageClass.Parameters["csi.storage.k8s.io/node-stage-secret-name"])
+	assert.Equal(t, "backup-rook-csi-rbd-provisioner", storageClass.Parameters["csi.storage.k8s.io/provisioner-secret-name"])
+	snapshotClass := newVolumeSnapshotClass(sc, rbdSnapshotter)
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: snapshotClass.Name}, snapshotClass))
+	assert.Equal(t, clusterID, snapshotClass.Parameters["clusterID"])
+	assert.Equal(t, "backup-rook-csi-rbd-provisioner", snapshotClass.Parameters[snapshotterSecretName])
+
+	// nothing is created for the cluster managed by Rook in the namespace
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: externalMonEndpointsConfigMap, Namespace: sc.Namespace}, configMap)
+	assert.True(t, errors.IsNotFound(err))
+	objectStore := &cephv1.CephObjectStore{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephObjectStore(sc), Namespace: sc.Namespace}, objectStore)
+	assert.True(t, errors.IsNotFound(err))
+
+	// the details can't be read from another Secret once applied
+	changed := sc.DeepCopy()
+	changed.Spec.ExternalStorage.ClusterDetailsSecret = "other-cluster-details"
+	assert.Error(t, validateExternalStorageSpec(changed))
+	changed.Spec.ExternalStorage.ClusterDetailsSecret = ""
+	assert.Error(t, validateExternalStorageSpec(changed))
+
+	// the namespace is deleted with the StorageCluster
+	assert.NoError(t, reconciler.Client.Delete(context.TODO(), cephCluster))
+	err = (&ocsExternalResources{}).ensureDeleted(&reconciler, sc)
+	assert.Error(t, err)
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: clusterID}, namespace)
+	assert.True(t, errors.IsNotFound(err))
+	assert.NoError(t, (&ocsExternalResources{}).ensureDeleted(&reconciler, sc))
+}
@@ -0,0 +1,173 @@
+package storagecluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// crushLevels are the CRUSH bucket types Rook places the OSDs in from the
+// labels of their nodes, from the narrowest to the widest. The levels between
+// host and zone come from the topology.rook.io/<level> labels.
+var crushLevels = []string{"host", "chassis", "rack", "row", "pdu", "pod", "room", "datacenter", "zone", "region"}
+
+// getCrushLevel returns the CRUSH level of a failure domain or of a level of
+// the CRUSH hierarchy, which may be given as a topology.rook.io label key
+func getCrushLevel(name string) string {
+	return strings.TrimPrefix(name, labelRookPrefix+"/")
+}
+
+// getCrushLevelRank returns the rank of a CRUSH level, the narrowest first, or
+// -1 if it isn't a CRUSH level
+func getCrushLevelRank(level string) int {
+	for i, crushLevel := range crushLevels {
+		if crushLevel == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// isRookCrushLevel returns true if the CRUSH level comes from a
+// topology.rook.io label
+func isRookCrushLevel(level string) bool {
+	rank := getCrushLevelRank(level)
+	return rank > getCrushLevelRank("host") && rank < getCrushLevelRank("zone")
+}
+
+// getRookCrushLevels returns the CRUSH levels which come from the
+// topology.rook.io labels
+func getRookCrushLevels() []string {
+	var levels []string
+	for _, level := range crushLevels {
+		if isRookCrushLevel(level) {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// validateFailureDomain checks the failure domain and the CRUSH hierarchy set
+// in the spec, and that the failure domain isn't changed once it is determined
+func validateFailureDomain(sc *ocsv1.StorageCluster) error {
+	previous := len(crushLevels)
+	declared := map[string]bool{}
+	for _, name := range sc.Spec.CrushHierarchy {
+		level := getCrushLevel(name)
+		if !isRookCrushLevel(level) {
+			return fmt.Errorf("crushHierarchy level %q is not one of the %s/<level> labels of the CRUSH map: %s",
+				name, labelRookPrefix, strings.Join(getRookCrushLevels(), ", "))
+		}
+		rank := getCrushLevelRank(level)
+		if rank >= previous {
+			return fmt.Errorf("crushHierarchy must list the levels once, from the widest to the narrowest: %s is not narrower than %s",
+				level, crushLevels[previous])
+		}
+		previous = rank
+		declared[level] = true
+	}
+
+	if sc.Spec.FailureDomain == "" {
+		return nil
+	}
+	failureDomain := getCrushLevel(sc.Spec.FailureDomain)
+	if failureDomain != "host" && failureDomain != "zone" && !isRookCrushLevel(failureDomain) {
+		return fmt.Errorf("failureDomain %q must be host, zone or one of the %s/<level> labels of the CRUSH map: %s",
+			sc.Spec.FailureDomain, labelRookPrefix, strings.Join(getRookCrushLevels(), ", "))
+	}
+	if sc.Spec.FlexibleScaling && failureDomain != "host" {
+		return fmt.Errorf("failureDomain must be host when flexibleScaling is enabled, not %s", failureDomain)
+	}
+	if arbiterEnabled(sc) && failureDomain != "zone" {
+		return fmt.Errorf("failureDomain must be zone when arbiter is enabled, not %s", failureDomain)
+	}
+	if isRookCrushLevel(failureDomain) && len(declared) > 0 && !declared[failureDomain] {
+		return fmt.Errorf("failureDomain %s is not a level of the crushHierarchy", failureDomain)
+	}
+	if sc.Status.FailureDomain != "" && failureDomain != sc.Status.FailureDomain {
+		return fmt.Errorf("failureDomain can't be changed from %s to %s", sc.Status.FailureDomain, failureDomain)
+	}
+	return nil
+}
+
+// validateNodeCrushHierarchy checks that every storage node has a label for
+// each level of the CRUSH hierarchy, and that each value of a level belongs to
+// a single value of the level above. Rook would otherwise move the CRUSH
+// buckets from one parent to the other as it starts the OSDs.
+func validateNodeCrushHierarchy(sc *ocsv1.StorageCluster, nodes *corev1.NodeList) error {
+	parents := map[string]string{}
+	for _, node := range nodes.Items {
+		parentLevel, parent := "", ""
+		for _, name := range sc.Spec.CrushHierarchy {
+			level := getCrushLevel(name)
+			key := fmt.Sprintf("%s/%s", labelRookPrefix, level)
+			value, found := node.Labels[key]
+			if !found {
+				return fmt.Errorf("storage node %s has no %s label of the CRUSH hierarchy", node.Name, key)
+			}
+			if parentLevel != "" {
+				bucket := fmt.Sprintf("%s %s", level, value)
+				if previous, found := parents[bucket]; found && previous != parent {
+					return fmt.Errorf("the %s is in both the %s %s and %s of the CRUSH hierarchy", bucket, parentLevel, previous, parent)
+				}
+				parents[bucket] = parent
+			}
+			parentLevel, parent = level, value
+		}
+	}
+	return nil
+}
+
+// getHierarchyFailureDomain returns the widest level of the CRUSH hierarchy
+// which has enough values for the replicas of the data, none if no level has
+func getHierarchyFailureDomain(sc *ocsv1.StorageCluster) string {
+	for _, name := range sc.Spec.CrushHierarchy {
+		level := getCrushLevel(name)
+		if _, values := getFailureDomainKeyValues(sc.Status.NodeTopologies, level); len(values) >= getMinDeviceSetReplica(sc) {
+			return level
+		}
+	}
+	return ""
+}
+
+// validateFailureDomainNodes checks that every storage node has a label for
+// a failure domain which comes from the topology.rook.io labels, and that
+// there are enough values for the replicas of the data. The operator only
+// creates the rack labels.
+func validateFailureDomainNodes(sc *ocsv1.StorageCluster, nodes *corev1.NodeList) error {
+	failureDomain := getFailureDomain(sc)
+	if !isRookCrushLevel(failureDomain) || failureDomain == "rack" {
+		return nil
+	}
+	key := getFailureDomainKey(sc)
+	var unlabeled []string
+	for _, node := range nodes.Items {
+		if _, found := node.Labels[key]; !found {
+			unlabeled = append(unlabeled, node.Name)
+		}
+	}
+	if len(unlabeled) > 0 {
+		sort.Strings(unlabeled)
+		return fmt.Errorf("storage nodes %s have no %s label of the %s failure domain", strings.Join(unlabeled, ", "), key, failureDomain)
+	}
+	if minValues := getMinDeviceSetReplica(sc); len(sc.Status.FailureDomainValues) < minValues {
+		return fmt.Errorf("Not enough %s values found: Expected %d, found %d", key, minValues, len(sc.Status.FailureDomainValues))
+	}
+	return nil
+}
+
+// getFailureDomainKeyValues returns the node label of a failure domain and
+// its values across the storage nodes. The levels of the topology.rook.io
+// labels are matched exactly, as the other labels may contain their name.
+func getFailureDomainKeyValues(topologyMap *ocsv1.NodeTopologyMap, failureDomain string) (string, []string) {
+	if isRookCrushLevel(failureDomain) {
+		key := fmt.Sprintf("%s/%s", labelRookPrefix, failureDomain)
+		if values, found := topologyMap.Labels[key]; found {
+			return key, values
+		}
+	}
+	return topologyMap.GetKeyValues(failureDomain)
+}
@@ -0,0 +1,132 @@
+package storagecluster
+
+import (
+	"testing"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+func TestValidateFailureDomain(t *testing.T) {
+	cases := []struct {
+		label          string
+		failureDomain  string
+		crushHierarchy []string
+		status         string
+		arbiter        bool
+		expectedError  bool
+	}{
+		{label: "nothing is set"},
+		{label: "a level of the rook labels", failureDomain: "row"},
+		{label: "a rook label key", failureDomain: "topology.rook.io/room"},
+		{label: "a level of the hierarchy", failureDomain: "row", crushHierarchy: []string{"datacenter", "topology.rook.io/room", "row", "rack"}},
+		{label: "zone is not a level of the hierarchy", failureDomain: "zone", crushHierarchy: []string{"room", "row"}},
+		{label: "an unknown level", failureDomain: "topology.rook.io/aisle", expectedError: true},
+		{label: "a label of another prefix", failureDomain: "example.com/row", expectedError: true},
+		{label: "a level out of the hierarchy", failureDomain: "rack", crushHierarchy: []string{"room", "row"}, expectedError: true},
+		{label: "a hierarchy in the wrong order", crushHierarchy: []string{"row", "room"}, expectedError: true},
+		{label: "a hierarchy with a level twice", crushHierarchy: []string{"row", "row"}, expectedError: true},
+		{label: "a hierarchy with zone", crushHierarchy: []string{"zone", "rack"}, expectedError: true},
+		{label: "an arbiter cluster", failureDomain: "row", arbiter: true, expectedError: true},
+		{label: "the failure domain is unchanged", failureDomain: "row", status: "row"},
+		{label: "the failure domain is changed", failureDomain: "row", status: "rack", expectedError: true},
+	}
+
+	for _, c := range cases {
+		sc := &api.StorageCluster{}
+		sc.Spec.FailureDomain = c.failureDomain
+		sc.Spec.CrushHierarchy = c.crushHierarchy
+		sc.Spec.Arbiter.Enable = c.arbiter
+		sc.Status.FailureDomain = c.status
+		err := validateFailureDomain(sc)
+		if c.expectedError {
+			assert.Errorf(t, err, "[%s]", c.label)
+		} else {
+			assert.NoErrorf(t, err, "[%s]", c.label)
+		}
+	}
+}
+
+func TestValidateNodeCrushHierarchy(t *testing.T) {
+	sc := &api.StorageCluster{}
+	sc.Spec.CrushHierarchy = []string{"room", "row", "rack"}
+	nodes := &corev1.NodeList{Items: []corev1.Node{
+		*newTestNode("node-a", map[string]string{defaults.NodeAffinityKey: "", "topology.rook.io/room": "r1", "topology.rook.io/row": "a", "topology.rook.io/rack": "a1"}),
+		*newTestNode("node-b", map[string]string{defaults.NodeAffinityKey: "", "topology.rook.io/room": "r1", "topology.rook.io/row": "a", "topology.rook.io/rack": "a2"}),
+		*newTestNode("node-c", map[string]string{defaults.NodeAffinityKey: "", "topology.rook.io/room": "r2", "topology.rook.io/row": "b", "topology.rook.io/rack": "b1"}),
+	}}
+	assert.NoError(t, validateNodeCrushHierarchy(sc, nodes))
+
+	// a row in two rooms
+	nodes.Items = append(nodes.Items, *newTestNode("node-d", map[string]string{defaults.NodeAffinityKey: "", "topology.rook.io/room": "r2", "topology.rook.io/row": "a", "topology.rook.io/rack": "a3"}))
+	err := validateNodeCrushHierarchy(sc, nodes)
+	assert.EqualError(t, err, "the row a is in both the room r1 and r2 of the CRUSH hierarchy")
+
+	// a node without a level
+	nodes.Items[3] = *newTestNode("node-d", map[string]string{defaults.NodeAffinityKey: "", "topology.rook.io/room": "r2", "topology.rook.io/rack": "b2"})
+	err = validateNodeCrushHierarchy(sc, nodes)
+	assert.EqualError(t, err, "storage node node-d has no topology.rook.io/row label of the CRUSH hierarchy")
+}
+
+func TestCustomFailureDomain(t *testing.T) {
+	nodes := []*corev1.Node{
+		newTestNode("node-a", map[string]string{defaults.NodeAffinityKey: "", "topology.rook.io/room": "r1", "topology.rook.io/row": "a", "topology.rook.io/rack": "a1"}),
+		newTestNode("node-b", map[string]string{defaults.NodeAffinityKey: "", "topology.rook.io/room": "r1", "topology.rook.io/row": "b", "topology.rook.io/rack": "b1"}),
+		newTestNode("node-c", map[string]string{defaults.NodeAffinityKey: "", "topology.rook.io/room": "r2", "topology.rook.io/row": "c", "topology.rook.io/rack": "c1"}),
+	}
+	objs := []runtime.Object{}
+	for _, node := range nodes {
+		objs = append(objs, node)
+	}
+	serverVersion := &version.Info{Major: "1", Minor: "19"}
+
+	for _, c := range []struct {
+		label          string
+		failureDomain  string
+		crushHierarchy []string
+	}{
+		{label: "a failure domain set in the spec", failureDomain: "topology.rook.io/row"},
+		{label: "a failure domain from the hierarchy", crushHierarchy: []string{"room", "row", "rack"}},
+	} {
+		reconciler := createFakeStorageClusterReconciler(t, objs...)
+		sc := &api.StorageCluster{ObjectMeta: metav1.ObjectMeta{Name: "ocsinit", Namespace: "openshift-storage"}}
+		sc.Spec.FailureDomain = c.failureDomain
+		sc.Spec.CrushHierarchy = c.crushHierarchy
+		sc.Spec.StorageDeviceSets = []api.StorageDeviceSet{*mockDeviceSets[0].DeepCopy()}
+		sc.Spec.StorageDeviceSets[0].Portable = true
+
+		assert.NoErrorf(t, reconciler.reconcileNodeTopologyMap(sc), "[%s]", c.label)
+		assert.Equalf(t, "row", getFailureDomain(sc), "[%s]", c.label)
+		assert.Equalf(t, "topology.rook.io/row", getFailureDomainKey(sc), "[%s]", c.label)
+		assert.ElementsMatchf(t, []string{"a", "b", "c"}, sc.Status.FailureDomainValues, "[%s]", c.label)
+
+		// the pools, the OSDs and the mons are spread across the rows
+		pools, err := reconciler.newCephBlockPoolInstances(sc)
+		assert.NoError(t, err)
+		assert.Equalf(t, "row", pools[0].Spec.FailureDomain, "[%s]", c.label)
+		for _, deviceSet := range newStorageClassDeviceSets(sc, serverVersion) {
+			var keys []string
+			for _, tsc := range deviceSet.Placement.TopologySpreadConstraints {
+				keys = append(keys, tsc.TopologyKey)
+			}
+			assert.Containsf(t, keys, "topology.rook.io/row", "[%s]", c.label)
+		}
+		monPlacement := getPlacement(sc, "mon")
+		for _, term := range monPlacement.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+			assert.Equalf(t, "topology.rook.io/row", term.TopologyKey, "[%s]", c.label)
+		}
+	}
+
+	// the nodes must have a label of the failure domain set in the spec
+	objs = append(objs, newTestNode("node-d", map[string]string{defaults.NodeAffinityKey: "", "topology.rook.io/room": "r2"}))
+	reconciler := createFakeStorageClusterReconciler(t, objs...)
+	sc := &api.StorageCluster{ObjectMeta: metav1.ObjectMeta{Name: "ocsinit", Namespace: "openshift-storage"}}
+	sc.Spec.FailureDomain = "row"
+	err := reconciler.reconcileNodeTopologyMap(sc)
+	assert.EqualError(t, err, "storage nodes node-d have no topology.rook.io/row label of the row failure domain")
+}
@@ -19,6 +19,16 @@ func generateNameForCephFilesystem(initData *ocsv1.StorageCluster) string {
 	return fmt.Sprintf("%s-cephfilesystem", initData.Name)
 }
 
+func generateNameForAdditionalCephFilesystem(initData *ocsv1.StorageCluster, fsName string) string {
+	return fmt.Sprintf("%s-%s", generateNameForCephFilesystem(initData), fsName)
+}
+
+// generateNameForCephFilesystemDataPool returns the name Rook gives to the
+// data pool of a CephFilesystem at the given index
+func generateNameForCephFilesystemDataPool(cephFilesystemName string, index int) string {
+	return fmt.Sprintf("%s-data%d", cephFilesystemName, index)
+}
+
 func generateNameForCephObjectStoreUser(initData *ocsv1.StorageCluster) string {
 	return fmt.Sprintf("%s-cephobjectstoreuser", initData.Name)
 }
@@ -27,10 +37,25 @@ func generateNameForCephBlockPool(initData *ocsv1.StorageCluster) string {
 	return fmt.Sprintf("%s-cephblockpool", initData.Name)
 }
 
+// generateNameForAdditionalCephBlockPool returns the name of the CephBlockPool
+// of an additional pool. The image metadata of an erasure coded pool is
+// stored in a replicated pool of the same name with a "-metadata" suffix.
+func generateNameForAdditionalCephBlockPool(initData *ocsv1.StorageCluster, poolName string) string {
+	return fmt.Sprintf("%s-%s", generateNameForCephBlockPool(initData), poolName)
+}
+
+func generateNameForAdditionalCephBlockPoolMetadata(initData *ocsv1.StorageCluster, poolName string) string {
+	return fmt.Sprintf("%s-metadata", generateNameForAdditionalCephBlockPool(initData, poolName))
+}
+
 func generateNameForCephObjectStore(initData *ocsv1.StorageCluster) string {
 	return fmt.Sprintf("%s-%s", initData.Name, "cephobjectstore")
 }
 
+func generateNameForExternalRgwCASecret(initData *ocsv1.StorageCluster) string {
+	return fmt.Sprintf("%s-ceph-rgw-ca", initData.Name)
+}
+
 func generateNameForCephRgwSC(initData *ocsv1.StorageCluster) string {
 	return fmt.Sprintf("%s-ceph-rgw", initData.Name)
 }
@@ -39,22 +64,77 @@ func generateNameForCephFilesystemSC(initData *ocsv1.StorageCluster) string {
 	return fmt.Sprintf("%s-cephfs", initData.Name)
 }
 
+func generateNameForAdditionalCephFilesystemSC(initData *ocsv1.StorageCluster, fsName string) string {
+	return fmt.Sprintf("%s-%s", generateNameForCephFilesystemSC(initData), fsName)
+}
+
 func generateNameForCephBlockPoolSC(initData *ocsv1.StorageCluster, suffix string) string {
 	return fmt.Sprintf("%s-ceph-rbd%s", initData.Name, suffix)
 }
 
+func generateNameForEncryptedCephBlockPoolSC(initData *ocsv1.StorageCluster) string {
+	return generateNameForCephBlockPoolSC(initData, "-encrypted")
+}
+
+// generateNameForTenant returns the name of the Rook resources, the Ceph user,
+// the Secret and the ResourceQuotas of a tenant
+func generateNameForTenant(initData *ocsv1.StorageCluster, tenant ocsv1.TenantSpec) string {
+	return fmt.Sprintf("%s-tenant-%s", initData.Name, tenant.Name)
+}
+
+// generateNameForTenantSC returns the name of the StorageClass of a tenant,
+// named after the StorageClass of its type
+func generateNameForTenantSC(initData *ocsv1.StorageCluster, tenant ocsv1.TenantSpec) string {
+	if tenant.Type == ocsv1.TenantTypeCephFS {
+		return generateNameForAdditionalCephFilesystemSC(initData, tenantStorageClassPrefix+tenant.Name)
+	}
+	return generateNameForCephBlockPoolSC(initData, "-"+tenantStorageClassPrefix+tenant.Name)
+}
+
+// generateNameForTenantLabel returns the value of the tenant label set on the
+// resources of a tenant
+func generateNameForTenantLabel(initData *ocsv1.StorageCluster, tenantName string) string {
+	return fmt.Sprintf("%s-tenant-%s", initData.Namespace, tenantName)
+}
+
 // generateNameForSnapshotClass function generates 'SnapshotClass' name.
 // 'snapshotType' can be: 'rbdSnapshotter' or 'cephfsSnapshotter'
 func generateNameForSnapshotClass(initData *ocsv1.StorageCluster, snapshotType SnapshotterType) string {
 	return fmt.Sprintf("%s-%splugin-snapclass", initData.Name, snapshotType)
 }
 
+// generateNameForAdditionalSnapshotClass generates the 'SnapshotClass' name of
+// an additional pool
+func generateNameForAdditionalSnapshotClass(initData *ocsv1.StorageCluster, snapshotType SnapshotterType, poolName string) string {
+	return fmt.Sprintf("%s-%splugin-%s-snapclass", initData.Name, snapshotType, poolName)
+}
+
 func generateNameForSnapshotClassDriver(initData *ocsv1.StorageCluster, snapshotType SnapshotterType) string {
 	return fmt.Sprintf("%s.%s.csi.ceph.com", initData.Namespace, snapshotType)
 }
 
-func generateNameForSnapshotClassSecret(snapshotType SnapshotterType) string {
-	return fmt.Sprintf("rook-csi-%s-provisioner", snapshotType)
+func generateNameForSnapshotClassSecret(initData *ocsv1.StorageCluster, snapshotType SnapshotterType) string {
+	return generateNameForCSISecret(initData, fmt.Sprintf("rook-csi-%s-provisioner", snapshotType))
+}
+
+// generateNameForCSIClusterID returns the clusterID of the StorageCluster in
+// the Ceph CSI configuration. Rook identifies the clusters by the namespace
+// of their CephCluster, so this is the namespace of the StorageCluster, or the
+// one of the CephCluster of an additional external cluster.
+func generateNameForCSIClusterID(initData *ocsv1.StorageCluster) string {
+	if isAdditionalExternalStorageCluster(initData) {
+		return fmt.Sprintf("%s-%s", initData.Namespace, initData.Name)
+	}
+	return initData.Namespace
+}
+
+// generateNameForCSISecret returns the name of the Secret of a Ceph CSI user
+// of the StorageCluster
+func generateNameForCSISecret(initData *ocsv1.StorageCluster, secretName string) string {
+	if isAdditionalExternalStorageCluster(initData) {
+		return fmt.Sprintf("%s-%s", initData.Name, secretName)
+	}
+	return secretName
 }
 
 // generateCephReplicatedSpec returns the ReplicatedSpec for the cephCluster
@@ -70,3 +150,18 @@ func generateCephReplicatedSpec(initData *ocsv1.StorageCluster, poolType string)
 
 	return crs
 }
+
+// generateCephAdditionalReplicatedSpec returns the ReplicatedSpec of an
+// additional data pool. It has no target size ratio, which is left to the
+// default data pools, and uses the replica of the pool when it is set.
+func generateCephAdditionalReplicatedSpec(initData *ocsv1.StorageCluster, replica int) cephv1.ReplicatedSpec {
+	crs := cephv1.ReplicatedSpec{}
+
+	crs.Size = getCephPoolReplicatedSize(initData)
+	if replica > 0 {
+		crs.Size = uint(replica)
+	}
+	crs.ReplicasPerFailureDomain = uint(getReplicasPerFailureDomain(initData))
+
+	return crs
+}
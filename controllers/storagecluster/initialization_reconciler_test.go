@@ -12,6 +12,7 @@ import (
 	routev1 "github.com/openshift/api/route/v1"
 	openshiftv1 "github.com/openshift/api/template/v1"
 	api "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
 	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	"github.com/stretchr/testify/assert"
@@ -24,6 +25,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
@@ -177,6 +179,7 @@ func createFakeInitializationStorageClusterReconcilerWithPlatform(t *testing.T,
 		serverVersion: &version.Info{},
 		Log:           logf.Log.WithName("controller_storagecluster_test"),
 		platform:      platform,
+		recorder:      statusutil.NewEventReporter(&record.FakeRecorder{}),
 	}
 }
 
@@ -229,6 +232,11 @@ func createFakeInitializationScheme(t *testing.T, obj ...runtime.Object) *runtim
 	if err != nil {
 		assert.Fail(t, "failed to add batchv1 scheme")
 	}
+	err = appsv1.AddToScheme(scheme)
+	if err != nil {
+		assert.Fail(t, "failed to add appsv1 scheme")
+	}
+	addTenantRookKindsToScheme(scheme)
 
 	return scheme
 }
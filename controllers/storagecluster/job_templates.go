@@ -122,25 +122,32 @@ func extendClusterTemplate(sc *ocsv1.StorageCluster) *openshiftv1.Template {
 }
 
 func newExtendClusterJob(sc *ocsv1.StorageCluster, jobTemplateName string, cephCommands []string) *batchv1.Job {
-	labels := map[string]string{
-		"app": "ceph-toolbox-job",
-	}
+	job := newCephToolboxJob(sc, jobTemplateName+"-job", cephCommands)
 
 	// Annotation template.alpha.openshift.io/wait-for-ready ensures template readiness
-	annotations := map[string]string{
+	job.Annotations = map[string]string{
 		"template.alpha.openshift.io/wait-for-ready": "true",
 	}
 
+	return job
+}
+
+// newCephToolboxJob returns a Job running the given command in a container
+// configured like the Ceph toolbox, with the admin credentials of the cluster
+func newCephToolboxJob(sc *ocsv1.StorageCluster, jobName string, cephCommands []string) *batchv1.Job {
+	labels := map[string]string{
+		"app": "ceph-toolbox-job",
+	}
+
 	job := &batchv1.Job{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Job",
 			APIVersion: "batch/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:        jobTemplateName + "-job",
-			Namespace:   sc.Namespace,
-			Labels:      labels,
-			Annotations: annotations,
+			Name:      jobName,
+			Namespace: sc.Namespace,
+			Labels:    labels,
 		},
 		Spec: batchv1.JobSpec{
 			Template: corev1.PodTemplateSpec{
@@ -0,0 +1,139 @@
+package storagecluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	awsRegionKey     = "AWS_REGION"
+	awsCMKARNKey     = "AWS_CMK_ARN"
+	awsEndpointKey   = "AWS_ENDPOINT"
+	awsSecretNameKey = "KMS_SECRET_NAME"
+	// keys of the Secret named by KMS_SECRET_NAME
+	awsAccessKeyIDKey     = "AWS_ACCESS_KEY_ID"
+	awsSecretAccessKeyKey = "AWS_SECRET_ACCESS_KEY"
+	awsSessionTokenKey    = "AWS_SESSION_TOKEN"
+
+	awsKMSService = "kms"
+)
+
+// awsKMSProvider is the AWS Key Management Service, authenticated with the
+// access keys of an IAM user
+type awsKMSProvider struct {
+	kmsProviderConfig
+}
+
+// Probe describes the customer master key of the ConfigMap
+func (p *awsKMSProvider) Probe(ctx context.Context, c client.Client, namespace string, config map[string]string) error {
+	credentials, err := p.getCredentials(ctx, c, namespace, config)
+	if err != nil {
+		return err
+	}
+	accessKeyID := string(credentials[awsAccessKeyIDKey])
+	secretAccessKey := string(credentials[awsSecretAccessKeyKey])
+	if accessKeyID == "" || secretAccessKey == "" {
+		return fmt.Errorf("the KMS credentials Secret %q must have the %s and %s keys", p.tokenSecretName(config), awsAccessKeyIDKey, awsSecretAccessKeyKey)
+	}
+
+	endpoint := config[awsEndpointKey]
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com", config[awsRegionKey])
+	}
+	body, err := json.Marshal(map[string]string{"KeyId": config[awsCMKARNKey]})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.DescribeKey")
+	if token := string(credentials[awsSessionTokenKey]); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signAWSRequest(req, body, accessKeyID, secretAccessKey, config[awsRegionKey], awsKMSService, time.Now())
+
+	tlsConfig, err := newKMSTLSConfig(nil, "")
+	if err != nil {
+		return err
+	}
+	return doKMSRequest(newKMSHTTPClient(tlsConfig), req, nil)
+}
+
+// signAWSRequest signs the request with the AWS Signature Version 4, over the
+// Host header and the Content-Type and X-Amz-* headers already set
+func signAWSRequest(req *http.Request, body []byte, accessKeyID, secretAccessKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	// writing to a hash never fails
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,73 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	azureVaultURLKey      = "AZURE_VAULT_URL"
+	azureTenantIDKey      = "AZURE_TENANT_ID"
+	azureClientIDKey      = "AZURE_CLIENT_ID"
+	azureAuthorityHostKey = "AZURE_AUTHORITY_HOST"
+	azureSecretNameKey    = "AZURE_CLIENT_SECRET_NAME"
+	// azureClientSecretKey is the key of the client secret in the Secret
+	// named by AZURE_CLIENT_SECRET_NAME
+	azureClientSecretKey = "AZURE_CLIENT_SECRET"
+
+	azureDefaultAuthorityHost = "https://login.microsoftonline.com"
+	azureKeyVaultScope        = "https://vault.azure.net/.default"
+	azureKeyVaultAPIVersion   = "7.3"
+)
+
+// azureKMSProvider is an Azure Key Vault, authenticated with the client
+// secret of an Azure AD application
+type azureKMSProvider struct {
+	kmsProviderConfig
+}
+
+// Probe gets an access token from Azure AD and lists the keys of the vault
+func (p *azureKMSProvider) Probe(ctx context.Context, c client.Client, namespace string, config map[string]string) error {
+	credentials, err := p.getCredentials(ctx, c, namespace, config)
+	if err != nil {
+		return err
+	}
+	clientSecret := string(credentials[azureClientSecretKey])
+	if clientSecret == "" {
+		return fmt.Errorf("the KMS credentials Secret %q has no %q key", p.tokenSecretName(config), azureClientSecretKey)
+	}
+
+	tlsConfig, err := newKMSTLSConfig(nil, "")
+	if err != nil {
+		return err
+	}
+	httpClient := newKMSHTTPClient(tlsConfig)
+
+	authorityHost := config[azureAuthorityHostKey]
+	if authorityHost == "" {
+		authorityHost = azureDefaultAuthorityHost
+	}
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(authorityHost, "/"), url.PathEscape(config[azureTenantIDKey]))
+	token, err := getKMSAccessToken(ctx, httpClient, tokenURL, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {config[azureClientIDKey]},
+		"client_secret": {clientSecret},
+		"scope":         {azureKeyVaultScope},
+	})
+	if err != nil {
+		return err
+	}
+
+	keysURL := fmt.Sprintf("%s/keys?api-version=%s&maxresults=1", strings.TrimSuffix(config[azureVaultURLKey], "/"), azureKeyVaultAPIVersion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, keysURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return doKMSRequest(httpClient, req, nil)
+}
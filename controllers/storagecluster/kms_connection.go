@@ -0,0 +1,225 @@
+package storagecluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// kmsTokenMinRequeue bounds how often the StorageCluster is reconciled to
+	// renew a KMS token
+	kmsTokenMinRequeue = time.Minute
+	// kmsHealthCheckInterval is how often the operator checks that it can
+	// connect to the KMS, so that an outage is noticed before the OSDs need
+	// their keys again
+	kmsHealthCheckInterval = 5 * time.Minute
+)
+
+type ocsKMS struct{}
+
+// ensureCreated keeps the KMS token valid, checks that the operator can
+// authenticate to the KMS, and reports it in the KMSConnected condition. The
+// health check runs every kmsHealthCheckInterval, or as soon as the token
+// must be renewed or the KMS configuration changes. A failed health check
+// doesn't fail the reconcile: the KMS is only needed when an OSD starts,
+// which the other resources must not wait for.
+func (obj *ocsKMS) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	if !sc.Spec.Encryption.KeyManagementService.Enable {
+		clearKMSStatus(sc)
+		return nil
+	}
+	// renewing the token, or logging in again, changes it, so the KMS isn't
+	// called in dry-run mode
+	if r.dryRun {
+		return nil
+	}
+
+	if err := r.reconcileKMSConnection(sc, time.Now()); err != nil {
+		r.Log.Error(err, "Failed to check the connection to the KMS.", "KMSConfigMap", klog.KRef(sc.Namespace, KMSConfigMapName))
+		return err
+	}
+	return nil
+}
+
+// ensureDeleted removes the KMS metrics of the StorageCluster, the KMS
+// resources themselves are deleted with deleteKMSResources
+func (obj *ocsKMS) ensureDeleted(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	clearKMSStatus(sc)
+	return nil
+}
+
+// reconcileKMSConnection checks the health of the KMS and records the result
+// in the status of the StorageCluster. Only the errors reading the KMS
+// configuration are returned.
+func (r *StorageClusterReconciler) reconcileKMSConnection(sc *ocsv1.StorageCluster, now time.Time) error {
+	kmsConfigMap, err := getKMSConfigMap(KMSConfigMapName, sc, r.Client)
+	if err != nil {
+		return fmt.Errorf("failed to get the KMS ConfigMap: %v", err)
+	}
+
+	if sc.Status.KMS == nil {
+		sc.Status.KMS = &ocsv1.KMSStatus{}
+	}
+	sc.Status.KMS.Provider = kmsConfigMap.Data[KMSProviderKey]
+	provider := getKMSProvider(kmsConfigMap.Data)
+	if provider == nil {
+		setKMSConnectedCondition(sc, corev1.ConditionUnknown, ocsv1.KMSProviderUnknown,
+			fmt.Sprintf("The connection to the %q KMS is not checked by the operator", sc.Status.KMS.Provider))
+		return nil
+	}
+
+	configHash, err := kmsConfigChecksum(kmsConfigMap.Data)
+	if err != nil {
+		return err
+	}
+	if !isKMSHealthCheckDue(sc.Status.KMS, configHash, now) {
+		return nil
+	}
+
+	err = r.checkKMSHealth(sc, provider, kmsConfigMap.Data, now)
+	checkTime := metav1.NewTime(now)
+	sc.Status.KMS.LastHealthCheckTime = &checkTime
+	sc.Status.KMS.ConfigHash = configHash
+	if err != nil {
+		r.Log.Error(err, "Failed to connect to the KMS.", "KMSConfigMap", klog.KRef(sc.Namespace, KMSConfigMapName))
+		if condition := conditionsv1.FindStatusCondition(sc.Status.Conditions, ocsv1.ConditionKMSConnected); condition == nil || condition.Status != corev1.ConditionFalse {
+			r.recorder.Report(sc, corev1.EventTypeWarning, statusutil.EventReasonKMSConnectionFailed, err.Error())
+		}
+		setKMSConnectedCondition(sc, corev1.ConditionFalse, ocsv1.KMSConnectionFailed, err.Error())
+		return nil
+	}
+	sc.Status.KMS.LastSuccessfulHealthCheckTime = &checkTime
+	setKMSConnectedCondition(sc, corev1.ConditionTrue, ocsv1.KMSConnected,
+		fmt.Sprintf("Connected successfully to the %s KMS", provider.Name()))
+	return nil
+}
+
+// isKMSHealthCheckDue returns true if the last health check is older than
+// kmsHealthCheckInterval, or kmsTokenMinRequeue if it failed, if the KMS
+// token must be renewed, or if the KMS configuration changed since
+func isKMSHealthCheckDue(status *ocsv1.KMSStatus, configHash string, now time.Time) bool {
+	lastCheck := status.LastHealthCheckTime
+	if lastCheck == nil || status.ConfigHash != configHash {
+		return true
+	}
+	if renewal := status.NextTokenRenewalTime; renewal != nil && !now.Before(renewal.Time) {
+		return true
+	}
+	interval := kmsHealthCheckInterval
+	if lastSuccess := status.LastSuccessfulHealthCheckTime; lastSuccess == nil || lastSuccess.Before(lastCheck) {
+		interval = kmsTokenMinRequeue
+	}
+	return !now.Before(lastCheck.Add(interval))
+}
+
+// kmsConfigChecksum returns the checksum of the data of the KMS ConfigMap
+func kmsConfigChecksum(config map[string]string) (string, error) {
+	// the keys of a map are marshaled in order
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return sha512sum(data)
+}
+
+// checkKMSHealth renews or rotates the token of the KMS if needed, and probes
+// the KMS with it
+func (r *StorageClusterReconciler) checkKMSHealth(sc *ocsv1.StorageCluster, provider KMSProvider, config map[string]string, now time.Time) error {
+	if err := provider.ValidateConfig(config); err != nil {
+		return fmt.Errorf("invalid %s KMS configuration: %v", provider.Name(), err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 2*kmsProbeTimeout)
+	defer cancel()
+	if tokenManager, ok := provider.(kmsTokenManager); ok {
+		token, err := tokenManager.EnsureToken(ctx, r.Client, sc.Namespace, config, now)
+		if err != nil {
+			return fmt.Errorf("failed to renew the %s KMS token: %v", provider.Name(), err)
+		}
+		setKMSTokenStatus(sc, token, now)
+		if token.action != "" {
+			r.Log.Info("KMS token was renewed.", "Action", token.action, "KMSTokenSecret", klog.KRef(sc.Namespace, KMSTokenSecretName))
+		}
+	}
+
+	start := time.Now()
+	err := provider.Probe(ctx, r.Client, sc.Namespace, config)
+	sc.Status.KMS.LastHealthCheckLatency = &metav1.Duration{Duration: time.Since(start)}
+	if err != nil {
+		return fmt.Errorf("failed to connect to the %s KMS: %v", provider.Name(), err)
+	}
+	return nil
+}
+
+// setKMSTokenStatus records the token in the status of the StorageCluster,
+// which the metrics exporter exposes
+func setKMSTokenStatus(sc *ocsv1.StorageCluster, token *kmsToken, now time.Time) {
+	toMetaTime := func(t *time.Time) *metav1.Time {
+		if t == nil {
+			return nil
+		}
+		mt := metav1.NewTime(*t)
+		return &mt
+	}
+	sc.Status.KMS.AuthMethod = token.authMethod
+	sc.Status.KMS.TokenExpiryTime = toMetaTime(token.expiryTime)
+	sc.Status.KMS.NextTokenRenewalTime = toMetaTime(token.renewalTime)
+	if token.action != "" {
+		sc.Status.KMS.LastTokenRenewalTime = toMetaTime(&now)
+	}
+}
+
+// clearKMSStatus removes the KMS status and condition of a StorageCluster
+// without KMS
+func clearKMSStatus(sc *ocsv1.StorageCluster) {
+	sc.Status.KMS = nil
+	conditionsv1.RemoveStatusCondition(&sc.Status.Conditions, ocsv1.ConditionKMSConnected)
+}
+
+func setKMSConnectedCondition(sc *ocsv1.StorageCluster, status corev1.ConditionStatus, reason, message string) {
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, conditionsv1.Condition{
+		Type:    ocsv1.ConditionKMSConnected,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
+}
+
+// getKMSRequeueAfter returns when the StorageCluster must be reconciled again
+// to check the health of the KMS or to renew its token, 0 if it doesn't need to
+func getKMSRequeueAfter(sc *ocsv1.StorageCluster, now time.Time) time.Duration {
+	if sc.Status.KMS == nil {
+		return 0
+	}
+	// a failed health check is retried sooner
+	if lastCheck := sc.Status.KMS.LastHealthCheckTime; lastCheck != nil {
+		if lastSuccess := sc.Status.KMS.LastSuccessfulHealthCheckTime; lastSuccess == nil || lastSuccess.Before(lastCheck) {
+			return kmsTokenMinRequeue
+		}
+	}
+	var next *metav1.Time
+	if sc.Status.KMS.LastHealthCheckTime != nil {
+		nextCheck := metav1.NewTime(sc.Status.KMS.LastHealthCheckTime.Add(kmsHealthCheckInterval))
+		next = &nextCheck
+	}
+	if renewal := sc.Status.KMS.NextTokenRenewalTime; renewal != nil && (next == nil || renewal.Before(next)) {
+		next = renewal
+	}
+	if next == nil {
+		return 0
+	}
+	requeueAfter := next.Sub(now)
+	if requeueAfter < kmsTokenMinRequeue {
+		return kmsTokenMinRequeue
+	}
+	return requeueAfter
+}
@@ -0,0 +1,320 @@
+package storagecluster
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestEnsureKMSConnection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kms")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	defer func(path string) { vaultServiceAccountTokenPath = path }(vaultServiceAccountTokenPath)
+	vaultServiceAccountTokenPath = filepath.Join(dir, "token")
+	assert.NoError(t, ioutil.WriteFile(vaultServiceAccountTokenPath, []byte("fake-jwt\n"), 0600))
+
+	cases := []struct {
+		label      string
+		authConfig map[string]string
+		// token of the ocs-kms-token Secret, if any, and its state in Vault
+		token     string
+		tokenInfo *fakeVaultTokenInfo
+		appRoleID string
+		// expected outcome
+		isValid     bool
+		action      kmsTokenAction
+		expires     bool
+		renewalTime bool
+		loggedIn    bool
+	}{
+		{
+			label:     "Case 1: static token which never expires",
+			token:     "s.static",
+			tokenInfo: &fakeVaultTokenInfo{},
+			isValid:   true,
+		},
+		{
+			label:       "Case 2: renewable static token before its renewal time",
+			token:       "s.static",
+			tokenInfo:   &fakeVaultTokenInfo{ttl: 3000, creationTTL: 3600, renewable: true},
+			isValid:     true,
+			expires:     true,
+			renewalTime: true,
+		},
+		{
+			label:       "Case 3: renewable static token about to expire",
+			token:       "s.static",
+			tokenInfo:   &fakeVaultTokenInfo{ttl: 100, creationTTL: 3600, renewable: true},
+			isValid:     true,
+			action:      kmsTokenRenewed,
+			expires:     true,
+			renewalTime: true,
+		},
+		{
+			label:     "Case 4: static token which can't be renewed",
+			token:     "s.static",
+			tokenInfo: &fakeVaultTokenInfo{ttl: 100, creationTTL: 3600},
+			isValid:   true,
+			expires:   true,
+		},
+		{
+			label:   "Case 5: revoked static token",
+			token:   "s.revoked",
+			isValid: false,
+		},
+		{
+			label:       "Case 6: kubernetes auth without token",
+			authConfig:  map[string]string{vaultAuthMethodKey: vaultAuthMethodKubernetes, vaultAuthKubernetesRoleKey: "ocs"},
+			isValid:     true,
+			action:      kmsTokenRotated,
+			expires:     true,
+			renewalTime: true,
+			loggedIn:    true,
+		},
+		{
+			label:       "Case 7: kubernetes auth with a token at its max TTL",
+			authConfig:  map[string]string{vaultAuthMethodKey: vaultAuthMethodKubernetes, vaultAuthKubernetesRoleKey: "ocs"},
+			token:       "s.issued-old",
+			tokenInfo:   &fakeVaultTokenInfo{ttl: 100, creationTTL: 3600, renewable: true, maxed: true},
+			isValid:     true,
+			action:      kmsTokenRotated,
+			expires:     true,
+			renewalTime: true,
+			loggedIn:    true,
+		},
+		{
+			label:       "Case 8: approle auth with a revoked token",
+			authConfig:  map[string]string{vaultAuthMethodKey: vaultAuthMethodAppRole, vaultAuthAppRoleSecretNameKey: "ocs-vault-approle"},
+			token:       "s.revoked",
+			appRoleID:   "ocs",
+			isValid:     true,
+			action:      kmsTokenRotated,
+			expires:     true,
+			renewalTime: true,
+			loggedIn:    true,
+		},
+		{
+			label:      "Case 9: approle auth with a wrong role",
+			authConfig: map[string]string{vaultAuthMethodKey: vaultAuthMethodAppRole, vaultAuthAppRoleSecretNameKey: "ocs-vault-approle"},
+			appRoleID:  "other",
+			isValid:    false,
+		},
+		{
+			label:      "Case 10: unknown auth method",
+			authConfig: map[string]string{vaultAuthMethodKey: "userpass"},
+			isValid:    false,
+		},
+	}
+
+	for _, c := range cases {
+		vault := newFakeVault(3600)
+		if c.tokenInfo != nil {
+			vault.tokens[c.token] = c.tokenInfo
+		}
+
+		sc := createDefaultStorageCluster()
+		sc.Spec.Encryption.KeyManagementService.Enable = true
+		kmsCM := createDummyKMSConfigMap(VaultKMSProvider, vault.server.URL)
+		kmsCM.Namespace = sc.Namespace
+		for key, value := range c.authConfig {
+			kmsCM.Data[key] = value
+		}
+		objs := []runtime.Object{kmsCM}
+		if c.token != "" {
+			secret := createDummyKMSTokenSecret(c.token)
+			secret.Namespace = sc.Namespace
+			objs = append(objs, secret)
+		}
+		if c.appRoleID != "" {
+			objs = append(objs, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "ocs-vault-approle", Namespace: sc.Namespace},
+				Data:       map[string][]byte{vaultAppRoleRoleIDKey: []byte(c.appRoleID), vaultAppRoleSecretIDKey: []byte("fake-secret-id")},
+			})
+		}
+		reconciler := createFakeStorageClusterReconciler(t, objs...)
+
+		obj := &ocsKMS{}
+		now := time.Now()
+		err := obj.ensureCreated(&reconciler, sc)
+		vault.server.Close()
+		condition := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionKMSConnected)
+		if !assert.NotNilf(t, condition, "[%s]", c.label) {
+			continue
+		}
+		// a failed health check doesn't block the other resources
+		assert.NoErrorf(t, err, "[%s]", c.label)
+		if !c.isValid {
+			assert.Equalf(t, corev1.ConditionFalse, condition.Status, "[%s]", c.label)
+			assert.NotNilf(t, sc.Status.KMS.LastHealthCheckTime, "[%s]", c.label)
+			assert.Nilf(t, sc.Status.KMS.LastSuccessfulHealthCheckTime, "[%s]", c.label)
+			// and it is retried sooner
+			assert.Equalf(t, kmsTokenMinRequeue, getKMSRequeueAfter(sc, now), "[%s]", c.label)
+			continue
+		}
+		assert.Equalf(t, corev1.ConditionTrue, condition.Status, "[%s]", c.label)
+
+		// the KMS, which is now down, isn't checked again before the next
+		// health check
+		assert.NoErrorf(t, obj.ensureCreated(&reconciler, sc), "[%s]", c.label)
+		assert.Truef(t, conditionsv1.IsStatusConditionTrue(sc.Status.Conditions, api.ConditionKMSConnected), "[%s]", c.label)
+
+		status := sc.Status.KMS
+		assert.Equalf(t, VaultKMSProvider, status.Provider, "[%s]", c.label)
+		assert.Equalf(t, getVaultAuthMethod(c.authConfig), status.AuthMethod, "[%s]", c.label)
+		assert.Equalf(t, c.expires, status.TokenExpiryTime != nil, "[%s]", c.label)
+		assert.Equalf(t, c.renewalTime, status.NextTokenRenewalTime != nil, "[%s]", c.label)
+		assert.Equalf(t, c.action != "", status.LastTokenRenewalTime != nil, "[%s]", c.label)
+		if c.action == kmsTokenRenewed {
+			// the token is renewed for its whole creation TTL
+			assert.WithinDurationf(t, now.Add(time.Hour), status.TokenExpiryTime.Time, 5*time.Second, "[%s]", c.label)
+		}
+		assert.Equalf(t, now.Unix(), status.LastSuccessfulHealthCheckTime.Unix(), "[%s]", c.label)
+		assert.NotNilf(t, status.LastHealthCheckLatency, "[%s]", c.label)
+		// the KMS is checked again at the latest after the health check interval
+		requeueAfter := getKMSRequeueAfter(sc, status.LastHealthCheckTime.Time)
+		assert.Truef(t, requeueAfter >= kmsTokenMinRequeue && requeueAfter <= kmsHealthCheckInterval, "[%s] requeue after %v", c.label, requeueAfter)
+
+		secret := &corev1.Secret{}
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: KMSTokenSecretName, Namespace: sc.Namespace}, secret))
+		if c.loggedIn {
+			// the issued token is passed on to Rook and NooBaa through the Secret
+			assert.Equalf(t, "s.issued-1", string(secret.Data[vaultTokenKey]), "[%s]", c.label)
+			cephSpec := getCephKMSSpec(kmsCM)
+			assert.Equalf(t, KMSTokenSecretName, cephSpec.TokenSecretName, "[%s]", c.label)
+			assert.NotContainsf(t, cephSpec.ConnectionDetails, vaultAuthMethodKey, "[%s]", c.label)
+		} else {
+			assert.Equalf(t, c.token, string(secret.Data[vaultTokenKey]), "[%s]", c.label)
+		}
+	}
+
+	// disabling the KMS clears its status
+	sc := createDefaultStorageCluster()
+	sc.Status.KMS = &api.KMSStatus{Provider: VaultKMSProvider}
+	setKMSConnectedCondition(sc, corev1.ConditionTrue, api.KMSConnected, "")
+	reconciler := createFakeStorageClusterReconciler(t)
+	assert.NoError(t, (&ocsKMS{}).ensureCreated(&reconciler, sc))
+	assert.Nil(t, sc.Status.KMS)
+	assert.Nil(t, conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionKMSConnected))
+	assert.Equal(t, time.Duration(0), getKMSRequeueAfter(sc, time.Now()))
+}
+
+func TestIsKMSHealthCheckDue(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) *metav1.Time {
+		mt := metav1.NewTime(now.Add(d))
+		return &mt
+	}
+	cases := []struct {
+		label      string
+		status     *api.KMSStatus
+		configHash string
+		expected   bool
+	}{
+		{
+			label:    "Case 1: never checked",
+			status:   &api.KMSStatus{},
+			expected: true,
+		},
+		{
+			label:      "Case 2: checked recently",
+			status:     &api.KMSStatus{LastHealthCheckTime: at(-time.Minute), LastSuccessfulHealthCheckTime: at(-time.Minute), ConfigHash: "a"},
+			configHash: "a",
+			expected:   false,
+		},
+		{
+			label:      "Case 3: health check interval passed",
+			status:     &api.KMSStatus{LastHealthCheckTime: at(-kmsHealthCheckInterval), LastSuccessfulHealthCheckTime: at(-kmsHealthCheckInterval), ConfigHash: "a"},
+			configHash: "a",
+			expected:   true,
+		},
+		{
+			label:      "Case 4: KMS configuration changed",
+			status:     &api.KMSStatus{LastHealthCheckTime: at(-time.Minute), LastSuccessfulHealthCheckTime: at(-time.Minute), ConfigHash: "a"},
+			configHash: "b",
+			expected:   true,
+		},
+		{
+			label: "Case 5: token renewal time passed",
+			status: &api.KMSStatus{LastHealthCheckTime: at(-time.Minute), LastSuccessfulHealthCheckTime: at(-time.Minute), ConfigHash: "a",
+				NextTokenRenewalTime: at(-time.Second)},
+			configHash: "a",
+			expected:   true,
+		},
+		{
+			label:      "Case 6: failed health check is retried sooner",
+			status:     &api.KMSStatus{LastHealthCheckTime: at(-kmsTokenMinRequeue), ConfigHash: "a"},
+			configHash: "a",
+			expected:   true,
+		},
+	}
+
+	for _, c := range cases {
+		assert.Equalf(t, c.expected, isKMSHealthCheckDue(c.status, c.configHash, now), "[%s]", c.label)
+	}
+}
+
+func TestGetKMSRequeueAfter(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) *metav1.Time {
+		mt := metav1.NewTime(now.Add(d))
+		return &mt
+	}
+	cases := []struct {
+		label    string
+		status   *api.KMSStatus
+		expected time.Duration
+	}{
+		{
+			label:    "Case 1: no KMS",
+			expected: 0,
+		},
+		{
+			label:    "Case 2: KMS which isn't checked",
+			status:   &api.KMSStatus{Provider: "newKMSProvider"},
+			expected: 0,
+		},
+		{
+			label:    "Case 3: next health check",
+			status:   &api.KMSStatus{LastHealthCheckTime: at(-time.Minute), LastSuccessfulHealthCheckTime: at(-time.Minute)},
+			expected: kmsHealthCheckInterval - time.Minute,
+		},
+		{
+			label:    "Case 4: token renewal before the next health check",
+			status:   &api.KMSStatus{LastHealthCheckTime: at(0), LastSuccessfulHealthCheckTime: at(0), NextTokenRenewalTime: at(2 * time.Minute)},
+			expected: 2 * time.Minute,
+		},
+		{
+			label:    "Case 5: token renewal after the next health check",
+			status:   &api.KMSStatus{LastHealthCheckTime: at(0), LastSuccessfulHealthCheckTime: at(0), NextTokenRenewalTime: at(time.Hour)},
+			expected: kmsHealthCheckInterval,
+		},
+		{
+			label:    "Case 6: overdue health check",
+			status:   &api.KMSStatus{LastHealthCheckTime: at(-time.Hour), LastSuccessfulHealthCheckTime: at(-time.Hour)},
+			expected: kmsTokenMinRequeue,
+		},
+		{
+			label:    "Case 7: failed health check",
+			status:   &api.KMSStatus{LastHealthCheckTime: at(0), LastSuccessfulHealthCheckTime: at(-time.Hour)},
+			expected: kmsTokenMinRequeue,
+		},
+	}
+
+	for _, c := range cases {
+		sc := createDefaultStorageCluster()
+		sc.Status.KMS = c.status
+		assert.Equalf(t, c.expected, getKMSRequeueAfter(sc, now), "[%s]", c.label)
+	}
+}
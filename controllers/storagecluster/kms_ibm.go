@@ -0,0 +1,68 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	ibmKPServiceInstanceIDKey = "IBM_KP_SERVICE_INSTANCE_ID"
+	ibmKPBaseURLKey           = "IBM_KP_BASE_URL"
+	ibmKPTokenURLKey          = "IBM_KP_TOKEN_URL"
+	ibmKPSecretNameKey        = "IBM_KP_SECRET_NAME"
+	// ibmKPServiceAPIKeyKey is the key of the API key in the Secret named by
+	// IBM_KP_SECRET_NAME
+	ibmKPServiceAPIKeyKey = "IBM_KP_SERVICE_API_KEY"
+
+	ibmDefaultTokenURL = "https://iam.cloud.ibm.com/oidc/token"
+)
+
+// ibmKeyProtectKMSProvider is an IBM Key Protect service instance,
+// authenticated with the API key of a service ID
+type ibmKeyProtectKMSProvider struct {
+	kmsProviderConfig
+}
+
+// Probe gets an access token from IBM Cloud IAM and lists the keys of the
+// service instance
+func (p *ibmKeyProtectKMSProvider) Probe(ctx context.Context, c client.Client, namespace string, config map[string]string) error {
+	credentials, err := p.getCredentials(ctx, c, namespace, config)
+	if err != nil {
+		return err
+	}
+	apiKey := string(credentials[ibmKPServiceAPIKeyKey])
+	if apiKey == "" {
+		return fmt.Errorf("the KMS credentials Secret %q has no %q key", p.tokenSecretName(config), ibmKPServiceAPIKeyKey)
+	}
+
+	tlsConfig, err := newKMSTLSConfig(nil, "")
+	if err != nil {
+		return err
+	}
+	httpClient := newKMSHTTPClient(tlsConfig)
+
+	tokenURL := config[ibmKPTokenURLKey]
+	if tokenURL == "" {
+		tokenURL = ibmDefaultTokenURL
+	}
+	token, err := getKMSAccessToken(ctx, httpClient, tokenURL, url.Values{
+		"grant_type": {"urn:ibm:params:oauth:grant-type:apikey"},
+		"apikey":     {apiKey},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(config[ibmKPBaseURLKey], "/")+"/api/v2/keys?limit=1", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Bluemix-Instance", config[ibmKPServiceInstanceIDKey])
+	return doKMSRequest(httpClient, req, nil)
+}
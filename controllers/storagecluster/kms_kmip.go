@@ -0,0 +1,199 @@
+package storagecluster
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	kmipEndpointKey      = "KMIP_ENDPOINT"
+	kmipSecretNameKey    = "KMIP_SECRET_NAME"
+	kmipTLSServerNameKey = "TLS_SERVER_NAME"
+	// keys of the Secret named by KMIP_SECRET_NAME
+	kmipCACertKey     = "CA_CERT"
+	kmipClientCertKey = "CLIENT_CERT"
+	kmipClientKeyKey  = "CLIENT_KEY"
+)
+
+// KMIP TTLV tags, types and values used by the probe
+const (
+	kmipTagBatchCount       = 0x42000D
+	kmipTagBatchItem        = 0x42000F
+	kmipTagOperation        = 0x42005C
+	kmipTagProtocolVersion  = 0x420069
+	kmipTagVersionMajor     = 0x42006A
+	kmipTagVersionMinor     = 0x42006B
+	kmipTagRequestHeader    = 0x420077
+	kmipTagRequestMessage   = 0x420078
+	kmipTagRequestPayload   = 0x420079
+	kmipTagResponseHeader   = 0x42007A
+	kmipTagResponseMessage  = 0x42007B
+	kmipTagResponsePayload  = 0x42007C
+	kmipTagResultStatus     = 0x42007F
+	kmipTypeStructure       = 0x01
+	kmipTypeInteger         = 0x02
+	kmipTypeEnumeration     = 0x05
+	kmipOperationDiscover   = 0x1E
+	kmipResultStatusSuccess = 0
+)
+
+// kmipKMSProvider is a KMIP server, authenticated with a client certificate
+type kmipKMSProvider struct {
+	kmsProviderConfig
+}
+
+// ValidateConfig checks the keys of the KMIP ConfigMap
+func (p *kmipKMSProvider) ValidateConfig(config map[string]string) error {
+	if err := p.kmsProviderConfig.ValidateConfig(config); err != nil {
+		return err
+	}
+	if _, _, err := net.SplitHostPort(config[kmipEndpointKey]); err != nil {
+		return fmt.Errorf("invalid %s: %v", kmipEndpointKey, err)
+	}
+	return nil
+}
+
+// Probe sends a Discover Versions request to the KMIP server, over a
+// mutually authenticated TLS connection
+func (p *kmipKMSProvider) Probe(ctx context.Context, c client.Client, namespace string, config map[string]string) error {
+	credentials, err := p.getCredentials(ctx, c, namespace, config)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := newKMSTLSConfig(credentials[kmipCACertKey], config[kmipTLSServerNameKey])
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(credentials[kmipClientCertKey], credentials[kmipClientKeyKey])
+	if err != nil {
+		return fmt.Errorf("failed to load the KMIP client certificate: %v", err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{cert}
+
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: kmsProbeTimeout}, Config: tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", config[kmipEndpointKey])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(kmsProbeTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	if _, err := conn.Write(newKMIPDiscoverVersionsRequest()); err != nil {
+		return err
+	}
+	response, err := readKMIPMessage(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read the KMIP response: %v", err)
+	}
+	status, found := findKMIPEnumeration(response, kmipTagResultStatus)
+	if !found {
+		return fmt.Errorf("the KMIP response has no result status")
+	}
+	if status != kmipResultStatusSuccess {
+		return fmt.Errorf("the KMIP server returned the result status %d", status)
+	}
+	return nil
+}
+
+// kmipItem encodes a KMIP TTLV item with the given value
+func kmipItem(tag uint32, itemType byte, value []byte) []byte {
+	padded := (len(value) + 7) / 8 * 8
+	item := make([]byte, 8+padded)
+	item[0], item[1], item[2], item[3] = byte(tag>>16), byte(tag>>8), byte(tag), itemType
+	binary.BigEndian.PutUint32(item[4:8], uint32(len(value)))
+	copy(item[8:], value)
+	return item
+}
+
+// kmipInteger encodes a KMIP Integer or Enumeration
+func kmipInteger(tag uint32, itemType byte, value uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, value)
+	return kmipItem(tag, itemType, b)
+}
+
+// kmipStructure encodes a KMIP Structure holding the given items
+func kmipStructure(tag uint32, items ...[]byte) []byte {
+	var value []byte
+	for _, item := range items {
+		value = append(value, item...)
+	}
+	return kmipItem(tag, kmipTypeStructure, value)
+}
+
+// newKMIPDiscoverVersionsRequest returns a KMIP 1.4 Discover Versions request,
+// which any KMIP server answers without side effects
+func newKMIPDiscoverVersionsRequest() []byte {
+	return kmipStructure(kmipTagRequestMessage,
+		kmipStructure(kmipTagRequestHeader,
+			kmipStructure(kmipTagProtocolVersion,
+				kmipInteger(kmipTagVersionMajor, kmipTypeInteger, 1),
+				kmipInteger(kmipTagVersionMinor, kmipTypeInteger, 4),
+			),
+			kmipInteger(kmipTagBatchCount, kmipTypeInteger, 1),
+		),
+		kmipStructure(kmipTagBatchItem,
+			kmipInteger(kmipTagOperation, kmipTypeEnumeration, kmipOperationDiscover),
+			kmipStructure(kmipTagRequestPayload),
+		),
+	)
+}
+
+// readKMIPMessage reads a KMIP TTLV message
+func readKMIPMessage(r io.Reader) ([]byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[4:8])
+	if length > kmsMaxResponseSize {
+		return nil, fmt.Errorf("message of %d bytes is too large", length)
+	}
+	message := make([]byte, 8+length)
+	copy(message, header)
+	if _, err := io.ReadFull(r, message[8:]); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// findKMIPEnumeration returns the value of the first Enumeration with the
+// given tag, looking into the nested structures
+func findKMIPEnumeration(message []byte, tag uint32) (uint32, bool) {
+	for len(message) >= 8 {
+		itemTag := uint32(message[0])<<16 | uint32(message[1])<<8 | uint32(message[2])
+		itemType := message[3]
+		length := int(binary.BigEndian.Uint32(message[4:8]))
+		if length > len(message)-8 {
+			return 0, false
+		}
+		value := message[8 : 8+length]
+		switch {
+		case itemType == kmipTypeStructure:
+			if found, ok := findKMIPEnumeration(value, tag); ok {
+				return found, true
+			}
+		case itemType == kmipTypeEnumeration && itemTag == tag && length == 4:
+			return binary.BigEndian.Uint32(value), true
+		}
+		padded := (length + 7) / 8 * 8
+		if padded > len(message)-8 {
+			return 0, false
+		}
+		message = message[8+padded:]
+	}
+	return 0, false
+}
@@ -0,0 +1,323 @@
+package storagecluster
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	nbv1 "github.com/noobaa/noobaa-operator/v2/pkg/apis/noobaa/v1alpha1"
+	rookCephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// KMIPKMSProvider a constant to represent 'kmip' KMS provider
+	KMIPKMSProvider = "kmip"
+	// AWSKMSProvider a constant to represent 'aws' KMS provider
+	AWSKMSProvider = "aws"
+	// AzureKMSProvider a constant to represent 'azure-kv' KMS provider
+	AzureKMSProvider = "azure-kv"
+	// IBMKeyProtectKMSProvider a constant to represent 'ibmkeyprotect' KMS provider
+	IBMKeyProtectKMSProvider = "ibmkeyprotect"
+
+	// kmsProbeTimeout bounds the calls made to check a KMS
+	kmsProbeTimeout = 5 * time.Second
+	// kmsMaxResponseSize bounds the size of the KMS responses read by the probes
+	kmsMaxResponseSize = 1 << 20
+)
+
+// KMSProvider is a key management service that can hold the encryption
+// keys of the cluster
+type KMSProvider interface {
+	// Name returns the value of the KMS_PROVIDER key selecting the provider
+	Name() string
+	// ValidateConfig checks the keys of the KMS ConfigMap
+	ValidateConfig(config map[string]string) error
+	// Probe checks that the KMS is reachable and accepts the credentials,
+	// by making an authenticated call
+	Probe(ctx context.Context, c client.Client, namespace string, config map[string]string) error
+	// CephKMSSpec translates the KMS ConfigMap into the CephCluster spec
+	CephKMSSpec(config map[string]string) rookCephv1.KeyManagementServiceSpec
+	// NooBaaKMSSpec translates the KMS ConfigMap into the NooBaa spec
+	NooBaaKMSSpec(config map[string]string) nbv1.KeyManagementServiceSpec
+}
+
+// kmsToken describes the token the operator keeps valid for a KMS
+type kmsToken struct {
+	// authMethod is the method the token was obtained with
+	authMethod string
+	// expiryTime is nil for the tokens which never expire
+	expiryTime *time.Time
+	// renewalTime is when the token must be renewed or rotated, nil if the
+	// operator can't do either
+	renewalTime *time.Time
+	// action is what the operator just did to the token, if anything
+	action kmsTokenAction
+}
+
+// kmsTokenAction is what the operator did to keep a KMS token valid
+type kmsTokenAction string
+
+const (
+	kmsTokenRenewed kmsTokenAction = "Renewed"
+	kmsTokenRotated kmsTokenAction = "Rotated"
+)
+
+// kmsTokenManager is implemented by the KMS providers whose tokens expire.
+// The operator renews them, or logs in again, before they do.
+type kmsTokenManager interface {
+	// EnsureToken makes sure the Secret referenced by the CephCluster and
+	// NooBaa KMS specs holds a valid token
+	EnsureToken(ctx context.Context, c client.Client, namespace string, config map[string]string, now time.Time) (*kmsToken, error)
+}
+
+// csiKMSProvider is implemented by the KMS providers which ceph-csi can
+// encrypt RBD volumes with
+type csiKMSProvider interface {
+	// CSIConnectionDetails returns the ceph-csi configuration of the KMS,
+	// which is stored in the CSI KMS ConfigMap, or an error if ceph-csi can't
+	// use the KMS as configured
+	CSIConnectionDetails(config map[string]string) (map[string]string, error)
+}
+
+// kmsProviders are the KMS providers known to the ocs-operator,
+// by the value of their KMS_PROVIDER key
+var kmsProviders = map[string]KMSProvider{
+	VaultKMSProvider:         &vaultKMSProvider{kmsProviderConfig{name: VaultKMSProvider, requiredKeys: []string{vaultAddrKey}, urlKeys: []string{vaultAddrKey}, operatorKeys: vaultAuthKeys}},
+	KMIPKMSProvider:          &kmipKMSProvider{kmsProviderConfig{name: KMIPKMSProvider, requiredKeys: []string{kmipEndpointKey, kmipSecretNameKey}, secretNameKey: kmipSecretNameKey}},
+	AWSKMSProvider:           &awsKMSProvider{kmsProviderConfig{name: AWSKMSProvider, requiredKeys: []string{awsRegionKey, awsCMKARNKey, awsSecretNameKey}, urlKeys: []string{awsEndpointKey}, secretNameKey: awsSecretNameKey}},
+	AzureKMSProvider:         &azureKMSProvider{kmsProviderConfig{name: AzureKMSProvider, requiredKeys: []string{azureVaultURLKey, azureTenantIDKey, azureClientIDKey, azureSecretNameKey}, urlKeys: []string{azureVaultURLKey, azureAuthorityHostKey}, secretNameKey: azureSecretNameKey}},
+	IBMKeyProtectKMSProvider: &ibmKeyProtectKMSProvider{kmsProviderConfig{name: IBMKeyProtectKMSProvider, requiredKeys: []string{ibmKPServiceInstanceIDKey, ibmKPBaseURLKey, ibmKPSecretNameKey}, urlKeys: []string{ibmKPBaseURLKey, ibmKPTokenURLKey}, secretNameKey: ibmKPSecretNameKey}},
+}
+
+// getKMSProvider returns the provider selected by the KMS ConfigMap, or nil
+// if the ocs-operator does not know it
+func getKMSProvider(config map[string]string) KMSProvider {
+	return kmsProviders[config[KMSProviderKey]]
+}
+
+// validateKMSProvider checks the KMS ConfigMap against its provider, and that
+// the KMS accepts the credentials unless probe is false. Providers unknown to
+// the ocs-operator are left to Rook to validate.
+func validateKMSProvider(c client.Client, kmsConfigMap *corev1.ConfigMap, probe bool) error {
+	if kmsConfigMap == nil {
+		return fmt.Errorf("please provide a valid config map")
+	}
+	provider := getKMSProvider(kmsConfigMap.Data)
+	if provider == nil {
+		return nil
+	}
+	if err := provider.ValidateConfig(kmsConfigMap.Data); err != nil {
+		return fmt.Errorf("invalid %s KMS configuration: %v", provider.Name(), err)
+	}
+	if !probe {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), kmsProbeTimeout)
+	defer cancel()
+	if err := provider.Probe(ctx, c, kmsConfigMap.Namespace, kmsConfigMap.Data); err != nil {
+		return fmt.Errorf("failed to connect to the %s KMS: %v", provider.Name(), err)
+	}
+	return nil
+}
+
+// getCephKMSSpec returns the KeyManagementService of the CephCluster
+func getCephKMSSpec(kmsConfigMap *corev1.ConfigMap) rookCephv1.KeyManagementServiceSpec {
+	if provider := getKMSProvider(kmsConfigMap.Data); provider != nil {
+		return provider.CephKMSSpec(kmsConfigMap.Data)
+	}
+	return rookCephv1.KeyManagementServiceSpec{
+		ConnectionDetails: kmsConfigMap.Data,
+		TokenSecretName:   KMSTokenSecretName,
+	}
+}
+
+// getNooBaaKMSSpec returns the KeyManagementService of the NooBaa system
+func getNooBaaKMSSpec(kmsConfigMap *corev1.ConfigMap) nbv1.KeyManagementServiceSpec {
+	if provider := getKMSProvider(kmsConfigMap.Data); provider != nil {
+		return provider.NooBaaKMSSpec(kmsConfigMap.Data)
+	}
+	return nbv1.KeyManagementServiceSpec{
+		ConnectionDetails: kmsConfigMap.Data,
+		TokenSecretName:   KMSTokenSecretName,
+	}
+}
+
+// kmsProviderConfig describes the keys of the KMS ConfigMap of a provider,
+// and implements the parts of KMSProvider common to all of them
+type kmsProviderConfig struct {
+	name string
+	// requiredKeys must be set in the ConfigMap
+	requiredKeys []string
+	// urlKeys hold HTTP(S) URLs, when set
+	urlKeys []string
+	// secretNameKey holds the name of the Secret with the credentials,
+	// the ocs-kms-token Secret is used if empty
+	secretNameKey string
+	// operatorKeys are only used by the operator, and are not passed on to
+	// Rook and NooBaa
+	operatorKeys []string
+}
+
+// Name returns the value of the KMS_PROVIDER key selecting the provider
+func (p *kmsProviderConfig) Name() string {
+	return p.name
+}
+
+// ValidateConfig checks that the required keys are set, and that the URLs
+// are valid
+func (p *kmsProviderConfig) ValidateConfig(config map[string]string) error {
+	for _, key := range p.requiredKeys {
+		if config[key] == "" {
+			return fmt.Errorf("%s is required", key)
+		}
+	}
+	for _, key := range p.urlKeys {
+		if config[key] == "" {
+			continue
+		}
+		if _, err := parseKMSURL(config[key]); err != nil {
+			return fmt.Errorf("invalid %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// tokenSecretName returns the name of the Secret with the credentials
+func (p *kmsProviderConfig) tokenSecretName(config map[string]string) string {
+	if p.secretNameKey == "" {
+		return KMSTokenSecretName
+	}
+	return config[p.secretNameKey]
+}
+
+// connectionDetails returns the keys of the KMS ConfigMap Rook and NooBaa need
+func (p *kmsProviderConfig) connectionDetails(config map[string]string) map[string]string {
+	if len(p.operatorKeys) == 0 {
+		return config
+	}
+	details := map[string]string{}
+	for key, value := range config {
+		details[key] = value
+	}
+	for _, key := range p.operatorKeys {
+		delete(details, key)
+	}
+	return details
+}
+
+// CephKMSSpec translates the KMS ConfigMap into the CephCluster spec
+func (p *kmsProviderConfig) CephKMSSpec(config map[string]string) rookCephv1.KeyManagementServiceSpec {
+	return rookCephv1.KeyManagementServiceSpec{
+		ConnectionDetails: p.connectionDetails(config),
+		TokenSecretName:   p.tokenSecretName(config),
+	}
+}
+
+// NooBaaKMSSpec translates the KMS ConfigMap into the NooBaa spec
+func (p *kmsProviderConfig) NooBaaKMSSpec(config map[string]string) nbv1.KeyManagementServiceSpec {
+	return nbv1.KeyManagementServiceSpec{
+		ConnectionDetails: p.connectionDetails(config),
+		TokenSecretName:   p.tokenSecretName(config),
+	}
+}
+
+// getCredentials returns the data of the Secret with the credentials
+func (p *kmsProviderConfig) getCredentials(ctx context.Context, c client.Client, namespace string, config map[string]string) (map[string][]byte, error) {
+	name := p.tokenSecretName(config)
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get the KMS credentials Secret %q: %v", name, err)
+	}
+	return secret.Data, nil
+}
+
+// parseKMSURL parses the address of a KMS, which must be an HTTP(S) URL
+func parseKMSURL(address string) (*url.URL, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http(s) URL", address)
+	}
+	return u, nil
+}
+
+// newKMSTLSConfig returns the TLS configuration trusting the given PEM
+// encoded CA certificates, or the system ones if empty
+func newKMSTLSConfig(caCert []byte, serverName string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if len(caCert) != 0 {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse the CA certificate")
+		}
+	}
+	return tlsConfig, nil
+}
+
+// newKMSHTTPClient returns the HTTP client used to probe a KMS
+func newKMSHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: kmsProbeTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+}
+
+// doKMSRequest sends a request to a KMS, and decodes the JSON response into
+// out unless it is nil
+func doKMSRequest(httpClient *http.Client, req *http.Request, out interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%s rejected the credentials: %s", req.URL.Host, resp.Status)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("unexpected response from %s: %s", req.URL.Host, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, kmsMaxResponseSize)).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode the response from %s: %v", req.URL.Host, err)
+	}
+	return nil
+}
+
+// getKMSAccessToken requests an OAuth2 access token from the identity
+// provider of a cloud KMS
+func getKMSAccessToken(ctx context.Context, httpClient *http.Client, tokenURL string, form url.Values) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := doKMSRequest(httpClient, req, &token); err != nil {
+		return "", fmt.Errorf("failed to get an access token: %v", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("failed to get an access token: empty token returned by %s", req.URL.Host)
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,506 @@
+package storagecluster
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const (
+	fakeVaultToken   = "s.fake-vault-token"
+	fakeKMSNamespace = "openshift-storage"
+	fakeAccessToken  = "fake-access-token"
+)
+
+// fakeVaultTokenInfo is a token known to the fake Vault server, with its TTL
+// in seconds
+type fakeVaultTokenInfo struct {
+	ttl         int64
+	creationTTL int64
+	renewable   bool
+	// maxed tokens can't be renewed past their current TTL
+	maxed bool
+}
+
+// fakeVault is a Vault server with the Kubernetes and AppRole auth methods
+type fakeVault struct {
+	sync.Mutex
+	server *httptest.Server
+	tokens map[string]*fakeVaultTokenInfo
+	// ttl of the tokens issued by the login APIs
+	ttl    int64
+	logins int
+}
+
+func newFakeVault(ttl int64) *fakeVault {
+	vault := &fakeVault{tokens: map[string]*fakeVaultTokenInfo{}, ttl: ttl}
+	vault.server = httptest.NewServer(http.HandlerFunc(vault.handle))
+	return vault
+}
+
+func (v *fakeVault) handle(w http.ResponseWriter, r *http.Request) {
+	v.Lock()
+	defer v.Unlock()
+	body := map[string]string{}
+	_ = json.NewDecoder(r.Body).Decode(&body)
+	token := v.tokens[r.Header.Get("X-Vault-Token")]
+
+	switch r.URL.Path {
+	case "/v1/auth/token/lookup-self":
+		if token == nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"ttl": token.ttl, "creation_ttl": token.creationTTL, "renewable": token.renewable,
+		}})
+	case "/v1/auth/token/renew-self":
+		if token == nil || !token.renewable {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if !token.maxed {
+			token.ttl = token.creationTTL
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{
+			"client_token": r.Header.Get("X-Vault-Token"), "lease_duration": token.ttl, "renewable": true,
+		}})
+	case "/v1/auth/kubernetes/login", "/v1/auth/approle/login":
+		if !(body["role"] == "ocs" && body["jwt"] == "fake-jwt") && !(body["role_id"] == "ocs" && body["secret_id"] == "fake-secret-id") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		v.logins++
+		issued := fmt.Sprintf("s.issued-%d", v.logins)
+		v.tokens[issued] = &fakeVaultTokenInfo{ttl: v.ttl, creationTTL: v.ttl, renewable: true}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{
+			"client_token": issued, "lease_duration": v.ttl, "renewable": true,
+		}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newFakeVaultServer returns a Vault server accepting the given token, which
+// never expires
+func newFakeVaultServer(token string) *httptest.Server {
+	vault := newFakeVault(3600)
+	vault.tokens[token] = &fakeVaultTokenInfo{}
+	return vault.server
+}
+
+// newFakeOAuthKMSServer returns a cloud KMS server, with its identity
+// provider, which issues an access token for the given form value and
+// accepts it on the keys path
+func newFakeOAuthKMSServer(tokenPath, credentialKey, credential, keysPath string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case tokenPath:
+			if r.Method != http.MethodPost || r.PostFormValue(credentialKey) != credential {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"access_token":"` + fakeAccessToken + `","token_type":"Bearer"}`))
+		case keysPath:
+			if r.Header.Get("Authorization") != "Bearer "+fakeAccessToken {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"value":[]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// newFakeAWSKMSServer returns an AWS KMS endpoint which checks the signature
+// of the requests made with the given secret access key
+func newFakeAWSKMSServer(secretAccessKey string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if err != nil || r.Header.Get("X-Amz-Target") != "TrentService.DescribeKey" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// sign the received request again, the signatures match only if
+		// the same secret access key was used
+		expected, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), bytes.NewReader(body))
+		for _, name := range []string{"Content-Type", "X-Amz-Target", "X-Amz-Security-Token"} {
+			if value := r.Header.Get(name); value != "" {
+				expected.Header.Set(name, value)
+			}
+		}
+		accessKeyID := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="), "/")[0]
+		signAWSRequest(expected, body, accessKeyID, secretAccessKey, "us-east-1", awsKMSService, date)
+		if r.Header.Get("Authorization") != expected.Header.Get("Authorization") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"KeyMetadata":{"Enabled":true}}`))
+	}))
+}
+
+// newTestCertificate returns a PEM encoded certificate and key signed by the
+// parent, or self-signed if the parent is nil
+func newTestCertificate(t *testing.T, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) ([]byte, []byte, *x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		cert, key
+}
+
+// newFakeKMIPServer returns the listener of a KMIP server answering the
+// requests of the clients with a certificate signed by the CA, and the PEM
+// encoded CA certificate, client certificate and client key
+func newFakeKMIPServer(t *testing.T) (net.Listener, []byte, []byte, []byte) {
+	notAfter := time.Now().Add(time.Hour)
+	caPEM, _, ca, caKey := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "kmip-ca"}, NotAfter: notAfter,
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+	serverPEM, serverKeyPEM, _, _ := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "kmip-server"}, NotAfter: notAfter,
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	clientPEM, clientKeyPEM, _, _ := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "kmip-client"}, NotAfter: notAfter,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	serverCert, err := tls.X509KeyPair(serverPEM, serverKeyPEM)
+	assert.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	assert.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				if _, err := readKMIPMessage(conn); err != nil {
+					return
+				}
+				_, _ = conn.Write(kmipStructure(kmipTagResponseMessage,
+					kmipStructure(kmipTagResponseHeader,
+						kmipStructure(kmipTagProtocolVersion,
+							kmipInteger(kmipTagVersionMajor, kmipTypeInteger, 1),
+							kmipInteger(kmipTagVersionMinor, kmipTypeInteger, 4),
+						),
+						kmipInteger(kmipTagBatchCount, kmipTypeInteger, 1),
+					),
+					kmipStructure(kmipTagBatchItem,
+						kmipInteger(kmipTagOperation, kmipTypeEnumeration, kmipOperationDiscover),
+						kmipInteger(kmipTagResultStatus, kmipTypeEnumeration, kmipResultStatusSuccess),
+						kmipStructure(kmipTagResponsePayload),
+					),
+				))
+			}(conn)
+		}
+	}()
+	return ln, caPEM, clientPEM, clientKeyPEM
+}
+
+func newKMSSecret(name string, data map[string]string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: fakeKMSNamespace},
+		Data:       map[string][]byte{},
+	}
+	for key, value := range data {
+		secret.Data[key] = []byte(value)
+	}
+	return secret
+}
+
+func TestKMSProviderValidateConfig(t *testing.T) {
+	cases := []struct {
+		label   string
+		config  map[string]string
+		isValid bool
+	}{
+		{
+			label:   "Case 1: vault",
+			config:  map[string]string{KMSProviderKey: VaultKMSProvider, vaultAddrKey: "https://vault.example.com:8200", vaultSkipVerifyKey: "false"},
+			isValid: true,
+		},
+		{
+			label:   "Case 2: vault without address",
+			config:  map[string]string{KMSProviderKey: VaultKMSProvider},
+			isValid: false,
+		},
+		{
+			label:   "Case 3: vault address without scheme",
+			config:  map[string]string{KMSProviderKey: VaultKMSProvider, vaultAddrKey: "vault.example.com:8200"},
+			isValid: false,
+		},
+		{
+			label:   "Case 4: vault with invalid VAULT_SKIP_VERIFY",
+			config:  map[string]string{KMSProviderKey: VaultKMSProvider, vaultAddrKey: "https://vault.example.com:8200", vaultSkipVerifyKey: "maybe"},
+			isValid: false,
+		},
+		{
+			label:   "Case 5: kmip",
+			config:  map[string]string{KMSProviderKey: KMIPKMSProvider, kmipEndpointKey: "kmip.example.com:5696", kmipSecretNameKey: "kmip-credentials"},
+			isValid: true,
+		},
+		{
+			label:   "Case 6: kmip endpoint without port",
+			config:  map[string]string{KMSProviderKey: KMIPKMSProvider, kmipEndpointKey: "kmip.example.com", kmipSecretNameKey: "kmip-credentials"},
+			isValid: false,
+		},
+		{
+			label:   "Case 7: aws",
+			config:  map[string]string{KMSProviderKey: AWSKMSProvider, awsRegionKey: "us-east-1", awsCMKARNKey: "arn:aws:kms:us-east-1:123456789012:key/abc", awsSecretNameKey: "aws-credentials"},
+			isValid: true,
+		},
+		{
+			label:   "Case 8: aws without key",
+			config:  map[string]string{KMSProviderKey: AWSKMSProvider, awsRegionKey: "us-east-1", awsSecretNameKey: "aws-credentials"},
+			isValid: false,
+		},
+		{
+			label:   "Case 9: azure",
+			config:  map[string]string{KMSProviderKey: AzureKMSProvider, azureVaultURLKey: "https://ocs.vault.azure.net", azureTenantIDKey: "tenant", azureClientIDKey: "client", azureSecretNameKey: "azure-credentials"},
+			isValid: true,
+		},
+		{
+			label:   "Case 10: azure with invalid authority host",
+			config:  map[string]string{KMSProviderKey: AzureKMSProvider, azureVaultURLKey: "https://ocs.vault.azure.net", azureTenantIDKey: "tenant", azureClientIDKey: "client", azureSecretNameKey: "azure-credentials", azureAuthorityHostKey: "login"},
+			isValid: false,
+		},
+		{
+			label:   "Case 11: ibm key protect",
+			config:  map[string]string{KMSProviderKey: IBMKeyProtectKMSProvider, ibmKPServiceInstanceIDKey: "instance", ibmKPBaseURLKey: "https://us-south.kms.cloud.ibm.com", ibmKPSecretNameKey: "ibm-credentials"},
+			isValid: true,
+		},
+		{
+			label:   "Case 12: ibm key protect without service instance",
+			config:  map[string]string{KMSProviderKey: IBMKeyProtectKMSProvider, ibmKPBaseURLKey: "https://us-south.kms.cloud.ibm.com", ibmKPSecretNameKey: "ibm-credentials"},
+			isValid: false,
+		},
+	}
+
+	for _, c := range cases {
+		provider := getKMSProvider(c.config)
+		assert.NotNilf(t, provider, "[%s]", c.label)
+		err := provider.ValidateConfig(c.config)
+		if c.isValid {
+			assert.NoErrorf(t, err, "[%s]", c.label)
+		} else {
+			assert.Errorf(t, err, "[%s]", c.label)
+		}
+	}
+}
+
+func TestKMSProviderProbe(t *testing.T) {
+	vault := newFakeVaultServer(fakeVaultToken)
+	defer vault.Close()
+	aws := newFakeAWSKMSServer("aws-secret")
+	defer aws.Close()
+	azure := newFakeOAuthKMSServer("/tenant/oauth2/v2.0/token", "client_secret", "azure-secret", "/keys")
+	defer azure.Close()
+	ibm := newFakeOAuthKMSServer("/oidc/token", "apikey", "ibm-api-key", "/api/v2/keys")
+	defer ibm.Close()
+	kmip, caPEM, clientPEM, clientKeyPEM := newFakeKMIPServer(t)
+	defer kmip.Close()
+	// a client certificate the KMIP server does not trust
+	_, _, otherCA, otherCAKey := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(4), NotAfter: time.Now().Add(time.Hour), IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+	otherClientPEM, otherClientKeyPEM, _, _ := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(5), NotAfter: time.Now().Add(time.Hour), ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, otherCA, otherCAKey)
+
+	vaultConfig := map[string]string{KMSProviderKey: VaultKMSProvider, vaultAddrKey: vault.URL, vaultNamespaceKey: "ocs"}
+	kmipConfig := map[string]string{KMSProviderKey: KMIPKMSProvider, kmipEndpointKey: kmip.Addr().String(), kmipSecretNameKey: "kmip-credentials"}
+	awsConfig := map[string]string{KMSProviderKey: AWSKMSProvider, awsEndpointKey: aws.URL, awsRegionKey: "us-east-1", awsCMKARNKey: "arn:aws:kms:us-east-1:123456789012:key/abc", awsSecretNameKey: "aws-credentials"}
+	azureConfig := map[string]string{KMSProviderKey: AzureKMSProvider, azureVaultURLKey: azure.URL, azureAuthorityHostKey: azure.URL, azureTenantIDKey: "tenant", azureClientIDKey: "client", azureSecretNameKey: "azure-credentials"}
+	ibmConfig := map[string]string{KMSProviderKey: IBMKeyProtectKMSProvider, ibmKPServiceInstanceIDKey: "instance", ibmKPBaseURLKey: ibm.URL, ibmKPTokenURLKey: ibm.URL + "/oidc/token", ibmKPSecretNameKey: "ibm-credentials"}
+
+	cases := []struct {
+		label   string
+		config  map[string]string
+		secret  *corev1.Secret
+		isValid bool
+	}{
+		{
+			label:   "Case 1: vault",
+			config:  vaultConfig,
+			secret:  newKMSSecret(KMSTokenSecretName, map[string]string{vaultTokenKey: fakeVaultToken}),
+			isValid: true,
+		},
+		{
+			label:   "Case 2: vault with a revoked token",
+			config:  vaultConfig,
+			secret:  newKMSSecret(KMSTokenSecretName, map[string]string{vaultTokenKey: "s.revoked"}),
+			isValid: false,
+		},
+		{
+			label:   "Case 3: vault without token Secret",
+			config:  vaultConfig,
+			isValid: false,
+		},
+		{
+			label:   "Case 4: kmip",
+			config:  kmipConfig,
+			secret:  newKMSSecret("kmip-credentials", map[string]string{kmipCACertKey: string(caPEM), kmipClientCertKey: string(clientPEM), kmipClientKeyKey: string(clientKeyPEM)}),
+			isValid: true,
+		},
+		{
+			label:   "Case 5: kmip with an untrusted client certificate",
+			config:  kmipConfig,
+			secret:  newKMSSecret("kmip-credentials", map[string]string{kmipCACertKey: string(caPEM), kmipClientCertKey: string(otherClientPEM), kmipClientKeyKey: string(otherClientKeyPEM)}),
+			isValid: false,
+		},
+		{
+			label:   "Case 6: aws",
+			config:  awsConfig,
+			secret:  newKMSSecret("aws-credentials", map[string]string{awsAccessKeyIDKey: "AKIAEXAMPLE", awsSecretAccessKeyKey: "aws-secret", awsSessionTokenKey: "session"}),
+			isValid: true,
+		},
+		{
+			label:   "Case 7: aws with a wrong secret access key",
+			config:  awsConfig,
+			secret:  newKMSSecret("aws-credentials", map[string]string{awsAccessKeyIDKey: "AKIAEXAMPLE", awsSecretAccessKeyKey: "wrong"}),
+			isValid: false,
+		},
+		{
+			label:   "Case 8: azure",
+			config:  azureConfig,
+			secret:  newKMSSecret("azure-credentials", map[string]string{azureClientSecretKey: "azure-secret"}),
+			isValid: true,
+		},
+		{
+			label:   "Case 9: azure with a wrong client secret",
+			config:  azureConfig,
+			secret:  newKMSSecret("azure-credentials", map[string]string{azureClientSecretKey: "wrong"}),
+			isValid: false,
+		},
+		{
+			label:   "Case 10: ibm key protect",
+			config:  ibmConfig,
+			secret:  newKMSSecret("ibm-credentials", map[string]string{ibmKPServiceAPIKeyKey: "ibm-api-key"}),
+			isValid: true,
+		},
+		{
+			label:   "Case 11: ibm key protect with a wrong API key",
+			config:  ibmConfig,
+			secret:  newKMSSecret("ibm-credentials", map[string]string{ibmKPServiceAPIKeyKey: "wrong"}),
+			isValid: false,
+		},
+	}
+
+	for _, c := range cases {
+		var objs []runtime.Object
+		if c.secret != nil {
+			objs = append(objs, c.secret)
+		}
+		client := fake.NewClientBuilder().WithScheme(createFakeScheme(t)).WithRuntimeObjects(objs...).Build()
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: KMSConfigMapName, Namespace: fakeKMSNamespace},
+			Data:       c.config,
+		}
+		err := validateKMSProvider(client, cm, true)
+		if c.isValid {
+			assert.NoErrorf(t, err, "[%s]", c.label)
+		} else {
+			assert.Errorf(t, err, "[%s]", c.label)
+		}
+	}
+}
+
+func TestKMSProviderSpecs(t *testing.T) {
+	cases := []struct {
+		label           string
+		config          map[string]string
+		tokenSecretName string
+	}{
+		{
+			label:           "Case 1: vault",
+			config:          map[string]string{KMSProviderKey: VaultKMSProvider, vaultAddrKey: "https://vault.example.com:8200"},
+			tokenSecretName: KMSTokenSecretName,
+		},
+		{
+			label:           "Case 2: kmip",
+			config:          map[string]string{KMSProviderKey: KMIPKMSProvider, kmipEndpointKey: "kmip.example.com:5696", kmipSecretNameKey: "kmip-credentials"},
+			tokenSecretName: "kmip-credentials",
+		},
+		{
+			label:           "Case 3: ibm key protect",
+			config:          map[string]string{KMSProviderKey: IBMKeyProtectKMSProvider, ibmKPSecretNameKey: "ibm-credentials"},
+			tokenSecretName: "ibm-credentials",
+		},
+		{
+			label:           "Case 4: unknown provider",
+			config:          map[string]string{KMSProviderKey: "newKMSProvider"},
+			tokenSecretName: KMSTokenSecretName,
+		},
+	}
+
+	for _, c := range cases {
+		cm := &corev1.ConfigMap{Data: c.config}
+		cephSpec := getCephKMSSpec(cm)
+		assert.Equalf(t, c.config, cephSpec.ConnectionDetails, "[%s]", c.label)
+		assert.Equalf(t, c.tokenSecretName, cephSpec.TokenSecretName, "[%s]", c.label)
+		nbSpec := getNooBaaKMSSpec(cm)
+		assert.Equalf(t, c.config, nbSpec.ConnectionDetails, "[%s]", c.label)
+		assert.Equalf(t, c.tokenSecretName, nbSpec.TokenSecretName, "[%s]", c.label)
+	}
+}
+
+func TestKMIPMessages(t *testing.T) {
+	request := newKMIPDiscoverVersionsRequest()
+	// every TTLV item is padded to 8 bytes
+	assert.Equal(t, 0, len(request)%8)
+	message, err := readKMIPMessage(bytes.NewReader(request))
+	assert.NoError(t, err)
+	assert.Equal(t, request, message)
+	operation, found := findKMIPEnumeration(message, kmipTagOperation)
+	assert.True(t, found)
+	assert.Equal(t, uint32(kmipOperationDiscover), operation)
+	_, found = findKMIPEnumeration(message, kmipTagResultStatus)
+	assert.False(t, found)
+	_, found = findKMIPEnumeration(message[:20], kmipTagOperation)
+	assert.False(t, found)
+}
@@ -2,11 +2,12 @@ package storagecluster
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"time"
 
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -25,13 +26,9 @@ const (
 	KMSProviderKey = "KMS_PROVIDER"
 	// VaultKMSProvider a constant to represent 'vault' KMS provider
 	VaultKMSProvider = "vault"
-)
-
-var (
-	// currently supported KMS providers mapped to their address key
-	kmsProviderAddressKeyMap = map[string]string{
-		VaultKMSProvider: "VAULT_ADDR",
-	}
+	// KMSServiceNameKey is the key in config map to get the ID of the KMS in
+	// the CSI KMS ConfigMap, it defaults to the KMS provider name
+	KMSServiceNameKey = "KMS_SERVICE_NAME"
 )
 
 func deleteKMSResources(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
@@ -149,26 +146,73 @@ func getKMSSecretToken(instance *ocsv1.StorageCluster, client client.Client) (*c
 	return kmsSecretToken, err
 }
 
-// reachKMSProvider function checks whether the provided address is reachable or not.
-// This function won't validate any other cases and only returns an error if the provided
-// KMS provider address is not reachable. All other validations will be done on rook side.
-func reachKMSProvider(kmsConfigMap *corev1.ConfigMap) error {
-	if kmsConfigMap == nil {
-		return fmt.Errorf("please provide a valid config map")
-	}
-	kmsProviderName, ok := kmsConfigMap.Data[KMSProviderKey]
-	if !ok {
+// validateEncryptionSpec checks that the encrypted StorageClass can get its
+// keys from a KMS
+func validateEncryptionSpec(sc *ocsv1.StorageCluster) error {
+	if !sc.Spec.Encryption.StorageClass {
 		return nil
 	}
-	var kmsProviderAddressKey string
-	if kmsProviderAddressKey, ok = kmsProviderAddressKeyMap[kmsProviderName]; !ok {
-		// cannot find an address key specific for this KMS provider
-		// nothing to validate
+	if sc.Spec.ExternalStorage.Enable {
+		return fmt.Errorf("failed to validate encryption: the encrypted StorageClass is not supported in external mode")
+	}
+	if !sc.Spec.Encryption.KeyManagementService.Enable {
+		return fmt.Errorf("failed to validate encryption: the encrypted StorageClass requires the KMS to be enabled")
+	}
+	return nil
+}
+
+// getCSIKMSID returns the ID of the KMS in the CSI KMS ConfigMap, which the
+// encrypted StorageClass refers to with its encryptionKMSID parameter
+func getCSIKMSID(kmsConfigMap *corev1.ConfigMap) string {
+	if kmsID := kmsConfigMap.Data[KMSServiceNameKey]; kmsID != "" {
+		return kmsID
+	}
+	return kmsConfigMap.Data[KMSProviderKey]
+}
+
+// ensureCSIKMSConnectionDetails adds the connection details of the KMS to the
+// CSI KMS ConfigMap, for ceph-csi to encrypt the volumes of the encrypted
+// StorageClass. An existing entry for the KMS is left as it is, so that it can
+// be tuned by the admin.
+func (r *StorageClusterReconciler) ensureCSIKMSConnectionDetails(sc *ocsv1.StorageCluster, kmsConfigMap *corev1.ConfigMap) error {
+	kmsID := getCSIKMSID(kmsConfigMap)
+	csiConfigMap := &corev1.ConfigMap{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: CSIKMSConfigMapName, Namespace: sc.Namespace}, csiConfigMap)
+	configMapExists := err == nil
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if _, found := csiConfigMap.Data[kmsID]; found {
 		return nil
 	}
-	kmsAddress, ok := kmsConfigMap.Data[kmsProviderAddressKey]
+
+	provider, ok := getKMSProvider(kmsConfigMap.Data).(csiKMSProvider)
 	if !ok {
-		return nil
+		return fmt.Errorf("ceph-csi can't be configured automatically for the %q KMS, add its connection details as %q to the %s ConfigMap",
+			kmsConfigMap.Data[KMSProviderKey], kmsID, CSIKMSConfigMapName)
+	}
+	connectionDetails, err := provider.CSIConnectionDetails(kmsConfigMap.Data)
+	if err != nil {
+		return fmt.Errorf("ceph-csi can't be configured automatically for the %q KMS, add its connection details as %q to the %s ConfigMap: %v",
+			kmsConfigMap.Data[KMSProviderKey], kmsID, CSIKMSConfigMapName, err)
+	}
+	details, err := json.Marshal(connectionDetails)
+	if err != nil {
+		return err
+	}
+
+	if !configMapExists {
+		csiConfigMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: CSIKMSConfigMapName, Namespace: sc.Namespace},
+			Data:       map[string]string{kmsID: string(details)},
+		}
+		r.Log.Info("Creating CSI KMS ConfigMap.", "ConfigMap", klog.KRef(sc.Namespace, CSIKMSConfigMapName), "KMSID", kmsID)
+		return r.Client.Create(context.TODO(), csiConfigMap)
+	}
+	if csiConfigMap.Data == nil {
+		csiConfigMap.Data = map[string]string{}
 	}
-	return checkEndpointReachable(kmsAddress, 5*time.Second)
+	csiConfigMap.Data[kmsID] = string(details)
+	r.Log.Info("Adding the KMS to the CSI KMS ConfigMap.", "ConfigMap", klog.KRef(sc.Namespace, CSIKMSConfigMapName), "KMSID", kmsID)
+	return r.Client.Update(context.TODO(), csiConfigMap)
 }
@@ -0,0 +1,398 @@
+package storagecluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	vaultAddrKey          = "VAULT_ADDR"
+	vaultNamespaceKey     = "VAULT_NAMESPACE"
+	vaultCACertKey        = "VAULT_CACERT"
+	vaultTLSServerNameKey = "VAULT_TLS_SERVER_NAME"
+	vaultSkipVerifyKey    = "VAULT_SKIP_VERIFY"
+	vaultBackendKey       = "VAULT_BACKEND"
+	vaultBackendPathKey   = "VAULT_BACKEND_PATH"
+	vaultClientCertKey    = "VAULT_CLIENT_CERT"
+	vaultClientKeyKey     = "VAULT_CLIENT_KEY"
+	// vaultTokenKey is the key of the token in the ocs-kms-token Secret
+	vaultTokenKey = "token"
+	// vaultCACertSecretKey is the key of the CA certificate in the Secret
+	// named by VAULT_CACERT
+	vaultCACertSecretKey = "cert"
+
+	// keys selecting how the operator authenticates to Vault
+	vaultAuthMethodKey            = "VAULT_AUTH_METHOD"
+	vaultAuthMountPathKey         = "VAULT_AUTH_MOUNT_PATH"
+	vaultAuthKubernetesRoleKey    = "VAULT_AUTH_KUBERNETES_ROLE"
+	vaultAuthAppRoleSecretNameKey = "VAULT_AUTH_APPROLE_SECRET_NAME"
+	// keys of the Secret named by VAULT_AUTH_APPROLE_SECRET_NAME
+	vaultAppRoleRoleIDKey   = "role_id"
+	vaultAppRoleSecretIDKey = "secret_id"
+
+	// vaultAuthMethodToken uses the token of the ocs-kms-token Secret as is
+	vaultAuthMethodToken = "token"
+	// vaultAuthMethodKubernetes logs in with the service account token of
+	// the operator
+	vaultAuthMethodKubernetes = "kubernetes"
+	// vaultAuthMethodAppRole logs in with the AppRole role ID and secret ID
+	vaultAuthMethodAppRole = "approle"
+
+	// csiVaultTokenSecret is the Secret with the Vault token of a tenant,
+	// which ceph-csi reads from the namespace of each encrypted
+	// PersistentVolumeClaim with the token auth method
+	csiVaultTokenSecret = "ceph-csi-kms-token"
+	// csiVaultServiceAccount is the ServiceAccount ceph-csi logs in to Vault
+	// with, from the namespace of each encrypted PersistentVolumeClaim, with
+	// the Kubernetes auth method
+	csiVaultServiceAccount = "ceph-csi-vault-sa"
+	// the Secrets with the CA certificate and the client certificate and key
+	// which ceph-csi reads from the namespace of each encrypted
+	// PersistentVolumeClaim when VAULT_CACERT, VAULT_CLIENT_CERT or
+	// VAULT_CLIENT_KEY are set
+	csiVaultCACertSecret     = "ceph-csi-vault-ca-cert"
+	csiVaultClientCertSecret = "ceph-csi-vault-client-cert"
+	csiVaultClientKeySecret  = "ceph-csi-vault-client-key"
+)
+
+// vaultAuthKeys are the keys of the Vault ConfigMap which are only used by
+// the operator, Rook and NooBaa are given the resulting token
+var vaultAuthKeys = []string{vaultAuthMethodKey, vaultAuthMountPathKey, vaultAuthKubernetesRoleKey, vaultAuthAppRoleSecretNameKey}
+
+// vaultServiceAccountTokenPath is the service account token of the operator,
+// used to log in with the Kubernetes auth method
+var vaultServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// vaultKMSProvider is a HashiCorp Vault server. The operator authenticates
+// with the token of the ocs-kms-token Secret, or logs in with the Kubernetes
+// or AppRole auth methods and keeps the resulting token in that Secret.
+type vaultKMSProvider struct {
+	kmsProviderConfig
+}
+
+// vaultTokenLookup is the response of the Vault token lookup-self API
+type vaultTokenLookup struct {
+	Data struct {
+		// TTL is the remaining time to live of the token in seconds, 0
+		// if it never expires
+		TTL         int64 `json:"ttl"`
+		CreationTTL int64 `json:"creation_ttl"`
+		Renewable   bool  `json:"renewable"`
+	} `json:"data"`
+}
+
+// vaultAuthResponse is the response of the Vault login and token renew-self APIs
+type vaultAuthResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+// getVaultAuthMethod returns the auth method of the Vault ConfigMap
+func getVaultAuthMethod(config map[string]string) string {
+	if method := config[vaultAuthMethodKey]; method != "" {
+		return method
+	}
+	return vaultAuthMethodToken
+}
+
+// ValidateConfig checks the keys of the Vault ConfigMap
+func (p *vaultKMSProvider) ValidateConfig(config map[string]string) error {
+	if err := p.kmsProviderConfig.ValidateConfig(config); err != nil {
+		return err
+	}
+	if value, ok := config[vaultSkipVerifyKey]; ok {
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid %s: %q is not a boolean", vaultSkipVerifyKey, value)
+		}
+	}
+	switch method := getVaultAuthMethod(config); method {
+	case vaultAuthMethodToken:
+	case vaultAuthMethodKubernetes:
+		if config[vaultAuthKubernetesRoleKey] == "" {
+			return fmt.Errorf("%s is required with the %s auth method", vaultAuthKubernetesRoleKey, method)
+		}
+	case vaultAuthMethodAppRole:
+		if config[vaultAuthAppRoleSecretNameKey] == "" {
+			return fmt.Errorf("%s is required with the %s auth method", vaultAuthAppRoleSecretNameKey, method)
+		}
+	default:
+		return fmt.Errorf("invalid %s: %q, must be one of %s, %s or %s", vaultAuthMethodKey, method,
+			vaultAuthMethodToken, vaultAuthMethodKubernetes, vaultAuthMethodAppRole)
+	}
+	return nil
+}
+
+// Probe looks the token up in Vault
+func (p *vaultKMSProvider) Probe(ctx context.Context, c client.Client, namespace string, config map[string]string) error {
+	credentials, err := p.getCredentials(ctx, c, namespace, config)
+	if err != nil {
+		return err
+	}
+	token := strings.TrimSpace(string(credentials[vaultTokenKey]))
+	if token == "" {
+		return fmt.Errorf("the KMS credentials Secret %q has no %q key", KMSTokenSecretName, vaultTokenKey)
+	}
+
+	httpClient, err := p.newHTTPClient(ctx, c, namespace, config)
+	if err != nil {
+		return err
+	}
+	return p.request(ctx, httpClient, config, http.MethodGet, "auth/token/lookup-self", token, nil, nil)
+}
+
+// EnsureToken renews the token of the ocs-kms-token Secret once two thirds
+// of its time to live have elapsed. With the Kubernetes and AppRole auth
+// methods, the operator logs in again if the token is missing, invalid or
+// can't be renewed any further, and stores the new token in the Secret Rook
+// and NooBaa read it from.
+func (p *vaultKMSProvider) EnsureToken(ctx context.Context, c client.Client, namespace string, config map[string]string, now time.Time) (*kmsToken, error) {
+	method := getVaultAuthMethod(config)
+	httpClient, err := p.newHTTPClient(ctx, c, namespace, config)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{}
+	err = c.Get(ctx, types.NamespacedName{Name: KMSTokenSecretName, Namespace: namespace}, secret)
+	if err != nil && (method == vaultAuthMethodToken || !errors.IsNotFound(err)) {
+		return nil, fmt.Errorf("failed to get the KMS credentials Secret %q: %v", KMSTokenSecretName, err)
+	}
+
+	if token := strings.TrimSpace(string(secret.Data[vaultTokenKey])); token != "" {
+		lookup := &vaultTokenLookup{}
+		err := p.request(ctx, httpClient, config, http.MethodGet, "auth/token/lookup-self", token, nil, lookup)
+		if err != nil && method == vaultAuthMethodToken {
+			return nil, err
+		}
+		if err == nil {
+			ttl := time.Duration(lookup.Data.TTL) * time.Second
+			if ttl == 0 {
+				// the token never expires
+				return &kmsToken{authMethod: method}, nil
+			}
+			period := time.Duration(lookup.Data.CreationTTL) * time.Second
+			if period < ttl {
+				period = ttl
+			}
+			current := newVaultToken(method, now, ttl, period, lookup.Data.Renewable || method != vaultAuthMethodToken, "")
+			if current.renewalTime == nil || now.Before(*current.renewalTime) {
+				return current, nil
+			}
+
+			if lookup.Data.Renewable {
+				renewed := &vaultAuthResponse{}
+				err := p.request(ctx, httpClient, config, http.MethodPost, "auth/token/renew-self", token, map[string]string{}, renewed)
+				lease := time.Duration(renewed.Auth.LeaseDuration) * time.Second
+				// the token can't be renewed past its max TTL
+				if err == nil && lease > ttl {
+					return newVaultToken(method, now, lease, period, true, kmsTokenRenewed), nil
+				}
+				if err != nil && method == vaultAuthMethodToken {
+					return nil, fmt.Errorf("failed to renew the token: %v", err)
+				}
+			}
+			if method == vaultAuthMethodToken {
+				// nothing more can be done, the token must be replaced
+				current.renewalTime = nil
+				return current, nil
+			}
+		}
+	}
+
+	auth, err := p.login(ctx, c, namespace, httpClient, config)
+	if err != nil {
+		return nil, err
+	}
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: KMSTokenSecretName, Namespace: namespace},
+	}
+	_, err = controllerutil.CreateOrUpdate(ctx, c, secret, func() error {
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[vaultTokenKey] = []byte(auth.Auth.ClientToken)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store the token in the KMS credentials Secret %q: %v", KMSTokenSecretName, err)
+	}
+	lease := time.Duration(auth.Auth.LeaseDuration) * time.Second
+	if lease == 0 {
+		return &kmsToken{authMethod: method, action: kmsTokenRotated}, nil
+	}
+	return newVaultToken(method, now, lease, lease, true, kmsTokenRotated), nil
+}
+
+// newVaultToken describes a token with the given time to live, renewed once
+// two thirds of its period have elapsed
+func newVaultToken(method string, now time.Time, ttl, period time.Duration, renewable bool, action kmsTokenAction) *kmsToken {
+	expiryTime := now.Add(ttl)
+	token := &kmsToken{authMethod: method, expiryTime: &expiryTime, action: action}
+	if renewable {
+		renewalTime := expiryTime.Add(-period / 3)
+		token.renewalTime = &renewalTime
+	}
+	return token
+}
+
+// login logs in to Vault with the Kubernetes or AppRole auth method
+func (p *vaultKMSProvider) login(ctx context.Context, c client.Client, namespace string, httpClient *http.Client, config map[string]string) (*vaultAuthResponse, error) {
+	method := getVaultAuthMethod(config)
+	var body map[string]string
+	switch method {
+	case vaultAuthMethodKubernetes:
+		jwt, err := ioutil.ReadFile(vaultServiceAccountTokenPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the service account token: %v", err)
+		}
+		body = map[string]string{
+			"role": config[vaultAuthKubernetesRoleKey],
+			"jwt":  strings.TrimSpace(string(jwt)),
+		}
+	case vaultAuthMethodAppRole:
+		name := config[vaultAuthAppRoleSecretNameKey]
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret); err != nil {
+			return nil, fmt.Errorf("failed to get the AppRole Secret %q: %v", name, err)
+		}
+		body = map[string]string{
+			"role_id":   string(secret.Data[vaultAppRoleRoleIDKey]),
+			"secret_id": string(secret.Data[vaultAppRoleSecretIDKey]),
+		}
+		if body["role_id"] == "" {
+			return nil, fmt.Errorf("the AppRole Secret %q has no %q key", name, vaultAppRoleRoleIDKey)
+		}
+	default:
+		return nil, fmt.Errorf("can't log in with the %s auth method", method)
+	}
+
+	mountPath := config[vaultAuthMountPathKey]
+	if mountPath == "" {
+		mountPath = method
+	}
+	auth := &vaultAuthResponse{}
+	if err := p.request(ctx, httpClient, config, http.MethodPost, "auth/"+strings.Trim(mountPath, "/")+"/login", "", body, auth); err != nil {
+		return nil, fmt.Errorf("failed to log in with the %s auth method: %v", method, err)
+	}
+	if auth.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("failed to log in with the %s auth method: no token returned", method)
+	}
+	return auth, nil
+}
+
+// request calls the Vault API at the given path, sending body and decoding
+// the response into out when not nil
+func (p *vaultKMSProvider) request(ctx context.Context, httpClient *http.Client, config map[string]string, method, path, token string, body, out interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(config[vaultAddrKey], "/")+"/v1/"+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if config[vaultNamespaceKey] != "" {
+		req.Header.Set("X-Vault-Namespace", config[vaultNamespaceKey])
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return doKMSRequest(httpClient, req, out)
+}
+
+// newHTTPClient returns the HTTP client trusting the CA of the Vault server
+func (p *vaultKMSProvider) newHTTPClient(ctx context.Context, c client.Client, namespace string, config map[string]string) (*http.Client, error) {
+	var caCert []byte
+	if name := config[vaultCACertKey]; name != "" {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret); err != nil {
+			return nil, fmt.Errorf("failed to get the Vault CA certificate Secret %q: %v", name, err)
+		}
+		caCert = secret.Data[vaultCACertSecretKey]
+	}
+	tlsConfig, err := newKMSTLSConfig(caCert, config[vaultTLSServerNameKey])
+	if err != nil {
+		return nil, err
+	}
+	// ValidateConfig already checked the value
+	tlsConfig.InsecureSkipVerify, _ = strconv.ParseBool(config[vaultSkipVerifyKey])
+	return newKMSHTTPClient(tlsConfig), nil
+}
+
+// CSIConnectionDetails returns the ceph-csi configuration of the Vault
+// server. ceph-csi authenticates as the tenant owning each PersistentVolumeClaim
+// rather than as the operator: with the token of the ceph-csi-kms-token Secret
+// in the namespace of the claim for the token auth method, or by logging in
+// with the ceph-csi-vault-sa ServiceAccount of that namespace for the
+// Kubernetes auth method. ceph-csi has no AppRole support. The CA and client
+// certificates are read from the namespace of the claim too, so the Secrets
+// named in the ConfigMap, which are in the namespace of the StorageCluster,
+// are replaced by the ones documented for the tenants.
+func (p *vaultKMSProvider) CSIConnectionDetails(config map[string]string) (map[string]string, error) {
+	details := map[string]string{"vaultAddress": config[vaultAddrKey]}
+	switch method := getVaultAuthMethod(config); method {
+	case vaultAuthMethodToken:
+		details["encryptionKMSType"] = "vaulttokens"
+		details["tenantTokenName"] = csiVaultTokenSecret
+	case vaultAuthMethodKubernetes:
+		mountPath := config[vaultAuthMountPathKey]
+		if mountPath == "" {
+			mountPath = method
+		}
+		details["encryptionKMSType"] = "vaulttenantsa"
+		details["tenantSAName"] = csiVaultServiceAccount
+		details["vaultAuthPath"] = "/v1/auth/" + strings.Trim(mountPath, "/") + "/login"
+		details["vaultRole"] = config[vaultAuthKubernetesRoleKey]
+	default:
+		return nil, fmt.Errorf("ceph-csi does not support the %s auth method of Vault", method)
+	}
+
+	csiKeys := map[string]string{
+		vaultBackendKey:       "vaultBackend",
+		vaultBackendPathKey:   "vaultBackendPath",
+		vaultNamespaceKey:     "vaultNamespace",
+		vaultTLSServerNameKey: "vaultTLSServerName",
+	}
+	for key, csiKey := range csiKeys {
+		if value := config[key]; value != "" {
+			details[csiKey] = value
+		}
+	}
+	tenantSecrets := map[string][2]string{
+		vaultCACertKey:     {"vaultCAFromSecret", csiVaultCACertSecret},
+		vaultClientCertKey: {"vaultClientCertFromSecret", csiVaultClientCertSecret},
+		vaultClientKeyKey:  {"vaultClientCertKeyFromSecret", csiVaultClientKeySecret},
+	}
+	for key, csiKeyAndSecret := range tenantSecrets {
+		if config[key] != "" {
+			details[csiKeyAndSecret[0]] = csiKeyAndSecret[1]
+		}
+	}
+	if skipVerify, _ := strconv.ParseBool(config[vaultSkipVerifyKey]); skipVerify {
+		details["vaultCAVerify"] = "false"
+	}
+	return details, nil
+}
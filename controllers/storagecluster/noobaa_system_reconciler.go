@@ -92,7 +92,7 @@ func (obj *ocsNoobaaSystem) ensureCreated(r *StorageClusterReconciler, sc *ocsv1
 		return err
 	}
 
-	statusutil.MapNoobaaNegativeConditions(&r.conditions, nb)
+	statusutil.MapNoobaaNegativeConditions(r.conditions.For(statusutil.ComponentNooBaa), nb)
 	return nil
 }
 
@@ -153,8 +153,7 @@ func (r *StorageClusterReconciler) setNooBaaDesiredState(nb *nbv1.NooBaa, sc *oc
 		if kmsConfig, err := getKMSConfigMap(KMSConfigMapName, sc, r.Client); err != nil {
 			return err
 		} else if kmsConfig != nil {
-			nb.Spec.Security.KeyManagementService.ConnectionDetails = kmsConfig.Data
-			nb.Spec.Security.KeyManagementService.TokenSecretName = KMSTokenSecretName
+			nb.Spec.Security.KeyManagementService = getNooBaaKMSSpec(kmsConfig)
 		}
 	}
 
@@ -183,8 +182,11 @@ func (obj *ocsNoobaaSystem) ensureDeleted(r *StorageClusterReconciler, sc *ocsv1
 			if err != nil {
 				return err
 			}
-			if len(pvcs.Items) > 0 {
-				return fmt.Errorf("Uninstall: Waiting on NooBaa PVCs to be deleted")
+			for _, pvc := range pvcs.Items {
+				// the PVCs retained with the Ceph cluster are kept
+				if _, retained := pvc.Labels[retainedFSIDLabel]; !retained {
+					return fmt.Errorf("Uninstall: Waiting on NooBaa PVCs to be deleted")
+				}
 			}
 			r.Log.Info("Uninstall: NooBaa and noobaa-db PVC not found.")
 			return nil
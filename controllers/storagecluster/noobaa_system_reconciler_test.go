@@ -329,7 +329,7 @@ func TestNoobaaSystemInExternalClusterMode(t *testing.T) {
 	reconciler := createExternalClusterReconciler(t)
 	result, err := reconciler.Reconcile(context.TODO(), request)
 	assert.NoError(t, err)
-	assert.Equal(t, reconcile.Result{}, result)
+	assert.Equal(t, reconcile.Result{RequeueAfter: externalProbeMinBackoff}, result)
 	assertNoobaaResource(t, reconciler)
 }
 
@@ -442,17 +442,23 @@ func assertNoobaaKMSConfiguration(t *testing.T, kmsArgs struct {
 	// enable KMS to true
 	cr.Spec.Encryption.KeyManagementService.Enable = true
 	cr.Spec.Encryption.Enable = kmsArgs.clusterWideEncryption
+	// start a fake server, if we are not expecting any errors
+	if !kmsArgs.failureExpected && kmsArgs.kmsProvider == VaultKMSProvider {
+		vault := newFakeVaultServer(fakeVaultToken)
+		defer vault.Close()
+		kmsArgs.kmsAddress = vault.URL
+	}
 	kmsCM := createDummyKMSConfigMap(kmsArgs.kmsProvider, kmsArgs.kmsAddress)
 	reconciler := createFakeInitializationStorageClusterReconciler(t, &nbv1.NooBaa{})
 	if err := reconciler.Client.Create(ctxTodo, kmsCM); err != nil {
 		t.Errorf("Unable to create KMS configmap: %v, %v", err, kmsArgs.testLabel)
 		t.FailNow()
 	}
-	reconciler.initializeImagesStatus(cr)
-	// start a dummy server, if we are not expecting any errors
-	if !kmsArgs.failureExpected {
-		startServerAt(kmsArgs.kmsAddress)
+	if err := reconciler.Client.Create(ctxTodo, createDummyKMSTokenSecret(fakeVaultToken)); err != nil {
+		t.Errorf("Unable to create KMS token secret: %v", err)
+		t.FailNow()
 	}
+	reconciler.initializeImagesStatus(cr)
 
 	var obj ocsCephCluster
 
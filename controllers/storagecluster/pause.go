@@ -0,0 +1,107 @@
+package storagecluster
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// PauseReconcileAnnotation pauses the reconcile of the StorageCluster.
+	// When set to "true" nothing is reconciled, and "false" pauses nothing.
+	// Otherwise it holds a comma separated list of the resource managers to
+	// pause, e.g. "CephCluster,CephFilesystems,NooBaa", while the other
+	// resource managers keep running. The uninstall of the StorageCluster is
+	// never paused.
+	PauseReconcileAnnotation = "reconcile.ocs.openshift.io/pause"
+)
+
+// getPausedComponents returns the names of the resource managers which are
+// paused, and whether the whole reconcile is paused
+func getPausedComponents(sc *ocsv1.StorageCluster) (paused map[string]bool, all bool) {
+	value, found := sc.GetAnnotations()[PauseReconcileAnnotation]
+	if !found {
+		return nil, false
+	}
+	if all, err := strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+		return nil, all
+	}
+	paused = map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			paused[name] = true
+		}
+	}
+	return paused, false
+}
+
+// validatePauseReconcileAnnotation checks that the PauseReconcileAnnotation
+// only refers to the resource managers of the StorageCluster
+func validatePauseReconcileAnnotation(sc *ocsv1.StorageCluster) error {
+	paused, _ := getPausedComponents(sc)
+	if len(paused) == 0 {
+		return nil
+	}
+	known := map[string]bool{}
+	var names []string
+	for _, node := range getResourceManagerNodes(sc) {
+		known[node.name] = true
+		names = append(names, node.name)
+	}
+	for name := range paused {
+		if !known[name] {
+			return fmt.Errorf("annotation %s refers to unknown component %q, must be true, false or a list of %v",
+				PauseReconcileAnnotation, name, names)
+		}
+	}
+	return nil
+}
+
+// setReconcilePausedCondition reports in the ReconcilePaused condition the
+// resource managers which were skipped because of the
+// PauseReconcileAnnotation, or all of them when the whole reconcile was
+// skipped. The condition is only added once the reconcile has been paused,
+// after which it is kept as False.
+func setReconcilePausedCondition(sc *ocsv1.StorageCluster, paused []string, all bool) {
+	if !all && len(paused) == 0 {
+		if conditionsv1.FindStatusCondition(sc.Status.Conditions, ocsv1.ConditionReconcilePaused) != nil {
+			conditionsv1.SetStatusCondition(&sc.Status.Conditions, conditionsv1.Condition{
+				Type:    ocsv1.ConditionReconcilePaused,
+				Status:  corev1.ConditionFalse,
+				Reason:  ocsv1.ReconcileResumed,
+				Message: "Reconcile is not paused",
+			})
+		}
+		return
+	}
+
+	message := "Reconcile is paused for all components"
+	if !all {
+		names := append([]string{}, paused...)
+		sort.Strings(names)
+		message = fmt.Sprintf("Reconcile is paused for components: %s", strings.Join(names, ", "))
+	}
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, conditionsv1.Condition{
+		Type:    ocsv1.ConditionReconcilePaused,
+		Status:  corev1.ConditionTrue,
+		Reason:  ocsv1.ReconcilePaused,
+		Message: message,
+	})
+}
+
+// getPausedResourceManagers returns the names of the resource managers which
+// were skipped because they are paused
+func getPausedResourceManagers(statuses []ocsv1.ResourceManagerStatus) []string {
+	var paused []string
+	for _, status := range statuses {
+		if status.Result == ocsv1.ResourceManagerPaused {
+			paused = append(paused, status.Name)
+		}
+	}
+	return paused
+}
@@ -0,0 +1,139 @@
+package storagecluster
+
+import (
+	"context"
+	"testing"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	api "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestValidatePauseReconcileAnnotation(t *testing.T) {
+	cases := []struct {
+		label   string
+		value   string
+		isValid bool
+	}{
+		{label: "Case 1: global pause", value: "true", isValid: true},
+		{label: "Case 2: known components", value: "CephCluster, NooBaa", isValid: true},
+		{label: "Case 3: unknown component", value: "CephCluster,Unknown", isValid: false},
+		{label: "Case 4: external only component", value: "ExternalResources", isValid: false},
+		{label: "Case 5: pause disabled", value: "false", isValid: true},
+	}
+
+	for _, c := range cases {
+		sc := createDefaultStorageCluster()
+		sc.Annotations = map[string]string{PauseReconcileAnnotation: c.value}
+		err := validatePauseReconcileAnnotation(sc)
+		if c.isValid {
+			assert.NoErrorf(t, err, "[%s]", c.label)
+		} else {
+			assert.Errorf(t, err, "[%s]", c.label)
+		}
+	}
+}
+
+func TestStorageClusterPauseReconcile(t *testing.T) {
+	cr := createDefaultStorageCluster()
+	cr.Annotations = map[string]string{PauseReconcileAnnotation: "true"}
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      cr.Name,
+			Namespace: cr.Namespace,
+		},
+	}
+	reconciler := createFakeInitializationStorageClusterReconciler(t)
+	assert.NoError(t, reconciler.Client.Create(context.TODO(), cr))
+	cephClusterName := types.NamespacedName{Name: generateNameForCephCluster(cr), Namespace: cr.Namespace}
+
+	// a global pause doesn't reconcile anything
+	_, err := reconciler.Reconcile(context.TODO(), request)
+	assert.NoError(t, err)
+	actual := &api.StorageCluster{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), request.NamespacedName, actual))
+	condition := conditionsv1.FindStatusCondition(actual.Status.Conditions, api.ConditionReconcilePaused)
+	assert.NotNil(t, condition)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, "Reconcile is paused for all components", condition.Message)
+	err = reconciler.Client.Get(context.TODO(), cephClusterName, &cephv1.CephCluster{})
+	assert.True(t, errors.IsNotFound(err), "CephCluster was created while paused")
+
+	// pausing a single component leaves the others managed
+	actual.Annotations[PauseReconcileAnnotation] = "CephCluster"
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), actual))
+	_, err = reconciler.Reconcile(context.TODO(), request)
+	assert.NoError(t, err)
+	actual = &api.StorageCluster{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), request.NamespacedName, actual))
+	condition = conditionsv1.FindStatusCondition(actual.Status.Conditions, api.ConditionReconcilePaused)
+	assert.NotNil(t, condition)
+	assert.Equal(t, corev1.ConditionTrue, condition.Status)
+	assert.Equal(t, "Reconcile is paused for components: CephCluster", condition.Message)
+	err = reconciler.Client.Get(context.TODO(), cephClusterName, &cephv1.CephCluster{})
+	assert.True(t, errors.IsNotFound(err), "CephCluster was created while paused")
+	for _, status := range actual.Status.ResourceManagers {
+		if status.Name == "CephCluster" {
+			assert.Equal(t, api.ResourceManagerPaused, status.Result)
+		} else if status.Name == "CephConfig" {
+			assert.Equal(t, api.ResourceManagerSucceeded, status.Result)
+		}
+	}
+
+	// resuming reconciles the paused components again
+	delete(actual.Annotations, PauseReconcileAnnotation)
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), actual))
+	_, err = reconciler.Reconcile(context.TODO(), request)
+	assert.NoError(t, err)
+	actual = &api.StorageCluster{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), request.NamespacedName, actual))
+	condition = conditionsv1.FindStatusCondition(actual.Status.Conditions, api.ConditionReconcilePaused)
+	assert.NotNil(t, condition)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), cephClusterName, &cephv1.CephCluster{}))
+
+	// an annotation naming an unknown component fails the validation, and
+	// nothing is reported as paused
+	actual.Annotations = map[string]string{PauseReconcileAnnotation: "CephClusters"}
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), actual))
+	_, err = reconciler.Reconcile(context.TODO(), request)
+	assert.Error(t, err)
+	actual = &api.StorageCluster{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), request.NamespacedName, actual))
+	assert.Equal(t, statusutil.PhaseError, actual.Status.Phase)
+	condition = conditionsv1.FindStatusCondition(actual.Status.Conditions, api.ConditionReconcilePaused)
+	assert.NotNil(t, condition)
+	assert.Equal(t, corev1.ConditionFalse, condition.Status)
+}
+
+func TestSetReconcilePausedCondition(t *testing.T) {
+	sc := createDefaultStorageCluster()
+
+	// nothing is reported until a resource manager is skipped
+	setReconcilePausedCondition(sc, nil, false)
+	assert.Nil(t, conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionReconcilePaused))
+
+	statuses := []api.ResourceManagerStatus{
+		{Name: "CephConfig", Result: api.ResourceManagerSucceeded},
+		{Name: "NooBaa", Result: api.ResourceManagerPaused},
+		{Name: "CephCluster", Result: api.ResourceManagerPaused},
+	}
+	setReconcilePausedCondition(sc, getPausedResourceManagers(statuses), false)
+	condition := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionReconcilePaused)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+		assert.Equal(t, "Reconcile is paused for components: CephCluster, NooBaa", condition.Message)
+	}
+
+	setReconcilePausedCondition(sc, nil, false)
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionReconcilePaused)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+	}
+}
@@ -59,7 +59,7 @@ func getPlacement(sc *ocsv1.StorageCluster, component string) rookv1.Placement {
 	}
 
 	topologyKey := getFailureDomain(sc)
-	topologyKey, _ = topologyMap.GetKeyValues(topologyKey)
+	topologyKey, _ = getFailureDomainKeyValues(topologyMap, topologyKey)
 	if component == "mon" || component == "mds" || (component == "rgw" && getCephObjectStoreGatewayInstances(sc) > 1) {
 		if placement.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution != nil {
 			for i := range placement.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
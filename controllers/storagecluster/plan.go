@@ -0,0 +1,594 @@
+package storagecluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+const (
+	// DryRunAnnotation puts the StorageCluster in dry-run mode when set to
+	// "true". In dry-run mode the operator doesn't apply any change, it only
+	// publishes the changes it would make in the status of the StorageCluster.
+	DryRunAnnotation = "reconcile.ocs.openshift.io/dry-run"
+)
+
+// isDryRun returns true if the StorageCluster is in dry-run mode
+func isDryRun(sc *ocsv1.StorageCluster) bool {
+	return sc.GetAnnotations()[DryRunAnnotation] == "true"
+}
+
+// reconcilePlan runs the resource managers with a client which records the
+// changes they would make instead of applying them, and publishes those
+// changes in the status of the StorageCluster. The planner doesn't emit
+// events, and doesn't call the KMS or the external cluster either, as a token
+// renewal or a login would be a change of its own.
+func (r *StorageClusterReconciler) reconcilePlan(instance *ocsv1.StorageCluster) error {
+	r.Log.Info("StorageCluster is in dry-run mode. Computing the reconcile plan.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+
+	planningClient := newPlanningClient(r.Client)
+	planner := *r
+	planner.Client = planningClient
+	planner.recorder = statusutil.NewEventReporter(&discardingEventRecorder{})
+	planner.dryRun = true
+	planner.conditions = statusutil.ConditionAggregator{}
+	planner.phase = ""
+
+	// The resource managers work on a copy, as the status changes they make
+	// are part of what isn't applied.
+	sc := instance.DeepCopy()
+	if !contains(sc.GetFinalizers(), storageClusterFinalizer) {
+		sc.ObjectMeta.Finalizers = append(sc.ObjectMeta.Finalizers, storageClusterFinalizer)
+		if err := planningClient.Update(context.TODO(), sc); err != nil {
+			return err
+		}
+	}
+	if err := planner.reconcileUninstallAnnotations(sc); err != nil {
+		return err
+	}
+	if !sc.Spec.ExternalStorage.Enable {
+		if err := planner.reconcileNodeTopologyMap(sc); err != nil {
+			r.Log.Error(err, "Failed to set node Topology Map for StorageCluster.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+			return err
+		}
+	}
+
+	statuses, err := planner.ensureResourceManagers(sc, getResourceManagerNodes(sc))
+	if statuses == nil && err != nil {
+		return err
+	}
+	if err != nil {
+		r.Log.Info("Reconcile plan is incomplete.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name), "Error", err.Error())
+	}
+
+	instance.Status.Plan = &ocsv1.StorageClusterPlan{
+		ObservedGeneration: instance.Generation,
+		Changes:            planningClient.getChanges(),
+		ResourceManagers:   statuses,
+	}
+	return nil
+}
+
+// discardingEventRecorder is the record.EventRecorder of the planner, the
+// events of a plan would announce changes which are not made
+type discardingEventRecorder struct{}
+
+var _ record.EventRecorder = &discardingEventRecorder{}
+
+func (d *discardingEventRecorder) Event(object runtime.Object, eventtype, reason, message string) {}
+
+func (d *discardingEventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+}
+
+func (d *discardingEventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+}
+
+// planningClient is a client.Client which reads from the cluster but, instead
+// of writing to it, records the changes it is asked to make. The objects it
+// reads reflect the changes recorded so far, so that a resource manager which
+// reads back what it created or updated sees the same as without dry-run.
+type planningClient struct {
+	client.Client
+
+	lock    sync.Mutex
+	changes []ocsv1.PlannedChange
+	// objects holds the planned state of the objects created or updated
+	objects map[string]client.Object
+	// deleted holds the current state of the objects planned for deletion,
+	// so that a later create of the same object is reported as a recreate
+	deleted map[string]client.Object
+}
+
+var _ client.Client = &planningClient{}
+
+func newPlanningClient(c client.Client) *planningClient {
+	return &planningClient{
+		Client:  c,
+		objects: map[string]client.Object{},
+		deleted: map[string]client.Object{},
+	}
+}
+
+// getChanges returns the recorded changes, sorted by object
+func (c *planningClient) getChanges() []ocsv1.PlannedChange {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	changes := append([]ocsv1.PlannedChange{}, c.changes...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return plannedChangeKey(changes[i]) < plannedChangeKey(changes[j])
+	})
+	return changes
+}
+
+func plannedChangeKey(change ocsv1.PlannedChange) string {
+	return strings.Join([]string{change.APIVersion, change.Kind, change.Namespace, change.Name}, "/")
+}
+
+// newPlannedChange returns a PlannedChange without patch for obj
+func (c *planningClient) newPlannedChange(obj client.Object, action ocsv1.PlannedAction) (ocsv1.PlannedChange, error) {
+	gvk, err := c.getObjectKind(obj)
+	if err != nil {
+		return ocsv1.PlannedChange{}, err
+	}
+	return ocsv1.PlannedChange{
+		APIVersion: gvk.GroupVersion().String(),
+		Kind:       gvk.Kind,
+		Namespace:  obj.GetNamespace(),
+		Name:       obj.GetName(),
+		Action:     action,
+	}, nil
+}
+
+func (c *planningClient) getObjectKind(obj runtime.Object) (schema.GroupVersionKind, error) {
+	return apiutil.GVKForObject(obj, c.Scheme())
+}
+
+// findChange returns the index of the last change of the object with the
+// given key and action, -1 if there is none
+func (c *planningClient) findChange(key string, action ocsv1.PlannedAction) int {
+	for i := len(c.changes) - 1; i >= 0; i-- {
+		if plannedChangeKey(c.changes[i]) == key && c.changes[i].Action == action {
+			return i
+		}
+	}
+	return -1
+}
+
+// getCurrent returns the object as it is in the cluster. It is read into a
+// new object, as the fields missing from the cluster one would otherwise keep
+// their desired values.
+func (c *planningClient) getCurrent(ctx context.Context, obj client.Object) (client.Object, error) {
+	current, err := newEmptyObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	err = c.Client.Get(ctx, types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, current)
+	return current, err
+}
+
+// newEmptyObject returns an empty object of the type and kind of obj
+func newEmptyObject(obj client.Object) (client.Object, error) {
+	empty, ok := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(client.Object)
+	if !ok {
+		return nil, fmt.Errorf("unable to copy %T", obj)
+	}
+	// an unstructured object only knows its kind from its content
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		empty.(*unstructured.Unstructured).SetGroupVersionKind(u.GroupVersionKind())
+	}
+	return empty, nil
+}
+
+// Get returns the planned state of the object if it was created or updated
+// earlier in the plan, and NotFound if it was deleted
+func (c *planningClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	gvk, err := c.getObjectKind(obj)
+	if err != nil {
+		return err
+	}
+	planKey := strings.Join([]string{gvk.GroupVersion().String(), gvk.Kind, key.Namespace, key.Name}, "/")
+
+	c.lock.Lock()
+	planned, found := c.objects[planKey]
+	_, deleted := c.deleted[planKey]
+	c.lock.Unlock()
+	if found && reflect.TypeOf(planned) == reflect.TypeOf(obj) {
+		reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(planned.DeepCopyObject()).Elem())
+		return nil
+	}
+	if deleted {
+		return errors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)}, key.Name)
+	}
+	return c.Client.Get(ctx, key, obj)
+}
+
+// List returns the objects of the cluster with the changes recorded so far
+// applied to them
+func (c *planningClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := c.Client.List(ctx, list, opts...); err != nil {
+		return err
+	}
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	listed := map[string]bool{}
+	var result []runtime.Object
+	for _, item := range items {
+		obj, ok := item.(client.Object)
+		if !ok {
+			return fmt.Errorf("unable to list %T", item)
+		}
+		gvk, err := c.getObjectKind(obj)
+		if err != nil {
+			return err
+		}
+		key := strings.Join([]string{gvk.GroupVersion().String(), gvk.Kind, obj.GetNamespace(), obj.GetName()}, "/")
+		listed[key] = true
+		if planned, found := c.objects[key]; found {
+			result = append(result, planned.DeepCopyObject())
+		} else if _, deleted := c.deleted[key]; !deleted {
+			result = append(result, item)
+		}
+	}
+	// the objects planned for creation which match the options
+	listGVK, err := c.getObjectKind(list)
+	if err != nil {
+		return err
+	}
+	itemKind := strings.TrimSuffix(listGVK.Kind, "List")
+	for key, planned := range c.objects {
+		gvk, err := c.getObjectKind(planned)
+		if err != nil {
+			return err
+		}
+		if listed[key] || gvk.GroupVersion() != listGVK.GroupVersion() || gvk.Kind != itemKind {
+			continue
+		}
+		if listOpts.Namespace != "" && planned.GetNamespace() != listOpts.Namespace {
+			continue
+		}
+		if listOpts.LabelSelector != nil && !listOpts.LabelSelector.Matches(labels.Set(planned.GetLabels())) {
+			continue
+		}
+		result = append(result, planned.DeepCopyObject())
+	}
+	return meta.SetList(list, result)
+}
+
+// Create records the creation of obj, or its recreation if it was deleted
+// earlier in the plan
+func (c *planningClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	change, err := c.newPlannedChange(obj, ocsv1.PlannedActionCreate)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	key := plannedChangeKey(change)
+	c.objects[key] = obj.DeepCopyObject().(client.Object)
+	if deleted, found := c.deleted[key]; found {
+		change.Action = ocsv1.PlannedActionRecreate
+		change.Patch, err = diffObjects(deleted, obj)
+		if err != nil {
+			return err
+		}
+		delete(c.deleted, key)
+		if i := c.findChange(key, ocsv1.PlannedActionDelete); i >= 0 {
+			c.changes[i] = change
+			return nil
+		}
+	}
+	c.changes = append(c.changes, change)
+	return nil
+}
+
+// Update records the changes between the object in the cluster and obj
+func (c *planningClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return c.recordUpdate(ctx, obj)
+}
+
+// Patch applies the patch to the planned state of the object, sets obj to the
+// result as the API server would, and records the changes between the object
+// in the cluster and the result
+func (c *planningClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	gvk, err := c.getObjectKind(obj)
+	if err != nil {
+		return err
+	}
+	// the changes planned so far are patched as well
+	current, err := newEmptyObject(obj)
+	if err != nil {
+		return err
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		return err
+	}
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	var patchedJSON []byte
+	switch patch.Type() {
+	case types.StrategicMergePatchType:
+		// the typed object holds the patch strategies of the fields, even
+		// when obj is unstructured
+		var schema runtime.Object
+		if schema, err = c.Scheme().New(gvk); err == nil {
+			patchedJSON, err = strategicpatch.StrategicMergePatch(currentJSON, data, schema)
+		}
+	case types.MergePatchType:
+		patchedJSON, err = mergePatch(currentJSON, data)
+	default:
+		err = fmt.Errorf("unsupported patch type %s", patch.Type())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply the patch to %s %s: %v", gvk.Kind, client.ObjectKeyFromObject(obj), err)
+	}
+
+	patched, err := newEmptyObject(obj)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(patchedJSON, patched); err != nil {
+		return err
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(patched).Elem())
+	return c.recordUpdate(ctx, obj)
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386) to the JSON document
+func mergePatch(doc, patch []byte) ([]byte, error) {
+	var docValue, patchValue interface{}
+	if err := json.Unmarshal(doc, &docValue); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergePatchValue(docValue, patchValue))
+}
+
+func mergePatchValue(doc, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	docMap, ok := doc.(map[string]interface{})
+	if !ok {
+		docMap = map[string]interface{}{}
+	}
+	for key, value := range patchMap {
+		if value == nil {
+			delete(docMap, key)
+		} else {
+			docMap[key] = mergePatchValue(docMap[key], value)
+		}
+	}
+	return docMap
+}
+
+// recordUpdate records the changes between the object in the cluster and obj.
+// An object updated several times, or recreated, has a single change, and the
+// updates of an object planned for creation are part of its creation.
+func (c *planningClient) recordUpdate(ctx context.Context, obj client.Object) error {
+	change, err := c.newPlannedChange(obj, ocsv1.PlannedActionUpdate)
+	if err != nil {
+		return err
+	}
+	key := plannedChangeKey(change)
+
+	c.lock.Lock()
+	created := c.findChange(key, ocsv1.PlannedActionCreate) >= 0
+	if created {
+		c.objects[key] = obj.DeepCopyObject().(client.Object)
+	}
+	c.lock.Unlock()
+	if created {
+		return nil
+	}
+
+	current, err := c.getCurrent(ctx, obj)
+	if err != nil {
+		return err
+	}
+	change.Patch, err = diffObjects(current, obj)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.objects[key] = obj.DeepCopyObject().(client.Object)
+	i := c.findChange(key, ocsv1.PlannedActionRecreate)
+	if i >= 0 {
+		change.Action = ocsv1.PlannedActionRecreate
+	} else {
+		i = c.findChange(key, ocsv1.PlannedActionUpdate)
+	}
+	switch {
+	case i >= 0 && change.Action == ocsv1.PlannedActionUpdate && len(change.Patch) == 0:
+		c.changes = append(c.changes[:i], c.changes[i+1:]...)
+	case i >= 0:
+		c.changes[i] = change
+	case len(change.Patch) > 0:
+		c.changes = append(c.changes, change)
+	}
+	return nil
+}
+
+// Delete records the deletion of obj, or drops its creation if it was only
+// planned
+func (c *planningClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	change, err := c.newPlannedChange(obj, ocsv1.PlannedActionDelete)
+	if err != nil {
+		return err
+	}
+	key := plannedChangeKey(change)
+
+	c.lock.Lock()
+	i := c.findChange(key, ocsv1.PlannedActionCreate)
+	if i >= 0 {
+		c.changes = append(c.changes[:i], c.changes[i+1:]...)
+		delete(c.objects, key)
+	}
+	c.lock.Unlock()
+	if i >= 0 {
+		return nil
+	}
+
+	current, err := c.getCurrent(ctx, obj)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.objects, key)
+	c.deleted[key] = current
+	c.changes = append(c.changes, change)
+	return nil
+}
+
+// DeleteAllOf isn't used by the resource managers, it is a no-op
+func (c *planningClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	return nil
+}
+
+// Status returns a StatusWriter which discards all the writes
+func (c *planningClient) Status() client.StatusWriter {
+	return &planningStatusWriter{}
+}
+
+// planningStatusWriter discards the status updates, the status of the objects
+// owned by the StorageCluster is never part of the plan
+type planningStatusWriter struct{}
+
+func (w *planningStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return nil
+}
+
+func (w *planningStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return nil
+}
+
+// diffObjects returns the JSON patch operations which turn current into
+// desired. The status and the metadata fields that are managed by the API
+// server are left out.
+func diffObjects(current, desired runtime.Object) ([]ocsv1.JSONPatchOperation, error) {
+	currentMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(current)
+	if err != nil {
+		return nil, err
+	}
+	desiredMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+	if err != nil {
+		return nil, err
+	}
+	pruneForDiff(currentMap)
+	pruneForDiff(desiredMap)
+
+	var ops []ocsv1.JSONPatchOperation
+	if err := diffValues("", currentMap, desiredMap, &ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// pruneForDiff removes the fields which the resource managers don't set
+func pruneForDiff(obj map[string]interface{}) {
+	delete(obj, "apiVersion")
+	delete(obj, "kind")
+	delete(obj, "status")
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		for key := range metadata {
+			if key != "labels" && key != "annotations" && key != "finalizers" {
+				delete(metadata, key)
+			}
+		}
+	}
+}
+
+func diffValues(path string, current, desired interface{}, ops *[]ocsv1.JSONPatchOperation) error {
+	currentMap, currentIsMap := current.(map[string]interface{})
+	desiredMap, desiredIsMap := desired.(map[string]interface{})
+	if !currentIsMap || !desiredIsMap {
+		if reflect.DeepEqual(current, desired) {
+			return nil
+		}
+		return appendOperation(ops, "replace", path, desired)
+	}
+
+	var keys []string
+	for key := range currentMap {
+		keys = append(keys, key)
+	}
+	for key := range desiredMap {
+		if _, found := currentMap[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := path + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+		currentValue, inCurrent := currentMap[key]
+		desiredValue, inDesired := desiredMap[key]
+		var err error
+		switch {
+		case !inDesired:
+			err = appendOperation(ops, "remove", keyPath, nil)
+		case !inCurrent:
+			err = appendOperation(ops, "add", keyPath, desiredValue)
+		default:
+			err = diffValues(keyPath, currentValue, desiredValue, ops)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendOperation(ops *[]ocsv1.JSONPatchOperation, op, path string, value interface{}) error {
+	operation := ocsv1.JSONPatchOperation{Op: op, Path: path}
+	if op != "remove" {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		operation.Value = string(encoded)
+	}
+	*ops = append(*ops, operation)
+	return nil
+}
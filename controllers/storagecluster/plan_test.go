@@ -0,0 +1,326 @@
+package storagecluster
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestDiffObjects(t *testing.T) {
+	current := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "cm",
+			ResourceVersion: "1",
+		},
+		Data: map[string]string{
+			"unchanged": "a",
+			"changed":   "b",
+			"removed":   "c",
+		},
+	}
+	desired := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "cm",
+		},
+		Data: map[string]string{
+			"unchanged": "a",
+			"changed":   "d",
+			"added/key": "e",
+		},
+	}
+
+	ops, err := diffObjects(current, desired)
+	assert.NoError(t, err)
+	assert.Equal(t, []api.JSONPatchOperation{
+		{Op: "add", Path: "/data/added~1key", Value: `"e"`},
+		{Op: "replace", Path: "/data/changed", Value: `"d"`},
+		{Op: "remove", Path: "/data/removed"},
+	}, ops)
+
+	ops, err = diffObjects(current, current.DeepCopy())
+	assert.NoError(t, err)
+	assert.Empty(t, ops)
+}
+
+func TestPlanningClient(t *testing.T) {
+	existing := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "existing"},
+		Provisioner: "fake.provisioner",
+		Parameters:  map[string]string{"pool": "old"},
+	}
+	reconciler := createFakeStorageClusterReconciler(t, existing)
+	planningClient := newPlanningClient(reconciler.Client)
+	ctx := context.TODO()
+
+	// an update is recorded but not applied
+	updated := existing.DeepCopy()
+	updated.Parameters["pool"] = "new"
+	assert.NoError(t, planningClient.Update(ctx, updated))
+	actual := &storagev1.StorageClass{}
+	assert.NoError(t, reconciler.Client.Get(ctx, types.NamespacedName{Name: existing.Name}, actual))
+	assert.Equal(t, "old", actual.Parameters["pool"])
+
+	// a delete followed by a create of the same object is a recreate
+	assert.NoError(t, planningClient.Delete(ctx, existing.DeepCopy()))
+	assert.NoError(t, planningClient.Create(ctx, updated.DeepCopy()))
+	assert.NoError(t, reconciler.Client.Get(ctx, types.NamespacedName{Name: existing.Name}, actual))
+
+	created := &storagev1.StorageClass{
+		ObjectMeta:  metav1.ObjectMeta{Name: "created"},
+		Provisioner: "fake.provisioner",
+	}
+	assert.NoError(t, planningClient.Create(ctx, created))
+	err := reconciler.Client.Get(ctx, types.NamespacedName{Name: created.Name}, actual)
+	assert.True(t, errors.IsNotFound(err))
+
+	changes := planningClient.getChanges()
+	assert.Len(t, changes, 3)
+	assert.Equal(t, "created", changes[0].Name)
+	assert.Equal(t, api.PlannedActionCreate, changes[0].Action)
+	assert.Equal(t, "existing", changes[1].Name)
+	assert.Equal(t, api.PlannedActionUpdate, changes[1].Action)
+	assert.Equal(t, []api.JSONPatchOperation{{Op: "replace", Path: "/parameters/pool", Value: `"new"`}}, changes[1].Patch)
+	assert.Equal(t, "existing", changes[2].Name)
+	assert.Equal(t, api.PlannedActionRecreate, changes[2].Action)
+	assert.Equal(t, changes[1].Patch, changes[2].Patch)
+	for _, change := range changes {
+		assert.Equal(t, "storage.k8s.io/v1", change.APIVersion)
+		assert.Equal(t, "StorageClass", change.Kind)
+	}
+}
+
+func TestPlanningClientReadsItsWrites(t *testing.T) {
+	existing := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "ns", Labels: map[string]string{"app": "test"}},
+		Data:       map[string]string{"key": "old"},
+	}
+	deleted := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "deleted", Namespace: "ns", Labels: map[string]string{"app": "test"}},
+	}
+	reconciler := createFakeStorageClusterReconciler(t, existing, deleted)
+	planningClient := newPlanningClient(reconciler.Client)
+	ctx := context.TODO()
+
+	created := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "created", Namespace: "ns", Labels: map[string]string{"app": "test"}},
+		Data:       map[string]string{"key": "a"},
+	}
+	assert.NoError(t, planningClient.Create(ctx, created.DeepCopy()))
+	updated := existing.DeepCopy()
+	updated.Data["key"] = "new"
+	assert.NoError(t, planningClient.Update(ctx, updated))
+	assert.NoError(t, planningClient.Delete(ctx, deleted.DeepCopy()))
+
+	// the planned state is read back
+	actual := &corev1.ConfigMap{}
+	assert.NoError(t, planningClient.Get(ctx, types.NamespacedName{Name: "created", Namespace: "ns"}, actual))
+	assert.Equal(t, "a", actual.Data["key"])
+	assert.NoError(t, planningClient.Get(ctx, types.NamespacedName{Name: "existing", Namespace: "ns"}, actual))
+	assert.Equal(t, "new", actual.Data["key"])
+	err := planningClient.Get(ctx, types.NamespacedName{Name: "deleted", Namespace: "ns"}, actual)
+	assert.True(t, errors.IsNotFound(err))
+
+	list := &corev1.ConfigMapList{}
+	assert.NoError(t, planningClient.List(ctx, list, client.InNamespace("ns"), client.MatchingLabels{"app": "test"}))
+	names := map[string]string{}
+	for _, cm := range list.Items {
+		names[cm.Name] = cm.Data["key"]
+	}
+	assert.Equal(t, map[string]string{"created": "a", "existing": "new"}, names)
+	assert.NoError(t, planningClient.List(ctx, list, client.InNamespace("other")))
+	assert.Empty(t, list.Items)
+
+	// an update of a planned object is part of its creation, and the
+	// creation of an object deleted later on is dropped
+	created.Data["key"] = "b"
+	assert.NoError(t, planningClient.Update(ctx, created.DeepCopy()))
+	changes := planningClient.getChanges()
+	assert.Len(t, changes, 3)
+	assert.NoError(t, planningClient.Delete(ctx, created.DeepCopy()))
+	changes = planningClient.getChanges()
+	if assert.Len(t, changes, 2) {
+		assert.Equal(t, "deleted", changes[0].Name)
+		assert.Equal(t, api.PlannedActionDelete, changes[0].Action)
+		assert.Equal(t, "existing", changes[1].Name)
+		assert.Equal(t, api.PlannedActionUpdate, changes[1].Action)
+	}
+
+	// an object updated twice has a single change
+	updated.Data["other"] = "c"
+	assert.NoError(t, planningClient.Update(ctx, updated.DeepCopy()))
+	changes = planningClient.getChanges()
+	if assert.Len(t, changes, 2) {
+		assert.Len(t, changes[1].Patch, 2)
+	}
+
+	// unstructured objects are planned too
+	subVolumeGroup := &unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{"name": "team-a"}}}
+	subVolumeGroup.SetGroupVersionKind(cephFilesystemSubVolumeGroupKind)
+	subVolumeGroup.SetName("team-a")
+	subVolumeGroup.SetNamespace("ns")
+	assert.NoError(t, reconciler.Client.Create(ctx, subVolumeGroup))
+	plannedGroup := subVolumeGroup.DeepCopy()
+	plannedGroup.Object["spec"] = map[string]interface{}{"name": "team-b"}
+	assert.NoError(t, planningClient.Update(ctx, plannedGroup.DeepCopy()))
+	actualGroup := &unstructured.Unstructured{}
+	actualGroup.SetGroupVersionKind(cephFilesystemSubVolumeGroupKind)
+	assert.NoError(t, planningClient.Get(ctx, types.NamespacedName{Name: "team-a", Namespace: "ns"}, actualGroup))
+	assert.Equal(t, plannedGroup.Object["spec"], actualGroup.Object["spec"])
+	changes = planningClient.getChanges()
+	assert.Len(t, changes, 3)
+	for _, change := range changes {
+		if change.Name == "team-a" {
+			assert.Equal(t, api.PlannedActionUpdate, change.Action)
+		}
+	}
+
+	// nothing is written to the cluster
+	assert.NoError(t, reconciler.Client.Get(ctx, types.NamespacedName{Name: "existing", Namespace: "ns"}, actual))
+	assert.Equal(t, map[string]string{"key": "old"}, actual.Data)
+	assert.NoError(t, reconciler.Client.Get(ctx, types.NamespacedName{Name: "deleted", Namespace: "ns"}, actual))
+	actualGroup = &unstructured.Unstructured{}
+	actualGroup.SetGroupVersionKind(cephFilesystemSubVolumeGroupKind)
+	assert.NoError(t, reconciler.Client.Get(ctx, types.NamespacedName{Name: "team-a", Namespace: "ns"}, actualGroup))
+	assert.Equal(t, subVolumeGroup.Object["spec"], actualGroup.Object["spec"])
+}
+
+func TestPlanningClientPatch(t *testing.T) {
+	node := newTestNode("node-a", map[string]string{defaults.NodeAffinityKey: ""})
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+		Data:       map[string]string{"key": "old", "removed": "a"},
+	}
+	reconciler := createFakeStorageClusterReconciler(t, node, cm)
+	planningClient := newPlanningClient(reconciler.Client)
+	ctx := context.TODO()
+
+	// a strategic merge patch is applied to the object passed along with it,
+	// as ensureNodeRacks does
+	newNode := node.DeepCopy()
+	newNode.Labels[defaults.RackTopologyKey] = "rack0"
+	patch, err := generateStrategicPatch(node, newNode)
+	assert.NoError(t, err)
+	patchedNode := node.DeepCopy()
+	assert.NoError(t, planningClient.Patch(ctx, patchedNode, patch))
+	assert.Equal(t, "rack0", patchedNode.Labels[defaults.RackTopologyKey])
+
+	// a merge patch is applied on top of the changes planned so far
+	updated := cm.DeepCopy()
+	updated.Data["key"] = "new"
+	assert.NoError(t, planningClient.Update(ctx, updated.DeepCopy()))
+	patched := updated.DeepCopy()
+	delete(patched.Data, "removed")
+	assert.NoError(t, planningClient.Patch(ctx, patched, client.MergeFrom(updated)))
+	assert.Equal(t, map[string]string{"key": "new"}, patched.Data)
+
+	changes := planningClient.getChanges()
+	if assert.Len(t, changes, 2) {
+		assert.Equal(t, "cm", changes[0].Name)
+		assert.Len(t, changes[0].Patch, 2)
+		assert.Equal(t, "node-a", changes[1].Name)
+		assert.Equal(t, []api.JSONPatchOperation{
+			{Op: "add", Path: "/metadata/labels/topology.rook.io~1rack", Value: `"rack0"`},
+		}, changes[1].Patch)
+	}
+
+	// nothing is written to the cluster
+	actual := &corev1.Node{}
+	assert.NoError(t, reconciler.Client.Get(ctx, types.NamespacedName{Name: "node-a"}, actual))
+	assert.NotContains(t, actual.Labels, defaults.RackTopologyKey)
+}
+
+func TestPlanSkipsExternalCalls(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	sc.Spec.Encryption.KeyManagementService.Enable = true
+	// nothing listens on the address of the KMS
+	kmsCM := createDummyKMSConfigMap(VaultKMSProvider, "http://127.0.0.1:1")
+	kmsCM.Namespace = sc.Namespace
+	kmsToken := createDummyKMSTokenSecret("s.token")
+	kmsToken.Namespace = sc.Namespace
+	reconciler := createFakeStorageClusterReconciler(t, kmsCM, kmsToken)
+
+	assert.NoError(t, (&ocsKMS{}).ensureCreated(&reconciler, sc))
+	assert.NotNil(t, sc.Status.KMS.LastHealthCheckTime)
+	assert.Nil(t, sc.Status.KMS.LastSuccessfulHealthCheckTime)
+
+	sc.Status.KMS = nil
+	reconciler.dryRun = true
+	assert.NoError(t, (&ocsKMS{}).ensureCreated(&reconciler, sc))
+	assert.Nil(t, sc.Status.KMS)
+	assert.NoError(t, validateKMSProvider(reconciler.Client, kmsCM, !reconciler.dryRun))
+}
+
+func TestStorageClusterDryRun(t *testing.T) {
+	cr := createDefaultStorageCluster()
+	cr.Annotations = map[string]string{DryRunAnnotation: "true"}
+	request := reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      cr.Name,
+			Namespace: cr.Namespace,
+		},
+	}
+	reconciler := createFakeInitializationStorageClusterReconciler(t)
+	recorder := record.NewFakeRecorder(100)
+	reconciler.recorder = statusutil.NewEventReporter(recorder)
+	assert.NoError(t, reconciler.Client.Create(context.TODO(), cr))
+
+	_, err := reconciler.Reconcile(context.TODO(), request)
+	assert.NoError(t, err)
+	assert.Empty(t, recorder.Events, "events were emitted in dry-run mode")
+
+	actual := &api.StorageCluster{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), request.NamespacedName, actual))
+	assert.NotContains(t, actual.GetFinalizers(), storageClusterFinalizer)
+	assert.NotNil(t, actual.Status.Plan)
+
+	cephCluster := &cephv1.CephCluster{}
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephCluster(cr), Namespace: cr.Namespace}, cephCluster)
+	assert.True(t, errors.IsNotFound(err), "CephCluster was created in dry-run mode")
+
+	var plannedCephCluster *api.PlannedChange
+	for i, change := range actual.Status.Plan.Changes {
+		if change.Kind == "CephCluster" {
+			plannedCephCluster = &actual.Status.Plan.Changes[i]
+		}
+	}
+	assert.NotNil(t, plannedCephCluster)
+	assert.Equal(t, api.PlannedActionCreate, plannedCephCluster.Action)
+
+	// the finalizer and the uninstall annotations are part of the plan
+	var plannedStorageCluster *api.PlannedChange
+	for i, change := range actual.Status.Plan.Changes {
+		if change.Kind == "StorageCluster" {
+			plannedStorageCluster = &actual.Status.Plan.Changes[i]
+		}
+	}
+	if assert.NotNil(t, plannedStorageCluster) {
+		assert.Equal(t, api.PlannedActionUpdate, plannedStorageCluster.Action)
+		assert.Contains(t, plannedStorageCluster.Patch, api.JSONPatchOperation{
+			Op: "add", Path: "/metadata/finalizers", Value: `["` + storageClusterFinalizer + `"]`})
+	}
+
+	// leaving dry-run mode applies the plan
+	actual.Annotations = map[string]string{}
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), actual))
+	_, err = reconciler.Reconcile(context.TODO(), request)
+	assert.NoError(t, err)
+	actual = &api.StorageCluster{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), request.NamespacedName, actual))
+	assert.Nil(t, actual.Status.Plan)
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephCluster(cr), Namespace: cr.Namespace}, cephCluster)
+	assert.NoError(t, err)
+}
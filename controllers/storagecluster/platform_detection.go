@@ -45,13 +45,13 @@ type Platform struct {
 
 // GetPlatform is used to get the CloudPlatformType of the running cluster
 func (p *Platform) GetPlatform(c client.Client) (configv1.PlatformType, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
 	// if 'platform' is already set just return it
 	if p.platform != "" {
 		return p.platform, nil
 	}
-	p.mux.Lock()
-	defer p.mux.Unlock()
-
 	return p.getPlatform(c)
 }
 
@@ -10,10 +10,12 @@ import (
 	"github.com/go-logr/logr"
 	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
 	statusutil "github.com/openshift/ocs-operator/controllers/util"
 	"github.com/openshift/ocs-operator/version"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
@@ -37,17 +39,7 @@ type ocsCephConfig struct{}
 type ocsJobTemplates struct{}
 
 const (
-	rookConfigMapName     = "rook-config-override"
-	defaultRookConfigData = `
-[global]
-bdev_flock_retry = 20
-mon_osd_full_ratio = .85
-mon_osd_backfillfull_ratio = .8
-mon_osd_nearfull_ratio = .75
-mon_max_pg_per_osd = 600
-[osd]
-osd_memory_target_cgroup_limit_ratio = 0.5
-`
+	rookConfigMapName      = "rook-config-override"
 	monCountOverrideEnvVar = "MON_COUNT_OVERRIDE"
 
 	// Name of MetadataPVCTemplate
@@ -82,6 +74,9 @@ osd_memory_target_cgroup_limit_ratio = 0.5
 	EBS StorageClassProvisionerType = "kubernetes.io/aws-ebs"
 )
 
+// minOSDMemoryTarget is the lowest osd_memory_target accepted by Ceph
+var minOSDMemoryTarget = resource.MustParse("896Mi")
+
 var storageClusterFinalizer = "storagecluster.ocs.openshift.io"
 
 const labelZoneRegionWithoutBeta = "failure-domain.kubernetes.io/region"
@@ -117,11 +112,14 @@ var validTopologyLabelKeys = []string{
 }
 
 // +kubebuilder:rbac:groups=ocs.openshift.io,resources=*,verbs=get;list;watch;create;update;patch;delete
-// +kubebuilder:rbac:groups=ceph.rook.io,resources=cephclusters;cephblockpools;cephfilesystems;cephobjectstores;cephobjectstoreusers,verbs=*
+// +kubebuilder:rbac:groups=ceph.rook.io,resources=cephclusters;cephblockpools;cephfilesystems;cephobjectstores;cephobjectstoreusers;cephclients;cephfilesystemsubvolumegroups;cephblockpoolradosnamespaces,verbs=*
 // +kubebuilder:rbac:groups=noobaa.io,resources=noobaas,verbs=*
+// +kubebuilder:rbac:groups=objectbucket.io,resources=objectbucketclaims;objectbuckets,verbs=get;list
 // +kubebuilder:rbac:groups=storage.k8s.io,resources=storageclasses,verbs=*
 // +kubebuilder:rbac:groups=core,resources=pods;services;endpoints;persistentvolumeclaims;events;configmaps;secrets;nodes,verbs=*
-// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch;create;delete
+// +kubebuilder:rbac:groups=core,resources=resourcequotas,verbs=get;list;watch;create;update;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;delete
 // +kubebuilder:rbac:groups=apps,resources=deployments;daemonsets;replicasets;statefulsets,verbs=*
 // +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors;prometheusrules,verbs=get;list;watch;create;update
 // +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots;volumesnapshotclasses,verbs=*
@@ -202,42 +200,66 @@ func (r *StorageClusterReconciler) initializeImagesStatus(sc *ocsv1.StorageClust
 // validateStorageClusterSpec must be called before reconciling. Any syntactic and sematic errors in the CR must be caught here.
 func (r *StorageClusterReconciler) validateStorageClusterSpec(instance *ocsv1.StorageCluster, request reconcile.Request) error {
 	if err := versionCheck(instance, r.Log); err != nil {
-		r.Log.Error(err, "Failed to validate StorageCluster version.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
-		r.recorder.ReportIfNotPresent(instance, corev1.EventTypeWarning, statusutil.EventReasonValidationFailed, err.Error())
-		instance.Status.Phase = statusutil.PhaseError
-		if updateErr := r.Client.Status().Update(context.TODO(), instance); updateErr != nil {
-			r.Log.Error(updateErr, "Failed to update StorageCluster.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
-			return updateErr
-		}
-		return err
+		return r.failValidation(instance, "Failed to validate StorageCluster version.", err)
 	}
 
 	if !instance.Spec.ExternalStorage.Enable {
-		if err := r.validateStorageDeviceSets(instance); err != nil {
-			r.Log.Error(err, "Failed to validate StorageDeviceSets.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
-			r.recorder.ReportIfNotPresent(instance, corev1.EventTypeWarning, statusutil.EventReasonValidationFailed, err.Error())
-			instance.Status.Phase = statusutil.PhaseError
-			if updateErr := r.Client.Status().Update(context.TODO(), instance); updateErr != nil {
-				r.Log.Error(updateErr, "Failed to update StorageCluster.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
-				return updateErr
-			}
-			return err
+		if err := validateStorageDeviceSets(instance); err != nil {
+			return r.failValidation(instance, "Failed to validate StorageDeviceSets.", err)
 		}
+
+		if err := validateCephConfig(instance); err != nil {
+			return r.failValidation(instance, "Failed to validate CephConfig.", err)
+		}
+
+		if err := validateAdditionalBlockPools(instance); err != nil {
+			return r.failValidation(instance, "Failed to validate additional CephBlockPools.", err)
+		}
+
+		if err := validateCephFilesystems(instance); err != nil {
+			return r.failValidation(instance, "Failed to validate CephFilesystems.", err)
+		}
+
+		if err := validateTenants(instance); err != nil {
+			return r.failValidation(instance, "Failed to validate tenants.", err)
+		}
+
+		if err := validateFailureDomain(instance); err != nil {
+			return r.failValidation(instance, "Failed to validate the failure domain.", err)
+		}
+	}
+
+	if err := validateEncryptionSpec(instance); err != nil {
+		return r.failValidation(instance, "Failed to validate EncryptionSpec.", err)
+	}
+
+	if err := validatePauseReconcileAnnotation(instance); err != nil {
+		return r.failValidation(instance, "Failed to validate the pause reconcile annotation.", err)
+	}
+
+	if err := validateExternalStorageSpec(instance); err != nil {
+		return r.failValidation(instance, "Failed to validate ExternalStorageClusterSpec.", err)
 	}
 
 	if err := validateArbiterSpec(instance, r.Log); err != nil {
-		r.Log.Error(err, "Failed to validate ArbiterSpec.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
-		r.recorder.ReportIfNotPresent(instance, corev1.EventTypeWarning, statusutil.EventReasonValidationFailed, err.Error())
-		instance.Status.Phase = statusutil.PhaseError
-		if updateErr := r.Client.Status().Update(context.TODO(), instance); updateErr != nil {
-			r.Log.Error(updateErr, "Could not update StorageCluster.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
-			return updateErr
-		}
-		return err
+		return r.failValidation(instance, "Failed to validate ArbiterSpec.", err)
 	}
 	return nil
 }
 
+// failValidation reports a failed validation of the StorageCluster spec and
+// moves the StorageCluster to the Error phase
+func (r *StorageClusterReconciler) failValidation(instance *ocsv1.StorageCluster, message string, err error) error {
+	r.Log.Error(err, message, "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+	r.recorder.ReportIfNotPresent(instance, corev1.EventTypeWarning, statusutil.EventReasonValidationFailed, err.Error())
+	instance.Status.Phase = statusutil.PhaseError
+	if updateErr := r.Client.Status().Update(context.TODO(), instance); updateErr != nil {
+		r.Log.Error(updateErr, "Failed to update StorageCluster.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+		return updateErr
+	}
+	return err
+}
+
 func (r *StorageClusterReconciler) reconcilePhases(
 	instance *ocsv1.StorageCluster,
 	request reconcile.Request) (reconcile.Result, error) {
@@ -285,6 +307,11 @@ func (r *StorageClusterReconciler) reconcilePhases(
 
 	// Check GetDeletionTimestamp to determine if the object is under deletion
 	if instance.GetDeletionTimestamp().IsZero() {
+		// In dry-run mode nothing is written, not even the finalizer
+		if isDryRun(instance) {
+			return reconcile.Result{}, r.reconcilePlan(instance)
+		}
+
 		if !contains(instance.GetFinalizers(), storageClusterFinalizer) {
 			r.Log.Info("Finalizer not found for StorageCluster. Adding finalizer.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
 			instance.ObjectMeta.Finalizers = append(instance.ObjectMeta.Finalizers, storageClusterFinalizer)
@@ -298,11 +325,18 @@ func (r *StorageClusterReconciler) reconcilePhases(
 			return reconcile.Result{}, err
 		}
 
+		if err := r.reconcileUninstallReport(instance); err != nil {
+			return reconcile.Result{}, err
+		}
+
 	} else {
 		// The object is marked for deletion
 		instance.Status.Phase = statusutil.PhaseDeleting
 
 		if contains(instance.GetFinalizers(), storageClusterFinalizer) {
+			// the report shows what the uninstall still waits for, failing to
+			// generate it doesn't hold the uninstall
+			_ = r.reconcileUninstallReport(instance)
 			if err := r.deleteResources(instance); err != nil {
 				r.Log.Info("Uninstall in progress.", "Status", err)
 				r.recorder.ReportIfNotPresent(instance, corev1.EventTypeWarning, statusutil.EventReasonUninstallPending, err.Error())
@@ -321,67 +355,66 @@ func (r *StorageClusterReconciler) reconcilePhases(
 		return reconcile.Result{}, nil
 	}
 
+	// A paused StorageCluster can still be uninstalled, but none of its
+	// resources are reconciled
+	if _, all := getPausedComponents(instance); all {
+		setReconcilePausedCondition(instance, nil, true)
+		r.Log.Info("Reconcile is paused for the StorageCluster. Skipping reconciliation.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+		return reconcile.Result{}, nil
+	}
+
 	if !instance.Spec.ExternalStorage.Enable {
 		// Get storage node topology labels
 		if err := r.reconcileNodeTopologyMap(instance); err != nil {
 			r.Log.Error(err, "Failed to set node Topology Map for StorageCluster.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
 			return reconcile.Result{}, err
 		}
+
+		if err := r.reconcileTopologyDrift(instance); err != nil {
+			r.Log.Error(err, "Failed to detect the topology drift of StorageCluster.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+			return reconcile.Result{}, err
+		}
+
+		if err := r.reconcileArbiterZone(instance); err != nil {
+			r.Log.Error(err, "Failed to elect the arbiter zone of StorageCluster.", "StorageCluster", klog.KRef(instance.Namespace, instance.Name))
+			return reconcile.Result{}, err
+		}
 	}
 
+	// The plan is only kept while in dry-run mode
+	instance.Status.Plan = nil
+
 	// in-memory conditions should start off empty. It will only ever hold
 	// negative conditions (!Available, Degraded, Progressing)
-	r.conditions = nil
+	r.conditions = statusutil.ConditionAggregator{}
 	// Start with empty r.phase
 	r.phase = ""
-	var objs []resourceManager
-	if !instance.Spec.ExternalStorage.Enable {
-		// list of default ensure functions
-		objs = []resourceManager{
-			&ocsStorageClass{},
-			&ocsSnapshotClass{},
-			&ocsCephObjectStores{},
-			&ocsCephObjectStoreUsers{},
-			&ocsCephRGWRoutes{},
-			&ocsCephBlockPools{},
-			&ocsCephFilesystems{},
-			&ocsCephConfig{},
-			&ocsCephCluster{},
-			&ocsNoobaaSystem{},
-			&ocsJobTemplates{},
-			&ocsQuickStarts{},
-		}
 
-	} else {
-		// for external cluster, we have a different set of ensure functions
-		objs = []resourceManager{
-			&ocsExternalResources{},
-			&ocsCephCluster{},
-			&ocsSnapshotClass{},
-			&ocsNoobaaSystem{},
-			&ocsQuickStarts{},
-		}
+	// Independent resource managers run concurrently, and a failing one only
+	// holds back the managers which depend on it.
+	statuses, err := r.ensureResourceManagers(instance, getResourceManagerNodes(instance))
+	instance.Status.ResourceManagers = statuses
+	setReconcilePausedCondition(instance, getPausedResourceManagers(statuses), false)
+	if r.phase == statusutil.PhaseClusterExpanding {
+		instance.Status.Phase = statusutil.PhaseClusterExpanding
+	} else if instance.Status.Phase != statusutil.PhaseReady &&
+		instance.Status.Phase != statusutil.PhaseConnecting {
+		instance.Status.Phase = statusutil.PhaseProgressing
 	}
-
-	for _, obj := range objs {
-		err := obj.ensureCreated(r, instance)
-		if r.phase == statusutil.PhaseClusterExpanding {
-			instance.Status.Phase = statusutil.PhaseClusterExpanding
-		} else if instance.Status.Phase != statusutil.PhaseReady &&
-			instance.Status.Phase != statusutil.PhaseConnecting {
-			instance.Status.Phase = statusutil.PhaseProgressing
-		}
-		if err != nil {
-			reason := ocsv1.ReconcileFailed
-			message := fmt.Sprintf("Error while reconciling: %v", err)
-			statusutil.SetErrorCondition(&instance.Status.Conditions, reason, message)
-			instance.Status.Phase = statusutil.PhaseError
-			// don't want to overwrite the actual reconcile failure
-			return reconcile.Result{}, err
-		}
+	// the managers which succeeded before the failure still report the
+	// status of their components
+	r.conditions.SetComponentsStatus(&instance.Status.Components)
+	if err != nil {
+		reason := ocsv1.ReconcileFailed
+		message := fmt.Sprintf("Error while reconciling: %v", err)
+		statusutil.SetErrorCondition(&instance.Status.Conditions, reason, message)
+		instance.Status.Phase = statusutil.PhaseError
+		// don't want to overwrite the actual reconcile failure
+		return reconcile.Result{}, err
 	}
+
 	// All component operators are in a happy state.
-	if r.conditions == nil {
+	if r.conditions.IsEmpty() {
 		r.Log.Info("No component operator reported negatively.")
 		reason := ocsv1.ReconcileCompleted
 		message := ocsv1.ReconcileCompletedMessage
@@ -390,8 +423,10 @@ func (r *StorageClusterReconciler) reconcilePhases(
 		// If no operator whose conditions we are watching reports an error, then it is safe
 		// to set readiness.
 		ReadinessSet()
+		// the phase of the external cluster managed by Rook follows its
+		// connection
 		if instance.Status.Phase != statusutil.PhaseClusterExpanding &&
-			!instance.Spec.ExternalStorage.Enable {
+			(!instance.Spec.ExternalStorage.Enable || isAdditionalExternalStorageCluster(instance)) {
 			instance.Status.Phase = statusutil.PhaseReady
 		}
 	} else {
@@ -401,10 +436,10 @@ func (r *StorageClusterReconciler) reconcilePhases(
 		// type with type "False". When reconciling the resource we would
 		// add it to the in-memory representation of OCS's conditions (r.conditions)
 		// and here we are simply writing it back to the server.
-		// One shortcoming is that only one failure of a particular condition can be
-		// captured at one time (ie. if resource1 and resource2 are both reporting !Available,
-		// you will only see resource2q as it updates last).
-		for _, condition := range r.conditions {
+		// If resource1 and resource2 are both reporting !Available, the
+		// messages of both are merged into a single condition, and the
+		// per-component breakdown is available in the status components.
+		for _, condition := range r.conditions.Conditions() {
 			conditionsv1.SetStatusCondition(&instance.Status.Conditions, condition)
 		}
 		reason := ocsv1.ReconcileCompleted
@@ -432,6 +467,20 @@ func (r *StorageClusterReconciler) reconcilePhases(
 		}
 	}
 
+	if instance.Spec.ExternalStorage.Enable {
+		rookReported := false
+		for _, condition := range r.conditions.Conditions() {
+			rookReported = rookReported || condition.Type == ocsv1.ConditionExternalClusterConnected
+		}
+		setExternalClusterConnectionConditions(instance, rookReported)
+		// an additional external cluster has no CephCluster, it is connecting
+		// while none of its mons is reachable
+		if isAdditionalExternalStorageCluster(instance) && instance.Status.Phase == statusutil.PhaseReady &&
+			conditionsv1.IsStatusConditionTrue(instance.Status.Conditions, ocsv1.ConditionExternalClusterConnecting) {
+			instance.Status.Phase = statusutil.PhaseConnecting
+		}
+	}
+
 	// enable metrics exporter at the end of reconcile
 	// this allows storagecluster to be instantiated before
 	// scraping metrics
@@ -452,7 +501,23 @@ func (r *StorageClusterReconciler) reconcilePhases(
 		}
 	}
 
-	return reconcile.Result{}, nil
+	// come back to check the KMS and renew its token before it expires, to
+	// probe the external cluster and to refresh the uninstall report
+	now := time.Now()
+	return reconcile.Result{RequeueAfter: earliestRequeueAfter(getKMSRequeueAfter(instance, now),
+		getExternalProbeRequeueAfter(instance, now), getUninstallReportRequeueAfter(instance))}, nil
+}
+
+// earliestRequeueAfter returns the shortest of the given delays after which
+// the StorageCluster must be reconciled again, ignoring the ones which are 0
+func earliestRequeueAfter(delays ...time.Duration) time.Duration {
+	var earliest time.Duration
+	for _, delay := range delays {
+		if delay > 0 && (earliest == 0 || delay < earliest) {
+			earliest = delay
+		}
+	}
+	return earliest
 }
 
 // versionCheck populates the `.Spec.Version` field
@@ -487,7 +552,7 @@ func versionCheck(sc *ocsv1.StorageCluster, reqLogger logr.Logger) error {
 
 // validateStorageDeviceSets checks the StorageDeviceSets of the given
 // StorageCluster for completeness and correctness
-func (r *StorageClusterReconciler) validateStorageDeviceSets(sc *ocsv1.StorageCluster) error {
+func validateStorageDeviceSets(sc *ocsv1.StorageCluster) error {
 	for i, ds := range sc.Spec.StorageDeviceSets {
 		if ds.DataPVCTemplate.Spec.StorageClassName == nil || *ds.DataPVCTemplate.Spec.StorageClassName == "" {
 			return fmt.Errorf("failed to validate StorageDeviceSet %d: no StorageClass specified", i)
@@ -507,6 +572,65 @@ func (r *StorageClusterReconciler) validateStorageDeviceSets(sc *ocsv1.StorageCl
 				return fmt.Errorf("failed to validate DeviceType %q: no Device of this type", ds.DeviceType)
 			}
 		}
+		if err := validateStorageDeviceSetConfig(ds); err != nil {
+			return fmt.Errorf("failed to validate StorageDeviceSet %d: %v", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateStorageDeviceSetConfig checks that the OSD options of the
+// StorageDeviceSet are consistent with each other and with its resources
+func validateStorageDeviceSetConfig(ds ocsv1.StorageDeviceSet) error {
+	config := ds.Config
+	if config.OSDsPerDevice < 0 {
+		return fmt.Errorf("osdsPerDevice must be positive, got %d", config.OSDsPerDevice)
+	}
+	if config.MetadataDevice != "" && ds.MetadataPVCTemplate != nil {
+		return fmt.Errorf("metadataDevice can't be used along with a metadataPVCTemplate")
+	}
+
+	sizes := []struct {
+		name  string
+		value *resource.Quantity
+	}{
+		{"bluestoreCacheSize", config.BlueStoreCacheSize},
+		{"bluestoreCacheSizeHDD", config.BlueStoreCacheSizeHDD},
+		{"bluestoreCacheSizeSSD", config.BlueStoreCacheSizeSSD},
+		{"osdMemoryTarget", config.OSDMemoryTarget},
+	}
+	for _, size := range sizes {
+		if size.value != nil && size.value.Sign() <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", size.name, size.value.String())
+		}
+	}
+
+	resources := ds.Resources
+	if resources.Requests == nil && resources.Limits == nil {
+		resources = defaults.DaemonResources["osd"]
+	}
+	memoryLimit, hasMemoryLimit := resources.Limits[corev1.ResourceMemory]
+
+	// The BlueStore cache is part of the memory used by the OSD, so it must
+	// fit in the memory target, from which the memory limit is derived.
+	maxCacheSize, maxCacheSizeName := memoryLimit, "memory limit"
+	if config.OSDMemoryTarget != nil {
+		if config.OSDMemoryTarget.Cmp(minOSDMemoryTarget) < 0 {
+			return fmt.Errorf("osdMemoryTarget must be at least %s, got %s", minOSDMemoryTarget.String(), config.OSDMemoryTarget.String())
+		}
+		_, hasMemoryRequest := ds.Resources.Requests[corev1.ResourceMemory]
+		if _, found := ds.Resources.Limits[corev1.ResourceMemory]; found || hasMemoryRequest {
+			return fmt.Errorf("osdMemoryTarget can't be set along with a memory in the resources, the memory of the OSDs is derived from it")
+		}
+		maxCacheSize, maxCacheSizeName, hasMemoryLimit = *config.OSDMemoryTarget, "osdMemoryTarget", true
+	}
+	if hasMemoryLimit {
+		for _, size := range sizes[:3] {
+			if size.value != nil && size.value.Cmp(maxCacheSize) >= 0 {
+				return fmt.Errorf("%s %s must be lower than the %s %s", size.name, size.value.String(), maxCacheSizeName, maxCacheSize.String())
+			}
+		}
 	}
 
 	return nil
@@ -520,8 +644,14 @@ func (obj *ocsCephConfig) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.S
 		return nil
 	}
 
+	osds, err := r.getDeviceSetOSDs(sc)
+	if err != nil {
+		r.Log.Error(err, "Failed to get the OSDs of the StorageDeviceSets.", "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+		return err
+	}
+
 	found := &corev1.ConfigMap{}
-	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: rookConfigMapName, Namespace: sc.Namespace}, found)
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Name: rookConfigMapName, Namespace: sc.Namespace}, found)
 
 	if err == nil && reconcileStrategy == ReconcileStrategyInit {
 		return nil
@@ -533,6 +663,7 @@ func (obj *ocsCephConfig) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.S
 		Kind:       sc.Kind,
 		Name:       sc.Name,
 	}
+	configData := getCephConfigData(sc, osds)
 	cm := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            rookConfigMapName,
@@ -540,7 +671,7 @@ func (obj *ocsCephConfig) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.S
 			OwnerReferences: []metav1.OwnerReference{ownerRef},
 		},
 		Data: map[string]string{
-			"config": defaultRookConfigData,
+			"config": configData,
 		},
 	}
 
@@ -563,7 +694,7 @@ func (obj *ocsCephConfig) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.S
 		}
 	}
 	val, ok := found.Data["config"]
-	if !ok || val != defaultRookConfigData || !ownerRefFound {
+	if !ok || val != configData || !ownerRefFound {
 		r.Log.Info("Updating Ceph ConfigMap.", "ConfigMap", klog.KRef(sc.Namespace, cm.Name))
 		return r.Client.Update(context.TODO(), cm)
 	}
@@ -596,6 +727,11 @@ func (r *StorageClusterReconciler) isActiveStorageCluster(instance *ocsv1.Storag
 
 	// There are many StorageClusters. Check if this is Active
 	for n, storageCluster := range storageClusterList.Items {
+		// external StorageClusters with their own details are all active
+		if storageCluster.Spec.ExternalStorage.Enable && instance.Spec.ExternalStorage.Enable &&
+			getExternalClusterDetailsSecret(&storageCluster) != getExternalClusterDetailsSecret(instance) {
+			continue
+		}
 		if storageCluster.Status.Phase != statusutil.PhaseIgnored &&
 			storageCluster.ObjectMeta.Name != instance.ObjectMeta.Name {
 			// Both StorageClusters are in creation phase
@@ -627,6 +763,16 @@ func contains(slice []string, s string) bool {
 	return false
 }
 
+// hasLabels returns whether labels has all the given labels
+func hasLabels(labels, wanted map[string]string) bool {
+	for k, v := range wanted {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
 // Removes a given string from a slice and returns the new slice
 func remove(slice []string, s string) (result []string) {
 	for _, item := range slice {
@@ -643,8 +789,11 @@ func validateArbiterSpec(sc *ocsv1.StorageCluster, reqLogger logr.Logger) error
 	if sc.Spec.Arbiter.Enable && sc.Spec.FlexibleScaling {
 		return fmt.Errorf("arbiter and flexibleScaling both can't be enabled")
 	}
-	if sc.Spec.Arbiter.Enable && sc.Spec.NodeTopologies.ArbiterLocation == "" {
-		return fmt.Errorf("arbiter is set to enable but no arbiterLocation has been provided in the Spec.NodeTopologies.ArbiterLocation")
+	// the arbiterLocation is elected when it isn't set, but it can't be
+	// changed once the mons are placed
+	if election := sc.Status.ArbiterElection; sc.Spec.Arbiter.Enable && election != nil && election.MonsPlaced &&
+		sc.Spec.NodeTopologies != nil && sc.Spec.NodeTopologies.ArbiterLocation != "" && sc.Spec.NodeTopologies.ArbiterLocation != election.Zone {
+		return fmt.Errorf("arbiterLocation can't be changed from %s to %s once the mons are placed", election.Zone, sc.Spec.NodeTopologies.ArbiterLocation)
 	}
 	return nil
 }
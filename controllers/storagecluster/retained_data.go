@@ -0,0 +1,409 @@
+package storagecluster
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// AdoptRetainedDataAnnotation requests, when set to "true", a new
+	// StorageCluster to start the Ceph cluster a StorageCluster deleted with
+	// the retain cleanup policy left behind, instead of a new one
+	AdoptRetainedDataAnnotation = "uninstall.ocs.openshift.io/adopt-retained-data"
+
+	// retainedFSIDLabel is set on the retained PVCs to the fsid of their Ceph
+	// cluster, and retainedTypeLabel to their type
+	retainedFSIDLabel = "ocs.openshift.io/retained-fsid"
+	retainedTypeLabel = "ocs.openshift.io/retained-type"
+
+	// retainedDataSecret holds a copy of the Rook mon Secret, with the fsid
+	// and the keyrings of the Ceph cluster, and of the mon endpoints, which
+	// the mons need to start again on their retained data
+	retainedDataSecret         = "ocs-retained-cluster-data"
+	retainedMonEndpointsPrefix = "mon-endpoints."
+
+	rookMonSecret             = "rook-ceph-mon"
+	rookMonEndpointsConfigMap = "rook-ceph-mon-endpoints"
+
+	retainedOSD          = "osd"
+	retainedMon          = "mon"
+	retainedNooBaaDB     = "noobaa-db"
+	retainedNooBaaSecret = "noobaa-secret"
+
+	noobaaDBSecret            = "noobaa-db"
+	noobaaRootMasterKeySecret = "noobaa-root-master-key"
+)
+
+// noobaaRetainedSecrets are the NooBaa Secrets which are retained along with
+// the NooBaa DB PVC. The NooBaa operator reuses the ones it finds instead of
+// generating new ones, which is needed for the retained DB: its credentials
+// are in the noobaa-db Secret and the data it holds is encrypted with the
+// root master key, unless the key is kept in a KMS.
+var noobaaRetainedSecrets = []string{
+	noobaaDBSecret,
+	noobaaRootMasterKeySecret,
+	"noobaa-server",
+	"noobaa-operator",
+	"noobaa-admin",
+	"noobaa-endpoints",
+}
+
+// retainedPVCSelectors select the PVCs of each type which are retained along
+// with the Ceph cluster
+var retainedPVCSelectors = []struct {
+	pvcType  string
+	selector client.ListOption
+}{
+	{retainedOSD, client.HasLabels{"ceph.rook.io/DeviceSet"}},
+	{retainedMon, client.MatchingLabels{"app": "rook-ceph-mon"}},
+	{retainedNooBaaDB, client.MatchingLabels{"noobaa-core": "noobaa"}},
+}
+
+// retainClusterData keeps what a new StorageCluster needs to adopt the Ceph
+// cluster when the StorageCluster is deleted with the retain cleanup policy.
+// The OSD, mon and NooBaa DB PVCs and the NooBaa Secrets are labeled with the
+// fsid of the cluster and no longer owned by the CephCluster or the NooBaa
+// system, so that they are not garbage collected along with them, and the Rook
+// mon Secret and the mon endpoints are copied in a Secret which is not owned
+// either.
+func (r *StorageClusterReconciler) retainClusterData(sc *ocsv1.StorageCluster) (string, error) {
+	if sc.Spec.ExternalStorage.Enable || sc.GetAnnotations()[CleanupPolicyAnnotation] != string(CleanupPolicyRetain) {
+		return "", nil
+	}
+
+	monSecret := &corev1.Secret{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: rookMonSecret, Namespace: sc.Namespace}, monSecret)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// the Ceph cluster never started, or is already gone
+			r.Log.Info("Uninstall: No Ceph cluster to retain.", "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+			return "", nil
+		}
+		return "", fmt.Errorf("uninstall: Unable to retrieve the Rook mon Secret: %v", err)
+	}
+	fsid := string(monSecret.Data["fsid"])
+	monEndpoints := &corev1.ConfigMap{}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Name: rookMonEndpointsConfigMap, Namespace: sc.Namespace}, monEndpoints)
+	if err != nil && !errors.IsNotFound(err) {
+		return "", fmt.Errorf("uninstall: Unable to retrieve the mon endpoints: %v", err)
+	}
+
+	retained := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: retainedDataSecret, Namespace: sc.Namespace}}
+	_, err = controllerutil.CreateOrUpdate(context.TODO(), r.Client, retained, func() error {
+		retained.Labels = map[string]string{retainedFSIDLabel: fsid}
+		retained.Data = map[string][]byte{}
+		for key, value := range monSecret.Data {
+			retained.Data[key] = value
+		}
+		for key, value := range monEndpoints.Data {
+			retained.Data[retainedMonEndpointsPrefix+key] = []byte(value)
+		}
+		return nil
+	})
+	if err != nil {
+		r.Log.Error(err, "Uninstall: Unable to retain the Ceph cluster secrets.", "Secret", klog.KRef(sc.Namespace, retainedDataSecret))
+		return "", fmt.Errorf("uninstall: Unable to retain the Ceph cluster secrets: %v", err)
+	}
+
+	counts := map[string]int{}
+	for _, pvcs := range retainedPVCSelectors {
+		list := &corev1.PersistentVolumeClaimList{}
+		if err := r.Client.List(context.TODO(), list, client.InNamespace(sc.Namespace), pvcs.selector); err != nil {
+			return "", fmt.Errorf("uninstall: Unable to list the %s PVCs: %v", pvcs.pvcType, err)
+		}
+		for i := range list.Items {
+			pvc := &list.Items[i]
+			if pvc.Labels[retainedFSIDLabel] != fsid || len(pvc.OwnerReferences) > 0 {
+				r.Log.Info("Uninstall: Retaining PVC.", "PersistentVolumeClaim", klog.KRef(pvc.Namespace, pvc.Name), "Type", pvcs.pvcType)
+				pvc.Labels[retainedFSIDLabel] = fsid
+				pvc.Labels[retainedTypeLabel] = pvcs.pvcType
+				pvc.OwnerReferences = nil
+				if err := r.Client.Update(context.TODO(), pvc); err != nil {
+					return "", fmt.Errorf("uninstall: Unable to retain the PVC %s: %v", pvc.Name, err)
+				}
+			}
+			counts[pvcs.pvcType]++
+		}
+	}
+
+	for _, name := range noobaaRetainedSecrets {
+		secret := &corev1.Secret{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: sc.Namespace}, secret)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return "", fmt.Errorf("uninstall: Unable to retrieve the NooBaa Secret %s: %v", name, err)
+		}
+		if secret.Labels[retainedFSIDLabel] != fsid || len(secret.OwnerReferences) > 0 {
+			r.Log.Info("Uninstall: Retaining NooBaa Secret.", "Secret", klog.KRef(secret.Namespace, secret.Name))
+			if secret.Labels == nil {
+				secret.Labels = map[string]string{}
+			}
+			secret.Labels[retainedFSIDLabel] = fsid
+			secret.Labels[retainedTypeLabel] = retainedNooBaaSecret
+			secret.OwnerReferences = nil
+			if err := r.Client.Update(context.TODO(), secret); err != nil {
+				return "", fmt.Errorf("uninstall: Unable to retain the NooBaa Secret %s: %v", secret.Name, err)
+			}
+		}
+		counts[retainedNooBaaSecret]++
+	}
+	return fmt.Sprintf("Retained the Ceph cluster %s with %d OSD, %d mon and %d NooBaa DB PVCs and %d NooBaa Secrets",
+		fsid, counts[retainedOSD], counts[retainedMon], counts[retainedNooBaaDB], counts[retainedNooBaaSecret]), nil
+}
+
+type ocsRetainedData struct{}
+
+// ensureCreated validates the data retained by a deleted StorageCluster and
+// reconstructs the Rook mon Secret and the mon endpoints from it, when the
+// adoption is requested. The CephCluster depends on it and is only created
+// once the retained data is valid, Rook then starts the mons and the OSDs on
+// their retained PVCs.
+func (obj *ocsRetainedData) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	if sc.GetAnnotations()[AdoptRetainedDataAnnotation] != "true" {
+		sc.Status.RetainedData = nil
+		return nil
+	}
+	if sc.Status.RetainedData != nil && sc.Status.RetainedData.Phase == ocsv1.RetainedDataAdopted {
+		return nil
+	}
+
+	status, err := r.adoptRetainedData(sc)
+	if err != nil {
+		r.Log.Error(err, "Unable to adopt the retained data.", "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+		r.recorder.ReportIfNotPresent(sc, corev1.EventTypeWarning, statusutil.EventReasonRetainedDataInvalid, err.Error())
+		if status == nil {
+			status = &ocsv1.RetainedDataStatus{}
+		}
+		status.Phase = ocsv1.RetainedDataInvalid
+		status.Message = err.Error()
+		sc.Status.RetainedData = status
+		return err
+	}
+	if status.Phase == ocsv1.RetainedDataAdopted {
+		r.Log.Info("Adopted the retained Ceph cluster.", "FSID", status.FSID, "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+		r.recorder.Report(sc, corev1.EventTypeNormal, statusutil.EventReasonRetainedDataAdopted,
+			fmt.Sprintf("Adopted the retained Ceph cluster %s", status.FSID))
+	}
+	sc.Status.RetainedData = status
+	return nil
+}
+
+// ensureDeleted is a no-op, the retained data is retained or deleted by the
+// uninstall steps
+func (obj *ocsRetainedData) ensureDeleted(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	return nil
+}
+
+// adoptRetainedData validates the retained Secret and PVCs, and reconstructs
+// the Rook mon Secret and the mon endpoints until the CephCluster is ready
+func (r *StorageClusterReconciler) adoptRetainedData(sc *ocsv1.StorageCluster) (*ocsv1.RetainedDataStatus, error) {
+	retained := &corev1.Secret{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: retainedDataSecret, Namespace: sc.Namespace}, retained)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Errorf("no retained Ceph cluster found, the Secret %s does not exist", retainedDataSecret)
+		}
+		return nil, fmt.Errorf("failed to get the Secret %s: %v", retainedDataSecret, err)
+	}
+	if err := validateRetainedSecret(retained); err != nil {
+		return nil, err
+	}
+	fsid := string(retained.Data["fsid"])
+	status := &ocsv1.RetainedDataStatus{Phase: ocsv1.RetainedDataValidated, FSID: fsid}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.Client.List(context.TODO(), pvcs, client.InNamespace(sc.Namespace), client.HasLabels{retainedFSIDLabel}); err != nil {
+		return status, fmt.Errorf("failed to list the retained PVCs: %v", err)
+	}
+	osdsBySet := map[string]int{}
+	noobaaDB := false
+	for _, pvc := range pvcs.Items {
+		if pvcFSID := pvc.Labels[retainedFSIDLabel]; pvcFSID != fsid {
+			return status, fmt.Errorf("the PVC %s was retained from the Ceph cluster %s, not %s", pvc.Name, pvcFSID, fsid)
+		}
+		pvcType := pvc.Labels[retainedTypeLabel]
+		if pvcType == retainedOSD {
+			osdsBySet[pvc.Labels["ceph.rook.io/DeviceSet"]]++
+		} else if pvcType == retainedNooBaaDB {
+			noobaaDB = true
+		}
+		status.PersistentVolumeClaims = append(status.PersistentVolumeClaims, ocsv1.RetainedPersistentVolumeClaim{Name: pvc.Name, Type: pvcType})
+	}
+	if len(osdsBySet) == 0 {
+		return status, fmt.Errorf("no retained OSD PVC of the Ceph cluster %s found", fsid)
+	}
+	for deviceSet, count := range osdsBySet {
+		if err := validateRetainedDeviceSet(sc, deviceSet, count); err != nil {
+			return status, err
+		}
+	}
+
+	if noobaaDB {
+		secrets, err := r.getRetainedNooBaaSecrets(sc, fsid)
+		if err != nil {
+			return status, err
+		}
+		status.Secrets = secrets
+	}
+
+	if err := r.restoreRookMonSecret(sc, retained); err != nil {
+		return status, err
+	}
+	if err := r.restoreMonEndpoints(sc, retained); err != nil {
+		return status, err
+	}
+
+	cephCluster := &cephv1.CephCluster{}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephCluster(sc), Namespace: sc.Namespace}, cephCluster)
+	if err == nil && cephCluster.Status.Phase == cephv1.ConditionReady {
+		status.Phase = ocsv1.RetainedDataAdopted
+	} else if err != nil && !errors.IsNotFound(err) {
+		return status, fmt.Errorf("failed to get the CephCluster: %v", err)
+	}
+	return status, nil
+}
+
+// getRetainedNooBaaSecrets checks that the NooBaa Secrets the retained NooBaa
+// DB can't be used without are retained too, and returns the names of the
+// retained ones. They are left as they are, for the NooBaa operator to reuse
+// them once the NooBaa system is created again.
+func (r *StorageClusterReconciler) getRetainedNooBaaSecrets(sc *ocsv1.StorageCluster, fsid string) ([]string, error) {
+	required := map[string]bool{noobaaDBSecret: true}
+	if !sc.Spec.Encryption.KeyManagementService.Enable {
+		// the root master key is only kept in a Secret when there is no KMS
+		required[noobaaRootMasterKeySecret] = true
+	}
+
+	var names []string
+	for _, name := range noobaaRetainedSecrets {
+		secret := &corev1.Secret{}
+		err := r.Client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: sc.Namespace}, secret)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				if required[name] {
+					return nil, fmt.Errorf("the NooBaa DB PVC is retained, but not the Secret %s", name)
+				}
+				continue
+			}
+			return nil, fmt.Errorf("failed to get the NooBaa Secret %s: %v", name, err)
+		}
+		if secretFSID := secret.Labels[retainedFSIDLabel]; secretFSID != fsid {
+			return nil, fmt.Errorf("the Secret %s was not retained from the Ceph cluster %s", name, fsid)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// validateRetainedSecret checks the fsid and the keyrings of the retained
+// Ceph cluster
+func validateRetainedSecret(retained *corev1.Secret) error {
+	var invalid []string
+	if !fsidRegexp.MatchString(string(retained.Data["fsid"])) {
+		invalid = append(invalid, "fsid must be a UUID")
+	}
+	for _, key := range []string{"mon-secret", "admin-secret"} {
+		keyring := retained.Data[key]
+		if len(keyring) == 0 {
+			invalid = append(invalid, fmt.Sprintf("%s is missing", key))
+		} else if _, err := base64.StdEncoding.DecodeString(string(keyring)); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s must be a base64 encoded Ceph key", key))
+		}
+	}
+	if len(retained.Data[retainedMonEndpointsPrefix+"data"]) == 0 {
+		invalid = append(invalid, "the mon endpoints are missing")
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("the Secret %s is invalid: %s", retainedDataSecret, strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// validateRetainedDeviceSet checks that the StorageCluster has the device set
+// of the retained OSD PVCs, with room for all of them
+func validateRetainedDeviceSet(sc *ocsv1.StorageCluster, name string, count int) error {
+	for _, deviceSet := range sc.Spec.StorageDeviceSets {
+		if deviceSet.Name != name {
+			continue
+		}
+		if size := deviceSet.Count * deviceSet.Replica; size < count {
+			return fmt.Errorf("the device set %s has %d OSDs, %d OSD PVCs of it are retained", name, size, count)
+		}
+		return nil
+	}
+	return fmt.Errorf("the device set %s of the retained OSD PVCs is not in the StorageCluster", name)
+}
+
+// restoreRookMonSecret creates the Rook mon Secret from the retained one, so
+// that Rook starts the Ceph cluster with its fsid and keyrings instead of
+// creating a new one
+func (r *StorageClusterReconciler) restoreRookMonSecret(sc *ocsv1.StorageCluster, retained *corev1.Secret) error {
+	monSecret := &corev1.Secret{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: rookMonSecret, Namespace: sc.Namespace}, monSecret)
+	if err == nil {
+		if fsid := string(monSecret.Data["fsid"]); fsid != string(retained.Data["fsid"]) {
+			return fmt.Errorf("the Ceph cluster %s already exists in the namespace, instead of the retained %s", fsid, retained.Data["fsid"])
+		}
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get the Rook mon Secret: %v", err)
+	}
+
+	monSecret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: rookMonSecret, Namespace: sc.Namespace},
+		Type:       "kubernetes.io/rook",
+		Data:       map[string][]byte{},
+	}
+	for key, value := range retained.Data {
+		if !strings.HasPrefix(key, retainedMonEndpointsPrefix) {
+			monSecret.Data[key] = value
+		}
+	}
+	r.Log.Info("Restoring the Rook mon Secret of the retained Ceph cluster.", "Secret", klog.KRef(sc.Namespace, rookMonSecret))
+	if err := r.Client.Create(context.TODO(), monSecret); err != nil {
+		return fmt.Errorf("failed to create the Rook mon Secret: %v", err)
+	}
+	return nil
+}
+
+// restoreMonEndpoints creates the mon endpoints ConfigMap from the retained
+// Secret, so that the mons start again with their IDs and retained PVCs
+func (r *StorageClusterReconciler) restoreMonEndpoints(sc *ocsv1.StorageCluster, retained *corev1.Secret) error {
+	monEndpoints := &corev1.ConfigMap{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: rookMonEndpointsConfigMap, Namespace: sc.Namespace}, monEndpoints)
+	if err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get the mon endpoints: %v", err)
+	}
+
+	monEndpoints = &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: rookMonEndpointsConfigMap, Namespace: sc.Namespace},
+		Data:       map[string]string{},
+	}
+	for key, value := range retained.Data {
+		if strings.HasPrefix(key, retainedMonEndpointsPrefix) {
+			monEndpoints.Data[strings.TrimPrefix(key, retainedMonEndpointsPrefix)] = string(value)
+		}
+	}
+	r.Log.Info("Restoring the mon endpoints of the retained Ceph cluster.", "ConfigMap", klog.KRef(sc.Namespace, rookMonEndpointsConfigMap))
+	if err := r.Client.Create(context.TODO(), monEndpoints); err != nil {
+		return fmt.Errorf("failed to create the mon endpoints: %v", err)
+	}
+	return nil
+}
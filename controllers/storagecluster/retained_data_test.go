@@ -0,0 +1,258 @@
+package storagecluster
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const retainedTestFSID = "b5f2c3a4-1d2e-4f5a-8b9c-0d1e2f3a4b5c"
+
+func newRetainedTestPVC(name string, labels map[string]string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       "openshift-storage",
+		Labels:          labels,
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: "ceph.rook.io/v1", Kind: "CephCluster", Name: "ocsinit-cephcluster", UID: "1234"}},
+	}}
+}
+
+func TestRetainClusterData(t *testing.T) {
+	objs := []runtime.Object{
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: rookMonSecret, Namespace: "openshift-storage"},
+			Data: map[string][]byte{
+				"fsid":         []byte(retainedTestFSID),
+				"mon-secret":   []byte("QVFCMm9uU2VjcmV0S2V5MTIzNDU2Nzg5MA=="),
+				"admin-secret": []byte("QVFCYWRtaW5TZWNyZXRLZXkxMjM0NTY3OA=="),
+			},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: rookMonEndpointsConfigMap, Namespace: "openshift-storage"},
+			Data:       map[string]string{"data": "a=10.0.0.1:6789", "maxMonId": "0"},
+		},
+		newRetainedTestPVC("ocs-deviceset-0-data-0abcd", map[string]string{"ceph.rook.io/DeviceSet": "ocs-deviceset"}),
+		newRetainedTestPVC("rook-ceph-mon-a", map[string]string{"app": "rook-ceph-mon"}),
+		newRetainedTestPVC("db-noobaa-db-pg-0", map[string]string{"noobaa-core": "noobaa"}),
+		newRetainedTestPVC("unrelated", map[string]string{"app": "other"}),
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:            noobaaDBSecret,
+			Namespace:       "openshift-storage",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "noobaa.io/v1alpha1", Kind: "NooBaa", Name: "noobaa", UID: "5678"}},
+		}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:            noobaaRootMasterKeySecret,
+			Namespace:       "openshift-storage",
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "noobaa.io/v1alpha1", Kind: "NooBaa", Name: "noobaa", UID: "5678"}},
+		}},
+	}
+	reconciler := createFakeStorageClusterReconciler(t, objs...)
+
+	// nothing is retained with the delete cleanup policy
+	sc := createDefaultStorageCluster()
+	sc.Namespace = "openshift-storage"
+	sc.Annotations = map[string]string{CleanupPolicyAnnotation: string(CleanupPolicyDelete)}
+	sc.Spec.StorageDeviceSets = []api.StorageDeviceSet{{Name: "ocs-deviceset", Count: 1, Replica: 3}}
+	outcome, err := reconciler.retainClusterData(sc)
+	assert.NoError(t, err)
+	assert.Empty(t, outcome)
+
+	sc.Annotations[CleanupPolicyAnnotation] = string(CleanupPolicyRetain)
+	outcome, err = reconciler.retainClusterData(sc)
+	assert.NoError(t, err)
+	assert.Equal(t, "Retained the Ceph cluster "+retainedTestFSID+" with 1 OSD, 1 mon and 1 NooBaa DB PVCs and 2 NooBaa Secrets", outcome)
+
+	retained := &corev1.Secret{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: retainedDataSecret, Namespace: sc.Namespace}, retained))
+	assert.Empty(t, retained.OwnerReferences)
+	assert.Equal(t, retainedTestFSID, string(retained.Data["fsid"]))
+	assert.Equal(t, "a=10.0.0.1:6789", string(retained.Data[retainedMonEndpointsPrefix+"data"]))
+	assert.NoError(t, validateRetainedSecret(retained))
+
+	for name, expected := range map[string]string{
+		"ocs-deviceset-0-data-0abcd": retainedOSD,
+		"rook-ceph-mon-a":            retainedMon,
+		"db-noobaa-db-pg-0":          retainedNooBaaDB,
+		"unrelated":                  "",
+	} {
+		pvc := &corev1.PersistentVolumeClaim{}
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: sc.Namespace}, pvc))
+		assert.Equalf(t, expected, pvc.Labels[retainedTypeLabel], "PVC %s", name)
+		if expected != "" {
+			assert.Equalf(t, retainedTestFSID, pvc.Labels[retainedFSIDLabel], "PVC %s", name)
+			assert.Emptyf(t, pvc.OwnerReferences, "PVC %s", name)
+		} else {
+			assert.NotEmpty(t, pvc.OwnerReferences)
+		}
+	}
+	for _, name := range []string{noobaaDBSecret, noobaaRootMasterKeySecret} {
+		secret := &corev1.Secret{}
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: sc.Namespace}, secret))
+		assert.Equalf(t, retainedTestFSID, secret.Labels[retainedFSIDLabel], "Secret %s", name)
+		assert.Equalf(t, retainedNooBaaSecret, secret.Labels[retainedTypeLabel], "Secret %s", name)
+		assert.Emptyf(t, secret.OwnerReferences, "Secret %s", name)
+	}
+}
+
+func TestAdoptRetainedData(t *testing.T) {
+	newRetainedSecret := func(fsid string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: retainedDataSecret, Namespace: "openshift-storage"},
+			Data: map[string][]byte{
+				"fsid":                                  []byte(fsid),
+				"mon-secret":                            []byte("QVFCMm9uU2VjcmV0S2V5MTIzNDU2Nzg5MA=="),
+				"admin-secret":                          []byte("QVFCYWRtaW5TZWNyZXRLZXkxMjM0NTY3OA=="),
+				retainedMonEndpointsPrefix + "data":     []byte("a=10.0.0.1:6789"),
+				retainedMonEndpointsPrefix + "maxMonId": []byte("0"),
+			},
+		}
+	}
+	newRetainedPVC := func(name, pvcType, fsid, deviceSet string) *corev1.PersistentVolumeClaim {
+		pvc := newRetainedTestPVC(name, map[string]string{retainedFSIDLabel: fsid, retainedTypeLabel: pvcType})
+		pvc.OwnerReferences = nil
+		if deviceSet != "" {
+			pvc.Labels["ceph.rook.io/DeviceSet"] = deviceSet
+		}
+		return pvc
+	}
+	newRetainedNooBaaSecret := func(name, fsid string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "openshift-storage",
+			Labels:    map[string]string{retainedFSIDLabel: fsid, retainedTypeLabel: retainedNooBaaSecret},
+		}}
+	}
+	otherFSID := "0f0e0d0c-0b0a-4908-8706-050403020100"
+
+	testcases := []struct {
+		label   string
+		objs    []runtime.Object
+		invalid bool
+		pvcs    int
+		secrets []string
+	}{
+		{
+			label:   "Case 1: no retained cluster",
+			objs:    []runtime.Object{newRetainedPVC("ocs-deviceset-0-data-0abcd", retainedOSD, retainedTestFSID, "ocs-deviceset")},
+			invalid: true,
+		},
+		{
+			label:   "Case 2: invalid fsid",
+			objs:    []runtime.Object{newRetainedSecret("not-a-uuid"), newRetainedPVC("ocs-deviceset-0-data-0abcd", retainedOSD, "not-a-uuid", "ocs-deviceset")},
+			invalid: true,
+		},
+		{
+			label:   "Case 3: no retained OSD",
+			objs:    []runtime.Object{newRetainedSecret(retainedTestFSID), newRetainedPVC("rook-ceph-mon-a", retainedMon, retainedTestFSID, "")},
+			invalid: true,
+		},
+		{
+			label: "Case 4: PVC of another cluster",
+			objs: []runtime.Object{newRetainedSecret(retainedTestFSID),
+				newRetainedPVC("ocs-deviceset-0-data-0abcd", retainedOSD, retainedTestFSID, "ocs-deviceset"),
+				newRetainedPVC("ocs-deviceset-1-data-0abcd", retainedOSD, otherFSID, "ocs-deviceset")},
+			invalid: true,
+		},
+		{
+			label:   "Case 5: device set not in the StorageCluster",
+			objs:    []runtime.Object{newRetainedSecret(retainedTestFSID), newRetainedPVC("other-0-data-0abcd", retainedOSD, retainedTestFSID, "other")},
+			invalid: true,
+		},
+		{
+			label: "Case 6: another Ceph cluster exists",
+			objs: []runtime.Object{newRetainedSecret(retainedTestFSID),
+				newRetainedPVC("ocs-deviceset-0-data-0abcd", retainedOSD, retainedTestFSID, "ocs-deviceset"),
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: rookMonSecret, Namespace: "openshift-storage"},
+					Data:       map[string][]byte{"fsid": []byte(otherFSID)},
+				}},
+			invalid: true,
+		},
+		{
+			label: "Case 7: valid retained cluster",
+			objs: []runtime.Object{newRetainedSecret(retainedTestFSID),
+				newRetainedPVC("ocs-deviceset-0-data-0abcd", retainedOSD, retainedTestFSID, "ocs-deviceset"),
+				newRetainedPVC("rook-ceph-mon-a", retainedMon, retainedTestFSID, "")},
+			pvcs: 2,
+		},
+		{
+			label: "Case 8: NooBaa DB without the root master key",
+			objs: []runtime.Object{newRetainedSecret(retainedTestFSID),
+				newRetainedPVC("ocs-deviceset-0-data-0abcd", retainedOSD, retainedTestFSID, "ocs-deviceset"),
+				newRetainedPVC("db-noobaa-db-pg-0", retainedNooBaaDB, retainedTestFSID, ""),
+				newRetainedNooBaaSecret(noobaaDBSecret, retainedTestFSID)},
+			invalid: true,
+		},
+		{
+			label: "Case 9: NooBaa Secret of another cluster",
+			objs: []runtime.Object{newRetainedSecret(retainedTestFSID),
+				newRetainedPVC("ocs-deviceset-0-data-0abcd", retainedOSD, retainedTestFSID, "ocs-deviceset"),
+				newRetainedPVC("db-noobaa-db-pg-0", retainedNooBaaDB, retainedTestFSID, ""),
+				newRetainedNooBaaSecret(noobaaDBSecret, retainedTestFSID),
+				newRetainedNooBaaSecret(noobaaRootMasterKeySecret, otherFSID)},
+			invalid: true,
+		},
+		{
+			label: "Case 10: valid retained cluster with NooBaa",
+			objs: []runtime.Object{newRetainedSecret(retainedTestFSID),
+				newRetainedPVC("ocs-deviceset-0-data-0abcd", retainedOSD, retainedTestFSID, "ocs-deviceset"),
+				newRetainedPVC("rook-ceph-mon-a", retainedMon, retainedTestFSID, ""),
+				newRetainedPVC("db-noobaa-db-pg-0", retainedNooBaaDB, retainedTestFSID, ""),
+				newRetainedNooBaaSecret(noobaaDBSecret, retainedTestFSID),
+				newRetainedNooBaaSecret(noobaaRootMasterKeySecret, retainedTestFSID),
+				newRetainedNooBaaSecret("noobaa-admin", retainedTestFSID)},
+			pvcs:    3,
+			secrets: []string{noobaaDBSecret, noobaaRootMasterKeySecret, "noobaa-admin"},
+		},
+	}
+
+	for _, tc := range testcases {
+		reconciler := createFakeStorageClusterReconciler(t, tc.objs...)
+		sc := createDefaultStorageCluster()
+		sc.Namespace = "openshift-storage"
+		sc.Annotations = map[string]string{AdoptRetainedDataAnnotation: "true"}
+		sc.Spec.StorageDeviceSets = []api.StorageDeviceSet{{Name: "ocs-deviceset", Count: 1, Replica: 3}}
+		obj := &ocsRetainedData{}
+		err := obj.ensureCreated(&reconciler, sc)
+		if tc.invalid {
+			assert.Errorf(t, err, "[%s]: invalid retained data is adopted", tc.label)
+			if assert.NotNilf(t, sc.Status.RetainedData, "[%s]", tc.label) {
+				assert.Equalf(t, api.RetainedDataInvalid, sc.Status.RetainedData.Phase, "[%s]", tc.label)
+				assert.NotEmptyf(t, sc.Status.RetainedData.Message, "[%s]", tc.label)
+			}
+			continue
+		}
+
+		assert.NoErrorf(t, err, "[%s]", tc.label)
+		assert.Equal(t, api.RetainedDataValidated, sc.Status.RetainedData.Phase)
+		assert.Equal(t, retainedTestFSID, sc.Status.RetainedData.FSID)
+		assert.Lenf(t, sc.Status.RetainedData.PersistentVolumeClaims, tc.pvcs, "[%s]", tc.label)
+		assert.Equalf(t, tc.secrets, sc.Status.RetainedData.Secrets, "[%s]", tc.label)
+		monSecret := &corev1.Secret{}
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: rookMonSecret, Namespace: sc.Namespace}, monSecret))
+		assert.Equal(t, retainedTestFSID, string(monSecret.Data["fsid"]))
+		assert.NotContains(t, monSecret.Data, retainedMonEndpointsPrefix+"data")
+		monEndpoints := &corev1.ConfigMap{}
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: rookMonEndpointsConfigMap, Namespace: sc.Namespace}, monEndpoints))
+		assert.Equal(t, map[string]string{"data": "a=10.0.0.1:6789", "maxMonId": "0"}, monEndpoints.Data)
+
+		// the data is adopted once the CephCluster is ready
+		cephCluster := &cephv1.CephCluster{ObjectMeta: metav1.ObjectMeta{Name: generateNameForCephCluster(sc), Namespace: sc.Namespace}}
+		cephCluster.Status.Phase = cephv1.ConditionReady
+		assert.NoError(t, reconciler.Client.Create(context.TODO(), cephCluster))
+		assert.NoError(t, obj.ensureCreated(&reconciler, sc))
+		assert.Equal(t, api.RetainedDataAdopted, sc.Status.RetainedData.Phase)
+
+		// and the status is removed along with the annotation
+		delete(sc.Annotations, AdoptRetainedDataAnnotation)
+		assert.NoError(t, obj.ensureCreated(&reconciler, sc))
+		assert.Nil(t, sc.Status.RetainedData)
+	}
+}
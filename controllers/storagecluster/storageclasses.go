@@ -31,6 +31,20 @@ func (obj *ocsStorageClass) ensureCreated(r *StorageClusterReconciler, instance
 		return err
 	}
 
+	if instance.Spec.Encryption.StorageClass {
+		kmsConfigMap, err := getKMSConfigMap(KMSConfigMapName, instance, r.Client)
+		if err != nil {
+			r.Log.Error(err, "Failed to get the KMS ConfigMap of the encrypted StorageClass.", "KMSConfigMap", klog.KRef(instance.Namespace, KMSConfigMapName))
+			return err
+		}
+		if err = r.ensureCSIKMSConnectionDetails(instance, kmsConfigMap); err != nil {
+			r.Log.Error(err, "Failed to configure the KMS for ceph-csi.", "ConfigMap", klog.KRef(instance.Namespace, CSIKMSConfigMapName))
+			return err
+		}
+	} else if err = r.deleteEncryptedStorageClass(instance); err != nil {
+		return err
+	}
+
 	err = r.createStorageClasses(scs)
 	if err != nil {
 		return err
@@ -76,6 +90,30 @@ func (obj *ocsStorageClass) ensureDeleted(r *StorageClusterReconciler, instance
 	return nil
 }
 
+// deleteEncryptedStorageClass deletes the encrypted StorageClass once it is
+// disabled. The volumes it provisioned are left as they are, and so is the
+// configuration of the KMS in the CSI KMS ConfigMap, which ceph-csi still
+// needs to unlock them.
+func (r *StorageClusterReconciler) deleteEncryptedStorageClass(instance *ocsv1.StorageCluster) error {
+	existing := &storagev1.StorageClass{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForEncryptedCephBlockPoolSC(instance)}, existing)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if existing.Parameters["encrypted"] != "true" || existing.DeletionTimestamp != nil {
+		return nil
+	}
+	r.Log.Info("Deleting the disabled encrypted StorageClass.", "StorageClass", klog.KRef("", existing.Name))
+	if err = r.Client.Delete(context.TODO(), existing); err != nil && !errors.IsNotFound(err) {
+		r.Log.Error(err, "Failed to delete StorageClass.", "StorageClass", klog.KRef("", existing.Name))
+		return err
+	}
+	return nil
+}
+
 func (r *StorageClusterReconciler) createStorageClasses(sccs []StorageClassConfiguration) error {
 	for _, scc := range sccs {
 		if scc.reconcileStrategy == ReconcileStrategyIgnore || scc.disable {
@@ -116,6 +154,17 @@ func (r *StorageClusterReconciler) createStorageClasses(sccs []StorageClassConfi
 					r.Log.Info("Failed to craete StorageClass.", "StorageClass", klog.KRef(sc.Namespace, sc.Name))
 					return err
 				}
+			} else if !hasLabels(existing.Labels, sc.Labels) {
+				if existing.Labels == nil {
+					existing.Labels = map[string]string{}
+				}
+				for k, v := range sc.Labels {
+					existing.Labels[k] = v
+				}
+				r.Log.Info("Labeling StorageClass.", "StorageClass", klog.KRef(sc.Namespace, existing.Name))
+				if err = r.Client.Update(context.TODO(), existing); err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -140,13 +189,13 @@ func newCephFilesystemStorageClassConfiguration(initData *ocsv1.StorageCluster)
 			// AllowVolumeExpansion is set to true to enable expansion of OCS backed Volumes
 			AllowVolumeExpansion: &allowVolumeExpansion,
 			Parameters: map[string]string{
-				"clusterID": initData.Namespace,
-				"fsName":    fmt.Sprintf("%s-cephfilesystem", initData.Name),
-				"csi.storage.k8s.io/provisioner-secret-name":            "rook-csi-cephfs-provisioner",
+				"clusterID": generateNameForCSIClusterID(initData),
+				"fsName":    generateNameForCephFilesystem(initData),
+				"csi.storage.k8s.io/provisioner-secret-name":            generateNameForCSISecret(initData, externalCephFSProvisionerSecret),
 				"csi.storage.k8s.io/provisioner-secret-namespace":       initData.Namespace,
-				"csi.storage.k8s.io/node-stage-secret-name":             "rook-csi-cephfs-node",
+				"csi.storage.k8s.io/node-stage-secret-name":             generateNameForCSISecret(initData, externalCephFSNodeSecret),
 				"csi.storage.k8s.io/node-stage-secret-namespace":        initData.Namespace,
-				"csi.storage.k8s.io/controller-expand-secret-name":      "rook-csi-cephfs-provisioner",
+				"csi.storage.k8s.io/controller-expand-secret-name":      generateNameForCSISecret(initData, externalCephFSProvisionerSecret),
 				"csi.storage.k8s.io/controller-expand-secret-namespace": initData.Namespace,
 			},
 		},
@@ -155,6 +204,34 @@ func newCephFilesystemStorageClassConfiguration(initData *ocsv1.StorageCluster)
 	}
 }
 
+// newAdditionalCephFilesystemStorageClassConfiguration generates configuration options for the StorageClass of an
+// additional Ceph Filesystem.
+func newAdditionalCephFilesystemStorageClassConfiguration(initData *ocsv1.StorageCluster, fs ocsv1.AdditionalFilesystemSpec) StorageClassConfiguration {
+	scc := newCephFilesystemStorageClassConfiguration(initData)
+	scc.storageClass.Name = generateNameForAdditionalCephFilesystemSC(initData, fs.Name)
+	scc.storageClass.Parameters["fsName"] = generateNameForAdditionalCephFilesystem(initData, fs.Name)
+	scc.disable = scc.disable || fs.DisableStorageClass
+	return scc
+}
+
+// newCephFilesystemDataPoolStorageClassConfigurations generates configuration options for the StorageClasses of the
+// additional data pools of a Ceph Filesystem, based on the StorageClass of the filesystem.
+func newCephFilesystemDataPoolStorageClassConfigurations(initData *ocsv1.StorageCluster, fsConfig StorageClassConfiguration, dataPools []ocsv1.FilesystemDataPoolSpec) []StorageClassConfiguration {
+	var ret []StorageClassConfiguration
+	for i, pool := range dataPools {
+		storageClass := fsConfig.storageClass.DeepCopy()
+		storageClass.Name = fmt.Sprintf("%s-%s", fsConfig.storageClass.Name, pool.Name)
+		// the first data pool is the default one of the filesystem
+		storageClass.Parameters["pool"] = generateNameForCephFilesystemDataPool(storageClass.Parameters["fsName"], i+1)
+		ret = append(ret, StorageClassConfiguration{
+			storageClass:      storageClass,
+			reconcileStrategy: fsConfig.reconcileStrategy,
+			disable:           initData.Spec.ManagedResources.CephFilesystems.DisableStorageClass || pool.DisableStorageClass,
+		})
+	}
+	return ret
+}
+
 // newCephBlockPoolStorageClassConfiguration generates configuration options for a Ceph Block Pool StorageClass.
 func newCephBlockPoolStorageClassConfiguration(initData *ocsv1.StorageCluster, thickProvision bool) StorageClassConfiguration {
 	thickProvisionStr := "false"
@@ -180,17 +257,17 @@ func newCephBlockPoolStorageClassConfiguration(initData *ocsv1.StorageCluster, t
 			// AllowVolumeExpansion is set to true to enable expansion of OCS backed Volumes
 			AllowVolumeExpansion: &allowVolumeExpansion,
 			Parameters: map[string]string{
-				"clusterID":                 initData.Namespace,
+				"clusterID":                 generateNameForCSIClusterID(initData),
 				"pool":                      generateNameForCephBlockPool(initData),
 				"imageFeatures":             "layering",
 				"csi.storage.k8s.io/fstype": "ext4",
 				"imageFormat":               "2",
 				"thickProvision":            thickProvisionStr,
-				"csi.storage.k8s.io/provisioner-secret-name":            "rook-csi-rbd-provisioner",
+				"csi.storage.k8s.io/provisioner-secret-name":            generateNameForCSISecret(initData, externalRBDProvisionerSecret),
 				"csi.storage.k8s.io/provisioner-secret-namespace":       initData.Namespace,
-				"csi.storage.k8s.io/node-stage-secret-name":             "rook-csi-rbd-node",
+				"csi.storage.k8s.io/node-stage-secret-name":             generateNameForCSISecret(initData, externalRBDNodeSecret),
 				"csi.storage.k8s.io/node-stage-secret-namespace":        initData.Namespace,
-				"csi.storage.k8s.io/controller-expand-secret-name":      "rook-csi-rbd-provisioner",
+				"csi.storage.k8s.io/controller-expand-secret-name":      generateNameForCSISecret(initData, externalRBDProvisionerSecret),
 				"csi.storage.k8s.io/controller-expand-secret-namespace": initData.Namespace,
 			},
 		},
@@ -199,6 +276,63 @@ func newCephBlockPoolStorageClassConfiguration(initData *ocsv1.StorageCluster, t
 	}
 }
 
+// newAdditionalCephBlockPoolStorageClassConfiguration generates configuration options for the StorageClass of an
+// additional Ceph Block Pool.
+func newAdditionalCephBlockPoolStorageClassConfiguration(initData *ocsv1.StorageCluster, pool ocsv1.AdditionalBlockPoolSpec) StorageClassConfiguration {
+	scc := newCephBlockPoolStorageClassConfiguration(initData, false)
+	scc.storageClass.Name = generateNameForCephBlockPoolSC(initData, "-"+pool.Name)
+	scc.storageClass.Parameters["pool"] = generateNameForAdditionalCephBlockPool(initData, pool.Name)
+	if pool.ErasureCoded != nil {
+		// RBD keeps the image metadata in a replicated pool
+		scc.storageClass.Parameters["pool"] = generateNameForAdditionalCephBlockPoolMetadata(initData, pool.Name)
+		scc.storageClass.Parameters["dataPool"] = generateNameForAdditionalCephBlockPool(initData, pool.Name)
+	}
+	scc.disable = scc.disable || pool.DisableStorageClass
+	return scc
+}
+
+// newEncryptedCephBlockPoolStorageClassConfiguration generates configuration options for the StorageClass whose RBD
+// volumes are encrypted by ceph-csi with keys stored in the KMS identified by kmsID.
+func newEncryptedCephBlockPoolStorageClassConfiguration(initData *ocsv1.StorageCluster, kmsID string) StorageClassConfiguration {
+	scc := newCephBlockPoolStorageClassConfiguration(initData, false)
+	scc.storageClass.Name = generateNameForEncryptedCephBlockPoolSC(initData)
+	scc.storageClass.Annotations["description"] = "Provides encrypted RWO Filesystem volumes, and RWO and RWX Block volumes"
+	scc.storageClass.Parameters["encrypted"] = "true"
+	scc.storageClass.Parameters["encryptionKMSID"] = kmsID
+	return scc
+}
+
+// newTenantStorageClassConfiguration generates configuration options for the StorageClass of a tenant, based on the
+// StorageClass of the filesystem or of the pool holding the tenant. The clusterID is left to the caller.
+func newTenantStorageClassConfiguration(initData *ocsv1.StorageCluster, tenant ocsv1.TenantSpec) StorageClassConfiguration {
+	var scc StorageClassConfiguration
+	if tenant.Type == ocsv1.TenantTypeCephFS {
+		scc = newCephFilesystemStorageClassConfiguration(initData)
+		for _, fs := range initData.Spec.ManagedResources.CephFilesystems.AdditionalFilesystems {
+			if fs.Name == tenant.Filesystem {
+				scc = newAdditionalCephFilesystemStorageClassConfiguration(initData, fs)
+			}
+		}
+	} else {
+		scc = newCephBlockPoolStorageClassConfiguration(initData, false)
+		for _, pool := range initData.Spec.ManagedResources.CephBlockPools.AdditionalPools {
+			if pool.Name == tenant.BlockPool {
+				scc = newAdditionalCephBlockPoolStorageClassConfiguration(initData, pool)
+			}
+		}
+	}
+	scc.storageClass.Name = generateNameForTenantSC(initData, tenant)
+	// the tenant only has access to its subvolume group or RADOS namespace,
+	// which are selected by the clusterID Rook publishes for them
+	secretName := generateNameForTenant(initData, tenant)
+	scc.storageClass.Parameters["csi.storage.k8s.io/provisioner-secret-name"] = secretName
+	scc.storageClass.Parameters["csi.storage.k8s.io/node-stage-secret-name"] = secretName
+	scc.storageClass.Parameters["csi.storage.k8s.io/controller-expand-secret-name"] = secretName
+	delete(scc.storageClass.Parameters, "clusterID")
+	scc.disable = false
+	return scc
+}
+
 // newCephOBCStorageClassConfiguration generates configuration options for a Ceph Object Store StorageClass.
 func newCephOBCStorageClassConfiguration(initData *ocsv1.StorageCluster) StorageClassConfiguration {
 	reclaimPolicy := corev1.PersistentVolumeReclaimDelete
@@ -227,11 +361,39 @@ func newCephOBCStorageClassConfiguration(initData *ocsv1.StorageCluster) Storage
 // newStorageClassConfigurations returns the StorageClassConfiguration instances that should be created
 // on first run.
 func (r *StorageClusterReconciler) newStorageClassConfigurations(initData *ocsv1.StorageCluster) ([]StorageClassConfiguration, error) {
+	cephFilesystemConfig := newCephFilesystemStorageClassConfiguration(initData)
 	ret := []StorageClassConfiguration{
-		newCephFilesystemStorageClassConfiguration(initData),
+		cephFilesystemConfig,
 		newCephBlockPoolStorageClassConfiguration(initData, false),
 		newCephBlockPoolStorageClassConfiguration(initData, true),
 	}
+	ret = append(ret, newCephFilesystemDataPoolStorageClassConfigurations(initData, cephFilesystemConfig, initData.Spec.ManagedResources.CephFilesystems.AdditionalDataPools)...)
+	for _, fs := range initData.Spec.ManagedResources.CephFilesystems.AdditionalFilesystems {
+		fsConfig := newAdditionalCephFilesystemStorageClassConfiguration(initData, fs)
+		ret = append(ret, fsConfig)
+		ret = append(ret, newCephFilesystemDataPoolStorageClassConfigurations(initData, fsConfig, fs.AdditionalDataPools)...)
+	}
+	for _, pool := range initData.Spec.ManagedResources.CephBlockPools.AdditionalPools {
+		ret = append(ret, newAdditionalCephBlockPoolStorageClassConfiguration(initData, pool))
+	}
+	if initData.Spec.Encryption.StorageClass {
+		kmsConfigMap, err := getKMSConfigMap(KMSConfigMapName, initData, r.Client)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, newEncryptedCephBlockPoolStorageClassConfiguration(initData, getCSIKMSID(kmsConfigMap)))
+	}
+	for _, tenant := range initData.Spec.Tenants {
+		clusterID, err := r.getTenantClusterID(initData, tenant)
+		if err != nil {
+			return nil, err
+		}
+		// the StorageClass is created once Rook published the clusterID
+		scc := newTenantStorageClassConfiguration(initData, tenant)
+		scc.storageClass.Parameters["clusterID"] = clusterID
+		scc.disable = clusterID == ""
+		ret = append(ret, scc)
+	}
 	// OBC storageclass will be returned only in TWO conditions,
 	// a. either 'externalStorage' is enabled
 	// OR
@@ -2,12 +2,18 @@ package storagecluster
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 
 	configv1 "github.com/openshift/api/config/v1"
 	api "github.com/openshift/ocs-operator/api/v1"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
@@ -83,3 +89,197 @@ func assertStorageClasses(t *testing.T, reconciler StorageClusterReconciler, cr
 		}
 	}
 }
+
+func TestEncryptedStorageClass(t *testing.T) {
+	cases := []struct {
+		label       string
+		provider    string
+		serviceName string
+		// additional keys of the KMS ConfigMap
+		config map[string]string
+		// entries already in the CSI KMS ConfigMap, if it exists
+		csiConfig map[string]string
+		isValid   bool
+		kmsID     string
+		// expected ceph-csi configuration of the KMS, if created by the operator
+		csiDetails map[string]string
+	}{
+		{
+			label:      "Case 1: vault without CSI KMS ConfigMap",
+			provider:   VaultKMSProvider,
+			isValid:    true,
+			kmsID:      VaultKMSProvider,
+			csiDetails: map[string]string{"encryptionKMSType": "vaulttokens", "tenantTokenName": "ceph-csi-kms-token", "vaultAddress": "https://vault.example.com:8200", "vaultBackendPath": "ocs", "vaultNamespace": "my-ocs-namespace"},
+		},
+		{
+			label:       "Case 2: vault with a service name and other KMSs in the CSI KMS ConfigMap",
+			provider:    VaultKMSProvider,
+			serviceName: "vault-ocs",
+			csiConfig:   map[string]string{"other": "{}"},
+			isValid:     true,
+			kmsID:       "vault-ocs",
+			csiDetails:  map[string]string{"encryptionKMSType": "vaulttokens", "tenantTokenName": "ceph-csi-kms-token", "vaultAddress": "https://vault.example.com:8200", "vaultBackendPath": "ocs", "vaultNamespace": "my-ocs-namespace"},
+		},
+		{
+			label:     "Case 3: vault configured by the admin",
+			provider:  VaultKMSProvider,
+			csiConfig: map[string]string{VaultKMSProvider: `{"encryptionKMSType":"vault"}`},
+			isValid:   true,
+			kmsID:     VaultKMSProvider,
+		},
+		{
+			label:    "Case 4: provider not supported by ceph-csi",
+			provider: KMIPKMSProvider,
+			isValid:  false,
+		},
+		{
+			label:     "Case 5: provider configured by the admin",
+			provider:  KMIPKMSProvider,
+			csiConfig: map[string]string{KMIPKMSProvider: "{}"},
+			isValid:   true,
+			kmsID:     KMIPKMSProvider,
+		},
+		{
+			label:    "Case 6: vault with the Kubernetes auth method and a CA",
+			provider: VaultKMSProvider,
+			config:   map[string]string{vaultAuthMethodKey: vaultAuthMethodKubernetes, vaultAuthKubernetesRoleKey: "ocs", vaultCACertKey: "vault-ca"},
+			isValid:  true,
+			kmsID:    VaultKMSProvider,
+			csiDetails: map[string]string{"encryptionKMSType": "vaulttenantsa", "tenantSAName": "ceph-csi-vault-sa",
+				"vaultAuthPath": "/v1/auth/kubernetes/login", "vaultRole": "ocs", "vaultCAFromSecret": "ceph-csi-vault-ca-cert",
+				"vaultAddress": "https://vault.example.com:8200", "vaultBackendPath": "ocs", "vaultNamespace": "my-ocs-namespace"},
+		},
+		{
+			label:    "Case 7: vault with the AppRole auth method",
+			provider: VaultKMSProvider,
+			config:   map[string]string{vaultAuthMethodKey: vaultAuthMethodAppRole, vaultAuthAppRoleSecretNameKey: "vault-approle"},
+			isValid:  false,
+		},
+	}
+
+	for _, c := range cases {
+		sc := createDefaultStorageCluster()
+		sc.Spec.Encryption.StorageClass = true
+		sc.Spec.Encryption.KeyManagementService.Enable = true
+		kmsCM := createDummyKMSConfigMap(c.provider, "https://vault.example.com:8200")
+		kmsCM.Namespace = sc.Namespace
+		if c.serviceName != "" {
+			kmsCM.Data[KMSServiceNameKey] = c.serviceName
+		}
+		for key, value := range c.config {
+			kmsCM.Data[key] = value
+		}
+		objs := []runtime.Object{kmsCM}
+		if c.csiConfig != nil {
+			objs = append(objs, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: CSIKMSConfigMapName, Namespace: sc.Namespace},
+				Data:       c.csiConfig,
+			})
+		}
+		reconciler := createFakeStorageClusterReconciler(t, objs...)
+
+		err := (&ocsStorageClass{}).ensureCreated(&reconciler, sc)
+		if !c.isValid {
+			assert.Errorf(t, err, "[%s]", c.label)
+			continue
+		}
+		assert.NoErrorf(t, err, "[%s]", c.label)
+
+		storageClass := &storagev1.StorageClass{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForEncryptedCephBlockPoolSC(sc)}, storageClass)
+		assert.NoErrorf(t, err, "[%s]", c.label)
+		assert.Equalf(t, "true", storageClass.Parameters["encrypted"], "[%s]", c.label)
+		assert.Equalf(t, c.kmsID, storageClass.Parameters["encryptionKMSID"], "[%s]", c.label)
+		assert.Equalf(t, generateNameForCephBlockPool(sc), storageClass.Parameters["pool"], "[%s]", c.label)
+
+		csiCM := &corev1.ConfigMap{}
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: CSIKMSConfigMapName, Namespace: sc.Namespace}, csiCM)
+		assert.NoErrorf(t, err, "[%s]", c.label)
+		// the entries of the admin are left as they are
+		for key, value := range c.csiConfig {
+			assert.Equalf(t, value, csiCM.Data[key], "[%s]", c.label)
+		}
+		if c.csiDetails != nil {
+			details := map[string]string{}
+			assert.NoErrorf(t, json.Unmarshal([]byte(csiCM.Data[c.kmsID]), &details), "[%s]", c.label)
+			assert.Equalf(t, c.csiDetails, details, "[%s]", c.label)
+		}
+	}
+
+	// the other StorageClasses are left unencrypted
+	sc := createDefaultStorageCluster()
+	reconciler := createFakeStorageClusterReconciler(t)
+	sccs, err := reconciler.newStorageClassConfigurations(sc)
+	assert.NoError(t, err)
+	for _, scc := range sccs {
+		assert.NotEqual(t, generateNameForEncryptedCephBlockPoolSC(sc), scc.storageClass.Name)
+		assert.NotContains(t, scc.storageClass.Parameters, "encrypted")
+	}
+}
+
+func TestEncryptedStorageClassDisabled(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	sc.Spec.Encryption.StorageClass = true
+	sc.Spec.Encryption.KeyManagementService.Enable = true
+	kmsCM := createDummyKMSConfigMap(VaultKMSProvider, "https://vault.example.com:8200")
+	kmsCM.Namespace = sc.Namespace
+	reconciler := createFakeStorageClusterReconciler(t, kmsCM)
+	assert.NoError(t, (&ocsStorageClass{}).ensureCreated(&reconciler, sc))
+	name := types.NamespacedName{Name: generateNameForEncryptedCephBlockPoolSC(sc)}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), name, &storagev1.StorageClass{}))
+
+	// turning the option off deletes the StorageClass, but keeps the KMS
+	// configuration the provisioned volumes need
+	sc.Spec.Encryption.StorageClass = false
+	assert.NoError(t, (&ocsStorageClass{}).ensureCreated(&reconciler, sc))
+	err := reconciler.Client.Get(context.TODO(), name, &storagev1.StorageClass{})
+	assert.True(t, errors.IsNotFound(err))
+	csiCM := &corev1.ConfigMap{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: CSIKMSConfigMapName, Namespace: sc.Namespace}, csiCM))
+	assert.Contains(t, csiCM.Data, VaultKMSProvider)
+
+	// and the default StorageClass is left alone
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephBlockPoolSC(sc, "")}, &storagev1.StorageClass{}))
+}
+
+func TestValidateEncryptionSpec(t *testing.T) {
+	cases := []struct {
+		label      string
+		encryption api.EncryptionSpec
+		external   bool
+		isValid    bool
+	}{
+		{
+			label:   "Case 1: no encryption",
+			isValid: true,
+		},
+		{
+			label:      "Case 2: encrypted StorageClass with KMS",
+			encryption: api.EncryptionSpec{StorageClass: true, KeyManagementService: api.KeyManagementServiceSpec{Enable: true}},
+			isValid:    true,
+		},
+		{
+			label:      "Case 3: encrypted StorageClass without KMS",
+			encryption: api.EncryptionSpec{StorageClass: true},
+			isValid:    false,
+		},
+		{
+			label:      "Case 4: encrypted StorageClass in external mode",
+			encryption: api.EncryptionSpec{StorageClass: true, KeyManagementService: api.KeyManagementServiceSpec{Enable: true}},
+			external:   true,
+			isValid:    false,
+		},
+	}
+
+	for _, c := range cases {
+		sc := createDefaultStorageCluster()
+		sc.Spec.Encryption = c.encryption
+		sc.Spec.ExternalStorage.Enable = c.external
+		err := validateEncryptionSpec(sc)
+		if c.isValid {
+			assert.NoErrorf(t, err, "[%s]", c.label)
+		} else {
+			assert.Errorf(t, err, "[%s]", c.label)
+		}
+	}
+}
@@ -1,17 +1,18 @@
 package storagecluster
 
 import (
+	"context"
 	"fmt"
 	"os"
 
 	"github.com/go-logr/logr"
 	nbv1 "github.com/noobaa/noobaa-operator/v2/pkg/apis/noobaa/v1alpha1"
-	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	"github.com/openshift/ocs-operator/controllers/util"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/kubernetes"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -19,7 +20,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 var (
@@ -75,7 +79,7 @@ type StorageClusterReconciler struct {
 	Log            logr.Logger
 	Scheme         *runtime.Scheme
 	serverVersion  *version.Info
-	conditions     []conditionsv1.Condition
+	conditions     util.ConditionAggregator
 	phase          string
 	monitoringIP   string
 	monitoringPort string
@@ -83,6 +87,7 @@ type StorageClusterReconciler struct {
 	platform       *Platform
 	images         ImageMap
 	recorder       *util.EventReporter
+	dryRun         bool
 }
 
 // SetupWithManager sets up a controller with manager
@@ -111,10 +116,71 @@ func (r *StorageClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		},
 	}
 
+	// Rook adds the subvolume groups and RADOS namespaces of the tenants to
+	// the Ceph CSI configuration once it created them, which is when their
+	// StorageClasses can be created. No other ConfigMap is of interest.
+	csiConfigPredicate := predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return e.Object.GetName() == csiConfigMapName
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.ObjectNew.GetName() == csiConfigMapName
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+	enqueueStorageClusters := handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		storageClusters := &ocsv1.StorageClusterList{}
+		if err := mgr.GetClient().List(context.TODO(), storageClusters, client.InNamespace(obj.GetNamespace())); err != nil {
+			r.Log.Error(err, "Failed to list StorageClusters.", "Namespace", obj.GetNamespace())
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, sc := range storageClusters.Items {
+			if len(sc.Spec.Tenants) > 0 {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: sc.Name, Namespace: sc.Namespace}})
+			}
+		}
+		return requests
+	})
+
+	// The topology drift is detected when the storage nodes come, go or
+	// change their topology labels. The other label changes are frequent and
+	// of no interest.
+	nodePredicate := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return topologyLabelsChanged(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels())
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
+	enqueueInternalStorageClusters := handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		storageClusters := &ocsv1.StorageClusterList{}
+		if err := mgr.GetClient().List(context.TODO(), storageClusters); err != nil {
+			r.Log.Error(err, "Failed to list StorageClusters.")
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, sc := range storageClusters.Items {
+			if !sc.Spec.ExternalStorage.Enable {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: sc.Name, Namespace: sc.Namespace}})
+			}
+		}
+		return requests
+	})
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&ocsv1.StorageCluster{}, builder.WithPredicates(scPredicate)).
 		Owns(&cephv1.CephCluster{}).
 		Owns(&nbv1.NooBaa{}).
 		Owns(&corev1.PersistentVolumeClaim{}, builder.WithPredicates(pvcPredicate)).
+		Owns(&cephv1.CephClient{}).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, enqueueStorageClusters, builder.WithPredicates(csiConfigPredicate)).
+		Watches(&source.Kind{Type: &corev1.Node{}}, enqueueInternalStorageClusters, builder.WithPredicates(nodePredicate)).
 		Complete(r)
 }
@@ -18,6 +18,8 @@ import (
 	rookCephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	v1 "github.com/rook/rook/pkg/apis/rook.io/v1"
 	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -26,6 +28,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	k8sVersion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -226,6 +229,24 @@ var mockNodeList = &corev1.NodeList{
 	},
 }
 
+// newTestNode returns a node with the hostname label of the nodes of
+// mockNodeList and the given labels
+func newTestNode(name string, labels map[string]string) *corev1.Node {
+	node := &corev1.Node{
+		TypeMeta: metav1.TypeMeta{
+			Kind: "Node",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{hostnameLabel: name},
+		},
+	}
+	for key, value := range labels {
+		node.Labels[key] = value
+	}
+	return node
+}
+
 var mockInfrastructure = &configv1.Infrastructure{
 	TypeMeta: metav1.TypeMeta{
 		Kind: "Infrastructure",
@@ -589,6 +610,63 @@ func TestIsActiveStorageCluster(t *testing.T) {
 			},
 			isActive: true,
 		},
+		{
+			// storageCluster2 is an external cluster with its own cluster details, so it is
+			// active alongside storageCluster1
+			label: "Case 5",
+			storageCluster1: &api.StorageCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "storage-test-a",
+					Namespace: "storage-test-ns",
+				},
+				Spec: api.StorageClusterSpec{
+					ExternalStorage: api.ExternalStorageClusterSpec{Enable: true},
+				},
+			},
+			storageCluster2: &api.StorageCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "storage-test-b",
+					Namespace: "storage-test-ns",
+				},
+				Spec: api.StorageClusterSpec{
+					ExternalStorage: api.ExternalStorageClusterSpec{
+						Enable:               true,
+						ClusterDetailsSecret: "storage-test-b-cluster-details",
+					},
+				},
+			},
+			isActive: true,
+		},
+		{
+			// storageCluster1 and storageCluster2 use the same cluster details, so only
+			// storageCluster1 is active
+			label: "Case 6",
+			storageCluster1: &api.StorageCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "storage-test-a",
+					Namespace: "storage-test-ns",
+				},
+				Spec: api.StorageClusterSpec{
+					ExternalStorage: api.ExternalStorageClusterSpec{
+						Enable:               true,
+						ClusterDetailsSecret: "storage-test-cluster-details",
+					},
+				},
+			},
+			storageCluster2: &api.StorageCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "storage-test-b",
+					Namespace: "storage-test-ns",
+				},
+				Spec: api.StorageClusterSpec{
+					ExternalStorage: api.ExternalStorageClusterSpec{
+						Enable:               true,
+						ClusterDetailsSecret: "storage-test-cluster-details",
+					},
+				},
+			},
+			isActive: false,
+		},
 	}
 
 	for _, tc := range testcases {
@@ -674,7 +752,7 @@ func TestNonWatchedReconcileWithTheCephClusterType(t *testing.T) {
 	err = reconciler.Client.Get(context.TODO(), mockStorageClusterRequest.NamespacedName, actual)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, actual.Status.Conditions)
-	assert.Len(t, actual.Status.Conditions, 5)
+	assert.Len(t, actual.Status.Conditions, 6)
 
 	assertExpectedCondition(t, actual.Status.Conditions)
 }
@@ -683,17 +761,9 @@ func TestStorageDeviceSets(t *testing.T) {
 	scName := ""
 	metadataScName := ""
 	walScName := ""
-	storageClassEBS := &storagev1.StorageClass{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: "gp2",
-		},
-		Provisioner: string(EBS),
-		Parameters: map[string]string{
-			"type": "gp2",
-		},
-	}
-
-	reconciler := createFakeStorageClusterReconciler(t, storageClassEBS)
+	smallQuantity := resource.MustParse("512Mi")
+	largeQuantity := resource.MustParse("8Gi")
+	osdMemoryTarget := resource.MustParse("4Gi")
 
 	testcases := []struct {
 		label          string
@@ -804,13 +874,100 @@ func TestStorageDeviceSets(t *testing.T) {
 			},
 			expectedError: fmt.Errorf("no StorageClass specified for walPVCTemplate"),
 		},
+		{
+			label:          "Case 8",
+			storageCluster: &api.StorageCluster{},
+			deviceSets: []api.StorageDeviceSet{
+				{
+					Name:            "mock-sds",
+					Count:           3,
+					DataPVCTemplate: mockDataPVCTemplate,
+					Portable:        true,
+					Config: api.StorageDeviceSetConfig{
+						OSDsPerDevice:      2,
+						OSDMemoryTarget:    &osdMemoryTarget,
+						BlueStoreCacheSize: &smallQuantity,
+					},
+				},
+			},
+			expectedError: nil,
+		},
+		{
+			label:          "Case 9",
+			storageCluster: &api.StorageCluster{},
+			deviceSets: []api.StorageDeviceSet{
+				{
+					Name:                "mock-sds",
+					Count:               3,
+					DataPVCTemplate:     mockDataPVCTemplate,
+					MetadataPVCTemplate: mockMetaDataPVCTemplate,
+					Portable:            true,
+					Config: api.StorageDeviceSetConfig{
+						MetadataDevice: "nvme0n1",
+					},
+				},
+			},
+			expectedError: fmt.Errorf("metadataDevice can't be used along with a metadataPVCTemplate"),
+		},
+		{
+			label:          "Case 10",
+			storageCluster: &api.StorageCluster{},
+			deviceSets: []api.StorageDeviceSet{
+				{
+					Name:            "mock-sds",
+					Count:           3,
+					DataPVCTemplate: mockDataPVCTemplate,
+					Portable:        true,
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{corev1.ResourceMemory: largeQuantity},
+					},
+					Config: api.StorageDeviceSetConfig{
+						OSDMemoryTarget: &osdMemoryTarget,
+					},
+				},
+			},
+			expectedError: fmt.Errorf("osdMemoryTarget can't be set along with a memory in the resources"),
+		},
+		{
+			label:          "Case 11",
+			storageCluster: &api.StorageCluster{},
+			deviceSets: []api.StorageDeviceSet{
+				{
+					Name:            "mock-sds",
+					Count:           3,
+					DataPVCTemplate: mockDataPVCTemplate,
+					Portable:        true,
+					Config: api.StorageDeviceSetConfig{
+						OSDMemoryTarget:       &osdMemoryTarget,
+						BlueStoreCacheSizeSSD: &osdMemoryTarget,
+					},
+				},
+			},
+			expectedError: fmt.Errorf("bluestoreCacheSizeSSD 4Gi must be lower than the osdMemoryTarget 4Gi"),
+		},
+		{
+			label:          "Case 12",
+			storageCluster: &api.StorageCluster{},
+			deviceSets: []api.StorageDeviceSet{
+				{
+					Name:            "mock-sds",
+					Count:           3,
+					DataPVCTemplate: mockDataPVCTemplate,
+					Portable:        true,
+					Config: api.StorageDeviceSetConfig{
+						OSDMemoryTarget: &smallQuantity,
+					},
+				},
+			},
+			expectedError: fmt.Errorf("osdMemoryTarget must be at least 896Mi"),
+		},
 	}
 
 	for _, tc := range testcases {
 		tc.storageCluster.Spec.StorageDeviceSets = tc.deviceSets
-		err := reconciler.validateStorageDeviceSets(tc.storageCluster)
+		err := validateStorageDeviceSets(tc.storageCluster)
 		if tc.expectedError == nil {
-			assert.NoError(t, err)
+			assert.NoErrorf(t, err, "[%s]", tc.label)
 			continue
 		}
 		assert.Error(t, err)
@@ -836,7 +993,7 @@ func TestStorageClusterInitConditions(t *testing.T) {
 	err = reconciler.Client.Get(context.TODO(), mockStorageClusterRequest.NamespacedName, actual)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, actual.Status.Conditions)
-	assert.Len(t, actual.Status.Conditions, 5)
+	assert.Len(t, actual.Status.Conditions, 6)
 
 	assertExpectedCondition(t, actual.Status.Conditions)
 }
@@ -910,6 +1067,7 @@ func assertExpectedCondition(t *testing.T, conditions []conditionsv1.Condition)
 		conditionsv1.ConditionProgressing: corev1.ConditionTrue,
 		conditionsv1.ConditionDegraded:    corev1.ConditionFalse,
 		conditionsv1.ConditionUpgradeable: corev1.ConditionUnknown,
+		api.ConditionTopologyDegraded:     corev1.ConditionFalse,
 	}
 	for cType, status := range expectedConditions {
 		found := assertCondition(conditions, cType, status)
@@ -938,6 +1096,7 @@ func createFakeStorageClusterReconciler(t *testing.T, obj ...runtime.Object) Sto
 		serverVersion: &k8sVersion.Info{},
 		Log:           logf.Log.WithName("controller_storagecluster_test"),
 		platform:      &Platform{platform: configv1.NonePlatformType},
+		recorder:      statusutil.NewEventReporter(&record.FakeRecorder{}),
 	}
 }
 
@@ -986,6 +1145,15 @@ func createFakeScheme(t *testing.T) *runtime.Scheme {
 	if err != nil {
 		assert.Fail(t, "failed to add routev1 scheme")
 	}
+	err = batchv1.AddToScheme(scheme)
+	if err != nil {
+		assert.Fail(t, "failed to add batchv1 scheme")
+	}
+	err = appsv1.AddToScheme(scheme)
+	if err != nil {
+		assert.Fail(t, "failed to add appsv1 scheme")
+	}
+	addTenantRookKindsToScheme(scheme)
 
 	return scheme
 }
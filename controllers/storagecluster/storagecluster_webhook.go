@@ -0,0 +1,334 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// WebhookValidatePath is the path on which the StorageCluster validating
+	// admission webhook is served
+	WebhookValidatePath = "/validate"
+	// WebhookMutatePath is the path on which the StorageCluster mutating
+	// admission webhook is served
+	WebhookMutatePath = "/mutate"
+)
+
+// +kubebuilder:webhook:path=/mutate,mutating=true,failurePolicy=fail,sideEffects=None,groups=ocs.openshift.io,resources=storageclusters,verbs=create;update,versions=v1,name=mstoragecluster.ocs.openshift.io,admissionReviewVersions={v1,v1beta1}
+// +kubebuilder:webhook:path=/validate,mutating=false,failurePolicy=fail,sideEffects=None,groups=ocs.openshift.io,resources=storageclusters,verbs=create;update,versions=v1,name=vstoragecluster.ocs.openshift.io,admissionReviewVersions={v1,v1beta1}
+
+// StorageClusterValidator rejects StorageCluster create and update requests
+// which would otherwise only fail once the reconciler picks them up
+type StorageClusterValidator struct {
+	Log     logr.Logger
+	decoder *admission.Decoder
+}
+
+// StorageClusterMutator injects the finalizer and the defaults into
+// StorageCluster create and update requests
+type StorageClusterMutator struct {
+	Log     logr.Logger
+	decoder *admission.Decoder
+}
+
+// InjectDecoder injects the decoder into the StorageClusterValidator
+func (v *StorageClusterValidator) InjectDecoder(d *admission.Decoder) error {
+	v.decoder = d
+	return nil
+}
+
+// Handle validates the StorageCluster in the admission request
+func (v *StorageClusterValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	sc := &ocsv1.StorageCluster{}
+	if err := v.decoder.DecodeRaw(req.Object, sc); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// Never block the updates that are part of the uninstall, such as the
+	// removal of the finalizer.
+	if !sc.GetDeletionTimestamp().IsZero() {
+		return admission.Allowed("")
+	}
+
+	if req.Operation == admissionv1.Update {
+		oldSc := &ocsv1.StorageCluster{}
+		if err := v.decoder.DecodeRaw(req.OldObject, oldSc); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		if err := validateStorageClusterUpdate(oldSc, sc); err != nil {
+			v.Log.Info("Rejecting StorageCluster update.", "StorageCluster", klog.KRef(req.Namespace, req.Name), "Reason", err.Error())
+			return admission.Denied(err.Error())
+		}
+		// Only the changed fields are validated, so that the updates of the
+		// metadata and of the other fields don't fail on a field which was
+		// valid when it was set.
+		if err := validateChangedStorageCluster(oldSc, sc, v.Log); err != nil {
+			v.Log.Info("Rejecting StorageCluster update.", "StorageCluster", klog.KRef(req.Namespace, req.Name), "Reason", err.Error())
+			return admission.Denied(err.Error())
+		}
+		return admission.Allowed("")
+	}
+
+	if err := validateStorageCluster(sc, v.Log); err != nil {
+		v.Log.Info("Rejecting StorageCluster.", "StorageCluster", klog.KRef(req.Namespace, req.Name), "Reason", err.Error())
+		return admission.Denied(err.Error())
+	}
+
+	return admission.Allowed("")
+}
+
+// InjectDecoder injects the decoder into the StorageClusterMutator
+func (m *StorageClusterMutator) InjectDecoder(d *admission.Decoder) error {
+	m.decoder = d
+	return nil
+}
+
+// Handle returns the patch which sets the finalizer and the defaults on the
+// StorageCluster in the admission request
+func (m *StorageClusterMutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	sc := &ocsv1.StorageCluster{}
+	if err := m.decoder.DecodeRaw(req.Object, sc); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if !sc.GetDeletionTimestamp().IsZero() {
+		return admission.Allowed("")
+	}
+
+	setStorageClusterDefaults(sc)
+
+	// Only the fields set by the defaults are copied to the request object,
+	// re-encoding the whole StorageCluster would also patch the fields it
+	// doesn't know or encodes differently.
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(req.Object.Raw); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	obj.SetFinalizers(sc.GetFinalizers())
+	obj.SetAnnotations(sc.GetAnnotations())
+	if err := unstructured.SetNestedField(obj.Object, sc.Spec.Version, "spec", "version"); err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	marshaled, err := obj.MarshalJSON()
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// storageClusterValidation is one of the spec validations of the
+// StorageCluster. fields returns the fields it reads, an update only runs the
+// validations of the fields it changes.
+type storageClusterValidation struct {
+	fields       func(sc *ocsv1.StorageCluster) []interface{}
+	validate     func(sc *ocsv1.StorageCluster, reqLogger logr.Logger) error
+	internalOnly bool
+}
+
+var storageClusterValidations = []storageClusterValidation{
+	{
+		fields: func(sc *ocsv1.StorageCluster) []interface{} { return []interface{}{sc.Spec.Version} },
+		// versionCheck sets the version on the object, so work on a copy
+		validate: func(sc *ocsv1.StorageCluster, reqLogger logr.Logger) error {
+			return versionCheck(sc.DeepCopy(), reqLogger)
+		},
+	},
+	{
+		fields:       func(sc *ocsv1.StorageCluster) []interface{} { return []interface{}{sc.Spec.StorageDeviceSets} },
+		validate:     func(sc *ocsv1.StorageCluster, _ logr.Logger) error { return validateStorageDeviceSets(sc) },
+		internalOnly: true,
+	},
+	{
+		fields:       func(sc *ocsv1.StorageCluster) []interface{} { return []interface{}{sc.Spec.CephConfig} },
+		validate:     func(sc *ocsv1.StorageCluster, _ logr.Logger) error { return validateCephConfig(sc) },
+		internalOnly: true,
+	},
+	{
+		fields: func(sc *ocsv1.StorageCluster) []interface{} {
+			return []interface{}{sc.Spec.ManagedResources.CephBlockPools, sc.Spec.Arbiter}
+		},
+		validate:     func(sc *ocsv1.StorageCluster, _ logr.Logger) error { return validateAdditionalBlockPools(sc) },
+		internalOnly: true,
+	},
+	{
+		fields: func(sc *ocsv1.StorageCluster) []interface{} {
+			return []interface{}{sc.Spec.ManagedResources.CephFilesystems, sc.Spec.Arbiter}
+		},
+		validate:     func(sc *ocsv1.StorageCluster, _ logr.Logger) error { return validateCephFilesystems(sc) },
+		internalOnly: true,
+	},
+	{
+		fields: func(sc *ocsv1.StorageCluster) []interface{} {
+			return []interface{}{sc.Spec.Tenants, sc.Spec.ManagedResources.CephBlockPools, sc.Spec.ManagedResources.CephFilesystems}
+		},
+		validate:     func(sc *ocsv1.StorageCluster, _ logr.Logger) error { return validateTenants(sc) },
+		internalOnly: true,
+	},
+	{
+		fields: func(sc *ocsv1.StorageCluster) []interface{} {
+			return []interface{}{sc.Spec.CrushHierarchy, sc.Spec.FailureDomain, sc.Spec.FlexibleScaling, sc.Spec.Arbiter, sc.Spec.StorageDeviceSets}
+		},
+		validate:     func(sc *ocsv1.StorageCluster, _ logr.Logger) error { return validateFailureDomain(sc) },
+		internalOnly: true,
+	},
+	{
+		fields: func(sc *ocsv1.StorageCluster) []interface{} {
+			return []interface{}{sc.Spec.Encryption, sc.Spec.ExternalStorage}
+		},
+		validate: func(sc *ocsv1.StorageCluster, _ logr.Logger) error { return validateEncryptionSpec(sc) },
+	},
+	{
+		fields:   func(sc *ocsv1.StorageCluster) []interface{} { return []interface{}{sc.Spec.ExternalStorage} },
+		validate: func(sc *ocsv1.StorageCluster, _ logr.Logger) error { return validateExternalStorageSpec(sc) },
+	},
+	{
+		fields: func(sc *ocsv1.StorageCluster) []interface{} {
+			return []interface{}{sc.Spec.Arbiter, sc.Spec.FlexibleScaling, sc.Spec.NodeTopologies}
+		},
+		validate: validateArbiterSpec,
+	},
+	{
+		fields: func(sc *ocsv1.StorageCluster) []interface{} { return []interface{}{sc.Spec.Network} },
+		validate: func(sc *ocsv1.StorageCluster, _ logr.Logger) error {
+			if !isMultus(sc.Spec.Network) {
+				return nil
+			}
+			return validateMultusSelectors(sc.Spec.Network.Selectors)
+		},
+	},
+	{
+		fields: func(sc *ocsv1.StorageCluster) []interface{} {
+			return []interface{}{sc.GetAnnotations()[PauseReconcileAnnotation], sc.Spec.ExternalStorage}
+		},
+		validate: func(sc *ocsv1.StorageCluster, _ logr.Logger) error { return validatePauseReconcileAnnotation(sc) },
+	},
+}
+
+// validateStorageCluster runs the same spec validations as the reconciler,
+// without touching the StorageCluster status
+func validateStorageCluster(sc *ocsv1.StorageCluster, reqLogger logr.Logger) error {
+	for _, validation := range storageClusterValidations {
+		if validation.internalOnly && sc.Spec.ExternalStorage.Enable {
+			continue
+		}
+		if err := validation.validate(sc, reqLogger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateChangedStorageCluster runs the spec validations of the fields
+// changed by an update, an update which leaves the spec untouched is always
+// valid
+func validateChangedStorageCluster(oldSc, newSc *ocsv1.StorageCluster, reqLogger logr.Logger) error {
+	for _, validation := range storageClusterValidations {
+		if validation.internalOnly && newSc.Spec.ExternalStorage.Enable {
+			continue
+		}
+		if reflect.DeepEqual(validation.fields(oldSc), validation.fields(newSc)) {
+			continue
+		}
+		if err := validation.validate(newSc, reqLogger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateStorageClusterUpdate checks that the fields which can't be changed
+// once the StorageCluster has been created are left untouched
+func validateStorageClusterUpdate(oldSc, newSc *ocsv1.StorageCluster) error {
+	if oldSc.Spec.ExternalStorage.Enable != newSc.Spec.ExternalStorage.Enable {
+		return fmt.Errorf("externalStorage.enable can't be changed once the StorageCluster is created")
+	}
+	if getExternalClusterDetailsSecret(oldSc) != getExternalClusterDetailsSecret(newSc) {
+		return fmt.Errorf("externalStorage.clusterDetailsSecret can't be changed once the StorageCluster is created")
+	}
+
+	for _, oldDs := range oldSc.Spec.StorageDeviceSets {
+		for _, newDs := range newSc.Spec.StorageDeviceSets {
+			if oldDs.Name != newDs.Name {
+				continue
+			}
+			if getDeviceSetReplica(newDs) < getDeviceSetReplica(oldDs) {
+				return fmt.Errorf("replica of StorageDeviceSet %q can't be lowered from %d to %d",
+					newDs.Name, getDeviceSetReplica(oldDs), getDeviceSetReplica(newDs))
+			}
+			// the existing OSDs are neither encrypted nor moved afterwards
+			if isDeviceSetEncrypted(newSc, newDs) != isDeviceSetEncrypted(oldSc, oldDs) &&
+				!reflect.DeepEqual(newDs.Config.EncryptedDevice, oldDs.Config.EncryptedDevice) {
+				return fmt.Errorf("config.encryptedDevice of StorageDeviceSet %q can't be changed once the StorageDeviceSet is created", newDs.Name)
+			}
+			if newDs.Config.MetadataDevice != oldDs.Config.MetadataDevice {
+				return fmt.Errorf("config.metadataDevice of StorageDeviceSet %q can't be changed from %q to %q",
+					newDs.Name, oldDs.Config.MetadataDevice, newDs.Config.MetadataDevice)
+			}
+		}
+	}
+
+	if isNooBaaManaged(oldSc) && !isNooBaaManaged(newSc) {
+		return fmt.Errorf("multiCloudGateway.reconcileStrategy can't be changed from %q to %q",
+			ReconcileStrategyManage, newSc.Spec.MultiCloudGateway.ReconcileStrategy)
+	}
+
+	return nil
+}
+
+// setStorageClusterDefaults sets the finalizer and the defaults that the
+// reconciler would otherwise set on its first run
+func setStorageClusterDefaults(sc *ocsv1.StorageCluster) {
+	if !contains(sc.GetFinalizers(), storageClusterFinalizer) {
+		sc.ObjectMeta.Finalizers = append(sc.ObjectMeta.Finalizers, storageClusterFinalizer)
+	}
+
+	if sc.Spec.Version == "" {
+		_ = versionCheck(sc, log)
+	}
+
+	if _, found := sc.ObjectMeta.Annotations[UninstallModeAnnotation]; !found {
+		metav1.SetMetaDataAnnotation(&sc.ObjectMeta, UninstallModeAnnotation, string(UninstallModeGraceful))
+	}
+	if _, found := sc.ObjectMeta.Annotations[CleanupPolicyAnnotation]; !found {
+		metav1.SetMetaDataAnnotation(&sc.ObjectMeta, CleanupPolicyAnnotation, string(CleanupPolicyDelete))
+	}
+}
+
+// getDeviceSetReplica returns the effective replica of a StorageDeviceSet
+func getDeviceSetReplica(ds ocsv1.StorageDeviceSet) int {
+	if ds.Replica == 0 {
+		return defaults.DeviceSetReplica
+	}
+	return ds.Replica
+}
+
+// isDeviceSetEncrypted returns true if the OSDs of the StorageDeviceSet are
+// encrypted
+func isDeviceSetEncrypted(sc *ocsv1.StorageCluster, ds ocsv1.StorageDeviceSet) bool {
+	if ds.Config.EncryptedDevice != nil {
+		return *ds.Config.EncryptedDevice
+	}
+	return sc.Spec.Encryption.Enable
+}
+
+// isNooBaaManaged returns true if the NooBaa system is reconciled by the
+// ocs-operator
+func isNooBaaManaged(sc *ocsv1.StorageCluster) bool {
+	if sc.Spec.MultiCloudGateway == nil {
+		return true
+	}
+	reconcileStrategy := ReconcileStrategy(sc.Spec.MultiCloudGateway.ReconcileStrategy)
+	return reconcileStrategy == ReconcileStrategyUnknown || reconcileStrategy == ReconcileStrategyManage
+}
@@ -0,0 +1,297 @@
+package storagecluster
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/version"
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func createAdmissionRequest(t *testing.T, operation admissionv1.Operation, oldSc, newSc *api.StorageCluster) admission.Request {
+	typeMeta := metav1.TypeMeta{
+		APIVersion: api.GroupVersion.String(),
+		Kind:       "StorageCluster",
+	}
+	req := admission.Request{}
+	req.Operation = operation
+	newSc = newSc.DeepCopy()
+	newSc.TypeMeta = typeMeta
+	raw, err := json.Marshal(newSc)
+	assert.NoError(t, err)
+	req.Object = runtime.RawExtension{Raw: raw}
+	if oldSc != nil {
+		oldSc = oldSc.DeepCopy()
+		oldSc.TypeMeta = typeMeta
+		raw, err = json.Marshal(oldSc)
+		assert.NoError(t, err)
+		req.OldObject = runtime.RawExtension{Raw: raw}
+	}
+	return req
+}
+
+func createStorageClusterAdmissionDecoder(t *testing.T) *admission.Decoder {
+	decoder, err := admission.NewDecoder(createFakeScheme(t))
+	assert.NoError(t, err)
+	return decoder
+}
+
+func TestStorageClusterValidator(t *testing.T) {
+	storageClassName := "gp2"
+	deviceSet := api.StorageDeviceSet{
+		Name:    "mock-sds",
+		Count:   1,
+		Replica: 3,
+		DataPVCTemplate: corev1.PersistentVolumeClaim{
+			Spec: corev1.PersistentVolumeClaimSpec{
+				StorageClassName: &storageClassName,
+			},
+		},
+	}
+
+	testcases := []struct {
+		label     string
+		operation admissionv1.Operation
+		mutate    func(oldSc, newSc *api.StorageCluster)
+		allowed   bool
+	}{
+		{
+			label:     "Case 1: valid StorageCluster is created",
+			operation: admissionv1.Create,
+			mutate:    func(oldSc, newSc *api.StorageCluster) {},
+			allowed:   true,
+		},
+		{
+			label:     "Case 2: StorageDeviceSet without StorageClass is rejected",
+			operation: admissionv1.Create,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				newSc.Spec.StorageDeviceSets[0].DataPVCTemplate.Spec.StorageClassName = nil
+			},
+			allowed: false,
+		},
+		{
+			label:     "Case 3: arbiter without arbiterLocation is allowed",
+			operation: admissionv1.Create,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				newSc.Spec.Arbiter.Enable = true
+			},
+			allowed: true,
+		},
+		{
+			label:     "Case 4: StorageCluster version higher than the operator is rejected",
+			operation: admissionv1.Create,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				newSc.Spec.Version = getSemVer(version.Version, 1, false)
+			},
+			allowed: false,
+		},
+		{
+			label:     "Case 5: StorageDeviceSet count can be increased",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				newSc.Spec.StorageDeviceSets[0].Count = 2
+			},
+			allowed: true,
+		},
+		{
+			label:     "Case 6: StorageDeviceSet replica can't be lowered",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				newSc.Spec.StorageDeviceSets[0].Replica = 2
+			},
+			allowed: false,
+		},
+		{
+			label:     "Case 7: external mode can't be toggled",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				newSc.Spec.ExternalStorage.Enable = true
+			},
+			allowed: false,
+		},
+		{
+			label:     "Case 8: MCG reconcileStrategy can't be changed away from manage",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				newSc.Spec.MultiCloudGateway = &api.MultiCloudGatewaySpec{
+					ReconcileStrategy: string(ReconcileStrategyStandalone),
+				}
+			},
+			allowed: false,
+		},
+		{
+			label:     "Case 9: MCG reconcileStrategy can be changed to manage",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				oldSc.Spec.MultiCloudGateway = &api.MultiCloudGatewaySpec{
+					ReconcileStrategy: string(ReconcileStrategyIgnore),
+				}
+				newSc.Spec.MultiCloudGateway = &api.MultiCloudGatewaySpec{
+					ReconcileStrategy: string(ReconcileStrategyManage),
+				}
+			},
+			allowed: true,
+		},
+		{
+			label:     "Case 10: clusterDetailsSecret is rejected in internal mode",
+			operation: admissionv1.Create,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				newSc.Spec.ExternalStorage.ClusterDetailsSecret = "backup-cluster-details"
+			},
+			allowed: false,
+		},
+		{
+			label:     "Case 11: clusterDetailsSecret can't be changed",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				oldSc.Spec.ExternalStorage.Enable = true
+				newSc.Spec.ExternalStorage.Enable = true
+				newSc.Spec.ExternalStorage.ClusterDetailsSecret = "backup-cluster-details"
+			},
+			allowed: false,
+		},
+		{
+			label:     "Case 12: arbiterLocation can't be changed once the mons are placed",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				for _, sc := range []*api.StorageCluster{oldSc, newSc} {
+					sc.Spec.Arbiter.Enable = true
+					sc.Status.ArbiterElection = &api.ArbiterElectionStatus{Zone: "c", Reason: api.ArbiterZoneMasterNodesOnly, MonsPlaced: true}
+				}
+				newSc.Spec.NodeTopologies = &api.NodeTopologyMap{ArbiterLocation: "a"}
+			},
+			allowed: false,
+		},
+		{
+			label:     "Case 13: update which leaves an invalid spec untouched is allowed",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				for _, sc := range []*api.StorageCluster{oldSc, newSc} {
+					sc.Spec.Version = getSemVer(version.Version, 1, false)
+				}
+				newSc.Labels = map[string]string{"app": "storage"}
+			},
+			allowed: true,
+		},
+		{
+			label:     "Case 14: update only validates the changed fields",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				for _, sc := range []*api.StorageCluster{oldSc, newSc} {
+					sc.Spec.Version = getSemVer(version.Version, 1, false)
+				}
+				newSc.Spec.StorageDeviceSets[0].Count = 2
+			},
+			allowed: true,
+		},
+		{
+			label:     "Case 15: update of an invalid field is rejected",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				newSc.Spec.CephConfig = &api.CephConfigSpec{Mon: map[string]string{"mon_osd_full_ratio": "2"}}
+			},
+			allowed: false,
+		},
+		{
+			label:     "Case 16: encryptedDevice of a StorageDeviceSet can't be changed",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				encrypted := true
+				newSc.Spec.StorageDeviceSets[0].Config.EncryptedDevice = &encrypted
+			},
+			allowed: false,
+		},
+		{
+			label:     "Case 17: encryptedDevice can be set to the cluster-wide encryption",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				encrypted := false
+				newSc.Spec.StorageDeviceSets[0].Config.EncryptedDevice = &encrypted
+			},
+			allowed: true,
+		},
+		{
+			label:     "Case 18: metadataDevice of a StorageDeviceSet can't be changed",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				newSc.Spec.StorageDeviceSets[0].Config.MetadataDevice = "nvme0n1"
+			},
+			allowed: false,
+		},
+		{
+			label:     "Case 19: new StorageDeviceSet can be encrypted",
+			operation: admissionv1.Update,
+			mutate: func(oldSc, newSc *api.StorageCluster) {
+				encrypted := true
+				newDs := newSc.Spec.StorageDeviceSets[0].DeepCopy()
+				newDs.Name = "encrypted-sds"
+				newDs.Config.EncryptedDevice = &encrypted
+				newDs.Config.MetadataDevice = "nvme0n1"
+				newSc.Spec.StorageDeviceSets = append(newSc.Spec.StorageDeviceSets, *newDs)
+			},
+			allowed: true,
+		},
+	}
+
+	validator := &StorageClusterValidator{Log: logf.Log.WithName("storagecluster_webhook_test")}
+	assert.NoError(t, validator.InjectDecoder(createStorageClusterAdmissionDecoder(t)))
+
+	for _, tc := range testcases {
+		oldSc := createDefaultStorageCluster()
+		oldSc.Spec.StorageDeviceSets = []api.StorageDeviceSet{*deviceSet.DeepCopy()}
+		newSc := oldSc.DeepCopy()
+		tc.mutate(oldSc, newSc)
+
+		if tc.operation == admissionv1.Create {
+			oldSc = nil
+		}
+		resp := validator.Handle(context.TODO(), createAdmissionRequest(t, tc.operation, oldSc, newSc))
+		assert.Equalf(t, tc.allowed, resp.Allowed, "[%s]: unexpected admission response %v", tc.label, resp.Result)
+	}
+}
+
+func TestStorageClusterMutator(t *testing.T) {
+	mutator := &StorageClusterMutator{Log: logf.Log.WithName("storagecluster_webhook_test")}
+	assert.NoError(t, mutator.InjectDecoder(createStorageClusterAdmissionDecoder(t)))
+
+	sc := createDefaultStorageCluster()
+	resp := mutator.Handle(context.TODO(), createAdmissionRequest(t, admissionv1.Create, nil, sc))
+	assert.True(t, resp.Allowed)
+
+	patched := map[string]bool{}
+	for _, patch := range resp.Patches {
+		patched[patch.Path] = true
+	}
+	assert.Len(t, patched, 3, "unexpected patches %v", resp.Patches)
+	assert.True(t, patched["/metadata/finalizers"], "finalizer not injected")
+	assert.True(t, patched["/metadata/annotations"], "uninstall annotations not injected")
+	assert.True(t, patched["/spec/version"], "version not defaulted")
+
+	// the fields unknown to the StorageCluster type are left untouched
+	req := createAdmissionRequest(t, admissionv1.Create, nil, sc)
+	obj := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(req.Object.Raw, &obj))
+	obj["spec"].(map[string]interface{})["unknownField"] = "value"
+	raw, err := json.Marshal(obj)
+	assert.NoError(t, err)
+	req.Object.Raw = raw
+	resp = mutator.Handle(context.TODO(), req)
+	assert.True(t, resp.Allowed)
+	for _, patch := range resp.Patches {
+		assert.NotEqual(t, "/spec/unknownField", patch.Path)
+	}
+
+	// an object which already has the defaults set must not be patched
+	setStorageClusterDefaults(sc)
+	resp = mutator.Handle(context.TODO(), createAdmissionRequest(t, admissionv1.Update, sc, sc))
+	assert.True(t, resp.Allowed)
+	assert.Empty(t, resp.Patches)
+}
@@ -0,0 +1,483 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	// csiConfigMapName is the ConfigMap in which Rook lists the clusters the
+	// Ceph CSI drivers connect to
+	csiConfigMapName = "rook-ceph-csi-config"
+
+	// tenantLabel is set on the resources of the tenants, some of which live
+	// outside of the namespace of the StorageCluster
+	tenantLabel = "ocs.openshift.io/tenant"
+
+	// tenantStorageClassPrefix starts the part of the names of the
+	// StorageClasses of the tenants which follows the name of the StorageClass
+	// of their filesystem or pool. The additional filesystems and pools can't
+	// use it, so that their StorageClasses don't collide.
+	tenantStorageClassPrefix = "tenant-"
+)
+
+var (
+	// the Rook resources of the tenants are newer than the Rook API the
+	// operator is built with, so they are handled as unstructured objects
+	cephFilesystemSubVolumeGroupKind = cephv1.SchemeGroupVersion.WithKind("CephFilesystemSubVolumeGroup")
+	cephBlockPoolRadosNamespaceKind  = cephv1.SchemeGroupVersion.WithKind("CephBlockPoolRadosNamespace")
+)
+
+type ocsTenants struct{}
+
+// ensureCreated has Rook create the subvolume groups and RADOS namespaces of
+// the tenants and register them in the Ceph CSI configuration, creates the
+// Ceph users of the tenants and sets their quotas. The StorageClasses of the
+// tenants are created with the other ones, once Rook published their
+// clusterIDs.
+func (obj *ocsTenants) ensureCreated(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	if err := r.pruneTenantResources(sc, sc.Spec.Tenants); err != nil {
+		return err
+	}
+
+	var waiting []string
+	for _, tenant := range sc.Spec.Tenants {
+		clusterID, err := r.ensureTenantRookResource(sc, tenant)
+		if err != nil {
+			return err
+		}
+		ready, err := r.ensureTenantCSISecret(sc, tenant)
+		if err != nil {
+			return err
+		}
+		if clusterID == "" || !ready {
+			waiting = append(waiting, tenant.Name)
+		}
+	}
+
+	if err := r.reconcileTenantResourceQuotas(sc, sc.Spec.Tenants); err != nil {
+		return err
+	}
+	if len(waiting) > 0 {
+		return fmt.Errorf("waiting for Rook to create the resources of tenants %s", strings.Join(waiting, ", "))
+	}
+	return nil
+}
+
+// ensureDeleted deletes the ResourceQuotas of the tenants. Their resources in
+// the namespace of the StorageCluster are owned by it, and the subvolume
+// groups and RADOS namespaces are left in place by Rook while they hold the
+// volumes of the tenants.
+func (obj *ocsTenants) ensureDeleted(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error {
+	return r.reconcileTenantResourceQuotas(sc, nil)
+}
+
+// newTenantRookResource returns the CephFilesystemSubVolumeGroup or the
+// CephBlockPoolRadosNamespace of a tenant. The subvolume group or the RADOS
+// namespace is named after the tenant.
+func newTenantRookResource(sc *ocsv1.StorageCluster, tenant ocsv1.TenantSpec) *unstructured.Unstructured {
+	parameters := newTenantStorageClassConfiguration(sc, tenant).storageClass.Parameters
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if tenant.Type == ocsv1.TenantTypeCephFS {
+		obj.SetGroupVersionKind(cephFilesystemSubVolumeGroupKind)
+		obj.Object["spec"] = map[string]interface{}{"name": tenant.Name, "filesystemName": parameters["fsName"]}
+	} else {
+		obj.SetGroupVersionKind(cephBlockPoolRadosNamespaceKind)
+		obj.Object["spec"] = map[string]interface{}{"name": tenant.Name, "blockPoolName": parameters["pool"]}
+	}
+	obj.SetName(generateNameForTenant(sc, tenant))
+	obj.SetNamespace(sc.Namespace)
+	obj.SetLabels(map[string]string{tenantLabel: generateNameForTenantLabel(sc, tenant.Name)})
+	return obj
+}
+
+// ensureTenantRookResource creates or updates the Rook resource of a tenant,
+// and returns the clusterID Rook published for it in the Ceph CSI
+// configuration, if any yet
+func (r *StorageClusterReconciler) ensureTenantRookResource(sc *ocsv1.StorageCluster, tenant ocsv1.TenantSpec) (string, error) {
+	desired := newTenantRookResource(sc, tenant)
+	if err := controllerutil.SetControllerReference(sc, desired, r.Scheme); err != nil {
+		return "", err
+	}
+
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(desired.GroupVersionKind())
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: desired.GetName(), Namespace: desired.GetNamespace()}, existing)
+	switch {
+	case meta.IsNoMatchError(err):
+		return "", fmt.Errorf("the tenants require a version of Rook with the %s resource", desired.GetKind())
+	case errors.IsNotFound(err):
+		r.Log.Info("Creating Rook resource for tenant.", desired.GetKind(), klog.KRef(desired.GetNamespace(), desired.GetName()), "Tenant", tenant.Name)
+		if err := r.Client.Create(context.TODO(), desired); err != nil {
+			return "", fmt.Errorf("failed to create %s %s of tenant %s: %v", desired.GetKind(), desired.GetName(), tenant.Name, err)
+		}
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("failed to get %s %s of tenant %s: %v", desired.GetKind(), desired.GetName(), tenant.Name, err)
+	}
+
+	if !reflect.DeepEqual(existing.Object["spec"], desired.Object["spec"]) || !reflect.DeepEqual(existing.GetLabels(), desired.GetLabels()) {
+		r.Log.Info("Updating Rook resource of tenant.", desired.GetKind(), klog.KRef(existing.GetNamespace(), existing.GetName()), "Tenant", tenant.Name)
+		existing.Object["spec"] = desired.Object["spec"]
+		existing.SetLabels(desired.GetLabels())
+		if err := r.Client.Update(context.TODO(), existing); err != nil {
+			return "", fmt.Errorf("failed to update %s %s of tenant %s: %v", desired.GetKind(), desired.GetName(), tenant.Name, err)
+		}
+	}
+	clusterID, _, _ := unstructured.NestedString(existing.Object, "status", "info", "clusterID")
+	return clusterID, nil
+}
+
+// getTenantClusterID returns the clusterID Rook published for a tenant in
+// the Ceph CSI configuration, none until Rook created its subvolume group or
+// RADOS namespace
+func (r *StorageClusterReconciler) getTenantClusterID(sc *ocsv1.StorageCluster, tenant ocsv1.TenantSpec) (string, error) {
+	obj := newTenantRookResource(sc, tenant)
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}, obj)
+	if err != nil {
+		if meta.IsNoMatchError(err) || errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get %s %s of tenant %s: %v", obj.GetKind(), obj.GetName(), tenant.Name, err)
+	}
+	clusterID, _, _ := unstructured.NestedString(obj.Object, "status", "info", "clusterID")
+	return clusterID, nil
+}
+
+// newTenantCephClient returns the Ceph user of a tenant, which can only use
+// the subvolume group or the RADOS namespace of the tenant
+func newTenantCephClient(sc *ocsv1.StorageCluster, tenant ocsv1.TenantSpec) *cephv1.CephClient {
+	parameters := newTenantStorageClassConfiguration(sc, tenant).storageClass.Parameters
+	var caps map[string]string
+	if tenant.Type == ocsv1.TenantTypeCephFS {
+		fsName := parameters["fsName"]
+		caps = map[string]string{
+			"mon": fmt.Sprintf("allow r fsname=%s", fsName),
+			"mgr": "allow rw",
+			"osd": fmt.Sprintf("allow rw tag cephfs metadata=%[1]s, allow rw tag cephfs data=%[1]s", fsName),
+			"mds": fmt.Sprintf("allow r fsname=%[1]s path=/volumes, allow rws fsname=%[1]s path=/volumes/%[2]s", fsName, tenant.Name),
+		}
+	} else {
+		osdCaps := fmt.Sprintf("profile rbd pool=%s namespace=%s", parameters["pool"], tenant.Name)
+		if dataPool := parameters["dataPool"]; dataPool != "" {
+			osdCaps += fmt.Sprintf(", profile rbd pool=%s namespace=%s", dataPool, tenant.Name)
+		}
+		caps = map[string]string{
+			"mon": "profile rbd",
+			"mgr": fmt.Sprintf("profile rbd pool=%s namespace=%s", parameters["pool"], tenant.Name),
+			"osd": osdCaps,
+		}
+	}
+	return &cephv1.CephClient{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateNameForTenant(sc, tenant),
+			Namespace: sc.Namespace,
+			Labels:    map[string]string{tenantLabel: generateNameForTenantLabel(sc, tenant.Name)},
+		},
+		Spec: cephv1.ClientSpec{Caps: caps},
+	}
+}
+
+// ensureTenantCSISecret creates the Ceph user of a tenant, and copies its key
+// to the Secret the StorageClass of the tenant hands to Ceph CSI. It returns
+// whether the Secret is ready.
+func (r *StorageClusterReconciler) ensureTenantCSISecret(sc *ocsv1.StorageCluster, tenant ocsv1.TenantSpec) (bool, error) {
+	cephClient := newTenantCephClient(sc, tenant)
+	if err := controllerutil.SetControllerReference(sc, cephClient, r.Scheme); err != nil {
+		return false, err
+	}
+	existing := &cephv1.CephClient{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: cephClient.Name, Namespace: cephClient.Namespace}, existing)
+	switch {
+	case errors.IsNotFound(err):
+		r.Log.Info("Creating CephClient for tenant.", "CephClient", klog.KRef(cephClient.Namespace, cephClient.Name), "Tenant", tenant.Name)
+		if err := r.Client.Create(context.TODO(), cephClient); err != nil {
+			return false, fmt.Errorf("failed to create CephClient %s of tenant %s: %v", cephClient.Name, tenant.Name, err)
+		}
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("failed to get CephClient %s of tenant %s: %v", cephClient.Name, tenant.Name, err)
+	case !reflect.DeepEqual(existing.Spec, cephClient.Spec) || !reflect.DeepEqual(existing.Labels, cephClient.Labels):
+		r.Log.Info("Updating CephClient of tenant.", "CephClient", klog.KRef(existing.Namespace, existing.Name), "Tenant", tenant.Name)
+		existing.Spec = cephClient.Spec
+		existing.Labels = cephClient.Labels
+		if err := r.Client.Update(context.TODO(), existing); err != nil {
+			return false, fmt.Errorf("failed to update CephClient %s of tenant %s: %v", cephClient.Name, tenant.Name, err)
+		}
+	}
+
+	// Rook stores the key of the user under its name
+	keySecretName := "rook-ceph-client-" + cephClient.Name
+	if existing.Status != nil && existing.Status.Info["secretName"] != "" {
+		keySecretName = existing.Status.Info["secretName"]
+	}
+	keySecret := &corev1.Secret{}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Name: keySecretName, Namespace: sc.Namespace}, keySecret)
+	if errors.IsNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get Secret %s of tenant %s: %v", keySecretName, tenant.Name, err)
+	}
+	key := keySecret.Data[cephClient.Name]
+	if len(key) == 0 {
+		return false, nil
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      generateNameForTenant(sc, tenant),
+			Namespace: sc.Namespace,
+			Labels:    map[string]string{tenantLabel: generateNameForTenantLabel(sc, tenant.Name)},
+		},
+		Data: map[string][]byte{
+			"userID":  []byte(cephClient.Name),
+			"userKey": key,
+		},
+	}
+	if tenant.Type == ocsv1.TenantTypeCephFS {
+		// the CephFS provisioner of the older Ceph CSI releases only reads
+		// the admin credentials
+		secret.Data["adminID"] = []byte(cephClient.Name)
+		secret.Data["adminKey"] = key
+	}
+	if err := controllerutil.SetControllerReference(sc, secret, r.Scheme); err != nil {
+		return false, err
+	}
+	existingSecret := &corev1.Secret{}
+	err = r.Client.Get(context.TODO(), types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, existingSecret)
+	switch {
+	case errors.IsNotFound(err):
+		r.Log.Info("Creating Ceph CSI Secret for tenant.", "Secret", klog.KRef(secret.Namespace, secret.Name), "Tenant", tenant.Name)
+		if err := r.Client.Create(context.TODO(), secret); err != nil {
+			return false, fmt.Errorf("failed to create Secret %s of tenant %s: %v", secret.Name, tenant.Name, err)
+		}
+	case err != nil:
+		return false, fmt.Errorf("failed to get Secret %s of tenant %s: %v", secret.Name, tenant.Name, err)
+	case !reflect.DeepEqual(existingSecret.Data, secret.Data) || !reflect.DeepEqual(existingSecret.Labels, secret.Labels):
+		r.Log.Info("Updating Ceph CSI Secret of tenant.", "Secret", klog.KRef(secret.Namespace, secret.Name), "Tenant", tenant.Name)
+		existingSecret.Data = secret.Data
+		existingSecret.Labels = secret.Labels
+		if err := r.Client.Update(context.TODO(), existingSecret); err != nil {
+			return false, fmt.Errorf("failed to update Secret %s of tenant %s: %v", secret.Name, tenant.Name, err)
+		}
+	}
+	return true, nil
+}
+
+// pruneTenantResources deletes the Rook resources, the Ceph users and the
+// Secrets of the removed tenants, along with the Jobs which created the
+// subvolume groups and RADOS namespaces before Rook did. Rook doesn't remove a
+// subvolume group or a RADOS namespace while it holds volumes.
+func (r *StorageClusterReconciler) pruneTenantResources(sc *ocsv1.StorageCluster, tenants []ocsv1.TenantSpec) error {
+	desired := map[string]bool{}
+	for _, tenant := range tenants {
+		desired[generateNameForTenant(sc, tenant)] = true
+	}
+
+	for _, resources := range []struct {
+		kind string
+		list client.ObjectList
+	}{
+		{cephFilesystemSubVolumeGroupKind.Kind, &unstructured.UnstructuredList{}},
+		{cephBlockPoolRadosNamespaceKind.Kind, &unstructured.UnstructuredList{}},
+		{"CephClient", &cephv1.CephClientList{}},
+		{"Secret", &corev1.SecretList{}},
+	} {
+		list := resources.list
+		if unstructuredList, ok := list.(*unstructured.UnstructuredList); ok {
+			unstructuredList.SetGroupVersionKind(cephv1.SchemeGroupVersion.WithKind(resources.kind + "List"))
+		}
+		err := r.Client.List(context.TODO(), list, client.InNamespace(sc.Namespace), client.HasLabels{tenantLabel})
+		if meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to list the %ss of the tenants: %v", resources.kind, err)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			obj := item.(client.Object)
+			if desired[obj.GetName()] || !metav1.IsControlledBy(obj, sc) {
+				continue
+			}
+			r.Log.Info("Deleting resource of removed tenant.", resources.kind, klog.KRef(obj.GetNamespace(), obj.GetName()))
+			if err := r.Client.Delete(context.TODO(), obj); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete %s %s of removed tenant: %v", resources.kind, obj.GetName(), err)
+			}
+		}
+	}
+
+	jobs := &batchv1.JobList{}
+	if err := r.Client.List(context.TODO(), jobs, client.InNamespace(sc.Namespace), client.MatchingLabels{"app": "ceph-toolbox-job"}); err != nil {
+		return fmt.Errorf("failed to list the Jobs of the tenants: %v", err)
+	}
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if !strings.HasPrefix(job.Name, sc.Name+"-tenant-") || !metav1.IsControlledBy(job, sc) {
+			continue
+		}
+		r.Log.Info("Deleting stale Job of tenant.", "Job", klog.KRef(job.Namespace, job.Name))
+		if err := r.Client.Delete(context.TODO(), job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete Job %s: %v", job.Name, err)
+		}
+	}
+	return nil
+}
+
+// newTenantResourceQuotas returns the ResourceQuotas limiting the use of the
+// StorageClass of a tenant
+func newTenantResourceQuotas(sc *ocsv1.StorageCluster, tenant ocsv1.TenantSpec) []*corev1.ResourceQuota {
+	if tenant.Quota == nil {
+		return nil
+	}
+	storageClassName := newTenantStorageClassConfiguration(sc, tenant).storageClass.Name
+	hard := corev1.ResourceList{}
+	if tenant.Quota.Storage != nil {
+		hard[corev1.ResourceName(storageClassName+".storageclass.storage.k8s.io/requests.storage")] = *tenant.Quota.Storage
+	}
+	if tenant.Quota.PersistentVolumeClaims != nil {
+		hard[corev1.ResourceName(storageClassName+".storageclass.storage.k8s.io/persistentvolumeclaims")] = *resource.NewQuantity(*tenant.Quota.PersistentVolumeClaims, resource.DecimalSI)
+	}
+
+	var ret []*corev1.ResourceQuota
+	for _, namespace := range tenant.Quota.Namespaces {
+		ret = append(ret, &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      generateNameForTenant(sc, tenant),
+				Namespace: namespace,
+				Labels:    map[string]string{tenantLabel: generateNameForTenantLabel(sc, tenant.Name)},
+			},
+			Spec: corev1.ResourceQuotaSpec{Hard: hard},
+		})
+	}
+	return ret
+}
+
+// reconcileTenantResourceQuotas creates or updates the ResourceQuotas of the
+// tenants, and deletes the ones of the tenants and namespaces which were
+// removed
+func (r *StorageClusterReconciler) reconcileTenantResourceQuotas(sc *ocsv1.StorageCluster, tenants []ocsv1.TenantSpec) error {
+	desired := map[types.NamespacedName]bool{}
+	for _, tenant := range tenants {
+		for _, quota := range newTenantResourceQuotas(sc, tenant) {
+			desired[types.NamespacedName{Name: quota.Name, Namespace: quota.Namespace}] = true
+
+			existing := &corev1.ResourceQuota{}
+			err := r.Client.Get(context.TODO(), types.NamespacedName{Name: quota.Name, Namespace: quota.Namespace}, existing)
+			switch {
+			case errors.IsNotFound(err):
+				r.Log.Info("Creating ResourceQuota for tenant.", "ResourceQuota", klog.KRef(quota.Namespace, quota.Name), "Tenant", tenant.Name)
+				if err := r.Client.Create(context.TODO(), quota); err != nil {
+					return fmt.Errorf("failed to create ResourceQuota %s/%s of tenant %s: %v", quota.Namespace, quota.Name, tenant.Name, err)
+				}
+			case err != nil:
+				return fmt.Errorf("failed to get ResourceQuota %s/%s of tenant %s: %v", quota.Namespace, quota.Name, tenant.Name, err)
+			case !reflect.DeepEqual(existing.Spec.Hard, quota.Spec.Hard) || !reflect.DeepEqual(existing.Labels, quota.Labels):
+				r.Log.Info("Updating ResourceQuota of tenant.", "ResourceQuota", klog.KRef(quota.Namespace, quota.Name), "Tenant", tenant.Name)
+				existing.Labels = quota.Labels
+				existing.Spec.Hard = quota.Spec.Hard
+				if err := r.Client.Update(context.TODO(), existing); err != nil {
+					return fmt.Errorf("failed to update ResourceQuota %s/%s of tenant %s: %v", quota.Namespace, quota.Name, tenant.Name, err)
+				}
+			}
+		}
+	}
+
+	quotas := &corev1.ResourceQuotaList{}
+	if err := r.Client.List(context.TODO(), quotas, client.HasLabels{tenantLabel}); err != nil {
+		return fmt.Errorf("failed to list the ResourceQuotas of the tenants: %v", err)
+	}
+	for i := range quotas.Items {
+		quota := &quotas.Items[i]
+		if !strings.HasPrefix(quota.Labels[tenantLabel], generateNameForTenantLabel(sc, "")) ||
+			desired[types.NamespacedName{Name: quota.Name, Namespace: quota.Namespace}] {
+			continue
+		}
+		r.Log.Info("Deleting ResourceQuota of removed tenant.", "ResourceQuota", klog.KRef(quota.Namespace, quota.Name))
+		if err := r.Client.Delete(context.TODO(), quota); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete ResourceQuota %s/%s: %v", quota.Namespace, quota.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateTenants checks that the tenants have unique names and refer to
+// filesystems and pools of the StorageCluster
+func validateTenants(sc *ocsv1.StorageCluster) error {
+	filesystems := map[string]bool{"": true}
+	for _, fs := range sc.Spec.ManagedResources.CephFilesystems.AdditionalFilesystems {
+		filesystems[fs.Name] = true
+	}
+	blockPools := map[string]bool{"": true}
+	for _, pool := range sc.Spec.ManagedResources.CephBlockPools.AdditionalPools {
+		blockPools[pool.Name] = true
+	}
+
+	names := map[string]bool{}
+	for _, tenant := range sc.Spec.Tenants {
+		if errs := validation.IsDNS1123Label(tenant.Name); len(errs) > 0 {
+			return fmt.Errorf("failed to validate tenant %q: %s", tenant.Name, strings.Join(errs, ", "))
+		}
+		if names[tenant.Name] {
+			return fmt.Errorf("failed to validate tenant %q: the name is used by another tenant", tenant.Name)
+		}
+		names[tenant.Name] = true
+
+		switch tenant.Type {
+		case ocsv1.TenantTypeCephFS:
+			if tenant.BlockPool != "" {
+				return fmt.Errorf("failed to validate tenant %q: blockPool can't be set for a cephfs tenant", tenant.Name)
+			}
+			if !filesystems[tenant.Filesystem] {
+				return fmt.Errorf("failed to validate tenant %q: unknown filesystem %q", tenant.Name, tenant.Filesystem)
+			}
+		case ocsv1.TenantTypeRBD:
+			if tenant.Filesystem != "" {
+				return fmt.Errorf("failed to validate tenant %q: filesystem can't be set for an rbd tenant", tenant.Name)
+			}
+			if !blockPools[tenant.BlockPool] {
+				return fmt.Errorf("failed to validate tenant %q: unknown blockPool %q", tenant.Name, tenant.BlockPool)
+			}
+		default:
+			return fmt.Errorf("failed to validate tenant %q: invalid type %q", tenant.Name, tenant.Type)
+		}
+
+		if tenant.Quota == nil {
+			continue
+		}
+		if len(tenant.Quota.Namespaces) == 0 {
+			return fmt.Errorf("failed to validate tenant %q: the quota must list at least one namespace", tenant.Name)
+		}
+		for _, namespace := range tenant.Quota.Namespaces {
+			if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+				return fmt.Errorf("failed to validate tenant %q: invalid namespace %q in quota", tenant.Name, namespace)
+			}
+		}
+		if tenant.Quota.Storage != nil && tenant.Quota.Storage.Sign() < 0 {
+			return fmt.Errorf("failed to validate tenant %q: quota.storage must not be negative", tenant.Name)
+		}
+		if tenant.Quota.PersistentVolumeClaims != nil && *tenant.Quota.PersistentVolumeClaims < 0 {
+			return fmt.Errorf("failed to validate tenant %q: quota.persistentVolumeClaims must not be negative", tenant.Name)
+		}
+	}
+	return nil
+}
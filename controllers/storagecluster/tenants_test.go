@@ -0,0 +1,203 @@
+package storagecluster
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	rookCephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// addTenantRookKindsToScheme registers the Rook resources of the tenants,
+// which are only known to the fake client as unstructured objects
+func addTenantRookKindsToScheme(scheme *runtime.Scheme) {
+	for _, gvk := range []schema.GroupVersionKind{cephFilesystemSubVolumeGroupKind, cephBlockPoolRadosNamespaceKind} {
+		scheme.AddKnownTypeWithName(gvk, &unstructured.Unstructured{})
+		scheme.AddKnownTypeWithName(gvk.GroupVersion().WithKind(gvk.Kind+"List"), &unstructured.UnstructuredList{})
+	}
+}
+
+func TestValidateTenants(t *testing.T) {
+	negativePVCs := int64(-1)
+	cases := []struct {
+		label   string
+		tenants []api.TenantSpec
+		isValid bool
+	}{
+		{
+			label: "Case 1: cephfs and rbd tenants",
+			tenants: []api.TenantSpec{
+				{Name: "team-a", Type: api.TenantTypeCephFS},
+				{Name: "team-b", Type: api.TenantTypeRBD, BlockPool: "gold", Quota: &api.TenantQuotaSpec{Namespaces: []string{"team-b"}}},
+			},
+			isValid: true,
+		},
+		{
+			label:   "Case 2: duplicated names",
+			tenants: []api.TenantSpec{{Name: "team-a", Type: api.TenantTypeCephFS}, {Name: "team-a", Type: api.TenantTypeRBD}},
+			isValid: false,
+		},
+		{
+			label:   "Case 3: unknown filesystem",
+			tenants: []api.TenantSpec{{Name: "team-a", Type: api.TenantTypeCephFS, Filesystem: "unknown"}},
+			isValid: false,
+		},
+		{
+			label:   "Case 4: block pool of a cephfs tenant",
+			tenants: []api.TenantSpec{{Name: "team-a", Type: api.TenantTypeCephFS, BlockPool: "gold"}},
+			isValid: false,
+		},
+		{
+			label:   "Case 5: quota without namespaces",
+			tenants: []api.TenantSpec{{Name: "team-a", Type: api.TenantTypeRBD, Quota: &api.TenantQuotaSpec{}}},
+			isValid: false,
+		},
+		{
+			label:   "Case 6: negative PVC quota",
+			tenants: []api.TenantSpec{{Name: "team-a", Type: api.TenantTypeRBD, Quota: &api.TenantQuotaSpec{Namespaces: []string{"team-a"}, PersistentVolumeClaims: &negativePVCs}}},
+			isValid: false,
+		},
+	}
+
+	for _, c := range cases {
+		sc := createDefaultStorageCluster()
+		sc.Spec.ManagedResources.CephBlockPools.AdditionalPools = []api.AdditionalBlockPoolSpec{{Name: "gold"}}
+		sc.Spec.Tenants = c.tenants
+		err := validateTenants(sc)
+		if c.isValid {
+			assert.NoErrorf(t, err, "[%s]", c.label)
+		} else {
+			assert.Errorf(t, err, "[%s]", c.label)
+		}
+	}
+}
+
+func TestTenantStorageClasses(t *testing.T) {
+	sc := createDefaultStorageCluster()
+	sc.Spec.ManagedResources.CephBlockPools.AdditionalPools = []api.AdditionalBlockPoolSpec{
+		{Name: "bronze", ErasureCoded: &api.ErasureCodedPoolSpec{DataChunks: 2, CodingChunks: 1}},
+	}
+	sc.Spec.Tenants = []api.TenantSpec{
+		{Name: "team-a", Type: api.TenantTypeCephFS},
+		{Name: "team-b", Type: api.TenantTypeRBD, BlockPool: "bronze"},
+	}
+
+	scc := newTenantStorageClassConfiguration(sc, sc.Spec.Tenants[0])
+	assert.Equal(t, "ocsinit-cephfs-tenant-team-a", scc.storageClass.Name)
+	assert.Equal(t, "ocsinit-cephfilesystem", scc.storageClass.Parameters["fsName"])
+	assert.Equal(t, "ocsinit-tenant-team-a", scc.storageClass.Parameters["csi.storage.k8s.io/node-stage-secret-name"])
+	assert.NotContains(t, scc.storageClass.Parameters, "clusterID")
+
+	scc = newTenantStorageClassConfiguration(sc, sc.Spec.Tenants[1])
+	assert.Equal(t, "ocsinit-ceph-rbd-tenant-team-b", scc.storageClass.Name)
+	assert.Equal(t, "ocsinit-cephblockpool-bronze-metadata", scc.storageClass.Parameters["pool"])
+	assert.Equal(t, "ocsinit-cephblockpool-bronze", scc.storageClass.Parameters["dataPool"])
+	assert.Equal(t, "ocsinit-tenant-team-b", scc.storageClass.Parameters["csi.storage.k8s.io/provisioner-secret-name"])
+
+	subVolumeGroup := newTenantRookResource(sc, sc.Spec.Tenants[0])
+	assert.Equal(t, "CephFilesystemSubVolumeGroup", subVolumeGroup.GetKind())
+	assert.Equal(t, map[string]interface{}{"name": "team-a", "filesystemName": "ocsinit-cephfilesystem"}, subVolumeGroup.Object["spec"])
+	radosNamespace := newTenantRookResource(sc, sc.Spec.Tenants[1])
+	assert.Equal(t, "CephBlockPoolRadosNamespace", radosNamespace.GetKind())
+	assert.Equal(t, "ocsinit-tenant-team-b", radosNamespace.GetName())
+	assert.Equal(t, map[string]interface{}{"name": "team-b", "blockPoolName": "ocsinit-cephblockpool-bronze-metadata"}, radosNamespace.Object["spec"])
+
+	// the Ceph users of the tenants are limited to their subvolume group or
+	// RADOS namespace
+	cephClient := newTenantCephClient(sc, sc.Spec.Tenants[0])
+	assert.Equal(t, "allow r fsname=ocsinit-cephfilesystem path=/volumes, allow rws fsname=ocsinit-cephfilesystem path=/volumes/team-a", cephClient.Spec.Caps["mds"])
+	cephClient = newTenantCephClient(sc, sc.Spec.Tenants[1])
+	assert.Equal(t, "profile rbd pool=ocsinit-cephblockpool-bronze-metadata namespace=team-b, profile rbd pool=ocsinit-cephblockpool-bronze namespace=team-b", cephClient.Spec.Caps["osd"])
+}
+
+func TestEnsureTenants(t *testing.T) {
+	pvcs := int64(10)
+	storage := resource.MustParse("1Ti")
+	sc := createDefaultStorageCluster()
+	sc.Spec.Tenants = []api.TenantSpec{
+		{Name: "team-a", Type: api.TenantTypeCephFS, Quota: &api.TenantQuotaSpec{Namespaces: []string{"team-a-dev", "team-a-prod"}, Storage: &storage, PersistentVolumeClaims: &pvcs}},
+		{Name: "team-b", Type: api.TenantTypeRBD},
+	}
+	// the Job which created the subvolume group of a tenant before Rook did
+	staleJob := newCephToolboxJob(sc, "ocsinit-tenant-team-a", []string{"ceph"})
+	assert.NoError(t, controllerutil.SetControllerReference(sc, staleJob, createFakeScheme(t)))
+	reconciler := createFakeStorageClusterReconciler(t, staleJob)
+	obj := &ocsTenants{}
+
+	// the tenants wait for Rook to create their resources
+	assert.Error(t, obj.ensureCreated(&reconciler, sc))
+	err := reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: staleJob.Name, Namespace: sc.Namespace}, &batchv1.Job{})
+	assert.True(t, errors.IsNotFound(err), "stale Job of tenant not deleted")
+	sccs, err := reconciler.newStorageClassConfigurations(sc)
+	assert.NoError(t, err)
+	for _, scc := range sccs {
+		if scc.storageClass.Name == "ocsinit-ceph-rbd-tenant-team-b" {
+			assert.True(t, scc.disable, "StorageClass of tenant enabled without clusterID")
+		}
+	}
+
+	// Rook publishes the clusterIDs and creates the keys of the Ceph users
+	for _, tenant := range sc.Spec.Tenants {
+		name := generateNameForTenant(sc, tenant)
+		rookResource := newTenantRookResource(sc, tenant)
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: sc.Namespace}, rookResource))
+		assert.NoError(t, unstructured.SetNestedField(rookResource.Object, "clusterid-"+tenant.Name, "status", "info", "clusterID"))
+		assert.NoError(t, reconciler.Client.Update(context.TODO(), rookResource))
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: sc.Namespace}, &rookCephv1.CephClient{}))
+		assert.NoError(t, reconciler.Client.Create(context.TODO(), &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-client-" + name, Namespace: sc.Namespace},
+			Data:       map[string][]byte{name: []byte("key-" + tenant.Name)},
+		}))
+	}
+	assert.NoError(t, obj.ensureCreated(&reconciler, sc))
+
+	secret := &corev1.Secret{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-tenant-team-a", Namespace: sc.Namespace}, secret))
+	assert.Equal(t, "ocsinit-tenant-team-a", string(secret.Data["userID"]))
+	assert.Equal(t, "key-team-a", string(secret.Data["adminKey"]))
+	sccs, err = reconciler.newStorageClassConfigurations(sc)
+	assert.NoError(t, err)
+	for _, scc := range sccs {
+		if scc.storageClass.Name == "ocsinit-ceph-rbd-tenant-team-b" {
+			assert.False(t, scc.disable)
+			assert.Equal(t, "clusterid-team-b", scc.storageClass.Parameters["clusterID"])
+		}
+	}
+
+	quota := &corev1.ResourceQuota{}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-tenant-team-a", Namespace: "team-a-prod"}, quota))
+	hard := quota.Spec.Hard[corev1.ResourceName("ocsinit-cephfs-tenant-team-a.storageclass.storage.k8s.io/requests.storage")]
+	assert.Equal(t, "1Ti", hard.String())
+
+	// removing a namespace from the quota deletes its ResourceQuota
+	sc.Spec.Tenants[0].Quota.Namespaces = []string{"team-a-prod"}
+	assert.NoError(t, obj.ensureCreated(&reconciler, sc))
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-tenant-team-a", Namespace: "team-a-dev"}, &corev1.ResourceQuota{})
+	assert.True(t, errors.IsNotFound(err))
+
+	// removing a tenant deletes its Rook resource, Ceph user and Secret
+	sc.Spec.Tenants = sc.Spec.Tenants[:1]
+	assert.NoError(t, obj.ensureCreated(&reconciler, sc))
+	for _, removed := range []client.Object{newTenantRookResource(sc, api.TenantSpec{Name: "team-b", Type: api.TenantTypeRBD}), &rookCephv1.CephClient{}, &corev1.Secret{}} {
+		err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-tenant-team-b", Namespace: sc.Namespace}, removed)
+		assert.Truef(t, errors.IsNotFound(err), "%T of removed tenant not deleted", removed)
+	}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-tenant-team-a", Namespace: sc.Namespace}, &rookCephv1.CephClient{}))
+
+	// uninstall removes the ResourceQuotas of the tenants
+	assert.NoError(t, obj.ensureDeleted(&reconciler, sc))
+	err = reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: "ocsinit-tenant-team-a", Namespace: "team-a-prod"}, &corev1.ResourceQuota{})
+	assert.True(t, errors.IsNotFound(err))
+}
@@ -18,6 +18,18 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// generatedRackAnnotation marks the nodes which ensureNodeRacks put in a
+// rack, with the rack it gave them. Only their rack labels are removed on
+// uninstall.
+const generatedRackAnnotation = "topology.ocs.openshift.io/generated-rack"
+
+// isGeneratedRack returns true if the rack label of the node is still the one
+// ensureNodeRacks gave it
+func isGeneratedRack(node corev1.Node) bool {
+	rack, found := node.Annotations[generatedRackAnnotation]
+	return found && rack == node.Labels[defaults.RackTopologyKey]
+}
+
 func (r *StorageClusterReconciler) getStorageClusterEligibleNodes(sc *ocsv1.StorageCluster) (nodes *corev1.NodeList, err error) {
 	nodes = &corev1.NodeList{}
 	var selector labels.Selector
@@ -54,7 +66,14 @@ func setFailureDomain(sc *ocsv1.StorageCluster) {
 
 	// We don't change the failure domain after it is determined
 	if sc.Status.FailureDomain != "" {
-		sc.Status.FailureDomainKey, sc.Status.FailureDomainValues = sc.Status.NodeTopologies.GetKeyValues(sc.Status.FailureDomain)
+		sc.Status.FailureDomainKey, sc.Status.FailureDomainValues = getFailureDomainKeyValues(sc.Status.NodeTopologies, sc.Status.FailureDomain)
+		return
+	}
+
+	// The failure domain set in the spec is used as is
+	if sc.Spec.FailureDomain != "" {
+		sc.Status.FailureDomain = getCrushLevel(sc.Spec.FailureDomain)
+		sc.Status.FailureDomainKey, sc.Status.FailureDomainValues = getFailureDomainKeyValues(sc.Status.NodeTopologies, sc.Status.FailureDomain)
 		return
 	}
 
@@ -70,6 +89,12 @@ func setFailureDomain(sc *ocsv1.StorageCluster) {
 		return
 	}
 
+	// If a CRUSH hierarchy is declared, its widest level with enough values
+	// is selected over the rack
+	if level := getHierarchyFailureDomain(sc); level != "" {
+		failureDomain = level
+	}
+
 	// If sufficient zones are available then we select zone as the failure domain
 	topologyMap := sc.Status.NodeTopologies
 	for label, labelValues := range topologyMap.Labels {
@@ -81,7 +106,7 @@ func setFailureDomain(sc *ocsv1.StorageCluster) {
 	}
 
 	sc.Status.FailureDomain = failureDomain
-	sc.Status.FailureDomainKey, sc.Status.FailureDomainValues = sc.Status.NodeTopologies.GetKeyValues(sc.Status.FailureDomain)
+	sc.Status.FailureDomainKey, sc.Status.FailureDomainValues = getFailureDomainKeyValues(sc.Status.NodeTopologies, sc.Status.FailureDomain)
 }
 
 // determinePlacementRack sorts the list of known racks in alphabetical order,
@@ -233,6 +258,7 @@ func (r *StorageClusterReconciler) ensureNodeRacks(
 			r.Log.Info("Labeling node with rack label.", "Node", node.Name, "Label", defaults.RackTopologyKey, "Value", rack)
 			newNode := node.DeepCopy()
 			newNode.Labels[defaults.RackTopologyKey] = rack
+			metav1.SetMetaDataAnnotation(&newNode.ObjectMeta, generatedRackAnnotation, rack)
 			patch, err := generateStrategicPatch(node, newNode)
 			if err != nil {
 				return err
@@ -289,9 +315,19 @@ func (r *StorageClusterReconciler) reconcileNodeTopologyMap(sc *ocsv1.StorageClu
 
 	}
 
+	if len(sc.Spec.CrushHierarchy) > 0 {
+		if err := validateNodeCrushHierarchy(sc, nodes); err != nil {
+			return err
+		}
+	}
+
 	filterDuplicateLabels(sc, nodes, topologyMap)
 	setFailureDomain(sc)
 
+	if err := validateFailureDomainNodes(sc, nodes); err != nil {
+		return err
+	}
+
 	if getFailureDomain(sc) == "rack" {
 		err = r.ensureNodeRacks(nodes, minNodes, nodeRacks, topologyMap)
 		if err != nil {
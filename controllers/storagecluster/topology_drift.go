@@ -0,0 +1,384 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// FailureDomainMigrationAnnotation requests the migration of the failure
+	// domain of the StorageCluster to the given one. Only the migration from
+	// rack to zone is supported, once every storage node has a zone label and
+	// enough zones are available.
+	FailureDomainMigrationAnnotation = "topology.ocs.openshift.io/migrate-failure-domain"
+
+	cephHealthOK = "HEALTH_OK"
+)
+
+// reconcileTopologyDrift migrates the failure domain when it is requested,
+// then compares the storage nodes and the OSDs with the failure domain, and
+// reports the drifts in the status and the TopologyDegraded condition. The
+// failure domain is never changed on its own once it is determined, so a
+// third zone becoming available, a rack losing all its nodes or the OSDs
+// piling up in some racks would otherwise go unnoticed.
+func (r *StorageClusterReconciler) reconcileTopologyDrift(sc *ocsv1.StorageCluster) error {
+	nodes, err := r.getStorageClusterEligibleNodes(sc)
+	if err != nil {
+		return fmt.Errorf("failed to list the storage nodes: %v", err)
+	}
+	osds, err := r.getOSDsPerNode(sc)
+	if err != nil {
+		return err
+	}
+
+	var previous ocsv1.TopologyStatus
+	if sc.Status.Topology != nil {
+		previous = *sc.Status.Topology
+	}
+	migration, err := r.reconcileFailureDomainMigration(sc, nodes, previous.Migration, time.Now())
+	if err != nil {
+		return err
+	}
+
+	setFailureDomainMigratingCondition(sc, migration)
+
+	failureDomains, drifts := detectTopologyDrift(sc, nodes, osds)
+	sc.Status.Topology = &ocsv1.TopologyStatus{
+		Drifts:         drifts,
+		FailureDomains: failureDomains,
+		Migration:      migration,
+	}
+
+	var degraded, advisories []string
+	for _, drift := range drifts {
+		if drift.Type == ocsv1.TopologyDriftZonesAvailable {
+			advisories = append(advisories, drift.Message)
+			continue
+		}
+		degraded = append(degraded, drift.Message)
+		if !hasTopologyDrift(previous.Drifts, drift) {
+			r.Log.Info("Topology of the storage nodes drifted from the failure domain.", "Drift", drift.Type, "Message", drift.Message, "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+			r.recorder.Report(sc, corev1.EventTypeWarning, statusutil.EventReasonTopologyDrifted, drift.Message)
+		}
+	}
+	condition := conditionsv1.Condition{
+		Type:    ocsv1.ConditionTopologyDegraded,
+		Status:  corev1.ConditionFalse,
+		Reason:  ocsv1.TopologyHealthy,
+		Message: fmt.Sprintf("The storage nodes and the OSDs match the %s failure domain", getFailureDomain(sc)),
+	}
+	switch {
+	case len(degraded) > 0:
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = ocsv1.TopologyDrifted
+		condition.Message = strings.Join(degraded, "; ")
+	case len(advisories) > 0:
+		condition.Reason = ocsv1.FailureDomainMigrationAvailable
+		condition.Message = strings.Join(advisories, "; ")
+	}
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, condition)
+	return nil
+}
+
+// setFailureDomainMigratingCondition reports the progress of the failure
+// domain migration, so that a failure domain changed in the status while Ceph
+// still moves the data is visible. The condition is only reported while the
+// migration is requested.
+func setFailureDomainMigratingCondition(sc *ocsv1.StorageCluster, migration *ocsv1.FailureDomainMigration) {
+	if migration == nil {
+		conditionsv1.RemoveStatusCondition(&sc.Status.Conditions, ocsv1.ConditionFailureDomainMigrating)
+		return
+	}
+	condition := conditionsv1.Condition{
+		Type:    ocsv1.ConditionFailureDomainMigrating,
+		Status:  corev1.ConditionFalse,
+		Reason:  ocsv1.FailureDomainNotMigrated,
+		Message: migration.Message,
+	}
+	switch migration.Phase {
+	case ocsv1.FailureDomainMigrationInProgress:
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = ocsv1.FailureDomainMigrating
+	case ocsv1.FailureDomainMigrationCompleted:
+		condition.Reason = ocsv1.FailureDomainMigrated
+	}
+	conditionsv1.SetStatusCondition(&sc.Status.Conditions, condition)
+}
+
+// isTopologyLabel returns true for the node labels the topology of the
+// storage nodes is built from, and for the labels making a node a storage or
+// a master node
+func isTopologyLabel(label string) bool {
+	if label == defaults.NodeAffinityKey || strings.Contains(label, "rack") {
+		return true
+	}
+	for _, key := range validTopologyLabelKeys {
+		if strings.Contains(label, key) {
+			return true
+		}
+	}
+	for _, key := range masterNodeRoleLabels {
+		if label == key {
+			return true
+		}
+	}
+	return false
+}
+
+// topologyLabelsChanged returns true when a topology label of a node is
+// added, removed or changed
+func topologyLabelsChanged(oldLabels, newLabels map[string]string) bool {
+	for label, value := range oldLabels {
+		if newValue, found := newLabels[label]; isTopologyLabel(label) && (!found || newValue != value) {
+			return true
+		}
+	}
+	for label := range newLabels {
+		if _, found := oldLabels[label]; isTopologyLabel(label) && !found {
+			return true
+		}
+	}
+	return false
+}
+
+// detectTopologyDrift counts the storage nodes and the OSDs in each value of
+// the failure domain, and returns the drifts of the topology: the values which
+// lost all their nodes, the OSDs unevenly spread across the values, and the
+// zones which became available to a rack failure domain.
+func detectTopologyDrift(sc *ocsv1.StorageCluster, nodes *corev1.NodeList, osds map[string]int32) ([]ocsv1.FailureDomainUsage, []ocsv1.TopologyDrift) {
+	failureDomain := getFailureDomain(sc)
+	failureDomainKey := getFailureDomainKey(sc)
+
+	usages := map[string]*ocsv1.FailureDomainUsage{}
+	for _, value := range sc.Status.FailureDomainValues {
+		usages[value] = &ocsv1.FailureDomainUsage{Value: value}
+	}
+	for _, node := range nodes.Items {
+		value, found := node.Labels[failureDomainKey]
+		if !found {
+			continue
+		}
+		usage, found := usages[value]
+		if !found {
+			usage = &ocsv1.FailureDomainUsage{Value: value}
+			usages[value] = usage
+		}
+		usage.Nodes++
+		usage.OSDs += osds[node.Name]
+	}
+	values := make([]string, 0, len(usages))
+	for value := range usages {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	failureDomains := make([]ocsv1.FailureDomainUsage, 0, len(values))
+	for _, value := range values {
+		failureDomains = append(failureDomains, *usages[value])
+	}
+
+	var drifts []ocsv1.TopologyDrift
+	// the hosts of the topology map are never pruned, so the replaced hosts
+	// are not reported
+	if failureDomain != "host" {
+		for _, usage := range failureDomains {
+			if usage.Nodes == 0 {
+				drifts = append(drifts, ocsv1.TopologyDrift{
+					Type:    ocsv1.TopologyDriftFailureDomainEmpty,
+					Message: fmt.Sprintf("The %s %s has no storage node left", failureDomain, usage.Value),
+				})
+			}
+		}
+
+		var spread []string
+		var minOSDs, maxOSDs, totalOSDs int32 = -1, 0, 0
+		for _, usage := range failureDomains {
+			if usage.Nodes == 0 {
+				continue
+			}
+			spread = append(spread, fmt.Sprintf("%s: %d", usage.Value, usage.OSDs))
+			if minOSDs < 0 || usage.OSDs < minOSDs {
+				minOSDs = usage.OSDs
+			}
+			if usage.OSDs > maxOSDs {
+				maxOSDs = usage.OSDs
+			}
+			totalOSDs += usage.OSDs
+		}
+		if totalOSDs > 0 && maxOSDs-minOSDs > 1 {
+			drifts = append(drifts, ocsv1.TopologyDrift{
+				Type:    ocsv1.TopologyDriftOSDImbalance,
+				Message: fmt.Sprintf("The OSDs are unevenly spread across the %s failure domain (%s)", failureDomain, strings.Join(spread, ", ")),
+			})
+		}
+	}
+
+	if failureDomain == "rack" && sc.Spec.FailureDomain == "" {
+		if zones, _ := getNodeZones(sc, nodes); len(zones) >= getMinimumZones(sc) {
+			drifts = append(drifts, ocsv1.TopologyDrift{
+				Type: ocsv1.TopologyDriftZonesAvailable,
+				Message: fmt.Sprintf("%d zones are available, the failure domain can be migrated from rack to zone with the %s annotation",
+					len(zones), FailureDomainMigrationAnnotation),
+			})
+		}
+	}
+
+	return failureDomains, drifts
+}
+
+// reconcileFailureDomainMigration changes the failure domain from rack to zone
+// when it is requested and the topology allows it, then follows the migration
+// until Ceph is healthy again. Ceph moves the data to the new failure domain
+// once the CephBlockPools are updated with it.
+func (r *StorageClusterReconciler) reconcileFailureDomainMigration(sc *ocsv1.StorageCluster, nodes *corev1.NodeList,
+	migration *ocsv1.FailureDomainMigration, now time.Time) (*ocsv1.FailureDomainMigration, error) {
+	if migration != nil && migration.Phase == ocsv1.FailureDomainMigrationInProgress {
+		health, checked, err := r.getCephClusterHealth(sc)
+		if err != nil {
+			return nil, err
+		}
+		if health != cephHealthOK || migration.StartTime == nil || !checked.After(migration.StartTime.Time) {
+			return migration, nil
+		}
+		migration = migration.DeepCopy()
+		migration.Phase = ocsv1.FailureDomainMigrationCompleted
+		migration.Message = fmt.Sprintf("Ceph is healthy with the %s failure domain", migration.To)
+		r.Log.Info("Failure domain migration completed.", "From", migration.From, "To", migration.To, "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+		r.recorder.Report(sc, corev1.EventTypeNormal, statusutil.EventReasonFailureDomainMigrationCompleted,
+			fmt.Sprintf("Migrated the failure domain from %s to %s", migration.From, migration.To))
+		return migration, nil
+	}
+
+	target, requested := sc.GetAnnotations()[FailureDomainMigrationAnnotation]
+	if !requested {
+		return nil, nil
+	}
+	from := getFailureDomain(sc)
+	if from == target {
+		// the migration is kept until the annotation is removed
+		return migration, nil
+	}
+
+	blocked := func(message string) (*ocsv1.FailureDomainMigration, error) {
+		if migration == nil || migration.Phase != ocsv1.FailureDomainMigrationBlocked || migration.Message != message {
+			r.Log.Info("Failure domain migration is blocked.", "From", from, "To", target, "Reason", message, "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+			r.recorder.Report(sc, corev1.EventTypeWarning, statusutil.EventReasonFailureDomainMigrationBlocked, message)
+		}
+		return &ocsv1.FailureDomainMigration{From: from, To: target, Phase: ocsv1.FailureDomainMigrationBlocked, Message: message}, nil
+	}
+
+	if sc.Spec.FailureDomain != "" {
+		return blocked(fmt.Sprintf("The failure domain is set to %s in the spec", sc.Spec.FailureDomain))
+	}
+	if from != "rack" || target != "zone" {
+		return blocked(fmt.Sprintf("Only the migration of the failure domain from rack to zone is supported, not from %s to %s", from, target))
+	}
+	zones, unlabeled := getNodeZones(sc, nodes)
+	if len(unlabeled) > 0 {
+		return blocked(fmt.Sprintf("The storage nodes %s have no zone label", strings.Join(unlabeled, ", ")))
+	}
+	if minZones := getMinimumZones(sc); len(zones) < minZones {
+		return blocked(fmt.Sprintf("The storage nodes are in %d zones, at least %d are needed", len(zones), minZones))
+	}
+	health, _, err := r.getCephClusterHealth(sc)
+	if err != nil {
+		return nil, err
+	}
+	if health != cephHealthOK {
+		return blocked(fmt.Sprintf("Waiting for Ceph to be healthy before migrating the failure domain, it is %q", health))
+	}
+
+	sc.Status.FailureDomain = target
+	setFailureDomain(sc)
+	startTime := metav1.NewTime(now)
+	r.Log.Info("Migrating the failure domain.", "From", from, "To", target, "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+	r.recorder.Report(sc, corev1.EventTypeNormal, statusutil.EventReasonFailureDomainMigrationStarted,
+		fmt.Sprintf("Migrating the failure domain from %s to %s", from, target))
+	return &ocsv1.FailureDomainMigration{
+		From:      from,
+		To:        target,
+		Phase:     ocsv1.FailureDomainMigrationInProgress,
+		Message:   fmt.Sprintf("Ceph is moving the data to the %s failure domain", target),
+		StartTime: &startTime,
+	}, nil
+}
+
+// getNodeZones returns the zones of the storage nodes, and the nodes which
+// have no zone label
+func getNodeZones(sc *ocsv1.StorageCluster, nodes *corev1.NodeList) (map[string]bool, []string) {
+	zones := map[string]bool{}
+	var unlabeled []string
+	zoneKey, _ := sc.Status.NodeTopologies.GetKeyValues("zone")
+	for _, node := range nodes.Items {
+		if zone, found := node.Labels[zoneKey]; found {
+			zones[zone] = true
+		} else {
+			unlabeled = append(unlabeled, node.Name)
+		}
+	}
+	return zones, unlabeled
+}
+
+// getMinimumZones returns how many zones the zone failure domain needs
+func getMinimumZones(sc *ocsv1.StorageCluster) int {
+	if arbiterEnabled(sc) {
+		return 2
+	}
+	return 3
+}
+
+// getOSDsPerNode counts the OSD pods of the StorageCluster on each node
+func (r *StorageClusterReconciler) getOSDsPerNode(sc *ocsv1.StorageCluster) (map[string]int32, error) {
+	pods := &corev1.PodList{}
+	err := r.Client.List(context.TODO(), pods, client.InNamespace(sc.Namespace), client.MatchingLabels{"app": "rook-ceph-osd"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the OSD pods: %v", err)
+	}
+	osds := map[string]int32{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != "" {
+			osds[pod.Spec.NodeName]++
+		}
+	}
+	return osds, nil
+}
+
+// getCephClusterHealth returns the health of the CephCluster and when Rook
+// last checked it
+func (r *StorageClusterReconciler) getCephClusterHealth(sc *ocsv1.StorageCluster) (string, time.Time, error) {
+	cephCluster := &cephv1.CephCluster{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephCluster(sc), Namespace: sc.Namespace}, cephCluster)
+	if errors.IsNotFound(err) {
+		return "", time.Time{}, nil
+	} else if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to get the CephCluster: %v", err)
+	}
+	if cephCluster.Status.CephStatus == nil {
+		return "", time.Time{}, nil
+	}
+	checked, _ := time.Parse(time.RFC3339, cephCluster.Status.CephStatus.LastChecked)
+	return cephCluster.Status.CephStatus.Health, checked, nil
+}
+
+func hasTopologyDrift(drifts []ocsv1.TopologyDrift, drift ocsv1.TopologyDrift) bool {
+	for _, d := range drifts {
+		if d.Type == drift.Type && d.Message == drift.Message {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	api "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func newOSDPod(name, namespace, nodeName string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: map[string]string{"app": "rook-ceph-osd"}},
+		Spec:       corev1.PodSpec{NodeName: nodeName},
+	}
+}
+
+func findTopologyDrift(drifts []api.TopologyDrift, driftType api.TopologyDriftType) *api.TopologyDrift {
+	for i := range drifts {
+		if drifts[i].Type == driftType {
+			return &drifts[i]
+		}
+	}
+	return nil
+}
+
+func TestDetectTopologyDrift(t *testing.T) {
+	racks := []string{"rack0", "rack1", "rack2"}
+	cases := []struct {
+		label          string
+		nodes          []*corev1.Node
+		osds           map[string]int32
+		expectedDrifts []api.TopologyDriftType
+	}{
+		{
+			label: "the nodes and the OSDs match the racks",
+			nodes: []*corev1.Node{
+				newTestNode("node-a", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack0", zoneTopologyLabel: "a"}),
+				newTestNode("node-b", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack1", zoneTopologyLabel: "a"}),
+				newTestNode("node-c", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack2", zoneTopologyLabel: "b"}),
+			},
+			osds: map[string]int32{"node-a": 1, "node-b": 2, "node-c": 1},
+		},
+		{
+			label: "a rack lost all its nodes",
+			nodes: []*corev1.Node{
+				newTestNode("node-a", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack0", zoneTopologyLabel: "a"}),
+				newTestNode("node-b", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack1", zoneTopologyLabel: "a"}),
+			},
+			osds:           map[string]int32{"node-a": 1, "node-b": 1},
+			expectedDrifts: []api.TopologyDriftType{api.TopologyDriftFailureDomainEmpty},
+		},
+		{
+			label: "the OSDs are unevenly spread",
+			nodes: []*corev1.Node{
+				newTestNode("node-a", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack0", zoneTopologyLabel: "a"}),
+				newTestNode("node-b", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack1", zoneTopologyLabel: "a"}),
+				newTestNode("node-c", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack2", zoneTopologyLabel: "b"}),
+				newTestNode("node-d", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack2", zoneTopologyLabel: "b"}),
+			},
+			osds:           map[string]int32{"node-a": 1, "node-b": 1, "node-c": 2, "node-d": 2},
+			expectedDrifts: []api.TopologyDriftType{api.TopologyDriftOSDImbalance},
+		},
+		{
+			label: "a third zone is available",
+			nodes: []*corev1.Node{
+				newTestNode("node-a", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack0", zoneTopologyLabel: "a"}),
+				newTestNode("node-b", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack1", zoneTopologyLabel: "b"}),
+				newTestNode("node-c", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack2", zoneTopologyLabel: "c"}),
+			},
+			expectedDrifts: []api.TopologyDriftType{api.TopologyDriftZonesAvailable},
+		},
+	}
+
+	for _, c := range cases {
+		sc := createStorageCluster("ocsinit", "rack", []string{"a", "b", "c"})
+		for _, rack := range racks {
+			sc.Status.NodeTopologies.Add(defaults.RackTopologyKey, rack)
+		}
+		setFailureDomain(sc)
+		nodes := &corev1.NodeList{}
+		for _, node := range c.nodes {
+			nodes.Items = append(nodes.Items, *node)
+		}
+		failureDomains, drifts := detectTopologyDrift(sc, nodes, c.osds)
+		assert.Lenf(t, failureDomains, len(racks), "[%s]", c.label)
+		assert.Lenf(t, drifts, len(c.expectedDrifts), "[%s]: %v", c.label, drifts)
+		for _, driftType := range c.expectedDrifts {
+			drift := findTopologyDrift(drifts, driftType)
+			if assert.NotNilf(t, drift, "[%s]: %s not detected", c.label, driftType) {
+				assert.NotEmpty(t, drift.Message)
+			}
+		}
+	}
+
+	// the replaced hosts are not reported
+	sc := createStorageCluster("ocsinit", "host", nil)
+	sc.Status.NodeTopologies.Add(corev1.LabelHostname, "node-a")
+	sc.Status.NodeTopologies.Add(corev1.LabelHostname, "node-old")
+	setFailureDomain(sc)
+	node := newTestNode("node-a", map[string]string{defaults.NodeAffinityKey: ""})
+	_, drifts := detectTopologyDrift(sc, &corev1.NodeList{Items: []corev1.Node{*node}}, nil)
+	assert.Empty(t, drifts)
+}
+
+func TestReconcileTopologyDrift(t *testing.T) {
+	sc := createStorageCluster("ocsinit", "rack", []string{"a", "b"})
+	sc.Namespace = "openshift-storage"
+	for _, rack := range []string{"rack0", "rack1", "rack2"} {
+		sc.Status.NodeTopologies.Add(defaults.RackTopologyKey, rack)
+	}
+	setFailureDomain(sc)
+	cephCluster := &cephv1.CephCluster{ObjectMeta: metav1.ObjectMeta{Name: generateNameForCephCluster(sc), Namespace: sc.Namespace}}
+	cephCluster.Status.CephStatus = &cephv1.CephStatus{Health: "HEALTH_WARN", LastChecked: time.Now().UTC().Format(time.RFC3339)}
+	objs := []runtime.Object{
+		cephCluster,
+		newTestNode("node-a", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack0", zoneTopologyLabel: "a"}),
+		newTestNode("node-b", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack1", zoneTopologyLabel: "b"}),
+		newTestNode("node-c", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack2"}),
+		newOSDPod("osd-0", sc.Namespace, "node-a"),
+		newOSDPod("osd-1", sc.Namespace, "node-b"),
+		newOSDPod("osd-2", sc.Namespace, "node-c"),
+	}
+	reconciler := createFakeStorageClusterReconciler(t, objs...)
+
+	assert.NoError(t, reconciler.reconcileTopologyDrift(sc))
+	condition := conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionTopologyDegraded)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, api.TopologyHealthy, condition.Reason)
+	}
+	if assert.NotNil(t, sc.Status.Topology) && assert.Len(t, sc.Status.Topology.FailureDomains, 3) {
+		assert.Equal(t, api.FailureDomainUsage{Value: "rack0", Nodes: 1, OSDs: 1}, sc.Status.Topology.FailureDomains[0])
+	}
+
+	// the migration is blocked while a node has no zone
+	sc.Annotations = map[string]string{FailureDomainMigrationAnnotation: "zone"}
+	assert.NoError(t, reconciler.reconcileTopologyDrift(sc))
+	migration := sc.Status.Topology.Migration
+	if assert.NotNil(t, migration) {
+		assert.Equal(t, api.FailureDomainMigrationBlocked, migration.Phase)
+		assert.Contains(t, migration.Message, "node-c")
+	}
+	assert.Equal(t, "rack", getFailureDomain(sc))
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionFailureDomainMigrating)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, api.FailureDomainNotMigrated, condition.Reason)
+	}
+
+	// a third zone makes the migration available, but Ceph isn't healthy
+	node := newTestNode("node-c", map[string]string{defaults.NodeAffinityKey: "", defaults.RackTopologyKey: "rack2", zoneTopologyLabel: "c"})
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), node))
+	sc.Status.NodeTopologies.Add(zoneTopologyLabel, "c")
+	assert.NoError(t, reconciler.reconcileTopologyDrift(sc))
+	assert.NotNil(t, findTopologyDrift(sc.Status.Topology.Drifts, api.TopologyDriftZonesAvailable))
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionTopologyDegraded)
+	assert.Equal(t, api.FailureDomainMigrationAvailable, condition.Reason)
+	assert.Equal(t, api.FailureDomainMigrationBlocked, sc.Status.Topology.Migration.Phase)
+	assert.Contains(t, sc.Status.Topology.Migration.Message, "HEALTH_WARN")
+
+	// then the failure domain is migrated
+	cephCluster.Status.CephStatus.Health = cephHealthOK
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), cephCluster))
+	assert.NoError(t, reconciler.reconcileTopologyDrift(sc))
+	migration = sc.Status.Topology.Migration
+	if assert.NotNil(t, migration) {
+		assert.Equal(t, api.FailureDomainMigrationInProgress, migration.Phase)
+		assert.Equal(t, "rack", migration.From)
+		assert.Equal(t, "zone", migration.To)
+	}
+	assert.Equal(t, "zone", getFailureDomain(sc))
+	assert.Equal(t, zoneTopologyLabel, getFailureDomainKey(sc))
+	assert.Empty(t, sc.Status.Topology.Drifts)
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionFailureDomainMigrating)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionTrue, condition.Status)
+		assert.Equal(t, api.FailureDomainMigrating, condition.Reason)
+	}
+
+	// and completes once Ceph is healthy after the change
+	assert.NoError(t, reconciler.reconcileTopologyDrift(sc))
+	assert.Equal(t, api.FailureDomainMigrationInProgress, sc.Status.Topology.Migration.Phase)
+	cephCluster.Status.CephStatus.LastChecked = migration.StartTime.Add(time.Minute).UTC().Format(time.RFC3339)
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), cephCluster))
+	assert.NoError(t, reconciler.reconcileTopologyDrift(sc))
+	assert.Equal(t, api.FailureDomainMigrationCompleted, sc.Status.Topology.Migration.Phase)
+	condition = conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionFailureDomainMigrating)
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, corev1.ConditionFalse, condition.Status)
+		assert.Equal(t, api.FailureDomainMigrated, condition.Reason)
+	}
+
+	// the migration is only reported while it is requested
+	delete(sc.Annotations, FailureDomainMigrationAnnotation)
+	assert.NoError(t, reconciler.reconcileTopologyDrift(sc))
+	assert.Nil(t, sc.Status.Topology.Migration)
+	assert.Nil(t, conditionsv1.FindStatusCondition(sc.Status.Conditions, api.ConditionFailureDomainMigrating))
+
+	// only the migration from rack to zone is supported
+	sc.Annotations[FailureDomainMigrationAnnotation] = "host"
+	assert.NoError(t, reconciler.reconcileTopologyDrift(sc))
+	assert.Equal(t, api.FailureDomainMigrationBlocked, sc.Status.Topology.Migration.Phase)
+	assert.Equal(t, fmt.Sprintf("Only the migration of the failure domain from rack to zone is supported, not from %s to %s", "zone", "host"),
+		sc.Status.Topology.Migration.Message)
+}
+
+func TestTopologyLabelsChanged(t *testing.T) {
+	labels := map[string]string{
+		defaults.NodeAffinityKey: "",
+		defaults.RackTopologyKey: "rack0",
+		zoneTopologyLabel:        "a",
+		"beta.kubernetes.io/os":  "linux",
+	}
+	cases := []struct {
+		label    string
+		update   func(map[string]string)
+		expected bool
+	}{
+		{label: "no change", update: func(map[string]string) {}},
+		{label: "an unrelated label is added", update: func(l map[string]string) { l["app"] = "test" }},
+		{label: "an unrelated label is removed", update: func(l map[string]string) { delete(l, "beta.kubernetes.io/os") }},
+		{label: "the rack is changed", update: func(l map[string]string) { l[defaults.RackTopologyKey] = "rack1" }, expected: true},
+		{label: "the zone is removed", update: func(l map[string]string) { delete(l, zoneTopologyLabel) }, expected: true},
+		{label: "the node is no longer a storage node", update: func(l map[string]string) { delete(l, defaults.NodeAffinityKey) }, expected: true},
+		{label: "the node becomes a master node", update: func(l map[string]string) { l["node-role.kubernetes.io/master"] = "" }, expected: true},
+	}
+
+	for _, c := range cases {
+		newLabels := map[string]string{}
+		for key, value := range labels {
+			newLabels[key] = value
+		}
+		c.update(newLabels)
+		assert.Equalf(t, c.expected, topologyLabelsChanged(labels, newLabels), "[%s]", c.label)
+	}
+}
@@ -835,6 +835,10 @@ func TestEnsureNodeRack(t *testing.T) {
 
 	for _, tc := range testcases {
 		reconciler := createFakeStorageClusterReconciler(t, tc.nodeList)
+		labeled := map[string]bool{}
+		for _, node := range tc.nodeList.Items {
+			_, labeled[node.Name] = node.Labels[defaults.RackTopologyKey]
+		}
 		err := reconciler.ensureNodeRacks(tc.nodeList, tc.minRacks, tc.nodeRacks, tc.topologyMap)
 		assert.NoError(t, err)
 
@@ -846,6 +850,8 @@ func TestEnsureNodeRack(t *testing.T) {
 				assert.Containsf(t, key, defaults.RackTopologyKey, "[%s]: failed to added rack label", tc.label)
 				assert.Containsf(t, value, fmt.Sprintf("rack%d", i), "[%s]: failed to added rack label", tc.label)
 			}
+			// only the racks given by ensureNodeRacks are marked
+			assert.Equalf(t, !labeled[node.Name], isGeneratedRack(node), "[%s]: unexpected generated rack of %s", tc.label, node.Name)
 		}
 
 	}
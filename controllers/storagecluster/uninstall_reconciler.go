@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	nbv1 "github.com/noobaa/noobaa-operator/v2/pkg/apis/noobaa/v1alpha1"
 	ocsv1 "github.com/openshift/ocs-operator/api/v1"
 	"github.com/openshift/ocs-operator/controllers/defaults"
+	statusutil "github.com/openshift/ocs-operator/controllers/util"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -37,52 +41,154 @@ const (
 	UninstallModeForced UninstallModeType = "forced"
 	// UninstallModeGraceful when set, sets the uninstall mode for Rook and Noobaa to graceful.
 	UninstallModeGraceful UninstallModeType = "graceful"
+
+	// cleanupJobPrefix is the prefix of the names of the Jobs Rook runs on
+	// each node to clean up a deleted CephCluster
+	cleanupJobPrefix = "cluster-cleanup-job-"
+	// cleanupJobsStartTimeout is how long the uninstall waits for the
+	// cleanup Jobs to be created, and cleanupJobsTimeout for them to finish
+	cleanupJobsStartTimeout = 2 * time.Minute
+	cleanupJobsTimeout      = 30 * time.Minute
 )
 
-//nolint:unused // func deleteNodeAffinityKeyFromNodes is not used. For Future usuage func is created.
 // deleteNodeAffinityKeyFromNodes deletes the default NodeAffinityKey from the OCS nodes
-func (r *StorageClusterReconciler) deleteNodeAffinityKeyFromNodes(sc *ocsv1.StorageCluster) (err error) {
+func (r *StorageClusterReconciler) deleteNodeAffinityKeyFromNodes(sc *ocsv1.StorageCluster) (string, error) {
 
-	// We should delete the label only when the StorageCluster is using the default NodeAffinityKey
-	if sc.Spec.LabelSelector == nil {
-		nodes, err := r.getStorageClusterEligibleNodes(sc)
-		if err != nil {
-			r.Log.Error(err, "Uninstall: Unable to obtain the list of nodes eligible for the Storage Cluster.", "StorageCluster", klog.KRef(sc.Namespace, sc.Name)) //nolint:gosimple
-			return nil
+	// We should delete the label only when the StorageCluster is using the default NodeAffinityKey,
+	// and the cleanup policy doesn't retain the nodes as they are
+	if sc.Spec.LabelSelector != nil || sc.Spec.ExternalStorage.Enable ||
+		sc.GetAnnotations()[CleanupPolicyAnnotation] == string(CleanupPolicyRetain) {
+		return "", nil
+	}
+
+	nodes, err := r.getStorageClusterEligibleNodes(sc)
+	if err != nil {
+		r.Log.Error(err, "Uninstall: Unable to obtain the list of nodes eligible for the Storage Cluster.", "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+		return "", fmt.Errorf("uninstall: Unable to list the storage nodes: %v", err)
+	}
+	var failed []string
+	for _, node := range nodes.Items {
+		r.Log.Info("Uninstall: Deleting OCS label from Node.", "Node", node.Name)
+		newNode := node.DeepCopy()
+		delete(newNode.ObjectMeta.Labels, defaults.NodeAffinityKey)
+		if err := r.patchNode(node, newNode); err != nil {
+			r.Log.Error(err, "Uninstall: Unable to remove the NodeAffinityKey from the Node.", "Node", node.Name)
+			failed = append(failed, node.Name)
 		}
-		for _, node := range nodes.Items {
-			r.Log.Info("Uninstall: Deleting OCS label from Node.", "Node", node.Name)
-			new := node.DeepCopy()
-			delete(new.ObjectMeta.Labels, defaults.NodeAffinityKey)
-
-			oldJSON, err := json.Marshal(node)
-			if err != nil {
-				r.Log.Error(err, "Uninstall: Unable to remove the NodeAffinityKey from the Node.", "Node", node.Name)
-				continue
-			}
+	}
+	if len(failed) > 0 {
+		return "", fmt.Errorf("uninstall: Unable to remove the %s label from the nodes %s", defaults.NodeAffinityKey, strings.Join(failed, ", "))
+	}
+	return fmt.Sprintf("Removed the %s label from %d nodes", defaults.NodeAffinityKey, len(nodes.Items)), nil
+}
 
-			newJSON, err := json.Marshal(new)
-			if err != nil {
-				r.Log.Error(err, "Uninstall: Unable to remove the NodeAffinityKey from the Node.", "Node", node.Name)
-				continue
-			}
+// deleteNodeRacks deletes the rack labels ensureNodeRacks put on the OCS
+// nodes unless the cleanup policy retains them, the racks defined by the
+// admin are kept
+func (r *StorageClusterReconciler) deleteNodeRacks(sc *ocsv1.StorageCluster) (string, error) {
+	if sc.Spec.ExternalStorage.Enable || getFailureDomain(sc) != "rack" ||
+		sc.GetAnnotations()[CleanupPolicyAnnotation] == string(CleanupPolicyRetain) {
+		return "", nil
+	}
 
-			patch, err := strategicpatch.CreateTwoWayMergePatch(oldJSON, newJSON, node)
-			if err != nil {
-				r.Log.Error(err, "Uninstall: Unable to remove the NodeAffinityKey from the Node.", "Node", node.Name)
-				continue
-			}
+	nodes, err := r.getStorageClusterEligibleNodes(sc)
+	if err != nil {
+		r.Log.Error(err, "Uninstall: Unable to obtain the list of nodes eligible for the Storage Cluster.", "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+		return "", fmt.Errorf("uninstall: Unable to list the storage nodes: %v", err)
+	}
+	var deleted, failed []string
+	for _, node := range nodes.Items {
+		if !isGeneratedRack(node) {
+			continue
+		}
+		r.Log.Info("Uninstall: Deleting rack label from Node.", "Node", node.Name, "Label", defaults.RackTopologyKey, "Value", node.Labels[defaults.RackTopologyKey])
+		newNode := node.DeepCopy()
+		delete(newNode.ObjectMeta.Labels, defaults.RackTopologyKey)
+		delete(newNode.ObjectMeta.Annotations, generatedRackAnnotation)
+		if err := r.patchNode(node, newNode); err != nil {
+			r.Log.Error(err, "Uninstall: Unable to remove the rack label from the Node.", "Node", node.Name)
+			failed = append(failed, node.Name)
+			continue
+		}
+		deleted = append(deleted, node.Name)
+	}
+	if len(failed) > 0 {
+		return "", fmt.Errorf("uninstall: Unable to remove the %s label from the nodes %s", defaults.RackTopologyKey, strings.Join(failed, ", "))
+	}
+	return fmt.Sprintf("Removed the %s label from %d nodes", defaults.RackTopologyKey, len(deleted)), nil
+}
 
-			err = r.Client.Patch(context.TODO(), &node, client.RawPatch(types.StrategicMergePatchType, patch))
-			if err != nil {
-				r.Log.Error(err, "Uninstall: Unable to remove the NodeAffinityKey from the Node.", "Node", node.Name)
-				continue
-			}
+// patchNode patches the node with the changes made to its copy
+func (r *StorageClusterReconciler) patchNode(node corev1.Node, newNode *corev1.Node) error {
+	patch, err := generateStrategicPatch(node, newNode)
+	if err != nil {
+		return err
+	}
+	return r.Client.Patch(context.TODO(), &node, patch)
+}
+
+// waitForCleanupJobs waits for the Jobs Rook runs on the nodes to wipe the
+// data directories and the disks of the deleted CephCluster, when the cleanup
+// policy requests it. Their outcome is reported once they all completed or
+// failed, or once cleanupJobsTimeout has passed since the CephCluster was
+// deleted.
+func (r *StorageClusterReconciler) waitForCleanupJobs(sc *ocsv1.StorageCluster) (string, error) {
+	if sc.Spec.ExternalStorage.Enable || sc.GetAnnotations()[CleanupPolicyAnnotation] != string(CleanupPolicyDelete) {
+		return "", nil
+	}
 
+	jobs := &batchv1.JobList{}
+	if err := r.Client.List(context.TODO(), jobs, client.InNamespace(sc.Namespace)); err != nil {
+		r.Log.Error(err, "Uninstall: Unable to list the cleanup Jobs.", "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+		return "", fmt.Errorf("uninstall: Unable to list the cleanup Jobs: %v", err)
+	}
+	var completed, failed, running []string
+	for _, job := range jobs.Items {
+		if !strings.HasPrefix(job.Name, cleanupJobPrefix) {
+			continue
 		}
+		switch {
+		case isJobConditionTrue(&job, batchv1.JobComplete):
+			completed = append(completed, job.Name)
+		case isJobConditionTrue(&job, batchv1.JobFailed):
+			failed = append(failed, job.Name)
+		default:
+			running = append(running, job.Name)
+		}
+	}
 
+	// Rook creates the Jobs once the CephCluster is deleted, none are
+	// expected if it was already gone when the uninstall started
+	deletionTime, deleted := getCephClusterDeletionTime(sc)
+	deletedSince := time.Since(deletionTime)
+	if deleted && len(running) > 0 && deletedSince < cleanupJobsTimeout {
+		r.Log.Info("Uninstall: Waiting for the cleanup Jobs to complete.", "Jobs", running, "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+		return "", fmt.Errorf("uninstall: Waiting for the cleanup Jobs %s to complete", strings.Join(running, ", "))
 	}
-	return nil
+	if deleted && len(completed)+len(failed)+len(running) == 0 && deletedSince < cleanupJobsStartTimeout {
+		r.Log.Info("Uninstall: Waiting for the cleanup Jobs to start.", "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+		return "", fmt.Errorf("uninstall: Waiting for the cleanup Jobs to start")
+	}
+
+	outcome := fmt.Sprintf("%d cleanup Jobs completed", len(completed))
+	if len(failed) > 0 || len(running) > 0 {
+		unfinished := append(failed, running...)
+		outcome = fmt.Sprintf("%s, the cleanup Jobs %s failed or timed out, the data directories and the disks of their nodes must be cleaned up manually",
+			outcome, strings.Join(unfinished, ", "))
+		r.Log.Info("Uninstall: Some cleanup Jobs did not complete.", "Jobs", unfinished, "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+		r.recorder.ReportIfNotPresent(sc, corev1.EventTypeWarning, statusutil.EventReasonUninstallCleanupFailed, outcome)
+	}
+	return outcome, nil
+}
+
+// isJobConditionTrue returns whether the Job has the given condition
+func isJobConditionTrue(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
 }
 
 // deleteNodeTaint deletes the default NodeTolerationKey from the OCS nodes
@@ -268,61 +374,128 @@ func (r *StorageClusterReconciler) reconcileUninstallAnnotations(sc *ocsv1.Stora
 	return nil
 }
 
-// deleteResources is the function where the storageClusterFinalizer is handled
-// Every function that is called within this function should be idempotent
-func (r *StorageClusterReconciler) deleteResources(sc *ocsv1.StorageCluster) error {
+// uninstallStep is a step of the uninstall, run until it succeeds before the
+// next one starts. Every step should be idempotent.
+type uninstallStep struct {
+	name string
+	run  uninstallStepFunc
+}
 
-	var obj ocsQuickStarts
-	err := obj.ensureDeleted(r, sc)
-	if err != nil {
-		return err
-	}
+// uninstallStepFunc runs a step of the uninstall, and returns its outcome once
+// it completes
+type uninstallStepFunc func(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) (string, error)
 
-	err = r.setRookUninstallandCleanupPolicy(sc)
-	if err != nil {
-		return err
+// withoutOutcome adapts the steps which have no outcome to report
+func withoutOutcome(run func(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) error) uninstallStepFunc {
+	return func(r *StorageClusterReconciler, sc *ocsv1.StorageCluster) (string, error) {
+		return "", run(r, sc)
 	}
+}
 
-	err = r.setNoobaaUninstallMode(sc)
-	if err != nil {
-		return err
+// getUninstallSteps returns the steps of the uninstall of the StorageCluster,
+// in order
+func getUninstallSteps(sc *ocsv1.StorageCluster) []uninstallStep {
+	// an additional external cluster shares everything else with the
+	// cluster managed by Rook in its namespace
+	if isAdditionalExternalStorageCluster(sc) {
+		return []uninstallStep{
+			{"StorageClasses", withoutOutcome((&ocsStorageClass{}).ensureDeleted)},
+			{"SnapshotClasses", withoutOutcome((&ocsSnapshotClass{}).ensureDeleted)},
+			{"ExternalResources", withoutOutcome((&ocsExternalResources{}).ensureDeleted)},
+		}
 	}
 
-	objs := []resourceManager{
-		&ocsNoobaaSystem{},
-		&ocsCephCluster{},
-		&ocsCephRGWRoutes{},
-		&ocsCephObjectStoreUsers{},
-		&ocsCephObjectStores{},
-		&ocsCephFilesystems{},
-		&ocsCephBlockPools{},
-		&ocsSnapshotClass{},
-		&ocsStorageClass{},
+	return []uninstallStep{
+		{"QuickStarts", withoutOutcome((&ocsQuickStarts{}).ensureDeleted)},
+		{"CephClusterCleanupPolicy", withoutOutcome((*StorageClusterReconciler).setRookUninstallandCleanupPolicy)},
+		{"NooBaaUninstallMode", withoutOutcome((*StorageClusterReconciler).setNoobaaUninstallMode)},
+		{"RetainData", (*StorageClusterReconciler).retainClusterData},
+		{"NooBaa", withoutOutcome((&ocsNoobaaSystem{}).ensureDeleted)},
+		{"CephCluster", withoutOutcome((&ocsCephCluster{}).ensureDeleted)},
+		{"CephRGWRoutes", withoutOutcome((&ocsCephRGWRoutes{}).ensureDeleted)},
+		{"CephObjectStoreUsers", withoutOutcome((&ocsCephObjectStoreUsers{}).ensureDeleted)},
+		{"CephObjectStores", withoutOutcome((&ocsCephObjectStores{}).ensureDeleted)},
+		{"CephFilesystems", withoutOutcome((&ocsCephFilesystems{}).ensureDeleted)},
+		{"CephBlockPools", withoutOutcome((&ocsCephBlockPools{}).ensureDeleted)},
+		{"SnapshotClasses", withoutOutcome((&ocsSnapshotClass{}).ensureDeleted)},
+		{"StorageClasses", withoutOutcome((&ocsStorageClass{}).ensureDeleted)},
+		{"Tenants", withoutOutcome((&ocsTenants{}).ensureDeleted)},
+		{"NodeTaints", withoutOutcome((*StorageClusterReconciler).deleteNodeTaint)},
+		{"KMS", withoutOutcome((&ocsKMS{}).ensureDeleted)},
+		{"KMSResources", withoutOutcome(deleteKMSResources)},
+		// the cleanup Jobs are scheduled on the nodes with the labels
+		{"CleanupJobs", (*StorageClusterReconciler).waitForCleanupJobs},
+		{"NodeRackLabels", (*StorageClusterReconciler).deleteNodeRacks},
+		{"NodeLabels", (*StorageClusterReconciler).deleteNodeAffinityKeyFromNodes},
 	}
+}
 
-	for _, obj := range objs {
-		err = obj.ensureDeleted(r, sc)
-		if err != nil {
-			return err
+// deleteResources is the function where the storageClusterFinalizer is handled.
+// It runs the uninstall steps in order and stops at the first one which is
+// still in progress, and records the progress of each step in the status.
+func (r *StorageClusterReconciler) deleteResources(sc *ocsv1.StorageCluster) error {
+	now := metav1.Now()
+	var err error
+	var inProgress string
+	var steps []ocsv1.UninstallStep
+	for _, step := range getUninstallSteps(sc) {
+		state, message := ocsv1.UninstallStepPending, ""
+		if err == nil {
+			var outcome string
+			if outcome, err = step.run(r, sc); err != nil {
+				state, message, inProgress = ocsv1.UninstallStepInProgress, err.Error(), step.name
+				r.Log.Info("Uninstall: Step is in progress.", "Step", step.name, "Status", message, "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+			} else {
+				state, message = ocsv1.UninstallStepCompleted, outcome
+			}
 		}
+		steps = append(steps, newUninstallStep(sc, step.name, state, message, now))
 	}
 
-	err = r.deleteNodeTaint(sc)
-	if err != nil {
-		return err
+	if sc.Status.Uninstall == nil {
+		sc.Status.Uninstall = &ocsv1.UninstallStatus{}
 	}
-
-	err = deleteKMSResources(r, sc)
+	sc.Status.Uninstall.Steps = steps
 	if err != nil {
-		return err
+		return fmt.Errorf("%s: %v", inProgress, err)
 	}
+	return nil
+}
 
-	// TODO: skip the deletion of these labels till we figure out a way to wait
-	// for the cleanup jobs
-	//err = r.deleteNodeAffinityKeyFromNodes(sc)
-	//if err != nil {
-	//	return err
-	//}
+// getCephClusterDeletionTime returns when the uninstall saw the CephCluster
+// deleted. The CephCluster step of a cluster which was already gone completed
+// along with the first step, in the first uninstall attempt.
+func getCephClusterDeletionTime(sc *ocsv1.StorageCluster) (time.Time, bool) {
+	if sc.Status.Uninstall == nil || len(sc.Status.Uninstall.Steps) == 0 {
+		return time.Time{}, false
+	}
+	started := sc.Status.Uninstall.Steps[0].LastTransitionTime
+	for _, step := range sc.Status.Uninstall.Steps {
+		if step.Name != "CephCluster" {
+			continue
+		}
+		// the previous attempt was still waiting for it
+		if step.State != ocsv1.UninstallStepCompleted {
+			return time.Now(), true
+		}
+		if step.LastTransitionTime != nil && started != nil && step.LastTransitionTime.After(started.Time) {
+			return step.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
 
-	return nil
+// newUninstallStep returns the status of a step, which keeps its last
+// transition time while its state doesn't change
+func newUninstallStep(sc *ocsv1.StorageCluster, name string, state ocsv1.UninstallStepState, message string, now metav1.Time) ocsv1.UninstallStep {
+	step := ocsv1.UninstallStep{Name: name, State: state, Message: message, LastTransitionTime: &now}
+	if sc.Status.Uninstall != nil {
+		for _, previous := range sc.Status.Uninstall.Steps {
+			if previous.Name == name && previous.State == state {
+				step.LastTransitionTime = previous.LastTransitionTime
+				break
+			}
+		}
+	}
+	return step
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"testing"
+	"time"
 
 	consolev1 "github.com/openshift/api/console/v1"
 
@@ -13,10 +14,12 @@ import (
 	"github.com/openshift/ocs-operator/controllers/defaults"
 	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
 	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -273,7 +276,7 @@ func assertTestDeleteNodeAffinityKeyFromNodes(
 	}
 
 	// delete NodeAffinityKey
-	err = reconciler.deleteNodeAffinityKeyFromNodes(sc)
+	_, err = reconciler.deleteNodeAffinityKeyFromNodes(sc)
 	assert.NoError(t, err)
 
 	nodes, err = reconciler.getStorageClusterEligibleNodes(sc)
@@ -845,3 +848,143 @@ func TestDeleteQuickStarts(t *testing.T) {
 	actualQuickStarts := getActualQuickStarts(t, cases, &reconciler)
 	assert.Equal(t, 0, len(actualQuickStarts))
 }
+
+func TestWaitForCleanupJobs(t *testing.T) {
+	newJob := func(name string, conditionType batchv1.JobConditionType) *batchv1.Job {
+		job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "openshift-storage"}}
+		if conditionType != "" {
+			job.Status.Conditions = []batchv1.JobCondition{{Type: conditionType, Status: corev1.ConditionTrue}}
+		}
+		return job
+	}
+	newStorageCluster := func(cephClusterDeleted time.Duration) *api.StorageCluster {
+		sc := &api.StorageCluster{ObjectMeta: metav1.ObjectMeta{
+			Name:        "ocsinit",
+			Namespace:   "openshift-storage",
+			Annotations: map[string]string{CleanupPolicyAnnotation: string(CleanupPolicyDelete)},
+		}}
+		startTime := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+		deletionTime := startTime
+		if cephClusterDeleted != 0 {
+			deletionTime = metav1.NewTime(time.Now().Add(-cephClusterDeleted))
+		}
+		sc.Status.Uninstall = &api.UninstallStatus{Steps: []api.UninstallStep{
+			{Name: "QuickStarts", State: api.UninstallStepCompleted, LastTransitionTime: &startTime},
+			{Name: "CephCluster", State: api.UninstallStepCompleted, LastTransitionTime: &deletionTime},
+		}}
+		return sc
+	}
+
+	testcases := []struct {
+		label              string
+		jobs               []runtime.Object
+		cephClusterDeleted time.Duration
+		retain             bool
+		inProgress         bool
+		outcome            string
+	}{
+		{
+			label:              "Case 1: the Jobs aren't created yet",
+			cephClusterDeleted: time.Second,
+			inProgress:         true,
+		},
+		{
+			label:              "Case 2: no Job was created",
+			cephClusterDeleted: 3 * time.Minute,
+			outcome:            "0 cleanup Jobs completed",
+		},
+		{
+			label:              "Case 3: a Job is running",
+			jobs:               []runtime.Object{newJob("cluster-cleanup-job-node-a", batchv1.JobComplete), newJob("cluster-cleanup-job-node-b", "")},
+			cephClusterDeleted: time.Second,
+			inProgress:         true,
+		},
+		{
+			label:              "Case 4: a Job failed",
+			jobs:               []runtime.Object{newJob("cluster-cleanup-job-node-a", batchv1.JobComplete), newJob("cluster-cleanup-job-node-b", batchv1.JobFailed)},
+			cephClusterDeleted: time.Second,
+			outcome:            "cluster-cleanup-job-node-b failed",
+		},
+		{
+			label:              "Case 5: a Job timed out",
+			jobs:               []runtime.Object{newJob("cluster-cleanup-job-node-b", "")},
+			cephClusterDeleted: time.Hour,
+			outcome:            "cluster-cleanup-job-node-b failed or timed out",
+		},
+		{
+			label:              "Case 6: the other Jobs are ignored",
+			jobs:               []runtime.Object{newJob("rook-ceph-osd-prepare-node-a", "")},
+			cephClusterDeleted: time.Second,
+			inProgress:         true,
+		},
+		{
+			label:              "Case 7: nothing is cleaned up with the retain policy",
+			jobs:               []runtime.Object{newJob("cluster-cleanup-job-node-b", "")},
+			cephClusterDeleted: time.Second,
+			retain:             true,
+		},
+		{
+			label:   "Case 8: the CephCluster was gone before the uninstall",
+			outcome: "0 cleanup Jobs completed",
+		},
+	}
+
+	for _, tc := range testcases {
+		reconciler := createFakeStorageClusterReconciler(t, tc.jobs...)
+		sc := newStorageCluster(tc.cephClusterDeleted)
+		if tc.retain {
+			sc.Annotations[CleanupPolicyAnnotation] = string(CleanupPolicyRetain)
+		}
+		outcome, err := reconciler.waitForCleanupJobs(sc)
+		if tc.inProgress {
+			assert.Errorf(t, err, "[%s]: the cleanup Jobs are not waited for", tc.label)
+			continue
+		}
+		assert.NoErrorf(t, err, "[%s]", tc.label)
+		assert.Containsf(t, outcome, tc.outcome, "[%s]", tc.label)
+	}
+}
+
+func TestDeleteNodeRacks(t *testing.T) {
+	newNode := func(name, rack, generatedRack string) *corev1.Node {
+		node := newTestNode(name, map[string]string{
+			defaults.NodeAffinityKey: "",
+			defaults.RackTopologyKey: rack,
+		})
+		if generatedRack != "" {
+			node.Annotations = map[string]string{generatedRackAnnotation: generatedRack}
+		}
+		return node
+	}
+	reconciler := createFakeStorageClusterReconciler(t, newNode("node-a", "rack0", "rack0"), newNode("node-b", "rack1", "rack1"),
+		newNode("node-c", "rack0", ""), newNode("node-d", "rack-admin", "rack2"))
+	sc := &api.StorageCluster{}
+	sc.Status.FailureDomain = "rack"
+
+	// the racks the admin set or changed are kept
+	outcome, err := reconciler.deleteNodeRacks(sc)
+	assert.NoError(t, err)
+	assert.Contains(t, outcome, "from 2 nodes")
+	for name, expected := range map[string]string{"node-a": "", "node-b": "", "node-c": "rack0", "node-d": "rack-admin"} {
+		node := &corev1.Node{}
+		assert.NoError(t, reconciler.Client.Get(context.TODO(), types.NamespacedName{Name: name}, node))
+		assert.Equalf(t, expected, node.Labels[defaults.RackTopologyKey], "node %s", name)
+		if expected == "" {
+			assert.NotContainsf(t, node.Annotations, generatedRackAnnotation, "node %s", name)
+		}
+	}
+
+	// the racks are kept with the retain cleanup policy
+	reconciler = createFakeStorageClusterReconciler(t, newNode("node-a", "rack0", "rack0"))
+	sc.Annotations = map[string]string{CleanupPolicyAnnotation: string(CleanupPolicyRetain)}
+	outcome, err = reconciler.deleteNodeRacks(sc)
+	assert.NoError(t, err)
+	assert.Empty(t, outcome)
+
+	// the racks of another failure domain are not generated
+	sc.Annotations = nil
+	sc.Status.FailureDomain = "zone"
+	outcome, err = reconciler.deleteNodeRacks(sc)
+	assert.NoError(t, err)
+	assert.Empty(t, outcome)
+}
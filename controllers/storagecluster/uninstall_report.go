@@ -0,0 +1,361 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	nbv1 "github.com/noobaa/noobaa-operator/v2/pkg/apis/noobaa/v1alpha1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/controllers/defaults"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// UninstallDryRunAnnotation requests, when set to "true", a report of
+	// the resources which would block the uninstall of the StorageCluster or
+	// be destroyed by it, in its status. Nothing is deleted.
+	UninstallDryRunAnnotation = "uninstall.ocs.openshift.io/dry-run"
+
+	// uninstallReportRefreshInterval is how often the uninstall report is
+	// generated again while it is requested
+	uninstallReportRefreshInterval = time.Minute
+)
+
+// objectBucketGroupVersion is the API of the ObjectBucketClaims and the
+// ObjectBuckets, which are read as unstructured objects
+var objectBucketGroupVersion = schema.GroupVersion{Group: "objectbucket.io", Version: "v1alpha1"}
+
+// isUninstallDryRun returns true if the uninstall report is requested
+func isUninstallDryRun(sc *ocsv1.StorageCluster) bool {
+	return sc.GetAnnotations()[UninstallDryRunAnnotation] == "true"
+}
+
+// reconcileUninstallReport generates the uninstall report while it is
+// requested, and removes it otherwise
+func (r *StorageClusterReconciler) reconcileUninstallReport(sc *ocsv1.StorageCluster) error {
+	if !isUninstallDryRun(sc) {
+		if sc.Status.Uninstall != nil {
+			sc.Status.Uninstall.Report = nil
+			if len(sc.Status.Uninstall.Steps) == 0 {
+				sc.Status.Uninstall = nil
+			}
+		}
+		return nil
+	}
+
+	r.Log.Info("Uninstall: Generating the uninstall report.", "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+	report, err := r.generateUninstallReport(sc, time.Now())
+	if err != nil {
+		r.Log.Error(err, "Uninstall: Failed to generate the uninstall report.", "StorageCluster", klog.KRef(sc.Namespace, sc.Name))
+		return err
+	}
+	if sc.Status.Uninstall == nil {
+		sc.Status.Uninstall = &ocsv1.UninstallStatus{}
+	}
+	sc.Status.Uninstall.Report = report
+	return nil
+}
+
+// getUninstallReportRequeueAfter returns when the StorageCluster must be
+// reconciled again to refresh the uninstall report, 0 if it doesn't need to
+func getUninstallReportRequeueAfter(sc *ocsv1.StorageCluster) time.Duration {
+	if !isUninstallDryRun(sc) {
+		return 0
+	}
+	return uninstallReportRefreshInterval
+}
+
+// generateUninstallReport lists, by namespace, the PVCs, RBD images,
+// ObjectBucketClaims and buckets which use the storage of the StorageCluster,
+// the node taints and labels the uninstall removes, and the clusters it
+// destroys. In the graceful mode the uninstall waits for the volumes and the
+// buckets to be deleted, in the forced mode it deletes them along with their
+// data.
+func (r *StorageClusterReconciler) generateUninstallReport(sc *ocsv1.StorageCluster, now time.Time) (*ocsv1.UninstallReport, error) {
+	report := &ocsv1.UninstallReport{
+		GeneratedTime: metav1.NewTime(now),
+		Mode:          string(UninstallModeGraceful),
+		CleanupPolicy: string(CleanupPolicyDelete),
+	}
+	if sc.GetAnnotations()[UninstallModeAnnotation] == string(UninstallModeForced) {
+		report.Mode = string(UninstallModeForced)
+	}
+	if sc.GetAnnotations()[CleanupPolicyAnnotation] == string(CleanupPolicyRetain) {
+		report.CleanupPolicy = string(CleanupPolicyRetain)
+	}
+	dataImpact := ocsv1.UninstallImpactBlocking
+	dataMessage := "must be deleted before the uninstall completes"
+	if report.Mode == string(UninstallModeForced) {
+		dataImpact = ocsv1.UninstallImpactDestroyed
+		dataMessage = "is deleted along with its data"
+	}
+
+	resources := map[string][]ocsv1.UninstallAffectedResource{}
+	add := func(namespace string, resource ocsv1.UninstallAffectedResource) {
+		resources[namespace] = append(resources[namespace], resource)
+		if resource.Impact == ocsv1.UninstallImpactBlocking {
+			report.Blocked = true
+		}
+	}
+
+	storageClasses, err := r.getUninstallStorageClasses(sc)
+	if err != nil {
+		return nil, err
+	}
+	clusterIDs, err := r.getAdditionalCSIClusterIDs(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	if err := r.Client.List(context.TODO(), pvcs); err != nil {
+		return nil, fmt.Errorf("failed to list the PersistentVolumeClaims: %v", err)
+	}
+	for _, pvc := range pvcs.Items {
+		if pvc.Spec.StorageClassName == nil || !storageClasses[*pvc.Spec.StorageClassName] {
+			continue
+		}
+		add(pvc.Namespace, ocsv1.UninstallAffectedResource{
+			Kind:    "PersistentVolumeClaim",
+			Name:    pvc.Name,
+			Impact:  dataImpact,
+			Message: fmt.Sprintf("Uses the StorageClass %s, %s", *pvc.Spec.StorageClassName, dataMessage),
+		})
+	}
+
+	// the RBD images are known from the PVs, which may outlive their PVCs
+	pvs := &corev1.PersistentVolumeList{}
+	if err := r.Client.List(context.TODO(), pvs); err != nil {
+		return nil, fmt.Errorf("failed to list the PersistentVolumes: %v", err)
+	}
+	rbdDriver := generateNameForSnapshotClassDriver(sc, rbdSnapshotter)
+	for _, pv := range pvs.Items {
+		csi := pv.Spec.CSI
+		if csi == nil || csi.Driver != rbdDriver || !usesCSICluster(sc, csi.VolumeAttributes["clusterID"], clusterIDs) {
+			continue
+		}
+		namespace := ""
+		if pv.Spec.ClaimRef != nil {
+			namespace = pv.Spec.ClaimRef.Namespace
+		}
+		add(namespace, ocsv1.UninstallAffectedResource{
+			Kind:    "RBDImage",
+			Name:    fmt.Sprintf("%s/%s", csi.VolumeAttributes["pool"], csi.VolumeAttributes["imageName"]),
+			Impact:  dataImpact,
+			Message: fmt.Sprintf("Backs the PersistentVolume %s, %s", pv.Name, dataMessage),
+		})
+	}
+
+	for _, kind := range []string{"ObjectBucketClaim", "ObjectBucket"} {
+		buckets, err := r.listObjectBuckets(kind)
+		if errors.IsForbidden(err) {
+			r.Log.Info("Uninstall: Not allowed to list the resources of the uninstall report.", "Kind", kind, "Error", err.Error())
+			report.Unavailable = append(report.Unavailable, fmt.Sprintf("%ss: %v", kind, err))
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, bucket := range buckets {
+			storageClass, _, _ := unstructured.NestedString(bucket.Object, "spec", "storageClassName")
+			if !storageClasses[storageClass] {
+				continue
+			}
+			namespace := bucket.GetNamespace()
+			message := fmt.Sprintf("Uses the StorageClass %s, %s", storageClass, dataMessage)
+			if kind == "ObjectBucket" {
+				namespace, _, _ = unstructured.NestedString(bucket.Object, "spec", "claimRef", "namespace")
+				bucketName, _, _ := unstructured.NestedString(bucket.Object, "spec", "endpoint", "bucketName")
+				message = fmt.Sprintf("Bucket %s of the StorageClass %s, %s", bucketName, storageClass, dataMessage)
+			}
+			add(namespace, ocsv1.UninstallAffectedResource{
+				Kind:    kind,
+				Name:    bucket.GetName(),
+				Impact:  dataImpact,
+				Message: message,
+			})
+		}
+	}
+
+	// the other resources are shared with the external cluster managed by
+	// Rook in the namespace
+	if !isAdditionalExternalStorageCluster(sc) {
+		if err := r.addUninstalledClusters(sc, report, add); err != nil {
+			return nil, err
+		}
+	}
+
+	namespaces := make([]string, 0, len(resources))
+	for namespace := range resources {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	for _, namespace := range namespaces {
+		affected := resources[namespace]
+		sort.SliceStable(affected, func(i, j int) bool {
+			if affected[i].Kind != affected[j].Kind {
+				return affected[i].Kind < affected[j].Kind
+			}
+			return affected[i].Name < affected[j].Name
+		})
+		report.Namespaces = append(report.Namespaces, ocsv1.UninstallNamespaceReport{Namespace: namespace, Resources: affected})
+	}
+	return report, nil
+}
+
+// addUninstalledClusters reports the node taints and labels, the CephCluster
+// and the NooBaa system the uninstall removes
+func (r *StorageClusterReconciler) addUninstalledClusters(sc *ocsv1.StorageCluster, report *ocsv1.UninstallReport,
+	add func(string, ocsv1.UninstallAffectedResource)) error {
+	if !sc.Spec.ExternalStorage.Enable {
+		nodes, err := r.getStorageClusterEligibleNodes(sc)
+		if err != nil {
+			return fmt.Errorf("failed to list the storage nodes: %v", err)
+		}
+		for _, node := range nodes.Items {
+			var removed []string
+			for _, taint := range node.Spec.Taints {
+				if taint.Key == defaults.NodeTolerationKey {
+					removed = append(removed, fmt.Sprintf("the %s taint", defaults.NodeTolerationKey))
+					break
+				}
+			}
+			if report.CleanupPolicy == string(CleanupPolicyDelete) {
+				if getFailureDomain(sc) == "rack" && isGeneratedRack(node) {
+					removed = append(removed, fmt.Sprintf("the %s label", defaults.RackTopologyKey))
+				}
+				if _, found := node.Labels[defaults.NodeAffinityKey]; found && sc.Spec.LabelSelector == nil {
+					removed = append(removed, fmt.Sprintf("the %s label", defaults.NodeAffinityKey))
+				}
+			}
+			if len(removed) > 0 {
+				add("", ocsv1.UninstallAffectedResource{
+					Kind:    "Node",
+					Name:    node.Name,
+					Impact:  ocsv1.UninstallImpactModified,
+					Message: fmt.Sprintf("Removes %s", strings.Join(removed, ", ")),
+				})
+			}
+		}
+
+		cephCluster := &cephv1.CephCluster{}
+		err = r.Client.Get(context.TODO(), types.NamespacedName{Name: generateNameForCephCluster(sc), Namespace: sc.Namespace}, cephCluster)
+		if err == nil {
+			message := "The CephCluster is deleted, the data directories of the hosts and the OSD disks are wiped"
+			if report.CleanupPolicy == string(CleanupPolicyRetain) {
+				message = fmt.Sprintf("The CephCluster is deleted, the data directories of the hosts and the OSD disks are kept, "+
+					"a new StorageCluster can adopt them with the %s annotation", AdoptRetainedDataAnnotation)
+			}
+			add(sc.Namespace, ocsv1.UninstallAffectedResource{
+				Kind:    "CephCluster",
+				Name:    cephCluster.Name,
+				Impact:  ocsv1.UninstallImpactDestroyed,
+				Message: message,
+			})
+		} else if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get the CephCluster: %v", err)
+		}
+	}
+
+	if sc.Spec.MultiCloudGateway != nil {
+		reconcileStrategy := ReconcileStrategy(sc.Spec.MultiCloudGateway.ReconcileStrategy)
+		if reconcileStrategy == ReconcileStrategyIgnore || reconcileStrategy == ReconcileStrategyStandalone {
+			return nil
+		}
+	}
+	noobaa := &nbv1.NooBaa{}
+	err := r.Client.Get(context.TODO(), types.NamespacedName{Name: "noobaa", Namespace: sc.Namespace}, noobaa)
+	if err == nil {
+		add(sc.Namespace, ocsv1.UninstallAffectedResource{
+			Kind:    "NooBaa",
+			Name:    noobaa.Name,
+			Impact:  ocsv1.UninstallImpactDestroyed,
+			Message: "The NooBaa system is deleted along with its database",
+		})
+	} else if !errors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+		return fmt.Errorf("failed to get the NooBaa system: %v", err)
+	}
+	return nil
+}
+
+// getUninstallStorageClasses returns the names of the StorageClasses whose
+// volumes or buckets are provisioned from the StorageCluster, including the
+// ones created by the users and by NooBaa
+func (r *StorageClusterReconciler) getUninstallStorageClasses(sc *ocsv1.StorageCluster) (map[string]bool, error) {
+	clusterIDs, err := r.getAdditionalCSIClusterIDs(sc)
+	if err != nil {
+		return nil, err
+	}
+	storageClasses := &storagev1.StorageClassList{}
+	if err := r.Client.List(context.TODO(), storageClasses); err != nil {
+		return nil, fmt.Errorf("failed to list the StorageClasses: %v", err)
+	}
+	names := map[string]bool{}
+	for _, storageClass := range storageClasses.Items {
+		// the provisioners of the namespace of the StorageCluster are
+		// <namespace>.rbd.csi.ceph.com, <namespace>.ceph.rook.io/bucket,
+		// <namespace>.noobaa.io/obc...
+		if !strings.HasPrefix(storageClass.Provisioner, sc.Namespace+".") {
+			continue
+		}
+		if usesCSICluster(sc, storageClass.Parameters["clusterID"], clusterIDs) {
+			names[storageClass.Name] = true
+		}
+	}
+	return names, nil
+}
+
+// getAdditionalCSIClusterIDs returns the clusterIDs of the other additional
+// external clusters in the namespace of the StorageCluster
+func (r *StorageClusterReconciler) getAdditionalCSIClusterIDs(sc *ocsv1.StorageCluster) (map[string]bool, error) {
+	storageClusters := &ocsv1.StorageClusterList{}
+	if err := r.Client.List(context.TODO(), storageClusters, client.InNamespace(sc.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list the StorageClusters: %v", err)
+	}
+	clusterIDs := map[string]bool{}
+	for i := range storageClusters.Items {
+		other := &storageClusters.Items[i]
+		if other.Name != sc.Name && isAdditionalExternalStorageCluster(other) {
+			clusterIDs[generateNameForCSIClusterID(other)] = true
+		}
+	}
+	return clusterIDs, nil
+}
+
+// usesCSICluster returns whether a StorageClass or a volume with the given
+// clusterID uses the storage of the StorageCluster. The ones of the cluster
+// managed by Rook may use the clusterIDs of its tenants, or none for buckets.
+func usesCSICluster(sc *ocsv1.StorageCluster, clusterID string, additionalClusterIDs map[string]bool) bool {
+	if isAdditionalExternalStorageCluster(sc) {
+		return clusterID == generateNameForCSIClusterID(sc)
+	}
+	return !additionalClusterIDs[clusterID]
+}
+
+// listObjectBuckets lists the ObjectBucketClaims or the ObjectBuckets, none
+// if their CRD isn't installed. The Forbidden errors are returned as they are.
+func (r *StorageClusterReconciler) listObjectBuckets(kind string) ([]unstructured.Unstructured, error) {
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(objectBucketGroupVersion.WithKind(kind + "List"))
+	if err := r.Client.List(context.TODO(), list); err != nil {
+		if meta.IsNoMatchError(err) || errors.IsNotFound(err) {
+			return nil, nil
+		} else if errors.IsForbidden(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to list the %ss: %v", kind, err)
+	}
+	return list.Items, nil
+}
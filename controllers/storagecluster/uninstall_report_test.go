@@ -0,0 +1,213 @@
+package storagecluster
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/openshift/ocs-operator/api/v1"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func findUninstallAffectedResource(report *api.UninstallReport, namespace, kind, name string) *api.UninstallAffectedResource {
+	for _, namespaceReport := range report.Namespaces {
+		if namespaceReport.Namespace != namespace {
+			continue
+		}
+		for i := range namespaceReport.Resources {
+			if namespaceReport.Resources[i].Kind == kind && namespaceReport.Resources[i].Name == name {
+				return &namespaceReport.Resources[i]
+			}
+		}
+	}
+	return nil
+}
+
+// forbiddenObjectBucketsClient isn't allowed to list the ObjectBucketClaims
+// and the ObjectBuckets
+type forbiddenObjectBucketsClient struct {
+	client.Client
+}
+
+func (c *forbiddenObjectBucketsClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if gvk := list.GetObjectKind().GroupVersionKind(); gvk.Group == objectBucketGroupVersion.Group {
+		return errors.NewForbidden(objectBucketGroupVersion.WithResource(strings.ToLower(gvk.Kind)).GroupResource(), "", fmt.Errorf("no RBAC"))
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func TestGenerateUninstallReport(t *testing.T) {
+	cp := &Platform{platform: allPlatforms[0]}
+	t, reconciler, sc, _ := initStorageClusterResourceCreateUpdateTestWithPlatform(t, cp, nil)
+	addDefaultNodeTaintOnNodes(t, reconciler, sc)
+
+	rbdStorageClass := generateNameForCephBlockPoolSC(sc, "")
+	bucketStorageClass := "noobaa"
+	otherStorageClass := "gp2"
+	objs := []client.Object{
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: bucketStorageClass},
+			Provisioner: fmt.Sprintf("%s.noobaa.io/obc", sc.Namespace),
+		},
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: otherStorageClass},
+			Provisioner: "kubernetes.io/aws-ebs",
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "app"},
+			Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &rbdStorageClass},
+		},
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "logs", Namespace: "app"},
+			Spec:       corev1.PersistentVolumeClaimSpec{StorageClassName: &otherStorageClass},
+		},
+		&corev1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "pvc-1234"},
+			Spec: corev1.PersistentVolumeSpec{
+				ClaimRef: &corev1.ObjectReference{Namespace: "app", Name: "db"},
+				PersistentVolumeSource: corev1.PersistentVolumeSource{CSI: &corev1.CSIPersistentVolumeSource{
+					Driver: generateNameForSnapshotClassDriver(sc, rbdSnapshotter),
+					VolumeAttributes: map[string]string{
+						"clusterID": generateNameForCSIClusterID(sc),
+						"pool":      generateNameForCephBlockPool(sc),
+						"imageName": "csi-vol-1234",
+					},
+				}},
+			},
+		},
+	}
+	for _, obj := range objs {
+		assert.NoError(t, reconciler.Client.Create(context.TODO(), obj))
+	}
+	// the ObjectBucketClaims are only known to the fake client as
+	// unstructured objects
+	for _, kind := range []string{"ObjectBucketClaim", "ObjectBucket"} {
+		reconciler.Scheme.AddKnownTypeWithName(objectBucketGroupVersion.WithKind(kind), &unstructured.Unstructured{})
+		reconciler.Scheme.AddKnownTypeWithName(objectBucketGroupVersion.WithKind(kind+"List"), &unstructured.UnstructuredList{})
+	}
+	obc := &unstructured.Unstructured{}
+	obc.SetGroupVersionKind(objectBucketGroupVersion.WithKind("ObjectBucketClaim"))
+	obc.SetName("backups")
+	obc.SetNamespace("app")
+	assert.NoError(t, unstructured.SetNestedField(obc.Object, bucketStorageClass, "spec", "storageClassName"))
+	assert.NoError(t, reconciler.Client.Create(context.TODO(), obc))
+
+	now := time.Now()
+	report, err := reconciler.generateUninstallReport(sc, now)
+	assert.NoError(t, err)
+	assert.Equal(t, string(UninstallModeGraceful), report.Mode)
+	assert.True(t, report.Blocked)
+	for _, expected := range []struct {
+		namespace, kind, name string
+		impact                api.UninstallImpact
+	}{
+		{"app", "PersistentVolumeClaim", "db", api.UninstallImpactBlocking},
+		{"app", "RBDImage", fmt.Sprintf("%s/csi-vol-1234", generateNameForCephBlockPool(sc)), api.UninstallImpactBlocking},
+		{"app", "ObjectBucketClaim", "backups", api.UninstallImpactBlocking},
+		{sc.Namespace, "CephCluster", generateNameForCephCluster(sc), api.UninstallImpactDestroyed},
+	} {
+		resource := findUninstallAffectedResource(report, expected.namespace, expected.kind, expected.name)
+		if assert.NotNilf(t, resource, "%s %s/%s not reported", expected.kind, expected.namespace, expected.name) {
+			assert.Equal(t, expected.impact, resource.Impact)
+		}
+	}
+	assert.Nil(t, findUninstallAffectedResource(report, "app", "PersistentVolumeClaim", "logs"))
+	nodes, err := reconciler.getStorageClusterEligibleNodes(sc)
+	assert.NoError(t, err)
+	for _, node := range nodes.Items {
+		resource := findUninstallAffectedResource(report, "", "Node", node.Name)
+		if assert.NotNil(t, resource) {
+			assert.Equal(t, api.UninstallImpactModified, resource.Impact)
+		}
+	}
+
+	assert.Empty(t, report.Unavailable)
+
+	// the buckets the operator isn't allowed to list are reported as such
+	reconciler.Client = &forbiddenObjectBucketsClient{Client: reconciler.Client}
+	report, err = reconciler.generateUninstallReport(sc, now)
+	assert.NoError(t, err)
+	assert.Len(t, report.Unavailable, 2)
+	assert.Nil(t, findUninstallAffectedResource(report, "app", "ObjectBucketClaim", "backups"))
+	reconciler.Client = reconciler.Client.(*forbiddenObjectBucketsClient).Client
+
+	// the forced mode deletes the volumes and the buckets instead of
+	// waiting for them
+	sc.Annotations = map[string]string{UninstallModeAnnotation: string(UninstallModeForced)}
+	report, err = reconciler.generateUninstallReport(sc, now)
+	assert.NoError(t, err)
+	assert.False(t, report.Blocked)
+	resource := findUninstallAffectedResource(report, "app", "PersistentVolumeClaim", "db")
+	if assert.NotNil(t, resource) {
+		assert.Equal(t, api.UninstallImpactDestroyed, resource.Impact)
+	}
+
+	// the report is only kept while it is requested
+	sc.Annotations[UninstallDryRunAnnotation] = "true"
+	assert.NoError(t, reconciler.reconcileUninstallReport(sc))
+	assert.NotNil(t, sc.Status.Uninstall.Report)
+	assert.Equal(t, uninstallReportRefreshInterval, getUninstallReportRequeueAfter(sc))
+	delete(sc.Annotations, UninstallDryRunAnnotation)
+	assert.NoError(t, reconciler.reconcileUninstallReport(sc))
+	assert.Nil(t, sc.Status.Uninstall)
+}
+
+func TestDeleteResourcesSteps(t *testing.T) {
+	cp := &Platform{platform: allPlatforms[0]}
+	t, reconciler, sc, _ := initStorageClusterResourceCreateUpdateTestWithPlatform(t, cp, nil)
+
+	// the CephCluster is being cleaned up by Rook
+	cephCluster := &cephv1.CephCluster{}
+	key := types.NamespacedName{Name: generateNameForCephCluster(sc), Namespace: sc.Namespace}
+	assert.NoError(t, reconciler.Client.Get(context.TODO(), key, cephCluster))
+	deletionTime := metav1.Now()
+	cephCluster.DeletionTimestamp = &deletionTime
+	assert.NoError(t, reconciler.Client.Update(context.TODO(), cephCluster))
+
+	err := reconciler.deleteResources(sc)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "CephCluster")
+	steps := sc.Status.Uninstall.Steps
+	assert.Len(t, steps, len(getUninstallSteps(sc)))
+	inProgress := false
+	for _, step := range steps {
+		switch {
+		case step.Name == "CephCluster":
+			assert.Equal(t, api.UninstallStepInProgress, step.State)
+			assert.NotEmpty(t, step.Message)
+			inProgress = true
+		case inProgress:
+			assert.Equalf(t, api.UninstallStepPending, step.State, "step %s", step.Name)
+		default:
+			assert.Equalf(t, api.UninstallStepCompleted, step.State, "step %s", step.Name)
+		}
+		assert.NotNil(t, step.LastTransitionTime)
+	}
+
+	// the steps keep their last transition time while their state doesn't
+	// change
+	transitionTime := metav1.NewTime(time.Now().Add(-time.Hour))
+	for i := range sc.Status.Uninstall.Steps {
+		sc.Status.Uninstall.Steps[i].LastTransitionTime = &transitionTime
+	}
+	assert.NoError(t, reconciler.Client.Delete(context.TODO(), cephCluster))
+	assert.NoError(t, reconciler.deleteResources(sc))
+	for _, step := range sc.Status.Uninstall.Steps {
+		assert.Equalf(t, api.UninstallStepCompleted, step.State, "step %s", step.Name)
+		if step.Name == "QuickStarts" {
+			assert.Equal(t, transitionTime, *step.LastTransitionTime)
+		} else if step.Name == "CephCluster" {
+			assert.NotEqual(t, transitionTime, *step.LastTransitionTime)
+		}
+	}
+}
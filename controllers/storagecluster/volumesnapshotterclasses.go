@@ -46,8 +46,8 @@ func newVolumeSnapshotClass(instance *ocsv1.StorageCluster, snapShotterType Snap
 		},
 		Driver: generateNameForSnapshotClassDriver(instance, snapShotterType),
 		Parameters: map[string]string{
-			"clusterID":                instance.Namespace,
-			snapshotterSecretName:      generateNameForSnapshotClassSecret(snapShotterType),
+			"clusterID":                generateNameForCSIClusterID(instance),
+			snapshotterSecretName:      generateNameForSnapshotClassSecret(instance, snapShotterType),
 			snapshotterSecretNamespace: instance.Namespace,
 		},
 		DeletionPolicy: snapapi.VolumeSnapshotContentDelete,
@@ -63,6 +63,14 @@ func newCephFilesystemSnapshotClassConfiguration(instance *ocsv1.StorageCluster)
 	}
 }
 
+func newAdditionalCephFilesystemSnapshotClassConfiguration(instance *ocsv1.StorageCluster, fs ocsv1.AdditionalFilesystemSpec) SnapshotClassConfiguration {
+	vscc := newCephFilesystemSnapshotClassConfiguration(instance)
+	vscc.snapshotClass.Name = generateNameForAdditionalSnapshotClass(instance, cephfsSnapshotter, fs.Name)
+	vscc.snapshotClass.Parameters["fsName"] = generateNameForAdditionalCephFilesystem(instance, fs.Name)
+	vscc.disable = vscc.disable || fs.DisableSnapshotClass
+	return vscc
+}
+
 func newCephBlockPoolSnapshotClassConfiguration(instance *ocsv1.StorageCluster) SnapshotClassConfiguration {
 	return SnapshotClassConfiguration{
 		snapshotClass:     newVolumeSnapshotClass(instance, rbdSnapshotter),
@@ -71,12 +79,26 @@ func newCephBlockPoolSnapshotClassConfiguration(instance *ocsv1.StorageCluster)
 	}
 }
 
+func newAdditionalCephBlockPoolSnapshotClassConfiguration(instance *ocsv1.StorageCluster, pool ocsv1.AdditionalBlockPoolSpec) SnapshotClassConfiguration {
+	vscc := newCephBlockPoolSnapshotClassConfiguration(instance)
+	vscc.snapshotClass.Name = generateNameForAdditionalSnapshotClass(instance, rbdSnapshotter, pool.Name)
+	vscc.reconcileStrategy = ReconcileStrategy(instance.Spec.ManagedResources.CephBlockPools.ReconcileStrategy)
+	vscc.disable = instance.Spec.ManagedResources.CephBlockPools.DisableSnapshotClass || pool.DisableSnapshotClass
+	return vscc
+}
+
 // newSnapshotClassConfigurations generates configuration options for Ceph SnapshotClasses.
 func newSnapshotClassConfigurations(instance *ocsv1.StorageCluster) []SnapshotClassConfiguration {
 	vsccs := []SnapshotClassConfiguration{
 		newCephFilesystemSnapshotClassConfiguration(instance),
 		newCephBlockPoolSnapshotClassConfiguration(instance),
 	}
+	for _, fs := range instance.Spec.ManagedResources.CephFilesystems.AdditionalFilesystems {
+		vsccs = append(vsccs, newAdditionalCephFilesystemSnapshotClassConfiguration(instance, fs))
+	}
+	for _, pool := range instance.Spec.ManagedResources.CephBlockPools.AdditionalPools {
+		vsccs = append(vsccs, newAdditionalCephBlockPoolSnapshotClassConfiguration(instance, pool))
+	}
 	return vsccs
 }
 
@@ -107,7 +129,7 @@ func (r *StorageClusterReconciler) createSnapshotClasses(vsccs []SnapshotClassCo
 			}
 		}
 		if vscc.reconcileStrategy == ReconcileStrategyInit {
-			return nil
+			continue
 		}
 		if existing.DeletionTimestamp != nil {
 			return fmt.Errorf("failed to restore SnapshotClass %q because it is marked for deletion", existing.Name)
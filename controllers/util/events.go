@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -15,12 +16,61 @@ const (
 
 	// EventReasonUninstallPending is used when the StorageCluster uninstall is Pending
 	EventReasonUninstallPending = "UninstallPending"
+
+	// EventReasonUninstallCleanupFailed is used when Rook fails to clean up the nodes during the StorageCluster uninstall
+	EventReasonUninstallCleanupFailed = "UninstallCleanupFailed"
+
+	// EventReasonRetainedDataInvalid is used when the data retained by a deleted StorageCluster can't be adopted
+	EventReasonRetainedDataInvalid = "RetainedDataInvalid"
+
+	// EventReasonRetainedDataAdopted is used when the Ceph cluster retained by a deleted StorageCluster is adopted
+	EventReasonRetainedDataAdopted = "RetainedDataAdopted"
+
+	// EventReasonTopologyDrifted is used when the storage nodes or the OSDs no longer match the failure domain
+	EventReasonTopologyDrifted = "TopologyDrifted"
+
+	// EventReasonFailureDomainMigrationBlocked is used when the topology doesn't allow the requested failure domain migration
+	EventReasonFailureDomainMigrationBlocked = "FailureDomainMigrationBlocked"
+
+	// EventReasonFailureDomainMigrationStarted is used when the failure domain is changed
+	EventReasonFailureDomainMigrationStarted = "FailureDomainMigrationStarted"
+
+	// EventReasonFailureDomainMigrationCompleted is used when Ceph is healthy again after a failure domain migration
+	EventReasonFailureDomainMigrationCompleted = "FailureDomainMigrationCompleted"
+
+	// EventReasonArbiterZoneElected is used when the zone of the arbiter is chosen
+	EventReasonArbiterZoneElected = "ArbiterZoneElected"
+
+	// EventReasonExternalResourceCreated is used when a resource of the external cluster details is created
+	EventReasonExternalResourceCreated = "ExternalResourceCreated"
+
+	// EventReasonExternalResourceUpdated is used when a resource is updated from the external cluster details
+	EventReasonExternalResourceUpdated = "ExternalResourceUpdated"
+
+	// EventReasonExternalResourcePruned is used when a resource removed from the external cluster details is deleted
+	EventReasonExternalResourcePruned = "ExternalResourcePruned"
+
+	// EventReasonExternalResourceIgnored is used when a resource or a key of the legacy external cluster details is unknown
+	EventReasonExternalResourceIgnored = "ExternalResourceIgnored"
+
+	// EventReasonExternalEndpointUnreachable is used when an endpoint of the external cluster becomes unreachable
+	EventReasonExternalEndpointUnreachable = "ExternalEndpointUnreachable"
+
+	// EventReasonExternalEndpointReachable is used when an endpoint of the external cluster is reachable again
+	EventReasonExternalEndpointReachable = "ExternalEndpointReachable"
+
+	// EventReasonKMSConnectionFailed is used when the health check of the KMS starts failing
+	EventReasonKMSConnectionFailed = "KMSConnectionFailed"
 )
 
 // EventReporter is custom events reporter type which allows user to limit the events
 type EventReporter struct {
 	recorder record.EventRecorder
 
+	// lock protects the maps below, events are reported by resource
+	// managers running concurrently
+	lock sync.Mutex
+
 	// lastReportedEvent will have a last captured event
 	lastReportedEvent map[string]string
 
@@ -47,6 +97,8 @@ func (rep *EventReporter) ReportIfNotPresent(instance runtime.Object, eventType,
 
 	eventKey := getEventKey(eventType, eventReason, msg)
 
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
 	if rep.lastReportedEvent[nameSpacedName] != eventKey || rep.lastReportedEventTime[nameSpacedName].Add(time.Minute*60).Before(time.Now()) {
 		rep.lastReportedEvent[nameSpacedName] = eventKey
 		rep.lastReportedEventTime[nameSpacedName] = time.Now()
@@ -54,6 +106,12 @@ func (rep *EventReporter) ReportIfNotPresent(instance runtime.Object, eventType,
 	}
 }
 
+// Report reports the event unconditionally, for events which record a change
+// rather than a state
+func (rep *EventReporter) Report(instance runtime.Object, eventType, eventReason, msg string) {
+	rep.recorder.Event(instance, eventType, eventReason, msg)
+}
+
 func getNameSpacedName(instance runtime.Object) (string, error) {
 	objMeta, err := meta.Accessor(instance)
 	if err != nil {
@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"strings"
 
 	nbv1 "github.com/noobaa/noobaa-operator/v2/pkg/apis/noobaa/v1alpha1"
 	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
@@ -40,6 +41,99 @@ const (
 	ExternalClusterErrorReason = "ExternalClusterStateError"
 )
 
+const (
+	// ComponentCephCluster is the name under which the CephCluster negative conditions are aggregated
+	ComponentCephCluster = "CephCluster"
+	// ComponentNooBaa is the name under which the NooBaa negative conditions are aggregated
+	ComponentNooBaa = "NooBaa"
+)
+
+// ConditionAggregator collects the negative conditions reported by each
+// component separately, so that a condition of a given type reported by one
+// component isn't overwritten by the same condition type reported by another
+// one. The zero value is ready to use. It isn't safe for concurrent use, the
+// components reporting to the same aggregator must be serialized.
+type ConditionAggregator struct {
+	// components keeps the order in which the components reported
+	components []string
+	conditions map[string]*[]conditionsv1.Condition
+}
+
+// For returns the negative conditions of the given component, to be passed to
+// the Map*Conditions functions. A component is listed in the status as soon as
+// For has been called for it, even if it doesn't report any negative condition.
+func (a *ConditionAggregator) For(component string) *[]conditionsv1.Condition {
+	if a.conditions == nil {
+		a.conditions = map[string]*[]conditionsv1.Condition{}
+	}
+	if _, found := a.conditions[component]; !found {
+		a.components = append(a.components, component)
+		a.conditions[component] = &[]conditionsv1.Condition{}
+	}
+	return a.conditions[component]
+}
+
+// IsEmpty returns true if none of the components reported a negative condition
+func (a *ConditionAggregator) IsEmpty() bool {
+	for _, component := range a.components {
+		if len(*a.conditions[component]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Conditions returns a single condition per type. When several components
+// report the same condition type, the status and reason of the first one are
+// kept and the messages of all of them are merged, prefixed with the name of
+// the component that reported them.
+func (a *ConditionAggregator) Conditions() []conditionsv1.Condition {
+	var aggregated []conditionsv1.Condition
+	messages := map[conditionsv1.ConditionType][]string{}
+	for _, component := range a.components {
+		for _, condition := range *a.conditions[component] {
+			if conditionsv1.FindStatusCondition(aggregated, condition.Type) == nil {
+				aggregated = append(aggregated, condition)
+			}
+			messages[condition.Type] = append(messages[condition.Type], fmt.Sprintf("%s: %s", component, condition.Message))
+		}
+	}
+	for i := range aggregated {
+		if len(messages[aggregated[i].Type]) > 1 {
+			aggregated[i].Message = strings.Join(messages[aggregated[i].Type], "; ")
+		}
+	}
+	return aggregated
+}
+
+// SetComponentsStatus replaces the given list of component statuses with the
+// conditions reported by each component, while preserving the
+// lastTransitionTime of the conditions that haven't changed.
+func (a *ConditionAggregator) SetComponentsStatus(components *[]ocsv1.ComponentStatus) {
+	var updated []ocsv1.ComponentStatus
+	for _, component := range a.components {
+		var existing []conditionsv1.Condition
+		for _, componentStatus := range *components {
+			if componentStatus.Name == component {
+				existing = componentStatus.Conditions
+				break
+			}
+		}
+
+		componentStatus := ocsv1.ComponentStatus{Name: component}
+		for _, condition := range *a.conditions[component] {
+			if found := conditionsv1.FindStatusCondition(existing, condition.Type); found != nil {
+				componentStatus.Conditions = append(componentStatus.Conditions, *found.DeepCopy())
+			}
+		}
+		for _, condition := range *a.conditions[component] {
+			conditionsv1.SetStatusCondition(&componentStatus.Conditions, condition)
+		}
+		updated = append(updated, componentStatus)
+	}
+	*components = updated
+}
+
 // SetProgressingCondition sets the ProgressingCondition to True and other conditions to
 // false or Unknown. Used when we are just starting to reconcile, and there are no existing
 // conditions.
@@ -0,0 +1,69 @@
+package util
+
+import (
+	"testing"
+
+	nbv1 "github.com/noobaa/noobaa-operator/v2/pkg/apis/noobaa/v1alpha1"
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	cephv1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestConditionAggregator(t *testing.T) {
+	cephCluster := &cephv1.CephCluster{}
+	cephCluster.Status.State = cephv1.ClusterStateError
+	cephCluster.Status.Message = "mons are down"
+	noobaa := &nbv1.NooBaa{}
+	noobaa.Status.Phase = nbv1.SystemPhaseRejected
+
+	aggregator := ConditionAggregator{}
+	assert.True(t, aggregator.IsEmpty())
+
+	MapCephClusterNegativeConditions(aggregator.For(ComponentCephCluster), cephCluster)
+	MapNoobaaNegativeConditions(aggregator.For(ComponentNooBaa), noobaa)
+	assert.False(t, aggregator.IsEmpty())
+
+	conditions := aggregator.Conditions()
+	assert.Len(t, conditions, 2)
+
+	degraded := conditionsv1.FindStatusCondition(conditions, conditionsv1.ConditionDegraded)
+	assert.NotNil(t, degraded)
+	assert.Equal(t, corev1.ConditionTrue, degraded.Status)
+	assert.Equal(t, "ClusterStateError", degraded.Reason)
+	assert.Contains(t, degraded.Message, "CephCluster: CephCluster error: mons are down")
+	assert.Contains(t, degraded.Message, "NooBaa: Noobaa object's configuration is rejected by the noobaa operator")
+
+	// a condition reported by a single component is left untouched
+	available := conditionsv1.FindStatusCondition(conditions, conditionsv1.ConditionAvailable)
+	assert.NotNil(t, available)
+	assert.Equal(t, "CephCluster error: mons are down", available.Message)
+}
+
+func TestConditionAggregatorComponentsStatus(t *testing.T) {
+	noobaa := &nbv1.NooBaa{}
+	noobaa.Status.Phase = nbv1.SystemPhaseCreating
+
+	aggregator := ConditionAggregator{}
+	MapNoobaaNegativeConditions(aggregator.For(ComponentNooBaa), noobaa)
+	// a healthy component is listed without any condition
+	aggregator.For(ComponentCephCluster)
+
+	var components []ocsv1.ComponentStatus
+	aggregator.SetComponentsStatus(&components)
+	assert.Len(t, components, 2)
+	assert.Equal(t, ComponentNooBaa, components[0].Name)
+	assert.Len(t, components[0].Conditions, 1)
+	assert.Equal(t, conditionsv1.ConditionProgressing, components[0].Conditions[0].Type)
+	assert.Equal(t, ComponentCephCluster, components[1].Name)
+	assert.Empty(t, components[1].Conditions)
+
+	// the lastTransitionTime of an unchanged condition is preserved
+	lastTransitionTime := components[0].Conditions[0].LastTransitionTime
+	aggregator = ConditionAggregator{}
+	MapNoobaaNegativeConditions(aggregator.For(ComponentNooBaa), noobaa)
+	aggregator.SetComponentsStatus(&components)
+	assert.Len(t, components, 1)
+	assert.Equal(t, lastTransitionTime, components[0].Conditions[0].LastTransitionTime)
+}
@@ -47,6 +47,7 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -82,11 +83,18 @@ func main() {
 	var probeAddr string
 	var metricsAddr string
 	var enableLeaderElection bool
+	var enableWebhooks bool
+	var webhookCertDir string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", true,
+		"Serve the StorageCluster admission webhooks. "+
+			"Disable it when running outside of OLM, which provides their serving certificate.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/apiserver.local.config/certificates",
+		"The directory that contains the serving certificate and key of the admission webhooks.")
 
 	loggerOpts := zap.Options{}
 	loggerOpts.BindFlags(flag.CommandLine)
@@ -142,6 +150,20 @@ func main() {
 	}
 	// +kubebuilder:scaffold:builder
 
+	if enableWebhooks {
+		// OLM mounts the serving certificate and key under these names
+		hookServer := mgr.GetWebhookServer()
+		hookServer.CertDir = webhookCertDir
+		hookServer.CertName = "apiserver.crt"
+		hookServer.KeyName = "apiserver.key"
+		hookServer.Register(storagecluster.WebhookValidatePath, &webhook.Admission{
+			Handler: &storagecluster.StorageClusterValidator{Log: ctrl.Log.WithName("webhooks").WithName("StorageCluster")},
+		})
+		hookServer.Register(storagecluster.WebhookMutatePath, &webhook.Admission{
+			Handler: &storagecluster.StorageClusterMutator{Log: ctrl.Log.WithName("webhooks").WithName("StorageCluster")},
+		})
+	}
+
 	// Create OCSInitialization CR if it's not present
 	ocsNamespacedName := ocsinitialization.InitNamespacedName()
 	client := mgr.GetClient()
@@ -0,0 +1,274 @@
+package collectors
+
+import (
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/metrics/internal/options"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+const (
+	// component within the project/exporter
+	storageClusterSubsystem  = "storagecluster"
+	kmsSubsystem             = "kms"
+	externalClusterSubsystem = "external_cluster"
+)
+
+var _ prometheus.Collector = &StorageClusterCollector{}
+
+// StorageClusterCollector is a custom collector for StorageCluster Custom Resource
+type StorageClusterCollector struct {
+	ReconcilePausedTimestamp     *prometheus.Desc
+	KMSConnectionStatus          *prometheus.Desc
+	KMSHealthCheckLatency        *prometheus.Desc
+	KMSLastSuccessfulHealthCheck *prometheus.Desc
+	KMSTokenExpiry               *prometheus.Desc
+	KMSLastTokenRenewal          *prometheus.Desc
+	ExternalEndpointReachable    *prometheus.Desc
+	ExternalEndpointProbeLatency *prometheus.Desc
+	Informer                     cache.SharedIndexInformer
+	AllowedNamespaces            []string
+}
+
+// NewStorageClusterCollector constructs a collector
+func NewStorageClusterCollector(opts *options.Options) *StorageClusterCollector {
+	client, err := newStorageClusterRESTClient(opts.Kubeconfig)
+	if err != nil {
+		klog.Error(err)
+	}
+
+	lw := cache.NewListWatchFromClient(client, "storageclusters", metav1.NamespaceAll, fields.Everything())
+	sharedIndexInformer := cache.NewSharedIndexInformer(lw, &ocsv1.StorageCluster{}, 0, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+
+	return &StorageClusterCollector{
+		ReconcilePausedTimestamp: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, storageClusterSubsystem, "reconcile_paused_timestamp_seconds"),
+			`Unix timestamp at which the reconcile of the StorageCluster was paused. Only exposed while it is paused`,
+			[]string{"name", "namespace"},
+			nil,
+		),
+		KMSConnectionStatus: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, kmsSubsystem, "connection_status"),
+			`Whether the operator could connect to the KMS of the StorageCluster at its last health check: 0=Failed, 1=Connected`,
+			[]string{"name", "namespace", "provider"},
+			nil,
+		),
+		KMSHealthCheckLatency: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, kmsSubsystem, "health_check_latency_seconds"),
+			`Time the KMS of the StorageCluster took to answer the last health check`,
+			[]string{"name", "namespace", "provider"},
+			nil,
+		),
+		KMSLastSuccessfulHealthCheck: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, kmsSubsystem, "last_successful_health_check_timestamp_seconds"),
+			`Unix timestamp of the last successful health check of the KMS of the StorageCluster`,
+			[]string{"name", "namespace", "provider"},
+			nil,
+		),
+		KMSTokenExpiry: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, kmsSubsystem, "token_expiry_timestamp_seconds"),
+			`Unix timestamp at which the KMS token of the StorageCluster expires. Not exposed for tokens which never expire`,
+			[]string{"name", "namespace", "provider", "auth_method"},
+			nil,
+		),
+		KMSLastTokenRenewal: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, kmsSubsystem, "last_token_renewal_timestamp_seconds"),
+			`Unix timestamp of the last renewal or rotation of the KMS token of the StorageCluster`,
+			[]string{"name", "namespace", "provider", "auth_method"},
+			nil,
+		),
+		ExternalEndpointReachable: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, externalClusterSubsystem, "endpoint_reachable"),
+			`Whether the operator could connect to the endpoint of the external cluster at its last probe: 0=Unreachable, 1=Reachable`,
+			[]string{"name", "namespace", "type", "endpoint"},
+			nil,
+		),
+		ExternalEndpointProbeLatency: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, externalClusterSubsystem, "endpoint_probe_latency_seconds"),
+			`Time the endpoint of the external cluster took to accept the connection at the last successful probe`,
+			[]string{"name", "namespace", "type", "endpoint"},
+			nil,
+		),
+		Informer:          sharedIndexInformer,
+		AllowedNamespaces: opts.AllowedNamespaces,
+	}
+}
+
+// newStorageClusterRESTClient returns a REST client for the ocs.openshift.io
+// API group, there is no generated clientset for it
+func newStorageClusterRESTClient(kubeconfig *rest.Config) (*rest.RESTClient, error) {
+	scheme := runtime.NewScheme()
+	if err := ocsv1.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	metav1.AddToGroupVersion(scheme, ocsv1.GroupVersion)
+
+	config := rest.CopyConfig(kubeconfig)
+	config.GroupVersion = &ocsv1.GroupVersion
+	config.APIPath = "/apis"
+	config.NegotiatedSerializer = serializer.NewCodecFactory(scheme).WithoutConversion()
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	return rest.RESTClientFor(config)
+}
+
+// Run starts StorageCluster informer
+func (c *StorageClusterCollector) Run(stopCh <-chan struct{}) {
+	go c.Informer.Run(stopCh)
+}
+
+// Describe implements prometheus.Collector interface
+func (c *StorageClusterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ds := []*prometheus.Desc{
+		c.ReconcilePausedTimestamp,
+		c.KMSConnectionStatus,
+		c.KMSHealthCheckLatency,
+		c.KMSLastSuccessfulHealthCheck,
+		c.KMSTokenExpiry,
+		c.KMSLastTokenRenewal,
+		c.ExternalEndpointReachable,
+		c.ExternalEndpointProbeLatency,
+	}
+
+	for _, d := range ds {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector interface
+func (c *StorageClusterCollector) Collect(ch chan<- prometheus.Metric) {
+	storageClusters := getAllStorageClusters(c.Informer.GetIndexer(), c.AllowedNamespaces)
+
+	if len(storageClusters) > 0 {
+		c.collectReconcilePaused(storageClusters, ch)
+		c.collectKMSHealth(storageClusters, ch)
+		c.collectExternalEndpoints(storageClusters, ch)
+	}
+}
+
+func getAllStorageClusters(indexer cache.Indexer, namespaces []string) (storageClusters []*ocsv1.StorageCluster) {
+	var objs []interface{}
+	if len(namespaces) == 0 {
+		objs = indexer.List()
+	}
+	for _, namespace := range namespaces {
+		tempObjs, err := indexer.ByIndex(cache.NamespaceIndex, namespace)
+		if err != nil {
+			klog.Errorf("couldn't list StorageClusters in namespace %s. %v", namespace, err)
+			continue
+		}
+		objs = append(objs, tempObjs...)
+	}
+	for _, obj := range objs {
+		if storageCluster, ok := obj.(*ocsv1.StorageCluster); ok {
+			storageClusters = append(storageClusters, storageCluster)
+		}
+	}
+	return
+}
+
+func (c *StorageClusterCollector) collectReconcilePaused(storageClusters []*ocsv1.StorageCluster, ch chan<- prometheus.Metric) {
+	for _, storageCluster := range storageClusters {
+		condition := conditionsv1.FindStatusCondition(storageCluster.Status.Conditions, ocsv1.ConditionReconcilePaused)
+		if condition == nil || condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.ReconcilePausedTimestamp,
+			prometheus.GaugeValue, float64(condition.LastTransitionTime.Unix()),
+			storageCluster.Name,
+			storageCluster.Namespace)
+	}
+}
+
+// collectKMSHealth exports the result of the KMS health checks the operator
+// runs, and the token it keeps valid, for the StorageClusters whose KMS it
+// checks
+func (c *StorageClusterCollector) collectKMSHealth(storageClusters []*ocsv1.StorageCluster, ch chan<- prometheus.Metric) {
+	for _, storageCluster := range storageClusters {
+		kms := storageCluster.Status.KMS
+		if kms == nil || kms.LastHealthCheckTime == nil {
+			continue
+		}
+		condition := conditionsv1.FindStatusCondition(storageCluster.Status.Conditions, ocsv1.ConditionKMSConnected)
+		if condition != nil && condition.Status != corev1.ConditionUnknown {
+			var connected float64
+			if condition.Status == corev1.ConditionTrue {
+				connected = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.KMSConnectionStatus,
+				prometheus.GaugeValue, connected,
+				storageCluster.Name,
+				storageCluster.Namespace,
+				kms.Provider)
+		}
+		if kms.LastHealthCheckLatency != nil {
+			ch <- prometheus.MustNewConstMetric(c.KMSHealthCheckLatency,
+				prometheus.GaugeValue, kms.LastHealthCheckLatency.Seconds(),
+				storageCluster.Name,
+				storageCluster.Namespace,
+				kms.Provider)
+		}
+		if kms.LastSuccessfulHealthCheckTime != nil {
+			ch <- prometheus.MustNewConstMetric(c.KMSLastSuccessfulHealthCheck,
+				prometheus.GaugeValue, float64(kms.LastSuccessfulHealthCheckTime.Unix()),
+				storageCluster.Name,
+				storageCluster.Namespace,
+				kms.Provider)
+		}
+		if kms.TokenExpiryTime != nil {
+			ch <- prometheus.MustNewConstMetric(c.KMSTokenExpiry,
+				prometheus.GaugeValue, float64(kms.TokenExpiryTime.Unix()),
+				storageCluster.Name,
+				storageCluster.Namespace,
+				kms.Provider,
+				kms.AuthMethod)
+		}
+		if kms.LastTokenRenewalTime != nil {
+			ch <- prometheus.MustNewConstMetric(c.KMSLastTokenRenewal,
+				prometheus.GaugeValue, float64(kms.LastTokenRenewalTime.Unix()),
+				storageCluster.Name,
+				storageCluster.Namespace,
+				kms.Provider,
+				kms.AuthMethod)
+		}
+	}
+}
+
+// collectExternalEndpoints exports the reachability of the endpoints of the
+// external clusters, which the operator probes
+func (c *StorageClusterCollector) collectExternalEndpoints(storageClusters []*ocsv1.StorageCluster, ch chan<- prometheus.Metric) {
+	for _, storageCluster := range storageClusters {
+		if storageCluster.Status.ExternalCluster == nil {
+			continue
+		}
+		for _, endpoint := range storageCluster.Status.ExternalCluster.Endpoints {
+			var reachable float64
+			if endpoint.Reachable {
+				reachable = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.ExternalEndpointReachable,
+				prometheus.GaugeValue, reachable,
+				storageCluster.Name,
+				storageCluster.Namespace,
+				endpoint.Type,
+				endpoint.Address)
+			if endpoint.Reachable && endpoint.LastProbeLatency != nil {
+				ch <- prometheus.MustNewConstMetric(c.ExternalEndpointProbeLatency,
+					prometheus.GaugeValue, endpoint.LastProbeLatency.Seconds(),
+					storageCluster.Name,
+					storageCluster.Namespace,
+					endpoint.Type,
+					endpoint.Address)
+			}
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package collectors
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	conditionsv1 "github.com/openshift/custom-resource-status/conditions/v1"
+	ocsv1 "github.com/openshift/ocs-operator/api/v1"
+	"github.com/openshift/ocs-operator/metrics/internal/options"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	mockStorageCluster1 = ocsv1.StorageCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mockStorageCluster-1",
+			Namespace: "openshift-storage",
+		},
+	}
+	mockStorageCluster2 = ocsv1.StorageCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mockStorageCluster-2",
+			Namespace: "default",
+		},
+	}
+)
+
+func getMockStorageClusterCollector(t *testing.T, mockOpts *options.Options) (mockStorageClusterCollector *StorageClusterCollector) {
+	setKubeConfig(t)
+	mockStorageClusterCollector = NewStorageClusterCollector(mockOpts)
+	assert.NotNil(t, mockStorageClusterCollector)
+	return
+}
+
+func TestGetAllStorageClusters(t *testing.T) {
+	storageClusterCollector := getMockStorageClusterCollector(t, mockOpts)
+	assert.NotNil(t, storageClusterCollector.Informer)
+
+	objs := []*ocsv1.StorageCluster{&mockStorageCluster1, &mockStorageCluster2}
+	for _, obj := range objs {
+		assert.Nil(t, storageClusterCollector.Informer.GetStore().Add(obj))
+	}
+
+	storageClusters := getAllStorageClusters(storageClusterCollector.Informer.GetIndexer(), storageClusterCollector.AllowedNamespaces)
+	assert.Equal(t, []*ocsv1.StorageCluster{&mockStorageCluster1}, storageClusters)
+
+	storageClusters = getAllStorageClusters(storageClusterCollector.Informer.GetIndexer(), nil)
+	assert.Len(t, storageClusters, 2)
+}
+
+func TestCollectReconcilePaused(t *testing.T) {
+	storageClusterCollector := getMockStorageClusterCollector(t, mockOpts)
+
+	pausedAt := time.Unix(1600000000, 0)
+	paused := mockStorageCluster1.DeepCopy()
+	paused.Status.Conditions = []conditionsv1.Condition{{
+		Type:               ocsv1.ConditionReconcilePaused,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.NewTime(pausedAt),
+	}}
+	resumed := mockStorageCluster1.DeepCopy()
+	resumed.Name = "resumed"
+	resumed.Status.Conditions = []conditionsv1.Condition{{
+		Type:   ocsv1.ConditionReconcilePaused,
+		Status: corev1.ConditionFalse,
+	}}
+	neverPaused := mockStorageCluster1.DeepCopy()
+	neverPaused.Name = "never-paused"
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		storageClusterCollector.collectReconcilePaused([]*ocsv1.StorageCluster{paused, resumed, neverPaused}, ch)
+		close(ch)
+	}()
+
+	var metrics []dto.Metric
+	for m := range ch {
+		assert.Contains(t, m.Desc().String(), "reconcile_paused_timestamp_seconds")
+		metric := dto.Metric{}
+		assert.Nil(t, m.Write(&metric))
+		metrics = append(metrics, metric)
+	}
+	// only the paused StorageCluster is reported
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, float64(pausedAt.Unix()), metrics[0].GetGauge().GetValue())
+	for _, label := range metrics[0].GetLabel() {
+		if label.GetName() == "name" {
+			assert.Equal(t, paused.Name, label.GetValue())
+		}
+	}
+}
+
+func TestCollectKMSHealth(t *testing.T) {
+	storageClusterCollector := getMockStorageClusterCollector(t, mockOpts)
+
+	checkedAt := metav1.NewTime(time.Unix(1600000000, 0))
+	renewedAt := metav1.NewTime(time.Unix(1599990000, 0))
+	expiresAt := metav1.NewTime(time.Unix(1600003600, 0))
+	connected := mockStorageCluster1.DeepCopy()
+	connected.Status.KMS = &ocsv1.KMSStatus{
+		Provider:                      "vault",
+		AuthMethod:                    "kubernetes",
+		LastHealthCheckTime:           &checkedAt,
+		LastSuccessfulHealthCheckTime: &checkedAt,
+		LastHealthCheckLatency:        &metav1.Duration{Duration: 250 * time.Millisecond},
+		TokenExpiryTime:               &expiresAt,
+		LastTokenRenewalTime:          &renewedAt,
+	}
+	connected.Status.Conditions = []conditionsv1.Condition{{
+		Type:   ocsv1.ConditionKMSConnected,
+		Status: corev1.ConditionTrue,
+	}}
+	failed := mockStorageCluster1.DeepCopy()
+	failed.Name = "failed"
+	failed.Status.KMS = &ocsv1.KMSStatus{
+		Provider:            "vault",
+		LastHealthCheckTime: &checkedAt,
+	}
+	failed.Status.Conditions = []conditionsv1.Condition{{
+		Type:   ocsv1.ConditionKMSConnected,
+		Status: corev1.ConditionFalse,
+	}}
+	unchecked := mockStorageCluster1.DeepCopy()
+	unchecked.Name = "unchecked"
+	unchecked.Status.KMS = &ocsv1.KMSStatus{Provider: "newKMSProvider"}
+	noKMS := mockStorageCluster1.DeepCopy()
+	noKMS.Name = "no-kms"
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		storageClusterCollector.collectKMSHealth([]*ocsv1.StorageCluster{connected, failed, unchecked, noKMS}, ch)
+		close(ch)
+	}()
+
+	values := map[string]float64{}
+	for m := range ch {
+		metric := dto.Metric{}
+		assert.Nil(t, m.Write(&metric))
+		var name string
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == "name" {
+				name = label.GetValue()
+			}
+		}
+		desc := m.Desc().String()
+		switch {
+		case strings.Contains(desc, "connection_status"):
+			values[name+"/status"] = metric.GetGauge().GetValue()
+		case strings.Contains(desc, "health_check_latency_seconds"):
+			values[name+"/latency"] = metric.GetGauge().GetValue()
+		case strings.Contains(desc, "last_successful_health_check_timestamp_seconds"):
+			values[name+"/success"] = metric.GetGauge().GetValue()
+		case strings.Contains(desc, "token_expiry_timestamp_seconds"):
+			values[name+"/expiry"] = metric.GetGauge().GetValue()
+		case strings.Contains(desc, "last_token_renewal_timestamp_seconds"):
+			values[name+"/renewal"] = metric.GetGauge().GetValue()
+		}
+	}
+	// only the StorageClusters whose KMS is checked are reported
+	assert.Equal(t, map[string]float64{
+		connected.Name + "/status":  1,
+		connected.Name + "/latency": 0.25,
+		connected.Name + "/success": float64(checkedAt.Unix()),
+		connected.Name + "/expiry":  float64(expiresAt.Unix()),
+		connected.Name + "/renewal": float64(renewedAt.Unix()),
+		failed.Name + "/status":     0,
+	}, values)
+}
+
+func TestCollectExternalEndpoints(t *testing.T) {
+	storageClusterCollector := getMockStorageClusterCollector(t, mockOpts)
+
+	external := mockStorageCluster1.DeepCopy()
+	external.Status.ExternalCluster = &ocsv1.ExternalClusterStatus{
+		Endpoints: []ocsv1.ExternalEndpointStatus{
+			{Type: "mon", Name: "a", Address: "10.20.30.40:6789", Reachable: true, LastProbeLatency: &metav1.Duration{Duration: 5 * time.Millisecond}},
+			{Type: "rgw", Address: "10.20.30.41:8080", Message: "connection refused"},
+		},
+	}
+	internal := mockStorageCluster2.DeepCopy()
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		storageClusterCollector.collectExternalEndpoints([]*ocsv1.StorageCluster{external, internal}, ch)
+		close(ch)
+	}()
+
+	values := map[string]float64{}
+	for m := range ch {
+		metric := dto.Metric{}
+		assert.Nil(t, m.Write(&metric))
+		var endpoint string
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == "endpoint" {
+				endpoint = label.GetValue()
+			}
+		}
+		desc := m.Desc().String()
+		switch {
+		case strings.Contains(desc, "endpoint_reachable"):
+			values[endpoint+"/reachable"] = metric.GetGauge().GetValue()
+		case strings.Contains(desc, "endpoint_probe_latency_seconds"):
+			values[endpoint+"/latency"] = metric.GetGauge().GetValue()
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"10.20.30.40:6789/reachable": 1,
+		"10.20.30.40:6789/latency":   0.005,
+		"10.20.30.41:8080/reachable": 0,
+	}, values)
+}
@@ -20,6 +20,20 @@
               severity_level: 'error',
             },
           },
+          {
+            alert: 'StorageClusterReconcilePaused',
+            expr: |||
+              time() - ocs_storagecluster_reconcile_paused_timestamp_seconds{%(ocsExporterSelector)s} > %(storageClusterReconcilePausedAlertTime)d
+            ||| % $._config,
+            labels: {
+              severity: 'warning',
+            },
+            annotations: {
+              message: 'Reconcile of the StorageCluster is paused for too long.',
+              description: 'Reconcile of StorageCluster {{ $labels.namespace }}/{{ $labels.name }} is paused for more than %d hours. Resume it by removing the reconcile.ocs.openshift.io/pause annotation.' % ($._config.storageClusterReconcilePausedAlertTime / 3600),
+              severity_level: 'warning',
+            },
+          },
         ],
       },
     ],
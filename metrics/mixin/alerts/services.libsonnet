@@ -20,6 +20,36 @@
               severity_level: 'error',
             },
           },
+          {
+            alert: 'StorageClusterReconcilePaused',
+            expr: |||
+              time() - ocs_storagecluster_reconcile_paused_timestamp_seconds{%(ocsExporterSelector)s} > %(storageClusterReconcilePausedAlertTime)d
+            ||| % $._config,
+            labels: {
+              severity: 'warning',
+            },
+            annotations: {
+              message: 'Reconcile of the StorageCluster is paused for too long.',
+              description: 'Reconcile of StorageCluster {{ $labels.namespace }}/{{ $labels.name }} is paused for more than %d hours. Resume it by removing the reconcile.ocs.openshift.io/pause annotation.' % ($._config.storageClusterReconcilePausedAlertTime / 3600),
+              severity_level: 'warning',
+            },
+          },
+          {
+            alert: 'KMSServerConnectionAlert',
+            expr: |||
+              ocs_kms_connection_status{%(ocsExporterSelector)s} == 0
+            ||| % $._config,
+            'for': $._config.kmsServerConnectionAlertTime,
+            labels: {
+              severity: 'critical',
+            },
+            annotations: {
+              message: 'Storage Cluster can not connect to its KMS. Please check the KMS configuration and connectivity.',
+              description: 'Storage Cluster {{ $labels.namespace }}/{{ $labels.name }} could not connect to its {{ $labels.provider }} KMS for more than %s. Encrypted OSDs will fail to start until the KMS is reachable again.' % $._config.kmsServerConnectionAlertTime,
+              storage_type: $._config.blockStorageType,
+              severity_level: 'error',
+            },
+          },
         ],
       },
     ],
@@ -5,9 +5,13 @@
 
     // Duration to raise various Alerts
     clusterObjectStoreStateAlertTime: '15s',
+    // in seconds, as it is compared to the time the reconcile was paused at
+    storageClusterReconcilePausedAlertTime: 24 * 60 * 60,
+    kmsServerConnectionAlertTime: '5m',
 
     // Constants
     objectStorageType: 'RGW',
+    blockStorageType: 'RBD',
 
     // We build alerts for the presence of all these jobs.
     jobs: {
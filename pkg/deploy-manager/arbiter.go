@@ -13,7 +13,8 @@ func (t *DeployManager) GetArbiterZone() string {
 	return t.storageClusterConf.arbiterConf.Zone
 }
 
-// electArbiterZone is a helper function just for the tests. In real deployments, the arbiter zone will be picked by the user.
+// electArbiterZone is a helper function just for the tests. In real deployments, the arbiter zone is picked by the user,
+// or elected by the ocs-operator when it isn't set.
 // In our tests, we will just pick the zone with the least number of nodes as the arbiter zone.
 func (t *DeployManager) electArbiterZone() error {
 	var arbiterZoneElect string